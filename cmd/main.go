@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"phynixdrive/config"
+	"phynixdrive/middleware"
 	"phynixdrive/routes"
 	"phynixdrive/services"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -53,9 +58,13 @@ func main() {
 	log.Println("Connected to MongoDB successfully")
 
 	b2Config := routes.B2Config{
-		KeyID:          cfg.B2ApplicationKeyID,
-		ApplicationKey: cfg.B2ApplicationKey,
-		BucketName:     cfg.B2BucketName,
+		KeyID:            cfg.B2ApplicationKeyID,
+		ApplicationKey:   cfg.B2ApplicationKey,
+		BucketName:       cfg.B2BucketName,
+		ObjectPrefix:     cfg.B2ObjectPrefix,
+		ObjectNameScheme: cfg.B2ObjectNameScheme,
+		BucketPublic:     cfg.B2BucketPublic,
+		URLExpiryMargin:  cfg.SignedURLExpiryMargin,
 	}
 
 	googleConfig := routes.GoogleConfig{
@@ -74,20 +83,63 @@ func main() {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
 
+	middleware.SetTokenRevocationService(services.NewTokenRevocationService(serviceContainer.DB))
+	middleware.SetMaintenanceService(services.NewMaintenanceService(serviceContainer.DB))
+	// Starting an instance with MAINTENANCE_MODE=true turns it on for all of them; an admin
+	// turns it off again through PUT /admin/maintenance
+	if cfg.MaintenanceMode {
+		if err := middleware.SetMaintenanceMode(context.Background(), true, "startup"); err != nil {
+			log.Printf("Warning: failed to enable maintenance mode: %v", err)
+		}
+	}
+
 	router := gin.Default()
-	router.Use(corsMiddleware(cfg.AllowedOrigins))
+	// Client IPs key the rate limits, so X-Forwarded-For is only believed from known proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(corsMiddleware(cfg.AllowedOrigins, cfg.CORSStrict))
+	// Folder ZIP downloads, streams and uploads manage their own, much longer deadlines. Completing a
+	// chunked upload re-reads the assembled file, which can take far longer than a normal request.
+	router.Use(middleware.TimeoutMiddleware(cfg.RequestTimeout,
+		"GET /api/folders/:id/download",
+		"GET /api/public/:token",
+		"GET /api/public/:token/download",
+		"POST /api/uploadfiles",
+		"GET /api/files/:id/content",
+		"PUT /api/files/:id/content",
+		"GET /api/files/:id/stream",
+		"PUT /api/uploads/:id/parts/:n",
+		"POST /api/uploads/:id/complete",
+		"POST /api/public/:token/upload",
+	))
+
+	// Maintenance mode blocks writes; admins can still flip it and users can still sign in
+	router.Use(middleware.MaintenanceMiddleware(cfg.MaintenanceRetryAfter,
+		"PUT /api/admin/maintenance",
+		"POST /api/admin/reconcile-storage",
+		"POST /api/auth/oauth-login",
+		"POST /api/auth/refresh-google",
+		"POST /api/auth/refresh",
+		"POST /api/auth/logout",
+	))
 
 	api := router.Group("/api")
 	routes.SetupRoutesWithContainer(api, serviceContainer)
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"time":   time.Now().UTC(),
-		})
-	})
+	routes.RegisterHealthRoutes(router, serviceContainer)
 
-	if cfg.TrashCleanupInterval > 0 {
+	// A daily time takes precedence over the interval so restarts don't shift the schedule
+	if cfg.TrashCleanupTime != "" {
+		trashService := services.NewTrashService(
+			mongoClient.Database(cfg.DatabaseName),
+			serviceContainer.B2Service,
+		)
+		if err := services.StartDailyTrashCleanupJob(trashService, cfg.TrashCleanupTime); err != nil {
+			log.Fatalf("Invalid TRASH_CLEANUP_TIME: %v", err)
+		}
+		log.Printf("Started trash cleanup job running daily at %s UTC", cfg.TrashCleanupTime)
+	} else if cfg.TrashCleanupInterval > 0 {
 		trashService := services.NewTrashService(
 			mongoClient.Database(cfg.DatabaseName),
 			serviceContainer.B2Service,
@@ -96,6 +148,29 @@ func main() {
 		log.Printf("Started trash cleanup job running every %v", cfg.TrashCleanupInterval)
 	}
 
+	if cfg.GrantExpiryInterval > 0 {
+		services.StartGrantExpiryJob(serviceContainer.PermissionService, cfg.GrantExpiryInterval)
+		log.Printf("Started grant expiry job running every %v", cfg.GrantExpiryInterval)
+	}
+
+	if cfg.StorageReconcileInterval > 0 {
+		services.StartStorageReconcileJob(
+			services.NewStorageReconciler(mongoClient.Database(cfg.DatabaseName)),
+			cfg.StorageReconcileInterval,
+		)
+		log.Printf("Started storage reconcile job running every %v", cfg.StorageReconcileInterval)
+	}
+
+	if cfg.UploadSessionCleanupInterval > 0 {
+		db := mongoClient.Database(cfg.DatabaseName)
+		fileService := services.NewFileService(db, serviceContainer.FolderService, serviceContainer.B2Service, serviceContainer.PermissionService)
+		services.StartUploadSessionCleanupJob(
+			services.NewChunkedUploadService(db, fileService, serviceContainer.B2Service),
+			cfg.UploadSessionCleanupInterval,
+		)
+		log.Printf("Started upload session cleanup job running every %v", cfg.UploadSessionCleanupInterval)
+	}
+
 	log.Printf("Starting PhynixDrive server on port %s", cfg.Port)
 	if err := router.Run(":" + cfg.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -154,55 +229,41 @@ func loadEnvFile() {
 	log.Printf("ALLOWED_ORIGINS value: '%s'", os.Getenv("ALLOWED_ORIGINS"))
 }
 
-func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
+// corsMiddleware answers CORS for allowedOrigins, which may hold exact origins, "*", or wildcard
+// subdomain patterns such as "*.example.com" or "https://*.example.com". In strict mode an origin
+// that is not allowed gets no CORS headers; otherwise it is still reflected for local development.
+func corsMiddleware(allowedOrigins []string, strict bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestOrigin := c.Request.Header.Get("Origin")
 
-		log.Printf("CORS Request - Origin: '%s', Method: %s, Path: %s", requestOrigin, c.Request.Method, c.Request.URL.Path)
-		log.Printf("CORS - Allowed Origins: %v", allowedOrigins)
-
 		var allowOrigin string
-
-		if len(allowedOrigins) == 0 {
-			log.Printf("CORS - No allowed origins specified, allowing all")
+		switch {
+		case slices.Contains(allowedOrigins, "*"), len(allowedOrigins) == 0 && !strict:
 			allowOrigin = "*"
-		} else {
-			found := false
-			for _, allowedOrigin := range allowedOrigins {
-				if allowedOrigin == "*" {
-					allowOrigin = "*"
-					found = true
-					log.Printf("CORS - Wildcard found, allowing all")
-					break
-				} else if allowedOrigin == requestOrigin {
-					allowOrigin = requestOrigin
-					found = true
-					log.Printf("CORS - Origin '%s' found in allowed list", requestOrigin)
-					break
-				}
-			}
-
-			if !found {
-				if requestOrigin == "" {
-					allowOrigin = allowedOrigins[0]
-					log.Printf("CORS - No origin header, using first allowed: %s", allowOrigin)
-				} else {
-					allowOrigin = requestOrigin
-					log.Printf("CORS - Origin '%s' not in allowed list, but allowing for debugging", requestOrigin)
-				}
+		case requestOrigin != "" && originAllowed(requestOrigin, allowedOrigins):
+			allowOrigin = requestOrigin
+		case strict:
+			if requestOrigin != "" {
+				log.Printf("CORS - Origin '%s' not in allowed list, omitting CORS headers", requestOrigin)
 			}
+		case requestOrigin == "":
+			allowOrigin = allowedOrigins[0]
+		default:
+			allowOrigin = requestOrigin
+			log.Printf("CORS - Origin '%s' not in allowed list, but allowing for debugging", requestOrigin)
 		}
 
-		log.Printf("CORS - Setting Access-Control-Allow-Origin to: %s", allowOrigin)
-
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
-		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
+		// The response depends on the Origin header, so caches must not share it across origins
+		c.Writer.Header().Add("Vary", "Origin")
+		if allowOrigin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-File-Access-Token, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+			c.Writer.Header().Set("Access-Control-Max-Age", "86400")
+		}
 
 		if c.Request.Method == "OPTIONS" {
-			log.Printf("CORS - Handling OPTIONS preflight request")
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -210,3 +271,31 @@ func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// originAllowed matches origin against exact entries and "*.domain" patterns. A pattern with a
+// scheme only matches that scheme, and a wildcard never matches the bare domain itself.
+func originAllowed(origin string, allowedOrigins []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == origin {
+			return true
+		}
+
+		scheme, hostPattern, hasScheme := strings.Cut(allowed, "://")
+		if !hasScheme {
+			scheme, hostPattern = "", allowed
+		}
+		if !strings.HasPrefix(hostPattern, "*.") || (scheme != "" && scheme != u.Scheme) {
+			continue
+		}
+		suffix := hostPattern[1:] // ".example.com", possibly with a port
+		if strings.HasSuffix(u.Host, suffix) && len(u.Host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
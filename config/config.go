@@ -18,7 +18,8 @@ type Config struct {
 	MongoURI     string
 	DatabaseName string
 
-	FrontendRedirectURL string
+	FrontendRedirectURL  string
+	AllowedRedirectHosts []string
 
 	JWTSecret     string
 	JWTExpiration time.Duration
@@ -31,20 +32,87 @@ type Config struct {
 	B2ApplicationKey   string
 	B2BucketName       string
 	B2BucketID         string
+	B2ObjectPrefix     string
+	B2ObjectNameScheme string
+	B2BucketPublic     bool
+
+	SignedURLExpiryMargin time.Duration
+	FileAccessTokenTTL    time.Duration
 
 	MaxFileSize    int64
 	MaxUserStorage int64
 
+	RawInlineMaxSize int64
+
+	StorageSoftLimitPercent int64
+
+	MaxFilesPerUser int64
+
+	PublicDownloadMaxBytes int64
+	PublicDownloadMaxFiles int64
+
+	FolderDownloadMaxBytes int64
+
+	MaxConcurrentUploads   int64
+	MaxConcurrentDownloads int64
+
+	AuthRateLimitRPS     int64
+	AuthRateLimitBurst   int64
+	UploadRateLimitRPS   int64
+	UploadRateLimitBurst int64
+
+	InboxMaxFileSize int64
+	InboxMaxFiles    int64
+
+	UsageRecalcInterval      time.Duration
+	StorageReconcileInterval time.Duration
+
+	UserCacheTTL       time.Duration // other instances may serve a changed profile this long; keep it short
+	FolderSizeCacheTTL time.Duration
+
+	FolderNameBlacklist []string
+
+	AllowedExtensions []string // empty allows any type not blocked
+	BlockedExtensions []string
+	VerifyFileContent bool
+
+	ChunkedUploadPartSize        int64
+	ChunkedUploadMaxFileSize     int64 // 0 uses MaxFileSize
+	UploadSessionTTL             time.Duration
+	UploadSessionCleanupInterval time.Duration
+
 	MailgunAPIKey  string
 	MailgunDomain  string
 	SendGridAPIKey string
 	FromEmail      string
 
+	NotificationsEnabled bool
+
 	TrashCleanupInterval time.Duration
+	TrashCleanupTime     string
+	TrashRetentionDays   int
+	PurgeConfirmationTTL time.Duration
+	GrantExpiryInterval  time.Duration
+
+	RequestTimeout time.Duration
+
+	HideInaccessibleResources bool
+
+	MaintenanceMode       bool
+	MaintenanceRetryAfter time.Duration
 
 	AllowedOrigins []string
+	CORSStrict     bool     // only allowlisted origins get CORS headers; defaults on when ENV=production
+	TrustedProxies []string // IPs/CIDRs whose X-Forwarded-For is believed; empty uses the peer address
 
 	JWTIssuer string
+
+	ImpersonationTokenTTL time.Duration
+
+	RefreshTokenTTL    time.Duration // lifetime of the app refresh tokens used with /auth/refresh-google
+	TokenEncryptionKey string        // encrypts stored OAuth refresh tokens; falls back to JWTSecret
+
+	FeatureFlags map[string]FeatureFlag
 }
 
 var AppConfig *Config
@@ -62,7 +130,8 @@ func LoadConfig() {
 		JWTExpiration: parseDuration(getEnv("JWT_EXPIRATION", "24h")),
 		JWTIssuer:     getEnv("JWT_ISSUER", "phynixdrive"),
 
-		FrontendRedirectURL: getEnv("FRONTEND_REDIRECT_URL", ""),
+		FrontendRedirectURL:  getEnv("FRONTEND_REDIRECT_URL", ""),
+		AllowedRedirectHosts: parseStringSlice(getEnv("ALLOWED_REDIRECT_HOSTS", "")),
 
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
@@ -72,18 +141,85 @@ func LoadConfig() {
 		B2ApplicationKey:   getB2AppKey(),
 		B2BucketName:       getB2BucketName(),
 		B2BucketID:         getEnv("B2_BUCKET_ID", ""),
+		B2ObjectPrefix:     getEnv("B2_OBJECT_PREFIX", "users"),
+		B2ObjectNameScheme: getEnv("B2_OBJECT_NAME_SCHEME", "path"),
+		B2BucketPublic:     parseBool(getEnv("B2_BUCKET_PUBLIC", "false")),
+
+		SignedURLExpiryMargin: parseDuration(getEnv("SIGNED_URL_EXPIRY_MARGIN", "2m")),
+		FileAccessTokenTTL:    parseDuration(getEnv("FILE_ACCESS_TOKEN_TTL", "10m")),
 
 		MaxFileSize:    parseInt64(getEnv("MAX_FILE_SIZE", "104857600")),
 		MaxUserStorage: parseInt64(getEnv("MAX_USER_STORAGE", "2147483648")),
 
+		RawInlineMaxSize: parseInt64(getEnv("RAW_INLINE_MAX_SIZE", "1048576")),
+
+		StorageSoftLimitPercent: parseInt64(getEnv("STORAGE_SOFT_LIMIT_PERCENT", "90")),
+
+		MaxFilesPerUser: parseInt64(getEnv("MAX_FILES_PER_USER", "0")),
+
+		PublicDownloadMaxBytes: parseInt64(getEnv("PUBLIC_DOWNLOAD_MAX_BYTES", "1073741824")),
+		PublicDownloadMaxFiles: parseInt64(getEnv("PUBLIC_DOWNLOAD_MAX_FILES", "1000")),
+
+		FolderDownloadMaxBytes: parseInt64(getEnv("FOLDER_DOWNLOAD_MAX_BYTES", "5368709120")),
+
+		MaxConcurrentUploads:   parseInt64(getEnv("MAX_CONCURRENT_UPLOADS", "3")),
+		MaxConcurrentDownloads: parseInt64(getEnv("MAX_CONCURRENT_DOWNLOADS", "1")),
+
+		AuthRateLimitRPS:     parseInt64(getEnv("AUTH_RATE_LIMIT_RPS", "1")),
+		AuthRateLimitBurst:   parseInt64(getEnv("AUTH_RATE_LIMIT_BURST", "5")),
+		UploadRateLimitRPS:   parseInt64(getEnv("UPLOAD_RATE_LIMIT_RPS", "2")),
+		UploadRateLimitBurst: parseInt64(getEnv("UPLOAD_RATE_LIMIT_BURST", "10")),
+
+		InboxMaxFileSize: parseInt64(getEnv("INBOX_MAX_FILE_SIZE", "26214400")),
+		InboxMaxFiles:    parseInt64(getEnv("INBOX_MAX_FILES", "100")),
+
+		UsageRecalcInterval:      parseDuration(getEnv("USAGE_RECALC_INTERVAL", "10m")),
+		StorageReconcileInterval: parseDuration(getEnv("STORAGE_RECONCILE_INTERVAL", "0")),
+
+		UserCacheTTL:       parseDuration(getEnv("USER_CACHE_TTL", "15s")),
+		FolderSizeCacheTTL: parseDuration(getEnv("FOLDER_SIZE_CACHE_TTL", "30s")),
+
+		FolderNameBlacklist: parseStringSlice(getEnv("FOLDER_NAME_BLACKLIST", "")),
+
+		AllowedExtensions: parseStringSlice(getEnv("ALLOWED_EXTENSIONS", "")),
+		BlockedExtensions: parseStringSlice(getEnv("BLOCKED_EXTENSIONS", "")),
+		VerifyFileContent: parseBool(getEnv("VERIFY_FILE_CONTENT", "true")),
+
+		ChunkedUploadPartSize:        parseInt64(getEnv("CHUNKED_UPLOAD_PART_SIZE", "10485760")),
+		ChunkedUploadMaxFileSize:     parseInt64(getEnv("CHUNKED_UPLOAD_MAX_FILE_SIZE", "0")),
+		UploadSessionTTL:             parseDuration(getEnv("UPLOAD_SESSION_TTL", "24h")),
+		UploadSessionCleanupInterval: parseDuration(getEnv("UPLOAD_SESSION_CLEANUP_INTERVAL", "1h")),
+
 		MailgunAPIKey:  getEnv("MAILGUN_API_KEY", ""),
 		MailgunDomain:  getEnv("MAILGUN_DOMAIN", ""),
 		SendGridAPIKey: getEnv("SENDGRID_API_KEY", ""),
 		FromEmail:      getEnv("FROM_EMAIL", "noreply@phynixdrive.com"),
 
+		NotificationsEnabled: parseBool(getEnv("NOTIFICATIONS_ENABLED", "true")),
+
 		TrashCleanupInterval: parseDuration(getEnv("TRASH_CLEANUP_INTERVAL", "24h")),
+		TrashCleanupTime:     getEnv("TRASH_CLEANUP_TIME", ""),
+		TrashRetentionDays:   int(parseInt64(getEnv("TRASH_RETENTION_DAYS", "30"))),
+		PurgeConfirmationTTL: parseDuration(getEnv("PURGE_CONFIRMATION_TTL", "2m")),
+		GrantExpiryInterval:  parseDuration(getEnv("GRANT_EXPIRY_INTERVAL", "15m")),
+
+		RequestTimeout: parseDuration(getEnv("REQUEST_TIMEOUT", "30s")),
+
+		HideInaccessibleResources: parseBool(getEnv("HIDE_INACCESSIBLE_RESOURCES", "true")),
+
+		MaintenanceMode:       parseBool(getEnv("MAINTENANCE_MODE", "false")),
+		MaintenanceRetryAfter: parseDuration(getEnv("MAINTENANCE_RETRY_AFTER", "5m")),
 
 		AllowedOrigins: parseStringSlice(getEnv("ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:5173")),
+		CORSStrict:     parseBool(getEnv("CORS_STRICT", strconv.FormatBool(getEnv("ENV", "development") == "production"))),
+		TrustedProxies: parseStringSlice(getEnv("TRUSTED_PROXIES", "")),
+
+		ImpersonationTokenTTL: parseDuration(getEnv("IMPERSONATION_TOKEN_TTL", "15m")),
+
+		RefreshTokenTTL:    parseDuration(getEnv("REFRESH_TOKEN_TTL", "720h")),
+		TokenEncryptionKey: getEnv("TOKEN_ENCRYPTION_KEY", ""),
+
+		FeatureFlags: parseFeatureFlags(getEnv("FEATURE_FLAGS", "public_links,versioning")),
 	}
 
 	logConfig()
@@ -135,14 +271,27 @@ func logConfig() {
 	log.Printf("  MongoDB URI: %s", maskConnectionString(AppConfig.MongoURI))
 	log.Printf("  JWT Secret: %s", maskSecret(AppConfig.JWTSecret))
 	log.Printf("  JWT Expiration: %v", AppConfig.JWTExpiration)
+	log.Printf("  Refresh Token TTL: %v", AppConfig.RefreshTokenTTL)
+	log.Printf("  Token Encryption Key: %s", maskSecret(AppConfig.TokenEncryptionKey))
 	log.Printf("  Google Client ID: %s", maskSecret(AppConfig.GoogleClientID))
 	log.Printf("  Google Redirect URL: %s", AppConfig.GoogleRedirectURL)
 	log.Printf("  B2 Key ID: %s", maskSecret(AppConfig.B2ApplicationKeyID))
 	log.Printf("  B2 Bucket: %s", AppConfig.B2BucketName)
+	log.Printf("  B2 Object Naming: %s/ (%s)", AppConfig.B2ObjectPrefix, AppConfig.B2ObjectNameScheme)
+	log.Printf("  B2 Public Bucket: %t", AppConfig.B2BucketPublic)
 	log.Printf("  Max File Size: %d bytes", AppConfig.MaxFileSize)
 	log.Printf("  Max User Storage: %d bytes", AppConfig.MaxUserStorage)
 	log.Printf("  Allowed Origins: %v", AppConfig.AllowedOrigins)
+	log.Printf("  CORS Strict: %t", AppConfig.CORSStrict)
+	log.Printf("  Trusted Proxies: %v", AppConfig.TrustedProxies)
 	log.Printf("  Trash Cleanup Interval: %v", AppConfig.TrashCleanupInterval)
+	if AppConfig.TrashCleanupTime != "" {
+		log.Printf("  Trash Cleanup Time: %s UTC", AppConfig.TrashCleanupTime)
+	}
+	log.Printf("  Trash Retention: %d days", AppConfig.TrashRetentionDays)
+	log.Printf("  Request Timeout: %v", AppConfig.RequestTimeout)
+	log.Printf("  Maintenance Mode: %t", AppConfig.MaintenanceMode)
+	log.Printf("  Feature Flags: %s", getEnv("FEATURE_FLAGS", "public_links,versioning"))
 }
 
 func maskSecret(secret string) string {
@@ -211,6 +360,14 @@ func parseInt64(s string) int64 {
 	return i
 }
 
+func parseBool(s string) bool {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatalf("Failed to parse bool: %s", s)
+	}
+	return b
+}
+
 func parseDuration(s string) time.Duration {
 	d, err := time.ParseDuration(s)
 	if err != nil {
@@ -0,0 +1,58 @@
+package config
+
+import "strings"
+
+// Feature names accepted in FEATURE_FLAGS
+const (
+	FeaturePublicLinks   = "public_links"
+	FeatureVersioning    = "versioning"
+	FeatureChunkedUpload = "chunked_upload"
+)
+
+// FeatureFlag is either on for everyone or only for the listed user IDs
+type FeatureFlag struct {
+	Enabled bool
+	Users   map[string]bool
+}
+
+// parseFeatureFlags reads a comma separated list where "name" turns a feature on for
+// everyone and "name:userID1|userID2" turns it on for those users only
+func parseFeatureFlags(s string) map[string]FeatureFlag {
+	flags := make(map[string]FeatureFlag)
+	for _, entry := range parseStringSlice(s) {
+		name, users, scoped := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		flag := flags[name]
+		if !scoped {
+			flag.Enabled = true
+		} else {
+			if flag.Users == nil {
+				flag.Users = make(map[string]bool)
+			}
+			for _, userID := range strings.Split(users, "|") {
+				if userID = strings.TrimSpace(userID); userID != "" {
+					flag.Users[userID] = true
+				}
+			}
+		}
+		flags[name] = flag
+	}
+	return flags
+}
+
+// FeatureEnabled reports whether a feature is on for the user. userID may be empty
+// for unauthenticated requests, in which case only globally enabled features pass.
+func FeatureEnabled(name, userID string) bool {
+	if AppConfig == nil {
+		return false
+	}
+	flag, ok := AppConfig.FeatureFlags[name]
+	if !ok {
+		return false
+	}
+	return flag.Enabled || (userID != "" && flag.Users[userID])
+}
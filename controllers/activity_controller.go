@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivityController serves the audit history of files and folders
+type ActivityController struct {
+	auditService *services.AuditService
+}
+
+func NewActivityController(auditService *services.AuditService) *ActivityController {
+	return &ActivityController{auditService: auditService}
+}
+
+// GetFileActivity handles GET /files/:id/activity?limit=&offset=
+func (ac *ActivityController) GetFileActivity(c *gin.Context) {
+	ac.getActivity(c, "file")
+}
+
+// GetFolderActivity handles GET /folders/:id/activity?limit=&offset=
+func (ac *ActivityController) GetFolderActivity(c *gin.Context) {
+	ac.getActivity(c, "folder")
+}
+
+func (ac *ActivityController) getActivity(c *gin.Context, resourceType string) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
+
+	entries, total, err := ac.auditService.GetResourceActivity(c.Request.Context(), userID, resourceType, c.Param("id"), limit, offset)
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case msg == "insufficient permissions":
+			utils.ForbiddenResponse(c, "Insufficient permissions")
+		case strings.HasSuffix(msg, "not found"):
+			utils.NotFoundResponse(c, strings.ToUpper(msg[:1])+msg[1:])
+		case strings.HasPrefix(msg, "invalid"):
+			utils.BadRequestResponse(c, msg, nil)
+		default:
+			utils.InternalServerErrorResponse(c, "Failed to get activity", nil)
+		}
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Activity retrieved", entries, &utils.Pagination{
+		Page:       offset/limit + 1,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	})
+}
+
+// reasonDetails carries an optional delete reason into the audit entry
+func reasonDetails(reason string) map[string]string {
+	if reason == "" {
+		return nil
+	}
+	return map[string]string{"reason": reason}
+}
+
+// recordActivity adds a resource event to the audit log on behalf of the request's user
+func recordActivity(c *gin.Context, auditService *services.AuditService, action, resourceType, resourceID string, details map[string]string) {
+	if auditService == nil {
+		return
+	}
+	auditService.RecordActivity(c.Request.Context(), action, c.GetString("userIdStr"), resourceType, resourceID, c.ClientIP(), details)
+}
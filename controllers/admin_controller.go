@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"net/http"
+	"phynixdrive/middleware"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AdminController exposes operational toggles and support tools to users with the admin role
+type AdminController struct {
+	adminService      *services.AdminService
+	storageReconciler *services.StorageReconciler
+}
+
+func NewAdminController(db *mongo.Database, jwtSecret string) *AdminController {
+	return &AdminController{
+		adminService:      services.NewAdminService(db, jwtSecret),
+		storageReconciler: services.NewStorageReconciler(db),
+	}
+}
+
+// GetMaintenanceMode handles GET /admin/maintenance
+func (ac *AdminController) GetMaintenanceMode(c *gin.Context) {
+	utils.SuccessResponse(c, "Maintenance mode status", gin.H{
+		"enabled": middleware.IsMaintenanceMode(c.Request.Context()),
+	})
+}
+
+// Impersonate handles POST /admin/impersonate/:userId
+func (ac *AdminController) Impersonate(c *gin.Context) {
+	adminID := utils.CurrentUserID(c)
+	if adminID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	// Chaining impersonations would hide the real admin behind another user
+	if c.GetString("impersonatedBy") != "" {
+		utils.ForbiddenResponse(c, "Cannot impersonate from an impersonated session")
+		return
+	}
+
+	result, err := ac.adminService.Impersonate(c.Request.Context(), adminID, c.Param("userId"), c.ClientIP())
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			utils.NotFoundResponse(c, "User not found")
+		case strings.HasPrefix(err.Error(), "invalid user ID"), strings.HasPrefix(err.Error(), "cannot impersonate"):
+			utils.BadRequestResponse(c, err.Error(), nil)
+		default:
+			utils.InternalServerErrorResponse(c, "Failed to impersonate user", err.Error())
+		}
+		return
+	}
+
+	c.Header("X-Impersonated-By", adminID)
+	utils.SuccessResponse(c, "Impersonation token issued", result)
+}
+
+// SetUserQuota handles PATCH /admin/users/:id/quota
+func (ac *AdminController) SetUserQuota(c *gin.Context) {
+	var req struct {
+		MaxStorage *int64 `json:"max_storage" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	user, err := ac.adminService.SetUserQuota(c.Request.Context(), utils.CurrentUserID(c), c.Param("id"), *req.MaxStorage)
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			utils.NotFoundResponse(c, "User not found")
+		case strings.HasPrefix(err.Error(), "invalid"):
+			utils.BadRequestResponse(c, err.Error(), nil)
+		default:
+			utils.InternalServerErrorResponse(c, "Failed to update quota", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, "Quota updated", gin.H{
+		"user_id":      user.ID.Hex(),
+		"max_storage":  user.MaxStorage,
+		"used_storage": user.UsedStorage,
+	})
+}
+
+// ReconcileStorage handles POST /admin/reconcile-storage. With ?user_id= only that user is reconciled.
+func (ac *AdminController) ReconcileStorage(c *gin.Context) {
+	if userID := c.Query("user_id"); userID != "" {
+		before, after, err := ac.storageReconciler.ReconcileUser(userID)
+		if err != nil {
+			switch {
+			case err.Error() == "user not found":
+				utils.NotFoundResponse(c, "User not found")
+			case strings.HasPrefix(err.Error(), "invalid"):
+				utils.BadRequestResponse(c, err.Error(), nil)
+			default:
+				utils.InternalServerErrorResponse(c, "Failed to reconcile storage", err.Error())
+			}
+			return
+		}
+
+		utils.SuccessResponse(c, "Storage reconciled", services.StorageCorrection{
+			UserID: userID,
+			Before: before,
+			After:  after,
+			Delta:  after - before,
+		})
+		return
+	}
+
+	report, err := ac.storageReconciler.ReconcileAll()
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to reconcile storage", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Storage reconciled", report)
+}
+
+// SetMaintenanceMode handles PUT /admin/maintenance
+func (ac *AdminController) SetMaintenanceMode(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Stored in the database, so every instance starts or stops rejecting writes, not just this one
+	if err := middleware.SetMaintenanceMode(c.Request.Context(), *req.Enabled, utils.CurrentUserID(c)); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to update maintenance mode", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Maintenance mode updated", gin.H{
+		"enabled": *req.Enabled,
+	})
+}
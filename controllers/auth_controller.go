@@ -1,24 +1,33 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"phynixdrive/config"
+	"phynixdrive/models"
 	"phynixdrive/services"
 	"phynixdrive/utils"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService    *services.AuthService
+	storageService *services.StorageService
+	tokenService   *services.TokenRevocationService
 }
 
 func NewAuthController(db *mongo.Database, jwtSecret, googleClientID, googleClientSecret, redirectURL string) *AuthController {
 	return &AuthController{
-		authService: services.NewAuthService(db, jwtSecret, googleClientID, googleClientSecret, redirectURL),
+		authService:    services.NewAuthService(db, jwtSecret, googleClientID, googleClientSecret, redirectURL),
+		storageService: services.NewStorageService(db),
+		tokenService:   services.NewTokenRevocationService(db),
 	}
 }
 
@@ -27,11 +36,26 @@ type OAuthLoginRequest struct {
 	Provider string `json:"provider" binding:"required,oneof=google"`
 }
 
+// GoogleRefreshRequest carries the long-lived refresh token handed out at sign-in. Browser
+// sign-ins get it as the refresh cookie instead and may leave it out.
+type GoogleRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest optionally names the refresh token held next to the session being ended
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 const (
 	stateCookieName = "oauth_state"
 	cookieMaxAge    = 10 * 60 // 10 minutes
 	cookiePath      = "/"
 	cookieDomain    = ""
+
+	// The refresh token never goes into a URL, where proxies and browser history keep it
+	refreshCookieName = "refresh_token"
+	refreshCookiePath = "/api/auth"
 )
 
 func (ac *AuthController) GoogleAuth(c *gin.Context) {
@@ -44,6 +68,15 @@ func (ac *AuthController) GoogleAuth(c *gin.Context) {
 	c.SetSameSite(http.SameSiteStrictMode)
 	c.SetCookie(stateCookieName, state, cookieMaxAge, cookiePath, cookieDomain, false, true)
 
+	// Optional post-login destination, checked now and again on the callback
+	if redirect := c.Query("redirect"); redirect != "" {
+		if err := utils.ValidateRedirectURL(redirect, allowedRedirectHosts()); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Redirect URL not allowed", nil)
+			return
+		}
+		ac.authService.SetStateRedirect(state, redirect)
+	}
+
 	authURL := ac.authService.GetGoogleAuthURL(state)
 
 	log.Printf("[AuthController] Generated OAuth state and URL - State: %s", state)
@@ -58,21 +91,69 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 	state := c.Query("state")
 	code := c.Query("code")
 
+	requestedRedirect := ac.authService.StateRedirect(state)
 	if !ac.authService.ValidateState(state) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid or expired authentication state"})
 		return
 	}
 
-	_, token, err := ac.authService.HandleGoogleCallback(code)
+	user, token, err := ac.authService.HandleGoogleCallback(code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
-	redirectURL := fmt.Sprintf("%s/auth/callback?token=%s", config.AppConfig.FrontendRedirectURL, token)
+	redirectURL := fmt.Sprintf("%s/auth/callback?token=%s", resolveRedirectBase(requestedRedirect), url.QueryEscape(token))
+	if refreshToken, err := ac.authService.IssueRefreshToken(c.Request.Context(), user); err != nil {
+		log.Printf("[AuthController] Failed to issue refresh token for %s: %v", user.Email, err)
+	} else if refreshToken != "" {
+		setRefreshCookie(c, refreshToken)
+	}
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
 
+// setRefreshCookie hands a refresh token to the browser as an HttpOnly cookie that is only
+// sent back to the auth endpoints. An empty token clears the cookie.
+func setRefreshCookie(c *gin.Context, refreshToken string) {
+	maxAge := -1
+	if refreshToken != "" {
+		maxAge = int((30 * 24 * time.Hour).Seconds())
+		if config.AppConfig.RefreshTokenTTL > 0 {
+			maxAge = int(config.AppConfig.RefreshTokenTTL.Seconds())
+		}
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(refreshCookieName, refreshToken, maxAge, refreshCookiePath, cookieDomain, config.AppConfig.Env == "production", true)
+}
+
+// resolveRedirectBase returns the requested frontend origin if it passes the allow-list,
+// otherwise the configured FrontendRedirectURL
+func resolveRedirectBase(requested string) string {
+	fallback := strings.TrimSuffix(config.AppConfig.FrontendRedirectURL, "/")
+	if requested == "" {
+		return fallback
+	}
+
+	if err := utils.ValidateRedirectURL(requested, allowedRedirectHosts()); err != nil {
+		log.Printf("[AuthController] Rejected redirect target %q: %v", requested, err)
+		return fallback
+	}
+
+	return strings.TrimSuffix(requested, "/")
+}
+
+// allowedRedirectHosts is the configured allow-list, or just the default frontend's host
+func allowedRedirectHosts() []string {
+	if len(config.AppConfig.AllowedRedirectHosts) > 0 {
+		return config.AppConfig.AllowedRedirectHosts
+	}
+	if u, err := url.Parse(config.AppConfig.FrontendRedirectURL); err == nil && u.Host != "" {
+		return []string{u.Host}
+	}
+	return nil
+}
+
 func (ac *AuthController) OAuthLogin(c *gin.Context) {
 	var req OAuthLoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -86,10 +167,17 @@ func (ac *AuthController) OAuthLogin(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, "Authentication successful", gin.H{
+	response := gin.H{
 		"user":  user,
 		"token": token,
-	})
+	}
+	if refreshToken, err := ac.authService.IssueRefreshToken(c.Request.Context(), user); err != nil {
+		log.Printf("[AuthController] Failed to issue refresh token for %s: %v", user.Email, err)
+	} else if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+
+	utils.SuccessResponse(c, "Authentication successful", response)
 }
 
 func (ac *AuthController) GetUserProfile(c *gin.Context) {
@@ -108,7 +196,118 @@ func (ac *AuthController) GetUserProfile(c *gin.Context) {
 	utils.SuccessResponse(c, "Profile retrieved successfully", user)
 }
 
+func (ac *AuthController) GetPreferences(c *gin.Context) {
+	userID := ac.extractUserID(c)
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	prefs, err := ac.authService.GetPreferences(userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "User profile not found", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Preferences retrieved successfully", prefs)
+}
+
+// RecalculateUsage recomputes the user's storage usage from their files and corrects the stored counter
+func (ac *AuthController) RecalculateUsage(c *gin.Context) {
+	userID := ac.extractUserID(c)
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	result, err := ac.storageService.RecalculateUsage(userID)
+	if err != nil {
+		switch err.Error() {
+		case "usage recalculation rate limited":
+			wait := ac.storageService.NextRecalculationIn(userID)
+			c.Header("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+			utils.ErrorResponse(c, http.StatusTooManyRequests, "Usage was recalculated recently, try again later", nil)
+		case "user not found":
+			utils.ErrorResponse(c, http.StatusNotFound, "User profile not found", nil)
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to recalculate usage", err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, "Storage usage recalculated", result)
+}
+
+func (ac *AuthController) UpdatePreferences(c *gin.Context) {
+	userID := ac.extractUserID(c)
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req models.UserPreferences
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	prefs, err := ac.authService.UpdatePreferences(userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "User profile not found", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid sort") || strings.Contains(err.Error(), "requires a sort field") {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid preferences", err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update preferences", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Preferences updated successfully", prefs)
+}
+
+// Logout revokes the current token and the refresh token sent with it (in the body or the
+// refresh cookie), or with ?all=true every token the user holds
 func (ac *AuthController) Logout(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*utils.Claims)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid authentication context", nil)
+		return
+	}
+
+	// The body is optional; a missing or malformed one just means no refresh token was named
+	var req LogoutRequest
+	_ = c.ShouldBindJSON(&req)
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie(refreshCookieName)
+	}
+
+	var err error
+	if c.Query("all") == "true" {
+		err = ac.tokenService.RevokeAllTokens(c.Request.Context(), claims.UserID)
+		if err == nil {
+			err = ac.authService.RevokeAllRefreshTokens(c.Request.Context(), claims.UserID)
+		}
+	} else {
+		if claims.ID != "" {
+			err = ac.tokenService.RevokeToken(c.Request.Context(), claims)
+		} else {
+			// Tokens issued before jti existed can only be revoked all at once
+			err = ac.tokenService.RevokeAllTokens(c.Request.Context(), claims.UserID)
+		}
+		if err == nil && refreshToken != "" {
+			err = ac.authService.RevokeRefreshToken(c.Request.Context(), claims.UserID, refreshToken)
+		}
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Logout failed", nil)
+		return
+	}
+
+	setRefreshCookie(c, "")
 	utils.SuccessResponse(c, "Logout successful", nil)
 }
 
@@ -121,6 +320,12 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// A refresh would turn a short-lived impersonation into an ordinary session
+	if c.GetString("impersonatedBy") != "" {
+		utils.ErrorResponse(c, http.StatusForbidden, "Impersonation tokens cannot be refreshed", nil)
+		return
+	}
+
 	newToken, err := ac.authService.GenerateJWT(userID, email)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Token refresh failed", err.Error())
@@ -132,6 +337,53 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 	})
 }
 
+// RefreshWithGoogle handles POST /auth/refresh-google for clients whose JWT has already
+// expired. A 401 means the client has to start the Google sign-in again.
+func (ac *AuthController) RefreshWithGoogle(c *gin.Context) {
+	var req GoogleRefreshRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+			return
+		}
+	}
+	fromCookie := false
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(refreshCookieName)
+		fromCookie = req.RefreshToken != ""
+	}
+	if req.RefreshToken == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "refresh_token is required", nil)
+		return
+	}
+
+	user, token, refreshToken, err := ac.authService.RefreshWithGoogle(c.Request.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, services.ErrInvalidToken):
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid or expired refresh token", nil)
+		return
+	case errors.Is(err, services.ErrGoogleReauthRequired):
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Google authorization was revoked; please sign in again", nil)
+		return
+	case err != nil:
+		log.Printf("[AuthController] Google refresh failed: %v", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Token refresh failed", nil)
+		return
+	}
+
+	response := gin.H{
+		"user":  user,
+		"token": token,
+	}
+	// The old token is spent either way; the replacement goes back the way it came
+	if fromCookie {
+		setRefreshCookie(c, refreshToken)
+	} else {
+		response["refresh_token"] = refreshToken
+	}
+	utils.SuccessResponse(c, "Token refreshed successfully", response)
+}
+
 func (ac *AuthController) ValidateToken(c *gin.Context) {
 	userID := ac.extractUserID(c)
 	email := ac.extractEmail(c)
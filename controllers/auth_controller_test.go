@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"testing"
+
+	"phynixdrive/config"
+)
+
+func TestResolveRedirectBaseHonoursAllowList(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{
+		FrontendRedirectURL:  "https://app.example.com/",
+		AllowedRedirectHosts: []string{"app.example.com", "staging.example.com:8443"},
+	}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	tests := []struct {
+		requested string
+		want      string
+	}{
+		{"https://staging.example.com:8443/", "https://staging.example.com:8443"},
+		{"https://app.example.com", "https://app.example.com"},
+		{"", "https://app.example.com"},
+		{"https://evil.example.net", "https://app.example.com"},
+		{"https://app.example.com@evil.example.net", "https://app.example.com"},
+		{"javascript:alert(1)", "https://app.example.com"},
+		{"//evil.example.net", "https://app.example.com"},
+	}
+	for _, tt := range tests {
+		if got := resolveRedirectBase(tt.requested); got != tt.want {
+			t.Errorf("resolveRedirectBase(%q) = %q, want %q", tt.requested, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChunkedUploadController accepts large files in resumable parts
+type ChunkedUploadController struct {
+	uploadService *services.ChunkedUploadService
+	auditService  *services.AuditService
+}
+
+func NewChunkedUploadController(uploadService *services.ChunkedUploadService, auditService *services.AuditService) *ChunkedUploadController {
+	return &ChunkedUploadController{uploadService: uploadService, auditService: auditService}
+}
+
+// InitUpload handles POST /uploads/init
+func (uc *ChunkedUploadController) InitUpload(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var request services.ChunkedUploadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err.Error())
+		return
+	}
+
+	status, err := uc.uploadService.InitUpload(c.Request.Context(), userID, request)
+	if err != nil {
+		uc.handleError(c, err, "Failed to start upload")
+		return
+	}
+
+	utils.CreatedResponse(c, "Upload started", status)
+}
+
+// GetUpload handles GET /uploads/:id
+func (uc *ChunkedUploadController) GetUpload(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	status, err := uc.uploadService.GetUpload(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		uc.handleError(c, err, "Failed to get upload")
+		return
+	}
+
+	utils.SuccessResponse(c, "Upload retrieved", status)
+}
+
+// UploadPart handles PUT /uploads/:id/parts/:n with the raw part bytes as the body.
+// An optional X-Content-SHA1 header is checked against the received bytes.
+func (uc *ChunkedUploadController) UploadPart(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Param("n"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid part number", nil)
+		return
+	}
+	checksum := c.GetHeader("X-Content-SHA1")
+	if checksum != "" && !sha1Pattern.MatchString(checksum) {
+		utils.BadRequestResponse(c, "Invalid SHA1 checksum", nil)
+		return
+	}
+
+	status, err := uc.uploadService.UploadPart(c.Request.Context(), c.Param("id"), userID, partNumber, c.Request.Body, checksum)
+	if err != nil {
+		uc.handleError(c, err, "Failed to upload part")
+		return
+	}
+
+	utils.SuccessResponse(c, "Part uploaded", status)
+}
+
+// CompleteUpload handles POST /uploads/:id/complete
+func (uc *ChunkedUploadController) CompleteUpload(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	file, err := uc.uploadService.CompleteUpload(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		uc.handleError(c, err, "Failed to complete upload")
+		return
+	}
+
+	recordActivity(c, uc.auditService, services.AuditActionCreate, "file", file.ID.Hex(), map[string]string{"name": file.Name, "path": file.RelativePath})
+
+	utils.CreatedResponse(c, "File uploaded successfully", file)
+}
+
+// AbortUpload handles DELETE /uploads/:id
+func (uc *ChunkedUploadController) AbortUpload(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := uc.uploadService.AbortUpload(c.Request.Context(), c.Param("id"), userID); err != nil {
+		uc.handleError(c, err, "Failed to abort upload")
+		return
+	}
+
+	utils.SuccessResponse(c, "Upload aborted", nil)
+}
+
+func (uc *ChunkedUploadController) handleError(c *gin.Context, err error, defaultMessage string) {
+	if writeQuotaError(c, err) {
+		return
+	}
+
+	msg := err.Error()
+	switch {
+	case msg == "upload not found":
+		utils.NotFoundResponse(c, "Upload not found")
+	case msg == "upload expired", msg == "upload is no longer active":
+		utils.ErrorResponse(c, http.StatusGone, "Upload is no longer accepting parts", nil)
+	case msg == "file was modified concurrently":
+		utils.ConflictResponse(c, "File was modified while the upload completed; please retry", nil)
+	case strings.HasPrefix(msg, "file too large"):
+		utils.PayloadTooLargeResponse(c, msg)
+	case strings.HasPrefix(msg, "file count limit exceeded"):
+		utils.ErrorResponse(c, http.StatusBadRequest, "Upload would exceed the maximum number of files", msg)
+	case strings.HasPrefix(msg, "file type not allowed"):
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, msg, nil)
+	case strings.HasPrefix(msg, "checksum mismatch"):
+		utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Upload was corrupted in transit; please retry", msg)
+	case strings.HasPrefix(msg, "invalid"), strings.HasPrefix(msg, "filename"),
+		strings.HasPrefix(msg, "file too small"), strings.HasPrefix(msg, "upload incomplete"):
+		utils.BadRequestResponse(c, msg, nil)
+	default:
+		utils.InternalServerErrorResponse(c, defaultMessage, nil)
+	}
+}
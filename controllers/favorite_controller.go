@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FavoriteController stars and unstars files and folders and lists a user's favorites
+type FavoriteController struct {
+	favoriteService *services.FavoriteService
+}
+
+func NewFavoriteController(favoriteService *services.FavoriteService) *FavoriteController {
+	return &FavoriteController{favoriteService: favoriteService}
+}
+
+// StarFile handles POST /files/:id/star
+func (fc *FavoriteController) StarFile(c *gin.Context) {
+	fc.star(c, "file")
+}
+
+// UnstarFile handles DELETE /files/:id/star
+func (fc *FavoriteController) UnstarFile(c *gin.Context) {
+	fc.unstar(c, "file")
+}
+
+// StarFolder handles POST /folders/:id/star
+func (fc *FavoriteController) StarFolder(c *gin.Context) {
+	fc.star(c, "folder")
+}
+
+// UnstarFolder handles DELETE /folders/:id/star
+func (fc *FavoriteController) UnstarFolder(c *gin.Context) {
+	fc.unstar(c, "folder")
+}
+
+// GetFavorites handles GET /favorites
+func (fc *FavoriteController) GetFavorites(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	favorites, err := fc.favoriteService.GetFavorites(c.Request.Context(), userID)
+	if err != nil {
+		fc.handleError(c, err, "Failed to get favorites")
+		return
+	}
+
+	utils.SuccessResponse(c, "Favorites retrieved", favorites)
+}
+
+func (fc *FavoriteController) star(c *gin.Context, resourceType string) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := fc.favoriteService.Star(c.Request.Context(), userID, resourceType, c.Param("id")); err != nil {
+		fc.handleError(c, err, "Failed to star "+resourceType)
+		return
+	}
+
+	utils.SuccessResponse(c, "Added to favorites", nil)
+}
+
+func (fc *FavoriteController) unstar(c *gin.Context, resourceType string) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := fc.favoriteService.Unstar(c.Request.Context(), userID, resourceType, c.Param("id")); err != nil {
+		fc.handleError(c, err, "Failed to unstar "+resourceType)
+		return
+	}
+
+	utils.SuccessResponse(c, "Removed from favorites", nil)
+}
+
+func (fc *FavoriteController) handleError(c *gin.Context, err error, defaultMessage string) {
+	msg := err.Error()
+	switch {
+	case msg == "insufficient permissions":
+		utils.ForbiddenResponse(c, "Insufficient permissions")
+	case strings.HasSuffix(msg, "not found"):
+		utils.NotFoundResponse(c, strings.ToUpper(msg[:1])+msg[1:])
+	case strings.HasPrefix(msg, "invalid"):
+		utils.BadRequestResponse(c, msg, nil)
+	default:
+		utils.InternalServerErrorResponse(c, defaultMessage, nil)
+	}
+}
@@ -1,21 +1,104 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"phynixdrive/config"
+	"phynixdrive/models"
 	"phynixdrive/services"
 	"phynixdrive/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type FileController struct {
-	fileService *services.FileService
+	fileService  *services.FileService
+	shareService *services.ShareService
+	auditService *services.AuditService
+	jwtSecret    string
 }
 
-func NewFileController(db *mongo.Database, folderService *services.FolderService, b2Service *services.B2Service, permissionService *services.PermissionService) *FileController {
+const (
+	defaultFileAccessTokenTTL = 10 * time.Minute
+	maxExternalWriteSize      = 100 * 1024 * 1024
+	rawCacheMaxAge            = 5 * time.Minute
+)
+
+var sha1Pattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+func NewFileController(db *mongo.Database, jwtSecret string, folderService *services.FolderService, b2Service *services.B2Service, permissionService *services.PermissionService, shareService *services.ShareService, auditService *services.AuditService) *FileController {
 	return &FileController{
-		fileService: services.NewFileService(db, folderService, b2Service, permissionService),
+		fileService:  services.NewFileService(db, folderService, b2Service, permissionService),
+		shareService: shareService,
+		auditService: auditService,
+		jwtSecret:    jwtSecret,
+	}
+}
+
+// writeQuotaError answers 507 with the quota numbers when err is a quota error, reporting
+// whether it wrote a response
+func writeQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	utils.InsufficientStorageResponse(c, "Upload would exceed storage limit", quotaErr)
+	return true
+}
+
+// handleError maps service errors to responses; "not found" also covers files the caller
+// cannot see at all, so their existence is not revealed
+func (fc *FileController) handleError(c *gin.Context, err error, defaultMessage string) {
+	if writeQuotaError(c, err) {
+		return
+	}
+
+	switch err.Error() {
+	case "file not found", "folder not found":
+		utils.NotFoundResponse(c, "File not found")
+	case "insufficient permissions":
+		utils.ForbiddenResponse(c, "Insufficient permissions")
+	case "file type not previewable":
+		utils.BadRequestResponse(c, "File type not previewable", nil)
+	case "version not found":
+		utils.NotFoundResponse(c, "Version not found")
+	case "file was modified concurrently":
+		utils.ErrorResponse(c, http.StatusConflict, "File was modified concurrently, please retry", nil)
+	default:
+		if strings.HasPrefix(err.Error(), "file with name") {
+			utils.ErrorResponse(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "filename ") || strings.HasPrefix(err.Error(), "file type not allowed") {
+			utils.BadRequestResponse(c, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "file content does not match") {
+			utils.ErrorResponse(c, http.StatusUnsupportedMediaType, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "file count limit exceeded") {
+			utils.BadRequestResponse(c, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "cannot move file") || strings.HasPrefix(err.Error(), "cannot copy file") || strings.HasPrefix(err.Error(), "invalid folder ID") {
+			utils.BadRequestResponse(c, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid file ID") {
+			utils.BadRequestResponse(c, "Invalid file ID", nil)
+			return
+		}
+		utils.InternalServerErrorResponse(c, defaultMessage, err.Error())
 	}
 }
 
@@ -46,6 +129,30 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 		return
 	}
 
+	// Optional SHA1 per file, matched by index; a single file may use the X-Content-SHA1 header instead
+	checksums := form.Value["sha1[]"]
+	if len(checksums) == 0 && len(files) == 1 && c.GetHeader("X-Content-SHA1") != "" {
+		checksums = []string{c.GetHeader("X-Content-SHA1")}
+	}
+	if len(checksums) > 0 && len(checksums) != len(files) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Files and checksums count mismatch", nil)
+		return
+	}
+	for i, checksum := range checksums {
+		if checksum != "" && !sha1Pattern.MatchString(checksum) {
+			utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid SHA1 checksum at index %d", i), nil)
+			return
+		}
+	}
+
+	// Paths are matched to files by index, so make sure each pair actually belongs together
+	for i, file := range files {
+		if err := utils.ValidateUploadPairing(file.Filename, relativePaths[i]); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Files and relative paths are misaligned at index %d", i), err.Error())
+			return
+		}
+	}
+
 	// Validate total upload size
 	var totalSize int64
 	for _, file := range files {
@@ -57,22 +164,38 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 	}
 
 	// Check user storage quota
-	canUpload, err := fc.fileService.CheckStorageQuota(userId, totalSize)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Storage check failed", nil)
-		return
-	}
-	if !canUpload {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Upload would exceed 2GB storage limit", nil)
+	if err := fc.fileService.CheckQuota(userId, totalSize); err != nil {
+		if !writeQuotaError(c, err) {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Storage check failed", nil)
+		}
 		return
 	}
 
-	uploadResult, err := fc.fileService.UploadFiles(userId, files, relativePaths)
+	uploadResult, err := fc.fileService.UploadFiles(userId, files, relativePaths, checksums)
 	if err != nil {
+		if writeQuotaError(c, err) {
+			return
+		}
+		if strings.HasPrefix(err.Error(), "file count limit exceeded") {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Upload would exceed the maximum number of files", err.Error())
+			return
+		}
+		if strings.HasPrefix(err.Error(), "file type not allowed") || strings.HasPrefix(err.Error(), "file content does not match") {
+			utils.ErrorResponse(c, http.StatusUnsupportedMediaType, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "checksum mismatch") {
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Upload was corrupted in transit; please retry", err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
+	for _, file := range uploadResult.Files {
+		recordActivity(c, fc.auditService, services.AuditActionCreate, "file", file.ID.Hex(), map[string]string{"name": file.Name, "path": file.RelativePath})
+	}
+
 	utils.SuccessResponse(c, "Files uploaded successfully", uploadResult)
 }
 
@@ -92,6 +215,23 @@ func (fc *FileController) GetAllFiles(c *gin.Context) {
 	utils.SuccessResponse(c, "Files retrieved", files)
 }
 
+// GetFolderFiles handles GET /folders/:id/files
+func (fc *FileController) GetFolderFiles(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	files, err := fc.fileService.GetFolderFiles(c.Param("id"), userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to get files")
+		return
+	}
+
+	utils.SuccessResponse(c, "Files retrieved", files)
+}
+
 func (fc *FileController) DownloadFile(c *gin.Context) {
 	fileId := c.Param("id")
 	userId := c.GetString("userIdStr")
@@ -108,10 +248,12 @@ func (fc *FileController) DownloadFile(c *gin.Context) {
 
 	downloadURL, err := fc.fileService.GetDownloadURL(fileId, userId)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		fc.handleError(c, err, "Failed to generate download URL")
 		return
 	}
 
+	recordActivity(c, fc.auditService, services.AuditActionDownload, "file", fileId, nil)
+	fc.setURLCacheHeader(c, services.URLTypeDownload)
 	utils.SuccessResponse(c, "Download URL generated", map[string]string{
 		"downloadUrl": downloadURL,
 	})
@@ -133,15 +275,458 @@ func (fc *FileController) PreviewFile(c *gin.Context) {
 
 	previewURL, err := fc.fileService.GetPreviewURL(fileId, userId)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		fc.handleError(c, err, "Failed to generate preview URL")
 		return
 	}
 
+	fc.setURLCacheHeader(c, services.URLTypePreview)
 	utils.SuccessResponse(c, "Preview URL generated", map[string]string{
 		"previewUrl": previewURL,
 	})
 }
 
+// GetFileURLs handles GET /files/:id/urls. previewUrl is empty for types that cannot be previewed.
+func (fc *FileController) GetFileURLs(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	downloadURL, previewURL, err := fc.fileService.GetFileURLs(c.Param("id"), userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to generate file URLs")
+		return
+	}
+
+	// Cache for the shorter of the two lifetimes
+	if previewURL != "" {
+		fc.setURLCacheHeader(c, services.URLTypePreview)
+	} else {
+		fc.setURLCacheHeader(c, services.URLTypeDownload)
+	}
+	utils.SuccessResponse(c, "File URLs generated", map[string]string{
+		"downloadUrl": downloadURL,
+		"previewUrl":  previewURL,
+	})
+}
+
+// GetFilePermissions handles GET /files/:id/permissions
+func (fc *FileController) GetFilePermissions(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	permissions, err := fc.shareService.GetResourcePermissions(c.Request.Context(), c.Param("id"), "file", userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to get file permissions")
+		return
+	}
+
+	utils.SuccessResponse(c, "File permissions retrieved", permissions)
+}
+
+// VerifyIntegrity handles POST /files/:id/verify. It re-reads the whole file from storage,
+// so it is meant for on-demand checks rather than routine use.
+func (fc *FileController) VerifyIntegrity(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	valid, err := fc.fileService.VerifyIntegrity(c.Param("id"), userId)
+	if err != nil {
+		if err.Error() == "file has no recorded checksum" {
+			utils.BadRequestResponse(c, "File has no recorded checksum", nil)
+			return
+		}
+		fc.handleError(c, err, "Failed to verify file")
+		return
+	}
+
+	utils.SuccessResponse(c, "File verified", gin.H{"valid": valid})
+}
+
+// GetRawFile handles GET /files/:id/raw. Small previewable files are returned inline so
+// clients can render thumbnails and text directly; larger ones redirect to a signed URL.
+func (fc *FileController) GetRawFile(c *gin.Context) {
+	fileId := c.Param("id")
+	userId := c.GetString("userIdStr")
+
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	file, url, err := fc.fileService.RawFile(fileId, userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to read file")
+		return
+	}
+	if url != "" {
+		recordActivity(c, fc.auditService, services.AuditActionDownload, "file", fileId, map[string]string{"via": "raw"})
+		c.Redirect(http.StatusTemporaryRedirect, url)
+		return
+	}
+
+	headers := map[string]string{
+		"Cache-Control":          fmt.Sprintf("private, max-age=%d", int(rawCacheMaxAge.Seconds())),
+		"Content-Disposition":    fmt.Sprintf("inline; filename=%q", file.Name),
+		"X-Content-Type-Options": "nosniff",
+	}
+	if file.SHA1Hash != "" {
+		etag := `"` + file.SHA1Hash + `"`
+		headers["ETag"] = etag
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	reader, _, err := fc.fileService.OpenFileContent(c.Request.Context(), fileId, userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to read file")
+		return
+	}
+	defer reader.Close()
+	recordActivity(c, fc.auditService, services.AuditActionDownload, "file", fileId, map[string]string{"via": "raw"})
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, file.Size, contentType, reader, headers)
+}
+
+// setURLCacheHeader lets clients reuse a signed URL response until its nominal expiry
+func (fc *FileController) setURLCacheHeader(c *gin.Context, urlType services.URLType) {
+	if ttl := fc.fileService.URLCacheTTL(urlType); ttl > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+	}
+}
+
+// IssueAccessToken gives an external app a short-lived token to read or write one file
+func (fc *FileController) IssueAccessToken(c *gin.Context) {
+	fileId := c.Param("id")
+	userId := c.GetString("userIdStr")
+
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req struct {
+		Action string `json:"action" binding:"required,oneof=read write"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	requiredRole := "viewer"
+	if req.Action == utils.FileActionWrite {
+		requiredRole = "editor"
+	}
+	if err := fc.fileService.CheckFileRole(fileId, userId, requiredRole); err != nil {
+		fc.handleError(c, err, "Failed to issue access token")
+		return
+	}
+
+	ttl := defaultFileAccessTokenTTL
+	if config.AppConfig != nil && config.AppConfig.FileAccessTokenTTL > 0 {
+		ttl = config.AppConfig.FileAccessTokenTTL
+	}
+
+	token, expiresAt, err := utils.GenerateFileAccessToken(userId, fileId, req.Action, fc.jwtSecret, ttl)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to issue access token", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Access token issued", map[string]interface{}{
+		"access_token": token,
+		"action":       req.Action,
+		"expires_at":   expiresAt,
+		"content_url":  fmt.Sprintf("/api/files/%s/content", fileId),
+	})
+}
+
+// GetFileContent streams a file through the server under its own name, so the B2 object key
+// never reaches the client. Signed-in users authenticate with their session; external apps
+// with a read token in the X-File-Access-Token header. Single Range requests are honoured so
+// media can be seeked.
+func (fc *FileController) GetFileContent(c *gin.Context) {
+	fileId := c.Param("id")
+
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	file, err := fc.fileService.GetFileByID(fileId, userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to read file content")
+		return
+	}
+
+	fc.streamFile(c, file, userId, "attachment", "content")
+}
+
+// StreamFile handles GET /files/:id/stream. Previewable files are streamed inline with
+// Range support, so <video> and <audio> elements can seek in private-bucket media.
+func (fc *FileController) StreamFile(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	file, err := fc.fileService.GetPreviewableFile(c.Param("id"), userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to stream file")
+		return
+	}
+
+	fc.streamFile(c, file, userId, "inline", "stream")
+}
+
+// streamFile writes a file, or the single byte range the request asks for, with the
+// given Content-Disposition type. Only reads from the first byte are recorded as downloads,
+// so a player seeking through a video doesn't log one per range request.
+func (fc *FileController) streamFile(c *gin.Context, file *models.File, userID, dispositionType, via string) {
+	start, length, partial, err := utils.ParseByteRange(c.GetHeader("Range"), file.Size)
+	if err != nil {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if !partial {
+		start, length = 0, file.Size
+	}
+
+	// An empty file has nothing to fetch from B2
+	var reader io.ReadCloser = io.NopCloser(strings.NewReader(""))
+	if length > 0 {
+		reader, err = fc.fileService.OpenFileRange(c.Request.Context(), file, start, length)
+		if err != nil {
+			fc.handleError(c, err, "Failed to read file content")
+			return
+		}
+	}
+	defer reader.Close()
+
+	if start == 0 && fc.auditService != nil {
+		fc.auditService.RecordActivity(c.Request.Context(), services.AuditActionDownload, userID, "file", file.ID.Hex(), c.ClientIP(), map[string]string{"via": via})
+	}
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := mime.FormatMediaType(dispositionType, map[string]string{"filename": file.Name})
+	if disposition == "" {
+		disposition = dispositionType
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", disposition)
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	status := http.StatusOK
+	if partial {
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, file.Size))
+		status = http.StatusPartialContent
+	}
+	c.Status(status)
+
+	// Headers are sent by now, so a failed copy can only be logged
+	buffer := make([]byte, 32*1024)
+	if _, err := io.CopyBuffer(c.Writer, reader, buffer); err != nil {
+		log.Printf("Streaming file %s failed: %v", file.ID.Hex(), err)
+	}
+}
+
+// PutFileContent stores the request body as a new version for an external app holding a write token.
+// The body must declare its Content-Length so the size limit and the owner's quota are checked
+// before anything is uploaded.
+func (fc *FileController) PutFileContent(c *gin.Context) {
+	fileId := c.Param("id")
+
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	size := c.Request.ContentLength
+	if size < 0 {
+		utils.ErrorResponse(c, http.StatusLengthRequired, "Content-Length is required", nil)
+		return
+	}
+	if size > maxExternalWriteSize {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "File exceeds 100MB limit", nil)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxExternalWriteSize)
+	file, err := fc.fileService.ReplaceContent(fileId, userId, body, size, c.ContentType())
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "File exceeds 100MB limit", nil)
+			return
+		}
+		if err.Error() == "file was modified concurrently" {
+			utils.ErrorResponse(c, http.StatusConflict, "File was modified concurrently", err.Error())
+			return
+		}
+		if strings.HasPrefix(err.Error(), "file type not allowed") {
+			utils.ErrorResponse(c, http.StatusUnsupportedMediaType, err.Error(), nil)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "content length mismatch") {
+			utils.BadRequestResponse(c, err.Error(), nil)
+			return
+		}
+		fc.handleError(c, err, "Failed to write file content")
+		return
+	}
+
+	utils.SuccessResponse(c, "File content updated", file)
+}
+
+// FindDuplicates reports groups of the user's files with identical content
+func (fc *FileController) FindDuplicates(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	groups, err := fc.fileService.FindDuplicates(userId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to find duplicate files", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Duplicate files retrieved", groups)
+}
+
+// GetFilesByCategory handles GET /files/by-category/:category for gallery-style views
+func (fc *FileController) GetFilesByCategory(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	category, err := services.ParseFileCategory(c.Param("category"))
+	if err != nil {
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
+
+	files, total, err := fc.fileService.GetFilesByCategory(userId, category, limit, offset)
+	if err != nil {
+		fc.handleError(c, err, "Failed to get files")
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Files retrieved", files, &utils.Pagination{
+		Page:       offset/limit + 1,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	})
+}
+
+// FileExists handles GET /files/exists?sha1=&size=. A hit returns the existing file so a sync
+// client can reference it instead of uploading the same content again.
+func (fc *FileController) FileExists(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var size int64
+	if raw := c.Query("size"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			utils.BadRequestResponse(c, "Invalid size", nil)
+			return
+		}
+		size = parsed
+	}
+
+	file, err := fc.fileService.FindBySHA1(userId, c.Query("sha1"), size)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid sha1") {
+			utils.BadRequestResponse(c, err.Error(), nil)
+			return
+		}
+		utils.InternalServerErrorResponse(c, "Failed to check file", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "File existence checked", gin.H{
+		"exists": file != nil,
+		"file":   file,
+	})
+}
+
+// DeleteFiles handles POST /files/batch-delete {ids, reason}
+func (fc *FileController) DeleteFiles(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req struct {
+		IDs    []string `json:"ids" binding:"required,min=1,max=100"`
+		Reason string   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	reason, err := services.NormalizeDeleteReason(req.Reason)
+	if err != nil {
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	results, err := fc.fileService.DeleteFiles(req.IDs, userId, reason)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to delete files", err.Error())
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+			recordActivity(c, fc.auditService, services.AuditActionDelete, "file", result.ID, reasonDetails(reason))
+		}
+	}
+
+	utils.SuccessResponse(c, "Files deleted", gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
 func (fc *FileController) DeleteFile(c *gin.Context) {
 	fileId := c.Param("id")
 	userId := c.GetString("userIdStr")
@@ -156,12 +741,21 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	err := fc.fileService.DeleteFile(fileId, userId)
+	// An optional ?reason= is shown in the owner's trash
+	reason, err := services.NormalizeDeleteReason(c.Query("reason"))
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	err = fc.fileService.DeleteFile(fileId, userId, reason)
+	if err != nil {
+		fc.handleError(c, err, "Failed to delete file")
 		return
 	}
 
+	recordActivity(c, fc.auditService, services.AuditActionDelete, "file", fileId, reasonDetails(reason))
+
 	utils.SuccessResponse(c, "File moved to trash", nil)
 }
 
@@ -181,13 +775,64 @@ func (fc *FileController) GetFileMetadata(c *gin.Context) {
 
 	fileMetadata, err := fc.fileService.GetFileByID(fileId, userId)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get file metadata", nil)
+		fc.handleError(c, err, "Failed to get file metadata")
+		return
+	}
+
+	// Clients may cache metadata but must revalidate, which is cheap with the ETag
+	etag := metadataETag(fileMetadata)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", fileMetadata.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
 	utils.SuccessResponse(c, "File metadata retrieved", fileMetadata)
 }
 
+// metadataETag identifies a version of a file's metadata. The content hash alone would miss
+// renames and moves, so updated_at, which every metadata change bumps, is part of it.
+func metadataETag(file *models.File) string {
+	return fmt.Sprintf(`"%s-%x"`, file.SHA1Hash, file.UpdatedAt.UnixMilli())
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFileProperties returns the full properties payload for a file
+func (fc *FileController) GetFileProperties(c *gin.Context) {
+	fileId := c.Param("id")
+	userId := c.GetString("userIdStr")
+
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if fileId == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "File ID is required", nil)
+		return
+	}
+
+	properties, err := fc.fileService.GetFileProperties(fileId, userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to get file properties")
+		return
+	}
+
+	utils.SuccessResponse(c, "File properties retrieved", properties)
+}
+
 func (fc *FileController) RenameFile(c *gin.Context) {
 	fileId := c.Param("id")
 	userId := c.GetString("userIdStr")
@@ -211,5 +856,155 @@ func (fc *FileController) RenameFile(c *gin.Context) {
 		return
 	}
 
+	if err := fc.fileService.RenameFile(fileId, req.NewName, userId); err != nil {
+		fc.handleError(c, err, "Failed to rename file")
+		return
+	}
+
+	recordActivity(c, fc.auditService, services.AuditActionRename, "file", fileId, map[string]string{"name": req.NewName})
+
 	utils.SuccessResponse(c, "File renamed successfully", nil)
 }
+
+// RestoreVersion makes a previous version of a file current again
+func (fc *FileController) RestoreVersion(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	file, err := fc.fileService.RestoreVersion(c.Param("id"), c.Param("versionId"), userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to restore version")
+		return
+	}
+
+	utils.SuccessResponse(c, "Version restored", file)
+}
+
+// DeleteVersion removes one historical version of a file
+func (fc *FileController) DeleteVersion(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := fc.fileService.DeleteVersion(c.Param("id"), c.Param("versionId"), userId); err != nil {
+		fc.handleError(c, err, "Failed to delete version")
+		return
+	}
+
+	utils.SuccessResponse(c, "Version deleted", nil)
+}
+
+// CopyFile duplicates a file into target_folder_id, or next to the original when omitted
+func (fc *FileController) CopyFile(c *gin.Context) {
+	fileId := c.Param("id")
+	userId := c.GetString("userIdStr")
+
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req struct {
+		TargetFolderID *string `json:"target_folder_id"`
+	}
+
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	targetFolderID := ""
+	if req.TargetFolderID != nil {
+		targetFolderID = *req.TargetFolderID
+	}
+
+	file, err := fc.fileService.CopyFile(fileId, targetFolderID, userId)
+	if err != nil {
+		fc.handleError(c, err, "Failed to copy file")
+		return
+	}
+
+	recordActivity(c, fc.auditService, services.AuditActionCreate, "file", file.ID.Hex(), map[string]string{"name": file.Name, "copied_from": fileId})
+
+	utils.CreatedResponse(c, "File copied successfully", file)
+}
+
+// MoveFile moves a file to another folder, or to the root when target_folder_id is null
+func (fc *FileController) MoveFile(c *gin.Context) {
+	fileId := c.Param("id")
+	userId := c.GetString("userIdStr")
+
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req struct {
+		TargetFolderID *string `json:"target_folder_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	targetFolderID := ""
+	if req.TargetFolderID != nil {
+		targetFolderID = *req.TargetFolderID
+	}
+
+	if err := fc.fileService.MoveFile(fileId, targetFolderID, userId); err != nil {
+		fc.handleError(c, err, "Failed to move file")
+		return
+	}
+
+	recordActivity(c, fc.auditService, services.AuditActionMove, "file", fileId, map[string]string{"target_folder_id": targetFolderID})
+
+	utils.SuccessResponse(c, "File moved successfully", nil)
+}
+
+func (fc *FileController) BulkTagFiles(c *gin.Context) {
+	userId := c.GetString("userIdStr")
+	if userId == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req struct {
+		IDs    []string `json:"ids" binding:"required,min=1,max=100"`
+		Add    []string `json:"add" binding:"max=20"`
+		Remove []string `json:"remove" binding:"max=20"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	results, err := fc.fileService.BulkTagFiles(userId, req.IDs, req.Add, req.Remove)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+
+	utils.SuccessResponse(c, "Tags updated", gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUploadFilesRejectsMisalignedRelativePaths(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("misaligned", func(mt *mtest.T) {
+		controller := NewFileController(mt.DB, "secret", nil, nil, nil, nil, nil)
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("userIdStr", "u1") })
+		router.POST("/files/upload", controller.UploadFiles)
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for _, name := range []string{"a.txt", "b.txt"} {
+			part, err := form.CreateFormFile("files[]", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(name))
+		}
+		// Same count, wrong order
+		form.WriteField("relativePath[]", "docs/b.txt")
+		form.WriteField("relativePath[]", "docs/a.txt")
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/files/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if !strings.Contains(w.Body.String(), "misaligned at index 0") {
+			t.Fatalf("body = %s", w.Body.String())
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Fatalf("a rejected upload ran %d commands", n)
+		}
+	})
+}
+
+func TestUploadOverQuotaAnswers507WithNumbers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("over quota", func(mt *mtest.T) {
+		controller := NewFileController(mt.DB, "secret", nil, nil, nil, nil, nil)
+		userID := primitive.NewObjectID()
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("userIdStr", userID.Hex()) })
+		router.POST("/files/upload", controller.UploadFiles)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: userID},
+			{Key: "used_storage", Value: int64(95)},
+			{Key: "max_storage", Value: int64(100)},
+		}))
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("files[]", "a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("0123456789"))
+		form.WriteField("relativePath[]", "a.txt")
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/files/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusInsufficientStorage {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusInsufficientStorage, w.Body.String())
+		}
+		var resp struct {
+			Error map[string]any `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]float64{"used": 95, "max": 100, "requested": 10, "remaining": 5}
+		for field, value := range want {
+			if got, ok := resp.Error[field].(float64); !ok || got != value {
+				t.Errorf("%s = %v, want the number %v", field, resp.Error[field], value)
+			}
+		}
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,12 +16,14 @@ import (
 type FolderController struct {
 	folderService *services.FolderService
 	b2Service     *services.B2Service
+	auditService  *services.AuditService
 }
 
-func NewFolderController(folderService *services.FolderService, b2Service *services.B2Service) *FolderController {
+func NewFolderController(folderService *services.FolderService, b2Service *services.B2Service, auditService *services.AuditService) *FolderController {
 	return &FolderController{
 		folderService: folderService,
 		b2Service:     b2Service,
+		auditService:  auditService,
 	}
 }
 
@@ -53,10 +57,20 @@ func (fc *FolderController) handleError(c *gin.Context, err error, defaultMessag
 		statusCode, message = http.StatusForbidden, "Insufficient permissions to share this folder"
 	case "file not found in folder":
 		statusCode, message = http.StatusNotFound, "File not found in folder"
+	case "cannot move folder into another user's folder":
+		statusCode, message = http.StatusForbidden, "Cannot move a folder into another user's folder"
+	case "cannot move a folder into itself":
+		statusCode, message = http.StatusBadRequest, "Cannot move a folder into itself or one of its subfolders"
+	case "folder was modified concurrently":
+		statusCode, message = http.StatusConflict, "Folder was changed by another request; reload and try again"
+	case "download too large":
+		statusCode, message = http.StatusRequestEntityTooLarge, "Folder is too large to download as a ZIP"
 	default:
 		errorStr := err.Error()
 		if len(errorStr) > 25 && errorStr[:19] == "folder with name '" && errorStr[len(errorStr)-15:] == "already exists" {
 			statusCode, message = http.StatusConflict, "Folder with this name already exists"
+		} else if strings.HasPrefix(errorStr, "file with name '") && strings.HasSuffix(errorStr, "already exists") {
+			statusCode, message = http.StatusConflict, "File with this name already exists"
 		} else if len(errorStr) > 17 && errorStr[:17] == "user with email " {
 			statusCode, message = http.StatusNotFound, "User not found"
 		}
@@ -75,7 +89,7 @@ func (fc *FolderController) CreateFolder(c *gin.Context) {
 
 	var req struct {
 		Name        string  `json:"name" binding:"required,min=1,max=255"`
-		Description string  `json:"description,omitempty"`
+		Description string  `json:"description,omitempty" binding:"max=1000"`
 		ParentID    *string `json:"parent_id,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -86,25 +100,57 @@ func (fc *FolderController) CreateFolder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid parent folder ID format"})
 		return
 	}
+	if err := utils.ValidateFolderName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 
-	folder, err := fc.folderService.CreateFolder(req.Name, req.ParentID, userIDStr)
+	folder, err := fc.folderService.CreateFolder(req.Name, req.Description, req.ParentID, userIDStr)
 	if err != nil {
 		fc.handleError(c, err, "Failed to create folder", http.StatusInternalServerError)
 		return
 	}
 
+	recordActivity(c, fc.auditService, services.AuditActionCreate, "folder", folder.ID.Hex(), map[string]string{"name": folder.Name, "path": folder.Path})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
 		"message": "Folder created successfully",
 		"data": gin.H{
-			"id":         folder.ID,
-			"name":       folder.Name,
-			"path":       folder.Path,
-			"created_at": folder.CreatedAt,
+			"id":          folder.ID,
+			"name":        folder.Name,
+			"path":        folder.Path,
+			"description": folder.Description,
+			"created_at":  folder.CreatedAt,
 		},
 	})
 }
 
+// ResolvePaths maps many relative folder paths to IDs without creating any folders
+func (fc *FolderController) ResolvePaths(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	var req struct {
+		Paths []string `json:"paths" binding:"required,min=1,max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request body", "error": err.Error()})
+		return
+	}
+
+	results, err := fc.folderService.ResolveFolderPaths(req.Paths, userIDStr)
+	if err != nil {
+		fc.handleError(c, err, "Failed to resolve paths", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": results})
+}
+
 // ListRootFolders
 func (fc *FolderController) ListRootFolders(c *gin.Context) {
 	userIDStr, err := fc.getUserID(c)
@@ -113,7 +159,13 @@ func (fc *FolderController) ListRootFolders(c *gin.Context) {
 		return
 	}
 
-	folders, err := fc.folderService.ListRootFoldersWithCounts(userIDStr)
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	folders, err := fc.folderService.ListRootFoldersWithCounts(userIDStr, sortOpt)
 	if err != nil {
 		fc.handleError(c, err, "Failed to retrieve folders", http.StatusInternalServerError)
 		return
@@ -135,13 +187,133 @@ func (fc *FolderController) GetFolderContents(c *gin.Context) {
 		return
 	}
 
-	contents, err := fc.folderService.GetFolderContents(folderID, userIDStr)
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	typeFilter, err := services.ParseContentFilter(c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
+
+	contents, err := fc.folderService.GetFolderContents(folderID, userIDStr, sortOpt, typeFilter, limit, offset)
 	if err != nil {
 		fc.handleError(c, err, "Failed to retrieve folder contents", http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": contents})
+	// Measuring walks the whole subtree, so it is only done on request
+	if c.Query("include_size") == "true" {
+		size, err := fc.folderService.GetFolderSize(folderID, userIDStr)
+		if err != nil {
+			fc.handleError(c, err, "Failed to calculate folder size", http.StatusInternalServerError)
+			return
+		}
+		contents.TotalSize = &size
+	}
+
+	total := int64(contents.Counts.Subfolders + contents.Counts.Files)
+	utils.PaginatedSuccessResponse(c, "Folder contents retrieved", contents, &utils.Pagination{
+		Page:       offset/limit + 1,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	})
+}
+
+// GetFolderSize returns the total bytes of live files under the folder
+func (fc *FolderController) GetFolderSize(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	folderID := c.Param("id")
+	if !primitive.IsValidObjectID(folderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid folder ID format"})
+		return
+	}
+
+	size, err := fc.folderService.GetFolderSize(folderID, userIDStr)
+	if err != nil {
+		fc.handleError(c, err, "Failed to calculate folder size", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"total_size": size}})
+}
+
+// GetBreadcrumb returns the folder's ancestors, root first, for breadcrumb navigation
+func (fc *FolderController) GetBreadcrumb(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	folderID := c.Param("id")
+	if !primitive.IsValidObjectID(folderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid folder ID format"})
+		return
+	}
+
+	ancestors, err := fc.folderService.GetAncestors(folderID, userIDStr)
+	if err != nil {
+		fc.handleError(c, err, "Failed to retrieve breadcrumb", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Breadcrumb retrieved successfully",
+		"data":    ancestors,
+	})
+}
+
+// GetFolderView returns a page of contents, the breadcrumb and the caller's role in one call
+func (fc *FolderController) GetFolderView(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	folderID := c.Param("id")
+	if !primitive.IsValidObjectID(folderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid folder ID format"})
+		return
+	}
+
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	typeFilter, err := services.ParseContentFilter(c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
+
+	view, err := fc.folderService.GetFolderView(folderID, userIDStr, sortOpt, typeFilter, limit, offset)
+	if err != nil {
+		fc.handleError(c, err, "Failed to retrieve folder", http.StatusInternalServerError)
+		return
+	}
+
+	total := int64(view.Contents.Counts.Subfolders + view.Contents.Counts.Files)
+	utils.PaginatedSuccessResponse(c, "Folder retrieved", view, &utils.Pagination{
+		Page:       offset/limit + 1,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	})
 }
 
 // GetFolder
@@ -179,20 +351,92 @@ func (fc *FolderController) RenameFolder(c *gin.Context) {
 	}
 
 	var req struct {
-		Name string `json:"name" binding:"required,min=1,max=255"`
+		Name              string     `json:"name" binding:"required,min=1,max=255"`
+		ExpectedUpdatedAt *time.Time `json:"expected_updated_at"` // optional; 409 if the folder changed since
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request data", "error": err.Error()})
 		return
 	}
+	if err := utils.ValidateFolderName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 
-	if err := fc.folderService.RenameFolder(folderID, req.Name, userIDStr); err != nil {
+	if err := fc.folderService.RenameFolder(folderID, req.Name, userIDStr, req.ExpectedUpdatedAt); err != nil {
 		fc.handleError(c, err, "Failed to rename folder", http.StatusInternalServerError)
 		return
 	}
+	recordActivity(c, fc.auditService, services.AuditActionRename, "folder", folderID, map[string]string{"name": req.Name})
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Folder renamed successfully"})
 }
 
+// MoveFolder
+func (fc *FolderController) MoveFolder(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	folderID := c.Param("id")
+	if !primitive.IsValidObjectID(folderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid folder ID format"})
+		return
+	}
+
+	var req struct {
+		ParentID          *string    `json:"parent_id"`
+		ExpectedUpdatedAt *time.Time `json:"expected_updated_at"` // optional; 409 if the folder changed since
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request data", "error": err.Error()})
+		return
+	}
+	if req.ParentID != nil && *req.ParentID != "" && !primitive.IsValidObjectID(*req.ParentID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid parent folder ID format"})
+		return
+	}
+
+	if err := fc.folderService.MoveFolder(folderID, req.ParentID, userIDStr, req.ExpectedUpdatedAt); err != nil {
+		fc.handleError(c, err, "Failed to move folder", http.StatusInternalServerError)
+		return
+	}
+	parentID := ""
+	if req.ParentID != nil {
+		parentID = *req.ParentID
+	}
+	recordActivity(c, fc.auditService, services.AuditActionMove, "folder", folderID, map[string]string{"parent_id": parentID})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Folder moved successfully"})
+}
+
+// MergeFolder moves the contents of one folder into another.
+// Query: on_conflict=rename|skip|fail (default rename), delete_source=true to trash the emptied source.
+func (fc *FolderController) MergeFolder(c *gin.Context) {
+	userIDStr, err := fc.getUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	folderID, destID := c.Param("id"), c.Param("destId")
+	if !primitive.IsValidObjectID(folderID) || !primitive.IsValidObjectID(destID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid folder ID format"})
+		return
+	}
+
+	onConflict, err := services.ParseMergeConflict(c.Query("on_conflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	result, err := fc.folderService.MergeFolder(c.Request.Context(), folderID, destID, userIDStr, onConflict, c.Query("delete_source") == "true")
+	if err != nil {
+		fc.handleError(c, err, "Failed to merge folder", http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Folder merged successfully", "data": result})
+}
+
 // DeleteFolder
 func (fc *FolderController) DeleteFolder(c *gin.Context) {
 	userIDStr, err := fc.getUserID(c)
@@ -206,10 +450,18 @@ func (fc *FolderController) DeleteFolder(c *gin.Context) {
 		return
 	}
 
-	if err := fc.folderService.DeleteFolder(c.Request.Context(), folderID, userIDStr); err != nil {
+	// An optional ?reason= is shown in the owner's trash
+	reason, err := services.NormalizeDeleteReason(c.Query("reason"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	if err := fc.folderService.DeleteFolder(c.Request.Context(), folderID, userIDStr, reason); err != nil {
 		fc.handleError(c, err, "Failed to delete folder", http.StatusInternalServerError)
 		return
 	}
+	recordActivity(c, fc.auditService, services.AuditActionDelete, "folder", folderID, reasonDetails(reason))
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Folder deleted successfully"})
 }
 
@@ -255,5 +507,7 @@ func (fc *FolderController) DownloadFolder(c *gin.Context) {
 		} else {
 			fmt.Printf("Error streaming folder zip for %s: %v\n", folderID, err)
 		}
+		return
 	}
+	recordActivity(c, fc.auditService, services.AuditActionDownload, "folder", folderID, nil)
 }
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"phynixdrive/middleware"
+	"phynixdrive/models"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetFolderViewReturnsContentsBreadcrumbAndRole(t *testing.T) {
+	const secret = "test-secret"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("view", func(mt *mtest.T) {
+		permissionService := services.NewPermissionService(mt.DB)
+		controller := NewFolderController(services.NewFolderService(mt.DB, permissionService, nil), nil, nil)
+		router := gin.New()
+		router.GET("/folders/:id/view", middleware.AuthMiddleware(secret), controller.GetFolderView)
+
+		userID, folderID := primitive.NewObjectID(), primitive.NewObjectID()
+		token, err := utils.GenerateJWTTokenWithSecret(&models.User{ID: userID, Email: "u@example.com"}, secret, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		folder := bson.D{
+			{Key: "_id", Value: folderID},
+			{Key: "name", Value: "docs"},
+			{Key: "path", Value: "/docs"},
+			{Key: "owner_id", Value: userID},
+			{Key: "is_deleted", Value: false},
+			{Key: "created_at", Value: time.Now()},
+			{Key: "updated_at", Value: time.Now()},
+		}
+		found := func() bson.D { return mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch, folder) }
+		mt.AddMockResponses(
+			found(), // access check
+			found(), // folder
+			found(), // can edit
+			found(), // can share
+			mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch), // subfolders
+			found(), // breadcrumb
+			found(), // breadcrumb visibility
+			found(), // role
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/folders/"+folderID.Hex()+"/view?type=folder&sort=name", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+
+		var contents services.FolderContentsResponse
+		if err := json.Unmarshal(body.Data["contents"], &contents); err != nil || contents.Folder.ID != folderID {
+			t.Fatalf("contents = %s, want the folder's listing", body.Data["contents"])
+		}
+		var breadcrumb []services.BreadcrumbItem
+		if err := json.Unmarshal(body.Data["breadcrumb"], &breadcrumb); err != nil || len(breadcrumb) != 1 || breadcrumb[0].ID != folderID {
+			t.Fatalf("breadcrumb = %s, want the folder itself", body.Data["breadcrumb"])
+		}
+		var role string
+		if err := json.Unmarshal(body.Data["role"], &role); err != nil || role != "owner" {
+			t.Fatalf("role = %s, want owner", body.Data["role"])
+		}
+	})
+}
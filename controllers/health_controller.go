@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"phynixdrive/services"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	healthCheckTimeout = 3 * time.Second
+	// Each B2 bucket lookup is a billed transaction, so frequent probes reuse a recent result
+	b2HealthCacheTTL = 15 * time.Second
+)
+
+// HealthController reports whether the server and the services it depends on are usable
+type HealthController struct {
+	db        *mongo.Database
+	b2Service *services.B2Service
+
+	mu          sync.Mutex
+	b2CheckedAt time.Time
+	b2Err       error
+}
+
+// DependencyStatus is the outcome of one readiness check. Errors are logged rather than
+// returned since the health endpoints are public.
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+func NewHealthController(db *mongo.Database, b2Service *services.B2Service) *HealthController {
+	return &HealthController{db: db, b2Service: b2Service}
+}
+
+// Live handles GET /health/live. It never touches a dependency, so a slow database
+// cannot get the process restarted.
+func (hc *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"time":   time.Now().UTC(),
+	})
+}
+
+// Ready handles GET /health and GET /health/ready, answering 503 if MongoDB or B2 is unreachable
+func (hc *HealthController) Ready(c *gin.Context) {
+	checks := map[string]DependencyStatus{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	run := func(name string, check func(ctx context.Context) error) {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+		defer cancel()
+
+		start := time.Now()
+		err := check(ctx)
+		result := DependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			log.Printf("Health check %s failed: %v", name, err)
+			result.Status = "unavailable"
+		}
+
+		mu.Lock()
+		checks[name] = result
+		mu.Unlock()
+	}
+
+	wg.Add(2)
+	go run("mongodb", hc.checkMongo)
+	go run("b2", hc.checkB2)
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"time":   time.Now().UTC(),
+		"checks": checks,
+	})
+}
+
+func (hc *HealthController) checkMongo(ctx context.Context) error {
+	return hc.db.Client().Ping(ctx, nil)
+}
+
+func (hc *HealthController) checkB2(ctx context.Context) error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if !hc.b2CheckedAt.IsZero() && time.Since(hc.b2CheckedAt) < b2HealthCacheTTL {
+		return hc.b2Err
+	}
+	hc.b2Err = hc.b2Service.CheckBucket(ctx)
+	hc.b2CheckedAt = time.Now()
+	return hc.b2Err
+}
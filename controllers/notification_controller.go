@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NotificationController serves the authenticated user's in-app notifications
+type NotificationController struct {
+	notificationService *services.NotificationService
+}
+
+// NewNotificationController only reads and updates notifications, so it needs no mail settings
+func NewNotificationController(db *mongo.Database) *NotificationController {
+	return &NotificationController{
+		notificationService: services.NewNotificationService(db, "", "", ""),
+	}
+}
+
+// ListNotifications handles GET /notifications
+func (nc *NotificationController) ListNotifications(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
+
+	notifications, total, err := nc.notificationService.ListNotifications(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		nc.handleError(c, err, "Failed to get notifications")
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Notifications retrieved", notifications, &utils.Pagination{
+		Page:       offset/limit + 1,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	})
+}
+
+// UnreadCount handles GET /notifications/unread-count
+func (nc *NotificationController) UnreadCount(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	count, err := nc.notificationService.UnreadCount(c.Request.Context(), userID)
+	if err != nil {
+		nc.handleError(c, err, "Failed to count notifications")
+		return
+	}
+
+	utils.SuccessResponse(c, "Unread count retrieved", gin.H{"unread": count})
+}
+
+// MarkRead handles PATCH /notifications/:id/read
+func (nc *NotificationController) MarkRead(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := nc.notificationService.MarkRead(c.Request.Context(), userID, c.Param("id")); err != nil {
+		nc.handleError(c, err, "Failed to update notification")
+		return
+	}
+
+	utils.SuccessResponse(c, "Notification marked as read", nil)
+}
+
+// MarkAllRead handles POST /notifications/read-all
+func (nc *NotificationController) MarkAllRead(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	updated, err := nc.notificationService.MarkAllRead(c.Request.Context(), userID)
+	if err != nil {
+		nc.handleError(c, err, "Failed to update notifications")
+		return
+	}
+
+	utils.SuccessResponse(c, "Notifications marked as read", gin.H{"updated": updated})
+}
+
+func (nc *NotificationController) handleError(c *gin.Context, err error, defaultMessage string) {
+	switch {
+	case err.Error() == "notification not found":
+		utils.NotFoundResponse(c, "Notification not found")
+	case strings.HasPrefix(err.Error(), "invalid"):
+		utils.BadRequestResponse(c, err.Error(), nil)
+	default:
+		utils.InternalServerErrorResponse(c, defaultMessage, err.Error())
+	}
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PublicController serves public link endpoints; none of them require a JWT
+type PublicController struct {
+	shareService  *services.ShareService
+	folderService *services.FolderService
+	b2Service     *services.B2Service
+	auditService  *services.AuditService
+}
+
+func NewPublicController(shareService *services.ShareService, folderService *services.FolderService, b2Service *services.B2Service, auditService *services.AuditService) *PublicController {
+	return &PublicController{
+		shareService:  shareService,
+		folderService: folderService,
+		b2Service:     b2Service,
+		auditService:  auditService,
+	}
+}
+
+// recordDownload logs an anonymous download through a public link on the linked resource
+func (pc *PublicController) recordDownload(c *gin.Context, link *models.PublicLink) {
+	recordActivity(c, pc.auditService, services.AuditActionDownload, link.ResourceType, link.ResourceID,
+		map[string]string{"via": "public_link", "link_id": link.ID.Hex()})
+}
+
+// Open handles GET /public/:token. File links redirect to a short-lived signed URL and
+// folder links stream a ZIP, the same as /public/:token/download.
+func (pc *PublicController) Open(c *gin.Context) {
+	link, file, err := pc.shareService.OpenPublicLink(c.Request.Context(), c.Param("token"), c.GetHeader("X-Link-Password"))
+	if err != nil {
+		pc.handleError(c, err)
+		return
+	}
+
+	if file == nil {
+		folderObjID, err := primitive.ObjectIDFromHex(link.ResourceID)
+		if err != nil {
+			utils.NotFoundResponse(c, "Link not found")
+			return
+		}
+		pc.streamFolder(c, link, folderObjID)
+		return
+	}
+
+	if pc.b2Service == nil {
+		utils.InternalServerErrorResponse(c, "Failed to load link", nil)
+		return
+	}
+	url, err := pc.b2Service.GetDownloadURLForFile(file.B2FileID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to load link", nil)
+		return
+	}
+
+	pc.recordDownload(c, link)
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+// GetLinkMeta handles GET /public/:token/meta
+func (pc *PublicController) GetLinkMeta(c *gin.Context) {
+	meta, err := pc.shareService.GetPublicLinkMeta(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		pc.handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Link details retrieved", meta)
+}
+
+// DownloadFolder handles GET /public/:token/download, streaming a public folder as a ZIP
+// within the configured size and file count limits
+func (pc *PublicController) DownloadFolder(c *gin.Context) {
+	link, folderObjID, err := pc.shareService.OpenPublicFolderLink(c.Request.Context(), c.Param("token"), c.GetHeader("X-Link-Password"))
+	if err != nil {
+		pc.handleError(c, err)
+		return
+	}
+
+	pc.streamFolder(c, link, folderObjID)
+}
+
+// streamFolder writes a public folder as a ZIP within the configured size and file count
+// limits. The download only counts against the link once the folder is within them.
+func (pc *PublicController) streamFolder(c *gin.Context, link *models.PublicLink, folderObjID primitive.ObjectID) {
+	var maxBytes, maxFiles int64
+	if config.AppConfig != nil {
+		maxBytes = config.AppConfig.PublicDownloadMaxBytes
+		maxFiles = config.AppConfig.PublicDownloadMaxFiles
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Minute)
+	defer cancel()
+
+	countDownload := func() error {
+		if err := pc.shareService.CountPublicDownload(ctx, link); err != nil {
+			return err
+		}
+		pc.recordDownload(c, link)
+		return nil
+	}
+	if err := pc.folderService.DownloadPublicFolder(ctx, c.Writer, folderObjID, maxBytes, maxFiles, countDownload); err != nil {
+		if !c.Writer.Written() {
+			pc.handleError(c, err)
+		} else {
+			fmt.Printf("Error streaming public folder zip for %s: %v\n", folderObjID.Hex(), err)
+		}
+	}
+}
+
+func (pc *PublicController) handleError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		utils.NotFoundResponse(c, "Link not found")
+	case strings.Contains(err.Error(), "expired"), strings.Contains(err.Error(), "limit reached"):
+		utils.ErrorResponse(c, http.StatusGone, "Link is no longer available", nil)
+	case strings.Contains(err.Error(), "password"):
+		utils.ErrorResponse(c, http.StatusUnauthorized, "A valid link password is required", nil)
+	case strings.Contains(err.Error(), "download too large"):
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Folder is too large to download from a public link", nil)
+	default:
+		utils.InternalServerErrorResponse(c, "Failed to load link", nil)
+	}
+}
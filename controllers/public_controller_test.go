@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"phynixdrive/services"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetLinkMetaDescribesFileWithoutServingIt(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("meta", func(mt *mtest.T) {
+		shareService := services.NewShareService(mt.DB, services.NewPermissionService(mt.DB), nil)
+		// No B2 service: the metadata route must not need one
+		controller := NewPublicController(shareService, nil, nil, nil)
+		router := gin.New()
+		router.GET("/public/:token/meta", controller.GetLinkMeta)
+
+		fileID := primitive.NewObjectID()
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.public_links", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "token", Value: "tok"},
+				{Key: "resource_id", Value: fileID.Hex()},
+				{Key: "resource_type", Value: "file"},
+				{Key: "password_hash", Value: "$2a$10$secret"},
+				{Key: "is_active", Value: true},
+			}),
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: fileID},
+				{Key: "name", Value: "report.pdf"},
+				{Key: "size", Value: int64(2048)},
+				{Key: "mime_type", Value: "application/pdf"},
+				{Key: "b2_file_id", Value: "b2-secret-id"},
+			}),
+		)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/tok/meta", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+
+		var body struct {
+			Data services.PublicLinkMeta `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		meta := body.Data
+		if meta.Name != "report.pdf" || meta.Type != "file" || meta.Size != 2048 || !meta.PasswordRequired {
+			t.Fatalf("meta = %+v", meta)
+		}
+		if raw := w.Body.String(); strings.Contains(raw, "b2-secret-id") || strings.Contains(raw, "secret") {
+			t.Fatalf("response leaks storage or password details: %s", raw)
+		}
+		if len(mt.GetAllStartedEvents()) != 2 {
+			t.Fatal("metadata lookup should only read the link and the file")
+		}
+	})
+}
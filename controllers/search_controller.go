@@ -28,27 +28,22 @@ func (sc *SearchController) Search(c *gin.Context) {
 		return
 	}
 
-	userId := c.GetString("userId")
+	userId := utils.CurrentUserID(c)
 	if userId == "" {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
 	// Optional parameters
-	limit := c.DefaultQuery("limit", "50")
-	offset := c.DefaultQuery("offset", "0")
+	limitInt, offsetInt := utils.ParsePagination(c, utils.DefaultPageLimit)
 
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt <= 0 {
-		limitInt = 50
-	}
-
-	offsetInt, err := strconv.Atoi(offset)
-	if err != nil || offsetInt < 0 {
-		offsetInt = 0
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort parameters", err.Error())
+		return
 	}
 
-	results, err := sc.searchService.Search(userId, query, limitInt, offsetInt)
+	results, err := sc.searchService.Search(userId, query, limitInt, offsetInt, c.Query("include_description") == "true", sortOpt)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Search failed", nil)
 		return
@@ -65,27 +60,22 @@ func (sc *SearchController) SearchFilesOnly(c *gin.Context) {
 		return
 	}
 
-	userId := c.GetString("userId")
+	userId := utils.CurrentUserID(c)
 	if userId == "" {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
 	// Optional parameters
-	limit := c.DefaultQuery("limit", "50")
-	offset := c.DefaultQuery("offset", "0")
+	limitInt, offsetInt := utils.ParsePagination(c, utils.DefaultPageLimit)
 
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt <= 0 {
-		limitInt = 50
-	}
-
-	offsetInt, err := strconv.Atoi(offset)
-	if err != nil || offsetInt < 0 {
-		offsetInt = 0
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort parameters", err.Error())
+		return
 	}
 
-	files, err := sc.searchService.SearchFilesOnly(userId, query, limitInt, offsetInt)
+	files, err := sc.searchService.SearchFilesOnly(userId, query, limitInt, offsetInt, c.Query("include_description") == "true", sortOpt)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "File search failed", nil)
 		return
@@ -102,27 +92,22 @@ func (sc *SearchController) SearchFoldersOnly(c *gin.Context) {
 		return
 	}
 
-	userId := c.GetString("userId")
+	userId := utils.CurrentUserID(c)
 	if userId == "" {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
 	// Optional parameters
-	limit := c.DefaultQuery("limit", "50")
-	offset := c.DefaultQuery("offset", "0")
-
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt <= 0 {
-		limitInt = 50
-	}
+	limitInt, offsetInt := utils.ParsePagination(c, utils.DefaultPageLimit)
 
-	offsetInt, err := strconv.Atoi(offset)
-	if err != nil || offsetInt < 0 {
-		offsetInt = 0
+	sortOpt, err := services.ParseSortOption(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort parameters", err.Error())
+		return
 	}
 
-	folders, err := sc.searchService.SearchFoldersOnly(userId, query, limitInt, offsetInt)
+	folders, err := sc.searchService.SearchFoldersOnly(userId, query, limitInt, offsetInt, c.Query("include_description") == "true", sortOpt)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Folder search failed", nil)
 		return
@@ -133,21 +118,16 @@ func (sc *SearchController) SearchFoldersOnly(c *gin.Context) {
 
 // GetRecentFiles retrieves recently accessed/modified files
 func (sc *SearchController) GetRecentFiles(c *gin.Context) {
-	userId := c.GetString("userId")
+	userId := utils.CurrentUserID(c)
 	if userId == "" {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
 	// Optional parameters
-	limit := c.DefaultQuery("limit", "20")
+	limitInt, _ := utils.ParsePagination(c, 20)
 	days := c.DefaultQuery("days", "30") // Recent files from last 30 days
 
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt <= 0 {
-		limitInt = 20
-	}
-
 	daysInt, err := strconv.Atoi(days)
 	if err != nil || daysInt <= 0 {
 		daysInt = 30
@@ -163,27 +143,16 @@ func (sc *SearchController) GetRecentFiles(c *gin.Context) {
 
 // GetSharedWithMe retrieves files and folders shared with the current user
 func (sc *SearchController) GetSharedWithMe(c *gin.Context) {
-	userId := c.GetString("userId")
+	userId := utils.CurrentUserID(c)
 	if userId == "" {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
 	// Optional parameters
-	limit := c.DefaultQuery("limit", "50")
-	offset := c.DefaultQuery("offset", "0")
+	limitInt, offsetInt := utils.ParsePagination(c, utils.DefaultPageLimit)
 	itemType := c.DefaultQuery("type", "all") // "files", "folders", or "all"
 
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt <= 0 {
-		limitInt = 50
-	}
-
-	offsetInt, err := strconv.Atoi(offset)
-	if err != nil || offsetInt < 0 {
-		offsetInt = 0
-	}
-
 	// Validate item type
 	if itemType != "files" && itemType != "folders" && itemType != "all" {
 		itemType = "all"
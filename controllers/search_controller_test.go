@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"phynixdrive/middleware"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSearchUsesAuthenticatedUser(t *testing.T) {
+	const secret = "test-secret"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("authenticated", func(mt *mtest.T) {
+		controller := NewSearchController(mt.DB, nil)
+		router := gin.New()
+		router.GET("/search", middleware.AuthMiddleware(secret), controller.Search)
+
+		userID := primitive.NewObjectID()
+		token, err := utils.GenerateJWTTokenWithSecret(&models.User{ID: userID, Email: "u@example.com"}, secret, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.permissions", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch),
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/search?q=foo&sort=name", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+		// The search is scoped to the user from the token
+		for _, evt := range mt.GetAllStartedEvents() {
+			if evt.CommandName == "find" && evt.Command.Lookup("find").StringValue() == "permissions" {
+				if got := evt.Command.Lookup("filter", "user_id").StringValue(); got != userID.Hex() {
+					t.Fatalf("searched as %q, want %q", got, userID.Hex())
+				}
+			}
+		}
+	})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"phynixdrive/services"
+	"phynixdrive/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +12,7 @@ import (
 
 type ShareController struct {
 	shareService *services.ShareService
+	auditService *services.AuditService
 	validator    *validator.Validate
 }
 
@@ -56,9 +58,25 @@ type SuccessResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-func NewShareController(shareService *services.ShareService) *ShareController {
+// normalizeRole rewrites a requested role to its canonical form (read -> viewer, write -> editor,
+// any casing) before validation, responding 400 when the role is unknown
+func (sc *ShareController) normalizeRole(c *gin.Context, role *string) bool {
+	normalized, err := utils.NormalizeRole(*role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_role",
+			Message: err.Error(),
+		})
+		return false
+	}
+	*role = normalized
+	return true
+}
+
+func NewShareController(shareService *services.ShareService, auditService *services.AuditService) *ShareController {
 	return &ShareController{
 		shareService: shareService,
+		auditService: auditService,
 		validator:    validator.New(),
 	}
 }
@@ -82,6 +100,10 @@ func (sc *ShareController) ShareResource(c *gin.Context) {
 		return
 	}
 
+	if !sc.normalizeRole(c, &request.Role) {
+		return
+	}
+
 	if err := sc.validator.Struct(request); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "validation_failed",
@@ -102,6 +124,8 @@ func (sc *ShareController) ShareResource(c *gin.Context) {
 			statusCode = http.StatusForbidden
 		} else if strings.Contains(err.Error(), "already shared") {
 			statusCode = http.StatusConflict
+		} else if strings.Contains(err.Error(), "expiry must be") {
+			statusCode = http.StatusBadRequest
 		}
 
 		c.JSON(statusCode, ErrorResponse{
@@ -111,6 +135,17 @@ func (sc *ShareController) ShareResource(c *gin.Context) {
 		return
 	}
 
+	recordActivity(c, sc.auditService, services.AuditActionShare, request.ResourceType, request.ResourceID,
+		map[string]string{"shared_with": request.Email, "role": request.Role})
+
+	if response.Action != services.ShareActionCreated {
+		c.JSON(http.StatusOK, SuccessResponse{
+			Message: "Share updated successfully",
+			Data:    response,
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, SuccessResponse{
 		Message: "Resource shared successfully",
 		Data:    response,
@@ -136,6 +171,10 @@ func (sc *ShareController) BulkShare(c *gin.Context) {
 		return
 	}
 
+	if !sc.normalizeRole(c, &request.Role) {
+		return
+	}
+
 	if err := sc.validator.Struct(request); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "validation_failed",
@@ -261,6 +300,34 @@ func (sc *ShareController) GetSharedWithMe(c *gin.Context) {
 	})
 }
 
+// GetEffectiveAccess lists direct shares plus everything inherited from shared folders
+func (sc *ShareController) GetEffectiveAccess(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	resources, err := sc.shareService.GetEffectiveAccess(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Effective access retrieved successfully",
+		Data: gin.H{
+			"resources": resources,
+			"total":     len(resources),
+		},
+	})
+}
+
 // GetAllSharedResources
 func (sc *ShareController) GetAllSharedResources(c *gin.Context) {
 	userID, exists := c.Get("userIdStr")
@@ -286,6 +353,59 @@ func (sc *ShareController) GetAllSharedResources(c *gin.Context) {
 	})
 }
 
+// ValidateShare reports whether a share would succeed without creating it
+func (sc *ShareController) ValidateShare(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	resourceID := c.Query("resource_id")
+	resourceType := c.Query("resource_type")
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
+
+	if resourceType != "file" && resourceType != "folder" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_resource_type",
+			Message: "Resource type must be 'file' or 'folder'",
+		})
+		return
+	}
+
+	if resourceID == "" || email == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: "resource_id and email are required",
+		})
+		return
+	}
+
+	if err := sc.validator.Var(email, "email"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "validation_failed",
+			Message: "Invalid email address",
+		})
+		return
+	}
+
+	result, err := sc.shareService.ValidateShare(c.Request.Context(), resourceID, resourceType, email, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Share validation completed",
+		Data:    result,
+	})
+}
+
 // GetResourcePermissions
 func (sc *ShareController) GetResourcePermissions(c *gin.Context) {
 	userID, exists := c.Get("userIdStr")
@@ -378,6 +498,46 @@ func (sc *ShareController) RevokePermission(c *gin.Context) {
 	})
 }
 
+// DeclineShare removes a share from the caller's own "shared with me"
+func (sc *ShareController) DeclineShare(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	shareID := c.Param("share_id")
+	if shareID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "missing_share_id",
+			Message: "Share ID is required",
+		})
+		return
+	}
+
+	err := sc.shareService.DeclineShare(c.Request.Context(), shareID, userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "invalid share ID") {
+			statusCode = http.StatusBadRequest
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "decline_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Share removed from your shared items",
+	})
+}
+
 // UpdatePermission
 func (sc *ShareController) UpdatePermission(c *gin.Context) {
 	userID, exists := c.Get("userIdStr")
@@ -406,6 +566,10 @@ func (sc *ShareController) UpdatePermission(c *gin.Context) {
 		return
 	}
 
+	if !sc.normalizeRole(c, &request.Role) {
+		return
+	}
+
 	if err := sc.validator.Struct(request); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "validation_failed",
@@ -460,3 +624,207 @@ func (sc *ShareController) GetShareDetails(c *gin.Context) {
 		Message: "GetShareDetails method needs to be implemented in ShareService",
 	})
 }
+
+// CreateShareLink handles POST /api/share/links
+func (sc *ShareController) CreateShareLink(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var request services.ShareLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if !sc.normalizeRole(c, &request.Role) {
+		return
+	}
+
+	if err := sc.validator.Struct(request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	link, err := sc.shareService.CreateShareLink(c.Request.Context(), request, userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "insufficient permissions") {
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "create_link_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse{
+		Message: "Share link created successfully",
+		Data:    link,
+	})
+}
+
+// RedeemShareLink handles POST /api/share/links/:token/redeem
+func (sc *ShareController) RedeemShareLink(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	response, err := sc.shareService.RedeemShareLink(c.Request.Context(), c.Param("token"), userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "expired") {
+			statusCode = http.StatusGone
+		} else if strings.Contains(err.Error(), "already have access") {
+			statusCode = http.StatusConflict
+		} else if strings.Contains(err.Error(), "insufficient permissions") {
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "redeem_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Share link redeemed successfully",
+		Data:    response,
+	})
+}
+
+// RevokeShareLink handles DELETE /api/share/links/:link_id
+func (sc *ShareController) RevokeShareLink(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	err := sc.shareService.RevokeShareLink(c.Request.Context(), c.Param("link_id"), userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "invalid") {
+			statusCode = http.StatusBadRequest
+		} else if strings.Contains(err.Error(), "insufficient permissions") {
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "revoke_link_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Share link revoked successfully",
+	})
+}
+
+// CreatePublicLink handles POST /api/share/public-links
+func (sc *ShareController) CreatePublicLink(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var request services.PublicLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := sc.validator.Struct(request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	link, err := sc.shareService.CreatePublicLink(c.Request.Context(), request, userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "insufficient permissions") {
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "create_public_link_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse{
+		Message: "Public link created successfully",
+		Data:    link,
+	})
+}
+
+// RevokePublicLink handles DELETE /api/share/public-links/:link_id
+func (sc *ShareController) RevokePublicLink(c *gin.Context) {
+	userID, exists := c.Get("userIdStr")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	err := sc.shareService.RevokePublicLink(c.Request.Context(), c.Param("link_id"), userID.(string))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			statusCode = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "invalid") {
+			statusCode = http.StatusBadRequest
+		} else if strings.Contains(err.Error(), "insufficient permissions") {
+			statusCode = http.StatusForbidden
+		}
+
+		c.JSON(statusCode, ErrorResponse{
+			Error:   "revoke_public_link_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Public link revoked successfully",
+	})
+}
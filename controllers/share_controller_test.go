@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedeemShareLinkRejectsAnonymousCaller(t *testing.T) {
+	// No auth middleware ran, so there is no user to grant the link's role to
+	controller := NewShareController(nil, nil)
+	router := gin.New()
+	router.POST("/share/links/:token/redeem", controller.RedeemShareLink)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/share/links/tok/redeem", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"phynixdrive/services"
 	"phynixdrive/utils"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,18 +13,14 @@ import (
 
 type TrashController struct {
 	trashService *services.TrashService
-}
-
-// RestoreItem represents an item to be restored (for service layer)
-type RestoreItem struct {
-	ID   string `json:"id"`
-	Type string `json:"type"`
+	auditService *services.AuditService
 }
 
 // RestoreItemRequest represents an item in the request with validation
 type RestoreItemRequest struct {
-	ID   string `json:"id" binding:"required"`
-	Type string `json:"type" binding:"required,oneof=file folder"`
+	ID                  string `json:"id" binding:"required"`
+	Type                string `json:"type" binding:"required,oneof=file folder"`
+	DestinationFolderID string `json:"destination_folder_id,omitempty"`
 }
 
 // RestoreMultipleRequest represents the request body for bulk restore
@@ -32,16 +29,18 @@ type RestoreMultipleRequest struct {
 }
 
 // ToRestoreItem converts a request item to a service item
-func (r RestoreItemRequest) ToRestoreItem() RestoreItem {
-	return RestoreItem{
-		ID:   r.ID,
-		Type: r.Type,
+func (r RestoreItemRequest) ToRestoreItem() services.RestoreItem {
+	return services.RestoreItem{
+		ID:                  r.ID,
+		Type:                r.Type,
+		DestinationFolderID: r.DestinationFolderID,
 	}
 }
 
-func NewTrashController(db *mongo.Database, b2Service *services.B2Service) *TrashController {
+func NewTrashController(db *mongo.Database, b2Service *services.B2Service, auditService *services.AuditService) *TrashController {
 	return &TrashController{
 		trashService: services.NewTrashService(db, b2Service),
+		auditService: auditService,
 	}
 }
 
@@ -55,19 +54,7 @@ func (tc *TrashController) GetTrashItems(c *gin.Context) {
 
 	// Optional filters
 	itemType := c.Query("type") // "file", "folder", or "" for all
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-
-	// Convert limit and offset to integers
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 0 {
-		limit = 50
-	}
-
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
-	}
+	limit, offset := utils.ParsePagination(c, utils.DefaultPageLimit)
 
 	trashItems, err := tc.trashService.GetTrashItems(userIdStr, itemType, limit, offset)
 	if err != nil {
@@ -82,6 +69,8 @@ func (tc *TrashController) GetTrashItems(c *gin.Context) {
 func (tc *TrashController) RestoreFromTrash(c *gin.Context) {
 	itemId := c.Param("id")
 	itemType := c.Query("type") // "file" or "folder"
+	// Optional: restore here ("root" for top level) instead of the original parent
+	targetFolderId := c.Query("target_folder_id")
 	userIdStr := c.GetString("userIdStr")
 
 	if userIdStr == "" {
@@ -101,19 +90,31 @@ func (tc *TrashController) RestoreFromTrash(c *gin.Context) {
 
 	switch itemType {
 	case "file":
-		err := tc.trashService.RestoreFile(itemId, userIdStr)
+		var err error
+		if targetFolderId != "" {
+			err = tc.trashService.RestoreFileTo(itemId, userIdStr, targetFolderId)
+		} else {
+			err = tc.trashService.RestoreFile(itemId, userIdStr)
+		}
 		if err != nil {
-			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+			utils.ErrorResponse(c, restoreErrorStatus(err), err.Error(), nil)
 			return
 		}
+		recordActivity(c, tc.auditService, services.AuditActionRestore, "file", itemId, restoreDetails(targetFolderId))
 		utils.SuccessResponse(c, "File restored successfully", nil)
 
 	case "folder":
-		err := tc.trashService.RestoreFolder(itemId, userIdStr)
+		var err error
+		if targetFolderId != "" {
+			err = tc.trashService.RestoreFolderTo(itemId, userIdStr, targetFolderId)
+		} else {
+			err = tc.trashService.RestoreFolder(itemId, userIdStr)
+		}
 		if err != nil {
-			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+			utils.ErrorResponse(c, restoreErrorStatus(err), err.Error(), nil)
 			return
 		}
+		recordActivity(c, tc.auditService, services.AuditActionRestore, "folder", itemId, restoreDetails(targetFolderId))
 		utils.SuccessResponse(c, "Folder restored successfully", nil)
 
 	default:
@@ -121,6 +122,31 @@ func (tc *TrashController) RestoreFromTrash(c *gin.Context) {
 	}
 }
 
+// restoreDetails notes where an item was restored to when it wasn't its original parent
+func restoreDetails(targetFolderID string) map[string]string {
+	if targetFolderID == "" {
+		return nil
+	}
+	return map[string]string{"target_folder_id": targetFolderID}
+}
+
+// restoreErrorStatus maps restore failures to a status code; anything unrecognised is a 500
+func restoreErrorStatus(err error) int {
+	errorStr := err.Error()
+	switch {
+	case strings.HasSuffix(errorStr, "already exists in destination"):
+		return http.StatusConflict
+	case errorStr == "cannot restore a folder into itself", strings.HasPrefix(errorStr, "invalid destination folder ID"):
+		return http.StatusBadRequest
+	case errorStr == "insufficient permissions", errorStr == "cannot restore folder into another user's folder":
+		return http.StatusForbidden
+	case errorStr == "destination folder not found":
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // PurgeFromTrash permanently deletes a single item from trash
 func (tc *TrashController) PurgeFromTrash(c *gin.Context) {
 	itemId := c.Param("id")
@@ -149,6 +175,7 @@ func (tc *TrashController) PurgeFromTrash(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 			return
 		}
+		recordActivity(c, tc.auditService, services.AuditActionPurge, "file", itemId, nil)
 		utils.SuccessResponse(c, "File permanently deleted", nil)
 
 	case "folder":
@@ -157,6 +184,7 @@ func (tc *TrashController) PurgeFromTrash(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 			return
 		}
+		recordActivity(c, tc.auditService, services.AuditActionPurge, "folder", itemId, nil)
 		utils.SuccessResponse(c, "Folder permanently deleted", nil)
 
 	default:
@@ -183,20 +211,61 @@ func (tc *TrashController) RestoreMultipleItems(c *gin.Context) {
 	}
 
 	// Convert request items (RestoreItemRequest) to service items (RestoreItem)
-	items := make([]RestoreItem, len(req.Items))
+	items := make([]services.RestoreItem, len(req.Items))
 	for i, itemReq := range req.Items {
 		items[i] = itemReq.ToRestoreItem()
 	}
 
-	results, err := tc.trashService.RestoreMultipleItems(userIdStr, nil)
+	results, err := tc.trashService.RestoreMultipleItems(userIdStr, items)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	for i, result := range results {
+		if result.Success {
+			recordActivity(c, tc.auditService, services.AuditActionRestore, result.Type, result.ID, restoreDetails(items[i].DestinationFolderID))
+		}
+	}
 
 	utils.SuccessResponse(c, "Bulk restore completed", results)
 }
 
+// RequestPurgeAll issues the confirmation token required by PurgeAllTrash
+func (tc *TrashController) RequestPurgeAll(c *gin.Context) {
+	userIdStr := c.GetString("userIdStr")
+	if userIdStr == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	token, expiresAt, err := tc.trashService.RequestPurgeConfirmation(userIdStr)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	utils.SuccessResponse(c, "Purge confirmation issued", map[string]interface{}{
+		"confirmation_token": token,
+		"expires_at":         expiresAt,
+	})
+}
+
+// consumePurgeToken validates the confirmation token sent with a purge-all request,
+// writing the error response and returning false if it is missing or invalid
+func (tc *TrashController) consumePurgeToken(c *gin.Context, userIdStr string) bool {
+	token := c.Query("confirmation_token")
+	if token == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Confirmation required: request a token from POST /trash/purge-all/request and pass it as ?confirmation_token=", nil)
+		return false
+	}
+
+	if err := tc.trashService.ConsumePurgeConfirmation(userIdStr, token); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+	return true
+}
+
 // PurgeAllTrash permanently deletes all items in trash
 func (tc *TrashController) PurgeAllTrash(c *gin.Context) {
 	userIdStr := c.GetString("userIdStr")
@@ -205,10 +274,7 @@ func (tc *TrashController) PurgeAllTrash(c *gin.Context) {
 		return
 	}
 
-	
-	confirm := c.Query("confirm")
-	if confirm != "true" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Confirmation required: add ?confirm=true to purge all items", nil)
+	if !tc.consumePurgeToken(c, userIdStr) {
 		return
 	}
 
@@ -217,6 +283,7 @@ func (tc *TrashController) PurgeAllTrash(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	tc.recordBulkPurge(c, userIdStr, "all", deletedCount)
 
 	response := map[string]interface{}{
 		"message":      "All trash items permanently deleted",
@@ -226,6 +293,43 @@ func (tc *TrashController) PurgeAllTrash(c *gin.Context) {
 	utils.SuccessResponse(c, "Trash purged successfully", response)
 }
 
+// GetTrashSummary reports what emptying the trash would remove and reclaim
+func (tc *TrashController) GetTrashSummary(c *gin.Context) {
+	userIdStr := c.GetString("userIdStr")
+	if userIdStr == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	summary, err := tc.trashService.GetTrashSummary(userIdStr)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	utils.SuccessResponse(c, "Trash summary retrieved", summary)
+}
+
+// PurgeExpired permanently deletes only the user's trash items past the retention period
+func (tc *TrashController) PurgeExpired(c *gin.Context) {
+	userIdStr := c.GetString("userIdStr")
+	if userIdStr == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	deletedCount, err := tc.trashService.PurgeExpiredForUser(userIdStr)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	tc.recordBulkPurge(c, userIdStr, "expired", deletedCount)
+
+	utils.SuccessResponse(c, "Expired trash items purged", map[string]interface{}{
+		"deletedCount": deletedCount,
+	})
+}
+
 // EmptyTrash empties the trash (alias for PurgeAllTrash)
 func (tc *TrashController) EmptyTrash(c *gin.Context) {
 	userIdStr := c.GetString("userIdStr")
@@ -234,10 +338,7 @@ func (tc *TrashController) EmptyTrash(c *gin.Context) {
 		return
 	}
 
-	// Optional confirmation parameter
-	confirm := c.Query("confirm")
-	if confirm != "true" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Confirmation required: add ?confirm=true to empty trash", nil)
+	if !tc.consumePurgeToken(c, userIdStr) {
 		return
 	}
 
@@ -246,6 +347,7 @@ func (tc *TrashController) EmptyTrash(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	tc.recordBulkPurge(c, userIdStr, "all", deletedCount)
 
 	response := map[string]interface{}{
 		"message":      "Trash emptied successfully",
@@ -254,3 +356,12 @@ func (tc *TrashController) EmptyTrash(c *gin.Context) {
 
 	utils.SuccessResponse(c, "Trash emptied successfully", response)
 }
+
+// recordBulkPurge logs a whole-trash purge against the user's trash, since the purged items
+// are gone and can no longer carry their own activity
+func (tc *TrashController) recordBulkPurge(c *gin.Context, userID, scope string, deletedCount int64) {
+	recordActivity(c, tc.auditService, services.AuditActionPurge, "trash", userID, map[string]string{
+		"scope":         scope,
+		"deleted_count": strconv.FormatInt(deletedCount, 10),
+	})
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPurgeAllRequiresIssuedConfirmationToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("token flow", func(mt *mtest.T) {
+		controller := NewTrashController(mt.DB, nil, nil)
+		userID := primitive.NewObjectID().Hex()
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("userIdStr", userID) })
+		router.POST("/trash/purge-all/request", controller.RequestPurgeAll)
+		router.DELETE("/trash/purge-all", controller.PurgeAllTrash)
+		serve := func(method, target string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+			return w
+		}
+
+		mt.ClearEvents()
+		if w := serve(http.MethodDelete, "/trash/purge-all"); w.Code != http.StatusBadRequest {
+			t.Fatalf("purge without token: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Fatalf("purge without token ran %d commands", n)
+		}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		w := serve(http.MethodPost, "/trash/purge-all/request")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request token: status = %d", w.Code)
+		}
+		var issued struct {
+			Data struct {
+				Token string `json:"confirmation_token"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil || issued.Data.Token == "" {
+			t.Fatalf("no token in %s", w.Body.String())
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: issued.Data.Token},
+				{Key: "user_id", Value: userID},
+				{Key: "expires_at", Value: time.Now().Add(time.Minute)},
+			}}),
+			// Nothing in trash: two ID lookups, then the two deletes and the commit
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(),
+		)
+		if w := serve(http.MethodDelete, "/trash/purge-all?confirmation_token="+issued.Data.Token); w.Code != http.StatusOK {
+			t.Fatalf("purge with token: status = %d, body %s", w.Code, w.Body.String())
+		}
+		redeemed := false
+		for _, evt := range mt.GetAllStartedEvents() {
+			if evt.CommandName == "findAndModify" && evt.Command.Lookup("query", "_id").StringValue() == issued.Data.Token {
+				redeemed = true
+			}
+		}
+		if !redeemed {
+			t.Fatal("purge did not redeem the issued token")
+		}
+
+		// The token is spent: replaying it finds nothing
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		if w := serve(http.MethodDelete, "/trash/purge-all?confirmation_token="+issued.Data.Token); w.Code != http.StatusBadRequest {
+			t.Fatalf("replayed token: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
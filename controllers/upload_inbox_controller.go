@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadInboxController manages upload inboxes and accepts anonymous uploads into them
+type UploadInboxController struct {
+	inboxService *services.UploadInboxService
+}
+
+func NewUploadInboxController(inboxService *services.UploadInboxService) *UploadInboxController {
+	return &UploadInboxController{inboxService: inboxService}
+}
+
+// CreateInbox handles POST /folders/:id/inbox
+func (ic *UploadInboxController) CreateInbox(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var request services.UploadInboxRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			utils.BadRequestResponse(c, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	inbox, err := ic.inboxService.CreateInbox(c.Request.Context(), c.Param("id"), userID, request)
+	if err != nil {
+		ic.handleError(c, err, "Failed to create upload inbox")
+		return
+	}
+
+	utils.CreatedResponse(c, "Upload inbox created", inbox)
+}
+
+// DisableInbox handles DELETE /folders/:id/inbox
+func (ic *UploadInboxController) DisableInbox(c *gin.Context) {
+	userID := c.GetString("userIdStr")
+	if userID == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	if err := ic.inboxService.DisableInbox(c.Request.Context(), c.Param("id"), userID); err != nil {
+		ic.handleError(c, err, "Failed to disable upload inbox")
+		return
+	}
+
+	utils.SuccessResponse(c, "Upload inbox disabled", nil)
+}
+
+// inboxFormOverhead leaves room for the multipart boundaries and part headers around the file
+const inboxFormOverhead = 1024 * 1024
+
+// Upload handles POST /public/:token/upload. No JWT is required; the token only allows uploading.
+func (ic *UploadInboxController) Upload(c *gin.Context) {
+	maxSize, err := ic.inboxService.MaxUploadSize(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		ic.handleError(c, err, "Failed to upload file")
+		return
+	}
+
+	// Cap the body before parsing it; an oversized upload must not be spooled to disk first
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+inboxFormOverhead)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.PayloadTooLargeResponse(c, fmt.Sprintf("file too large: limit is %d bytes", maxSize))
+			return
+		}
+		utils.BadRequestResponse(c, "A file is required", nil)
+		return
+	}
+
+	result, err := ic.inboxService.Upload(c.Request.Context(), c.Param("token"), fileHeader)
+	if err != nil {
+		ic.handleError(c, err, "Failed to upload file")
+		return
+	}
+
+	utils.CreatedResponse(c, "File uploaded", result)
+}
+
+func (ic *UploadInboxController) handleError(c *gin.Context, err error, defaultMessage string) {
+	if writeQuotaError(c, err) {
+		return
+	}
+
+	msg := err.Error()
+	switch {
+	case msg == "insufficient permissions":
+		utils.ForbiddenResponse(c, "Insufficient permissions")
+	case strings.Contains(msg, "not found"):
+		utils.NotFoundResponse(c, strings.ToUpper(msg[:1])+msg[1:])
+	case strings.Contains(msg, "expired"), strings.Contains(msg, "limit reached"):
+		utils.ErrorResponse(c, http.StatusGone, "Upload inbox is no longer accepting files", nil)
+	case strings.HasPrefix(msg, "file too large"):
+		utils.PayloadTooLargeResponse(c, msg)
+	case strings.HasPrefix(msg, "file count limit exceeded"):
+		utils.ErrorResponse(c, http.StatusInsufficientStorage, "Folder owner has reached their file limit", nil)
+	case strings.HasPrefix(msg, "invalid"), strings.HasPrefix(msg, "filename"),
+		msg == "expiry must be in the future":
+		utils.BadRequestResponse(c, msg, nil)
+	case strings.HasPrefix(msg, "file type not allowed"), strings.HasPrefix(msg, "file content does not match"):
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, msg, nil)
+	default:
+		utils.InternalServerErrorResponse(c, defaultMessage, nil)
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"phynixdrive/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func multipartFile(t *testing.T, name string, size int) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("a"), size))
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+func TestInboxUploadRejectsOversizedBodyBeforeParsing(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("oversized", func(mt *mtest.T) {
+		controller := NewUploadInboxController(services.NewUploadInboxService(mt.DB, nil, nil, nil))
+		router := gin.New()
+		router.POST("/public/:token/upload", controller.Upload)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.upload_inboxes", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "token", Value: "tok"},
+			{Key: "max_file_size", Value: int64(1024)},
+			{Key: "max_files", Value: 10},
+			{Key: "is_active", Value: true},
+		}))
+
+		body, contentType := multipartFile(t, "big.txt", 1024+inboxFormOverhead+1)
+		req := httptest.NewRequest(http.MethodPost, "/public/tok/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body.String())
+		}
+		// Only the inbox lookup ran; no upload slot was reserved
+		for _, evt := range mt.GetAllStartedEvents() {
+			if evt.CommandName != "find" {
+				t.Fatalf("unexpected %s command", evt.CommandName)
+			}
+		}
+	})
+}
+
+func TestInboxUploadUnknownTokenIsNotParsed(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("unknown", func(mt *mtest.T) {
+		controller := NewUploadInboxController(services.NewUploadInboxService(mt.DB, nil, nil, nil))
+		router := gin.New()
+		router.POST("/public/:token/upload", controller.Upload)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.upload_inboxes", mtest.FirstBatch))
+
+		body, contentType := multipartFile(t, "a.txt", 10)
+		req := httptest.NewRequest(http.MethodPost, "/public/nope/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
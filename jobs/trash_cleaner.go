@@ -14,11 +14,13 @@ import (
 )
 
 type TrashCleaner struct {
-	db            *mongo.Database
-	b2Service     *services.B2Service
-	fileService   *services.FileService
-	folderService *services.FolderService
-	logger        *log.Logger
+	db                *mongo.Database
+	b2Service         *services.B2Service
+	fileService       *services.FileService
+	folderService     *services.FolderService
+	permissionService *services.PermissionService
+	retentionDays     int
+	logger            *log.Logger
 }
 
 func NewTrashCleaner() *TrashCleaner {
@@ -31,17 +33,22 @@ func NewTrashCleaner() *TrashCleaner {
 	if err != nil {
 		log.Fatalf("Failed to initialize B2Service: %v", err)
 	}
+	b2Service.SetObjectNaming(cfg.B2ObjectPrefix, cfg.B2ObjectNameScheme)
+	b2Service.SetBucketPublic(cfg.B2BucketPublic)
+	b2Service.SetURLExpiryMargin(cfg.SignedURLExpiryMargin)
 
 	permissionService := services.NewPermissionService(db)
 	folderService := services.NewFolderService(db, permissionService, b2Service)
 	fileService := services.NewFileService(db, folderService, b2Service, permissionService)
 
 	return &TrashCleaner{
-		db:            db,
-		b2Service:     b2Service,
-		fileService:   fileService,
-		folderService: folderService,
-		logger:        log.New(log.Writer(), "[TRASH_CLEANER] ", log.LstdFlags),
+		db:                db,
+		b2Service:         b2Service,
+		fileService:       fileService,
+		folderService:     folderService,
+		permissionService: permissionService,
+		retentionDays:     services.TrashRetentionDays(),
+		logger:            log.New(log.Writer(), "[TRASH_CLEANER] ", log.LstdFlags),
 	}
 }
 
@@ -68,8 +75,8 @@ func (tc *TrashCleaner) runCleanup() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
-	// Calculate cutoff date (30 days ago)
-	cutoffDate := time.Now().AddDate(0, 0, -30)
+	// Items deleted before the cutoff have outlived the retention period
+	cutoffDate := time.Now().AddDate(0, 0, -tc.retentionDays)
 
 	// Clean up files
 	filesDeleted, err := tc.cleanupFiles(ctx, cutoffDate)
@@ -95,7 +102,7 @@ func (tc *TrashCleaner) cleanupFiles(ctx context.Context, cutoffDate time.Time)
 
 	// Find files deleted before cutoff date
 	filter := bson.M{
-		"deletedAt": bson.M{
+		"deleted_at": bson.M{
 			"$ne":  nil,
 			"$lte": cutoffDate,
 		},
@@ -123,15 +130,17 @@ func (tc *TrashCleaner) cleanupFiles(ctx context.Context, cutoffDate time.Time)
 	// Delete files from B2 and MongoDB
 	for _, file := range filesToDelete {
 		// Delete from Backblaze B2
-		if err := tc.b2Service.DeleteFile(file.B2FileID); err != nil {
-			tc.logger.Printf("Failed to delete file from B2: %s, error: %v", file.B2FileID, err)
-			continue
-		}
+		if tc.b2Service != nil {
+			if err := tc.b2Service.DeleteFile(file.B2FileID); err != nil {
+				tc.logger.Printf("Failed to delete file from B2: %s, error: %v", file.B2FileID, err)
+				continue
+			}
 
-		// Delete all versions from B2
-		for _, version := range file.Versions {
-			if err := tc.b2Service.DeleteFile(version.B2FileID); err != nil {
-				tc.logger.Printf("Failed to delete file version from B2: %s, error: %v", version.B2FileID, err)
+			// Delete all versions from B2
+			for _, version := range file.Versions {
+				if err := tc.b2Service.DeleteFile(version.B2FileID); err != nil {
+					tc.logger.Printf("Failed to delete file version from B2: %s, error: %v", version.B2FileID, err)
+				}
 			}
 		}
 
@@ -142,12 +151,11 @@ func (tc *TrashCleaner) cleanupFiles(ctx context.Context, cutoffDate time.Time)
 			continue
 		}
 
-		// Update user storage usage
-		err = tc.updateUserStorage(ctx, file.OwnerID.Hex(), -file.Size)
-		if err != nil {
-			tc.logger.Printf("Failed to update user storage for file deletion: %v", err)
+		if err := tc.permissionService.DeleteResourcePermissions(ctx, []string{file.ID.Hex()}); err != nil {
+			tc.logger.Printf("Failed to delete permissions for file %s: %v", file.ID.Hex(), err)
 		}
 
+		// Storage was already released when the file was moved to trash
 		deletedCount++
 		tc.logger.Printf("Permanently deleted file: %s (%s)", file.Name, file.ID.Hex())
 	}
@@ -160,7 +168,7 @@ func (tc *TrashCleaner) cleanupFolders(ctx context.Context, cutoffDate time.Time
 
 	// Find folders deleted before cutoff date
 	filter := bson.M{
-		"deletedAt": bson.M{
+		"deleted_at": bson.M{
 			"$ne":  nil,
 			"$lte": cutoffDate,
 		},
@@ -188,21 +196,13 @@ func (tc *TrashCleaner) cleanupFolders(ctx context.Context, cutoffDate time.Time
 			continue
 		}
 
+		if err := tc.permissionService.DeleteResourcePermissions(ctx, []string{folder.ID.Hex()}); err != nil {
+			tc.logger.Printf("Failed to delete permissions for folder %s: %v", folder.ID.Hex(), err)
+		}
+
 		deletedCount++
 		tc.logger.Printf("Permanently deleted folder: %s (%s)", folder.Name, folder.ID.Hex())
 	}
 
 	return deletedCount, nil
 }
-
-func (tc *TrashCleaner) updateUserStorage(ctx context.Context, userID string, sizeChange int64) error {
-	usersCollection := tc.db.Collection("users")
-
-	filter := bson.M{"_id": userID}
-	update := bson.M{
-		"$inc": bson.M{"usedStorage": sizeChange},
-	}
-
-	_, err := usersCollection.UpdateOne(ctx, filter, update)
-	return err
-}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"phynixdrive/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCleanerPurgesFileTrashedPastRetention(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("expired", func(mt *mtest.T) {
+		permissionService := services.NewPermissionService(mt.DB)
+		fileService := services.NewFileService(mt.DB, nil, nil, nil)
+		cleaner := &TrashCleaner{
+			db:                mt.DB,
+			permissionService: permissionService,
+			retentionDays:     30,
+			logger:            log.New(io.Discard, "", 0),
+		}
+		mt.ClearEvents()
+
+		fileID, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+		file := bson.D{
+			{Key: "_id", Value: fileID},
+			{Key: "owner_id", Value: ownerID},
+			{Key: "name", Value: "old.txt"},
+			{Key: "size", Value: int64(10)},
+		}
+
+		// Trashing the file releases its storage
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: file}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+		if err := fileService.DeleteFile(fileID.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		deletedAt := time.Now().AddDate(0, 0, -31)
+		trashed := append(file, bson.E{Key: "is_deleted", Value: true}, bson.E{Key: "deleted_at", Value: deletedAt})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch, trashed),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // file
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // permissions
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // shares
+		)
+		count, err := cleaner.cleanupFiles(mt.Context(), time.Now().AddDate(0, 0, -cleaner.retentionDays))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("purged %d files, want 1", count)
+		}
+
+		var find bson.Raw
+		var deletes []bson.Raw
+		var storage []int64
+		for _, evt := range mt.GetAllStartedEvents() {
+			switch evt.CommandName {
+			case "find":
+				find = evt.Command
+			case "delete":
+				deletes = append(deletes, evt.Command)
+			case "update":
+				if evt.Command.Lookup("update").StringValue() == "users" {
+					storage = append(storage, evt.Command.Lookup("updates", "0", "u", "$inc", "used_storage").AsInt64())
+				}
+			}
+		}
+
+		// The cutoff must select a file trashed 31 days ago under a 30 day retention
+		cutoff := find.Lookup("filter", "deleted_at", "$lte").Time()
+		if find.Lookup("filter", "deleted_at", "$ne").Type != bson.TypeNull || !deletedAt.Before(cutoff) {
+			t.Fatalf("filter %v does not select the expired file", find.Lookup("filter"))
+		}
+		if len(deletes) == 0 || deletes[0].Lookup("delete").StringValue() != "files" ||
+			deletes[0].Lookup("deletes", "0", "q", "_id").ObjectID() != fileID {
+			t.Fatal("the expired file was not deleted")
+		}
+		// Storage is decremented once, when trashed; purging must not release it again
+		if len(storage) != 1 || storage[0] != -10 {
+			t.Fatalf("storage changes = %v, want a single -10", storage)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"phynixdrive/services"
 	"phynixdrive/utils"
 	"strings"
 
@@ -9,6 +10,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var tokenRevocation *services.TokenRevocationService
+
+// SetTokenRevocationService makes AuthMiddleware reject revoked tokens. Without it only
+// the signature and expiry are checked.
+func SetTokenRevocationService(service *services.TokenRevocationService) {
+	tokenRevocation = service
+}
+
 func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := extractBearerToken(c)
@@ -25,6 +34,20 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		return
 	}
 
+		if tokenRevocation != nil {
+			revoked, err := tokenRevocation.IsRevoked(c.Request.Context(), claims)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to verify token", nil)
+				c.Abort()
+				return
+			}
+			if revoked {
+				utils.ErrorResponse(c, http.StatusUnauthorized, "Token has been revoked", nil)
+				c.Abort()
+				return
+			}
+		}
+
 	userID, err := primitive.ObjectIDFromHex(claims.UserID)
 		if err != nil {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token", nil)
@@ -38,6 +61,13 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		c.Set("name", claims.Name)
 		c.Set("googleId", claims.GoogleID)
 		c.Set("role", claims.Role)
+		c.Set("claims", claims)
+
+		// Impersonated sessions are flagged on every response so clients and logs can tell
+		if claims.ImpersonatedBy != "" {
+			c.Set("impersonatedBy", claims.ImpersonatedBy)
+			c.Header("X-Impersonated-By", claims.ImpersonatedBy)
+		}
 
 		c.Next()
 	}
@@ -76,3 +106,48 @@ func RequireRole(requiredRole string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AuthUnlessAccessToken applies AuthMiddleware, or FileAccessMiddleware for action when the
+// request carries a scoped file access token header
+func AuthUnlessAccessToken(jwtSecret, action string) gin.HandlerFunc {
+	auth := AuthMiddleware(jwtSecret)
+	fileAccess := FileAccessMiddleware(jwtSecret, action)
+	return func(c *gin.Context) {
+		if c.GetHeader(utils.FileAccessTokenHeader) != "" {
+			fileAccess(c)
+			return
+		}
+		auth(c)
+	}
+}
+
+// FileAccessMiddleware admits only requests whose file access token was issued for the :id
+// file and action. The token's user becomes the request's user, as AuthMiddleware would set it.
+func FileAccessMiddleware(jwtSecret, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(utils.FileAccessTokenHeader)
+		if token == "" {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Access token required", nil)
+			c.Abort()
+			return
+		}
+
+		claims, err := utils.VerifyFileAccessToken(token, jwtSecret, c.Param("id"), action)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid or expired access token", nil)
+			c.Abort()
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(claims.UserID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token", nil)
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", userID)
+		c.Set("userIdStr", claims.UserID)
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"phynixdrive/models"
+	"phynixdrive/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFileAccessMiddlewareRequiresWriteTokenForFile(t *testing.T) {
+	const secret = "test-secret"
+	userID, fileID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+
+	router := gin.New()
+	router.PUT("/files/:id/content", FileAccessMiddleware(secret, utils.FileActionWrite), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userIdStr"))
+	})
+
+	token := func(file, action string) string {
+		t.Helper()
+		tok, _, err := utils.GenerateFileAccessToken(userID, file, action, secret, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"read token", token(fileID, utils.FileActionRead), http.StatusUnauthorized},
+		{"other file", token(primitive.NewObjectID().Hex(), utils.FileActionWrite), http.StatusUnauthorized},
+		{"write token", token(fileID, utils.FileActionWrite), http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/files/"+fileID+"/content", nil)
+		if tt.token != "" {
+			req.Header.Set(utils.FileAccessTokenHeader, tt.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && w.Body.String() != userID {
+			t.Errorf("%s: handler saw user %q, want %q", tt.name, w.Body.String(), userID)
+		}
+	}
+}
+
+func TestAuthMiddlewareActsAsImpersonatedUser(t *testing.T) {
+	const secret = "test-secret"
+	adminID := primitive.NewObjectID().Hex()
+	target := &models.User{ID: primitive.NewObjectID(), Email: "user@example.com", Role: "user"}
+
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(secret), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userIdStr")+" "+c.GetString("impersonatedBy"))
+	})
+
+	token, _, err := utils.GenerateImpersonationToken(target, adminID, secret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if want := target.ID.Hex() + " " + adminID; w.Body.String() != want {
+		t.Fatalf("handler saw %q, want %q", w.Body.String(), want)
+	}
+	if got := w.Header().Get("X-Impersonated-By"); got != adminID {
+		t.Fatalf("X-Impersonated-By = %q, want %q", got, adminID)
+	}
+}
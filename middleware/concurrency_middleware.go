@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"phynixdrive/utils"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// concurrencyLimiter counts in-flight requests per user
+type concurrencyLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	max      int
+}
+
+func (l *concurrencyLimiter) acquire(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[userID] >= l.max {
+		return false
+	}
+	l.inFlight[userID]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[userID] <= 1 {
+		delete(l.inFlight, userID)
+		return
+	}
+	l.inFlight[userID]--
+}
+
+// UploadConcurrencyMiddleware caps how many uploads one user may have in flight at once,
+// answering 429 beyond maxPerUser so a single client can't saturate B2 throughput or memory.
+// It must run after AuthMiddleware. A non-positive limit disables it.
+func UploadConcurrencyMiddleware(maxPerUser int) gin.HandlerFunc {
+	return perUserConcurrencyLimit(maxPerUser, "Too many uploads in progress, please wait for one to finish")
+}
+
+// DownloadConcurrencyMiddleware caps concurrent folder ZIP downloads per user the same way,
+// since each one streams the whole subtree out of B2
+func DownloadConcurrencyMiddleware(maxPerUser int) gin.HandlerFunc {
+	return perUserConcurrencyLimit(maxPerUser, "Too many folder downloads in progress, please wait for one to finish")
+}
+
+func perUserConcurrencyLimit(maxPerUser int, message string) gin.HandlerFunc {
+	limiter := &concurrencyLimiter{inFlight: make(map[string]int), max: maxPerUser}
+
+	return func(c *gin.Context) {
+		userID := c.GetString("userIdStr")
+		if maxPerUser <= 0 || userID == "" {
+			c.Next()
+			return
+		}
+
+		if !limiter.acquire(userID) {
+			c.Header("Retry-After", "5")
+			utils.ErrorResponse(c, http.StatusTooManyRequests, message, nil)
+			c.Abort()
+			return
+		}
+		defer limiter.release(userID)
+
+		c.Next()
+	}
+}
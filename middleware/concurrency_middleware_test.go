@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadConcurrencyThrottlesPerUser(t *testing.T) {
+	const limit = 2
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.POST("/upload", func(c *gin.Context) {
+		c.Set("userIdStr", c.GetHeader("X-User"))
+		c.Next()
+	}, UploadConcurrencyMiddleware(limit), func(c *gin.Context) {
+		if c.GetHeader("X-Hold") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+
+	upload := func(user string, hold bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		req.Header.Set("X-User", user)
+		if hold {
+			req.Header.Set("X-Hold", "1")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Fill the user's slots with uploads that stay in flight
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := upload("alice", true); w.Code != http.StatusOK {
+				t.Errorf("in-flight upload: status = %d", w.Code)
+			}
+		}()
+		<-entered
+	}
+
+	w := upload("alice", false)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("upload %d: status = %d, want %d", limit+1, w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+	if w := upload("bob", false); w.Code != http.StatusOK {
+		t.Fatalf("other user: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// Finished uploads give their slots back
+	if w := upload("alice", false); w.Code != http.StatusOK {
+		t.Fatalf("after release: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestDownloadConcurrencyThrottlesSecondExport(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.GET("/download", func(c *gin.Context) {
+		c.Set("userIdStr", "alice")
+		c.Next()
+	}, DownloadConcurrencyMiddleware(1), func(c *gin.Context) {
+		if c.Query("hold") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download?hold=1", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second export: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("first export: status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"phynixdrive/config"
+	"phynixdrive/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature hides a route behind a feature flag. Disabled features answer 404 so
+// clients cannot tell an unreleased endpoint from one that does not exist. Place it after
+// AuthMiddleware for per-user flags to apply.
+func RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.FeatureEnabled(name, c.GetString("userIdStr")) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Not found", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"phynixdrive/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireFeatureHidesDisabledEndpoints(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userIdStr", c.GetHeader("X-User")) })
+	router.POST("/uploads", RequireFeature(config.FeatureChunkedUpload), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	serve := func(user string) int {
+		req := httptest.NewRequest(http.MethodPost, "/uploads", nil)
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name  string
+		flags map[string]config.FeatureFlag
+		user  string
+		want  int
+	}{
+		{"disabled", map[string]config.FeatureFlag{}, "u1", http.StatusNotFound},
+		{"enabled", map[string]config.FeatureFlag{config.FeatureChunkedUpload: {Enabled: true}}, "u1", http.StatusOK},
+		{"enabled for this user", map[string]config.FeatureFlag{config.FeatureChunkedUpload: {Users: map[string]bool{"u1": true}}}, "u1", http.StatusOK},
+		{"enabled for another user", map[string]config.FeatureFlag{config.FeatureChunkedUpload: {Users: map[string]bool{"u2": true}}}, "u1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		config.AppConfig = &config.Config{FeatureFlags: tt.flags}
+		if got := serve(tt.user); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
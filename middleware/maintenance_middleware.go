@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"phynixdrive/services"
+	"phynixdrive/utils"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	maintenanceService *services.MaintenanceService
+	// maintenanceMode is only used when no service is set, e.g. in tests
+	maintenanceMode atomic.Bool
+)
+
+// SetMaintenanceService stores maintenance mode in the database, so a toggle on any instance
+// reaches all of them within a few seconds. Without it the flag is local to this process.
+func SetMaintenanceService(service *services.MaintenanceService) {
+	maintenanceService = service
+}
+
+// SetMaintenanceMode turns maintenance mode on or off, recording actorID as the one who did
+func SetMaintenanceMode(ctx context.Context, enabled bool, actorID string) error {
+	if maintenanceService != nil {
+		return maintenanceService.SetEnabled(ctx, enabled, actorID)
+	}
+	maintenanceMode.Store(enabled)
+	return nil
+}
+
+// IsMaintenanceMode reports whether mutating requests are currently rejected
+func IsMaintenanceMode(ctx context.Context) bool {
+	if maintenanceService != nil {
+		return maintenanceService.IsEnabled(ctx)
+	}
+	return maintenanceMode.Load()
+}
+
+// MaintenanceMiddleware rejects mutating requests with 503 while maintenance mode is on.
+// Reads keep working. exemptRoutes lets individual routes through (admin toggle, sign-in),
+// each given as "METHOD /full/route/pattern" exactly as registered, as for TimeoutMiddleware.
+func MaintenanceMiddleware(retryAfter time.Duration, exemptRoutes ...string) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(exemptRoutes))
+	for _, route := range exemptRoutes {
+		exempt[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if !IsMaintenanceMode(c.Request.Context()) {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if exempt[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Service is in maintenance mode, please try again later", nil)
+		c.Abort()
+	}
+}
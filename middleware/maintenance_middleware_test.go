@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaintenanceMiddlewareExemptsExactRoutesOnly(t *testing.T) {
+	SetMaintenanceMode(context.Background(), true, "")
+	t.Cleanup(func() { SetMaintenanceMode(context.Background(), false, "") })
+
+	router := gin.New()
+	router.Use(MaintenanceMiddleware(time.Minute, "PUT /api/admin/maintenance"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.PUT("/api/admin/maintenance", ok)
+	router.POST("/api/admin/maintenance", ok)
+	router.PUT("/api/files/:id/api/admin/maintenance", ok)
+	router.GET("/api/files/:id", ok)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPut, "/api/admin/maintenance", http.StatusOK},
+		{http.MethodGet, "/api/files/abc", http.StatusOK},
+		// Neither another method nor a path merely containing the exempt one gets through
+		{http.MethodPost, "/api/admin/maintenance", http.StatusServiceUnavailable},
+		{http.MethodPut, "/api/files/abc/api/admin/maintenance", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceMiddlewareBlocksUploadsAndAllowsDownloads(t *testing.T) {
+	router := gin.New()
+	router.Use(MaintenanceMiddleware(2 * time.Minute))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/files/upload", ok)
+	router.GET("/api/files/:id/download", ok)
+
+	upload := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/files/upload", nil))
+		return w
+	}
+
+	if w := upload(); w.Code != http.StatusOK {
+		t.Fatalf("upload outside maintenance: status = %d", w.Code)
+	}
+
+	SetMaintenanceMode(context.Background(), true, "")
+	t.Cleanup(func() { SetMaintenanceMode(context.Background(), false, "") })
+
+	w := upload()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("upload in maintenance: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("Retry-After") != "120" {
+		t.Fatalf("Retry-After = %q, want 120", w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/files/abc/download", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("download in maintenance: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
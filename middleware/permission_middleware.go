@@ -4,14 +4,17 @@ import (
 	"net/http"
 	"phynixdrive/services"
 	"phynixdrive/utils"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func PermissionMiddleware(requiredRole string) gin.HandlerFunc {
+// PermissionMiddleware requires requiredRole on the resource in the route. Like the file and
+// folder variants it shares the service it is given instead of building one per request,
+// and expects AuthMiddleware to have run first.
+func PermissionMiddleware(permissionService *services.PermissionService, requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetString("userID")
+		userID := c.GetString("userIdStr")
 		if userID == "" {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 			c.Abort()
@@ -33,24 +36,10 @@ func PermissionMiddleware(requiredRole string) gin.HandlerFunc {
 			return
 		}
 
-		db, ok := c.MustGet("db").(*mongo.Database)
-		if !ok {
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
-			c.Abort()
-			return
-		}
-
-		permissionService := services.NewPermissionService(db)
-
 		// Use the enhanced method that auto-detects resource type
 		hasPermission, err := permissionService.HasResourcePermission(c.Request.Context(), userID, resourceID, requiredRole)
 		if err != nil {
-			if err.Error() == "resource not found" {
-				utils.ErrorResponse(c, http.StatusNotFound, "Resource not found", nil)
-			} else {
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Permission check failed", err.Error())
-			}
-			c.Abort()
+			abortPermissionError(c, err, "resource not found", "Resource not found")
 			return
 		}
 
@@ -65,9 +54,9 @@ func PermissionMiddleware(requiredRole string) gin.HandlerFunc {
 }
 
 // Specific middleware for file operations
-func FilePermissionMiddleware(requiredRole string) gin.HandlerFunc {
+func FilePermissionMiddleware(permissionService *services.PermissionService, requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetString("userID")
+		userID := c.GetString("userIdStr")
 		if userID == "" {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 			c.Abort()
@@ -85,22 +74,9 @@ func FilePermissionMiddleware(requiredRole string) gin.HandlerFunc {
 			return
 		}
 
-		db, ok := c.MustGet("db").(*mongo.Database)
-		if !ok {
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
-			c.Abort()
-			return
-		}
-
-		permissionService := services.NewPermissionService(db)
 		hasPermission, err := permissionService.HasFilePermission(c.Request.Context(), userID, fileID, requiredRole)
 		if err != nil {
-			if err.Error() == "file not found" {
-				utils.ErrorResponse(c, http.StatusNotFound, "File not found", nil)
-			} else {
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Permission check failed", err.Error())
-			}
-			c.Abort()
+			abortPermissionError(c, err, "file not found", "File not found")
 			return
 		}
 
@@ -114,9 +90,9 @@ func FilePermissionMiddleware(requiredRole string) gin.HandlerFunc {
 	}
 }
 
-func FolderPermissionMiddleware(requiredRole string) gin.HandlerFunc {
+func FolderPermissionMiddleware(permissionService *services.PermissionService, requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetString("userID")
+		userID := c.GetString("userIdStr")
 		if userID == "" {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated", nil)
 			c.Abort()
@@ -134,22 +110,9 @@ func FolderPermissionMiddleware(requiredRole string) gin.HandlerFunc {
 			return
 		}
 
-		db, ok := c.MustGet("db").(*mongo.Database)
-		if !ok {
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
-			c.Abort()
-			return
-		}
-
-		permissionService := services.NewPermissionService(db)
 		hasPermission, err := permissionService.HasFolderPermission(c.Request.Context(), userID, folderID, requiredRole)
 		if err != nil {
-			if err.Error() == "folder not found" {
-				utils.ErrorResponse(c, http.StatusNotFound, "Folder not found", nil)
-			} else {
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Permission check failed", err.Error())
-			}
-			c.Abort()
+			abortPermissionError(c, err, "folder not found", "Folder not found")
 			return
 		}
 
@@ -161,5 +124,18 @@ func FolderPermissionMiddleware(requiredRole string) gin.HandlerFunc {
 
 		c.Next()
 	}
+}
 
+// abortPermissionError answers a failed permission lookup: notFoundErr becomes a 404, a
+// malformed ID a 400, and anything else a 500
+func abortPermissionError(c *gin.Context, err error, notFoundErr, notFoundMessage string) {
+	switch {
+	case err.Error() == notFoundErr:
+		utils.ErrorResponse(c, http.StatusNotFound, notFoundMessage, nil)
+	case strings.HasPrefix(err.Error(), "invalid "):
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Permission check failed", err.Error())
+	}
+	c.Abort()
 }
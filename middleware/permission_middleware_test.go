@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"phynixdrive/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFolderPermissionMiddlewareUsesInjectedService(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("injected", func(mt *mtest.T) {
+		ownerID, folderID := primitive.NewObjectID(), primitive.NewObjectID()
+		permissionService := services.NewPermissionService(mt.DB)
+
+		router := gin.New()
+		router.GET("/folders/:id/files", func(c *gin.Context) {
+			c.Set("userIdStr", ownerID.Hex())
+		}, FolderPermissionMiddleware(permissionService, "viewer"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		// Only the injected service's deployment can answer the lookup
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: folderID},
+			{Key: "owner_id", Value: ownerID},
+		}))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/folders/"+folderID.Hex()+"/files", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		var finds int
+		for _, evt := range mt.GetAllStartedEvents() {
+			if evt.CommandName == "find" {
+				finds++
+			}
+		}
+		if finds != 1 {
+			t.Fatalf("injected service ran %d finds, want 1", finds)
+		}
+	})
+}
+
+func TestPermissionMiddlewareRejectsMalformedAndMissingResources(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("errors", func(mt *mtest.T) {
+		router := gin.New()
+		router.POST("/files/:id/star", func(c *gin.Context) {
+			c.Set("userIdStr", primitive.NewObjectID().Hex())
+		}, PermissionMiddleware(services.NewPermissionService(mt.DB), "viewer"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/files/not-an-id/star", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("malformed ID: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+
+		// Neither a file nor a folder has the ID
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch),
+		)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/files/"+primitive.NewObjectID().Hex()+"/star", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("missing resource: status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"phynixdrive/utils"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenBucket holds the tokens left for one client and when they were last topped up
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client: each request takes a token, and tokens
+// refill at rps up to burst
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	rps       float64
+	burst     float64
+	lastSweep time.Time
+}
+
+// allow takes a token for key, or reports how long until one is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / l.rps * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, since they behave like new ones
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(l.burst / l.rps * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit allows each client rps requests per second with bursts of up to burst,
+// answering 429 with Retry-After beyond that. Clients are keyed by user when
+// AuthMiddleware has already run and by IP otherwise. A non-positive rps disables it.
+func RateLimit(rps, burst int) gin.HandlerFunc {
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := &rateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		rps:       float64(rps),
+		burst:     float64(burst),
+		lastSweep: time.Now(),
+	}
+
+	return func(c *gin.Context) {
+		if rps <= 0 {
+			c.Next()
+			return
+		}
+
+		key := "ip:" + c.ClientIP()
+		if userID := c.GetString("userIdStr"); userID != "" {
+			key = "user:" + userID
+		}
+
+		allowed, wait := limiter.allow(key, time.Now())
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			utils.ErrorResponse(c, http.StatusTooManyRequests, "Too many requests, please slow down", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
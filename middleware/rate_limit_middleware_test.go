@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(rps, burst int) *gin.Engine {
+	router := gin.New()
+	router.GET("/limited", RateLimit(rps, burst), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func requestFrom(router *gin.Engine, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitRejectsRequestAfterBurst(t *testing.T) {
+	const burst = 3
+	router := newRateLimitedRouter(1, burst)
+
+	for i := 1; i <= burst; i++ {
+		if w := requestFrom(router, "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+
+	w := requestFrom(router, "192.0.2.1:1234", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request %d: status = %d, want %d", burst+1, w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+
+	// Another client has its own bucket
+	if w := requestFrom(router, "192.0.2.2:1234", ""); w.Code != http.StatusOK {
+		t.Fatalf("other client: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	router := newRateLimitedRouter(1, 1)
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := requestFrom(router, "192.0.2.1:1234", "198.51.100.1"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	// A spoofed header must not buy a fresh bucket
+	if w := requestFrom(router, "192.0.2.1:1234", "198.51.100.2"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed request: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitKeysByForwardedForBehindTrustedProxy(t *testing.T) {
+	router := newRateLimitedRouter(1, 1)
+	if err := router.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := requestFrom(router, "10.0.0.5:1234", "198.51.100.1"); w.Code != http.StatusOK {
+		t.Fatalf("first client: status = %d", w.Code)
+	}
+	if w := requestFrom(router, "10.0.0.5:1234", "198.51.100.2"); w.Code != http.StatusOK {
+		t.Fatalf("second client via proxy: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := requestFrom(router, "10.0.0.5:1234", "198.51.100.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("first client again: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := &rateLimiter{buckets: map[string]*tokenBucket{}, rps: 2, burst: 1, lastSweep: time.Now()}
+	now := time.Now()
+
+	if ok, _ := limiter.allow("k", now); !ok {
+		t.Fatal("first request should pass")
+	}
+	ok, wait := limiter.allow("k", now)
+	if ok || wait <= 0 {
+		t.Fatalf("second request: allowed=%t wait=%v", ok, wait)
+	}
+	if ok, _ := limiter.allow("k", now.Add(wait)); !ok {
+		t.Fatal("request after the advertised wait should pass")
+	}
+}
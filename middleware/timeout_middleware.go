@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"phynixdrive/utils"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// TimeoutMiddleware bounds each request to timeout. The handler runs with a context deadline and
+// writes into a buffer; if it has not finished when the deadline passes, the client gets a 504
+// straight away and whatever the handler writes afterwards is discarded. The middleware still
+// waits for the handler to return before releasing the gin context, so handlers should honour
+// c.Request.Context().
+//
+// exemptRoutes opts individual routes out, each given as "METHOD /full/route/pattern" exactly as
+// registered (e.g. "GET /api/files/:id/stream"). Streaming downloads and large uploads belong
+// there: they manage their own deadlines and must write to the client as they go.
+// A non-positive timeout disables the middleware.
+func TimeoutMiddleware(timeout time.Duration, exemptRoutes ...string) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(exemptRoutes))
+	for _, route := range exemptRoutes {
+		exempt[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if timeout <= 0 || exempt[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		original := c.Writer
+		buffered := &timeoutWriter{ResponseWriter: original, header: original.Header().Clone(), status: http.StatusOK}
+		c.Writer = buffered
+
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer close(done)
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+			c.Writer = original
+			select {
+			case p := <-panicked:
+				// Re-raise on the request goroutine so the recovery middleware sees it
+				panic(p)
+			default:
+			}
+			buffered.flushTo(original)
+		case <-ctx.Done():
+			buffered.timeOut()
+			// Answer now, then wait for the handler (its context is already cancelled) so the
+			// gin context isn't returned to the pool while it is still in use.
+			writeTimeout(original)
+			<-done
+			c.Writer = original
+			select {
+			case p := <-panicked:
+				panic(p)
+			default:
+			}
+			c.Abort()
+		}
+	}
+}
+
+// writeTimeout sends the same body utils.ErrorResponse would. It can't use c itself because the
+// handler goroutine may still be touching it.
+func writeTimeout(w gin.ResponseWriter) {
+	w.WriteHeader(http.StatusGatewayTimeout)
+	_ = render.JSON{Data: utils.APIResponse{Success: false, Message: "Request timed out"}}.Render(w)
+	w.Flush()
+}
+
+// timeoutWriter holds a handler's response until it finishes within the deadline. After
+// timeOut, writes are accepted and dropped so the handler can run to completion.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	written  bool
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+	if w.timedOut {
+		return len(data), nil
+	}
+	return w.body.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// Flush is a no-op: nothing reaches the client until the handler finishes
+func (w *timeoutWriter) Flush() {}
+
+func (w *timeoutWriter) timeOut() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+}
+
+// flushTo copies the buffered headers, status and body to the real writer
+func (w *timeoutWriter) flushTo(dst gin.ResponseWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	header := dst.Header()
+	for key := range header {
+		if _, ok := w.header[key]; !ok {
+			header.Del(key)
+		}
+	}
+	for key, values := range w.header {
+		header[key] = values
+	}
+
+	dst.WriteHeader(w.status)
+	if w.written || w.body.Len() > 0 {
+		dst.WriteHeaderNow()
+	}
+	if w.body.Len() > 0 {
+		_, _ = dst.Write(w.body.Bytes())
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestTimeoutMiddlewareAnswers504WhenHandlerOverruns(t *testing.T) {
+	router := gin.New()
+	router.Use(TimeoutMiddleware(20 * time.Millisecond))
+	router.GET("/slow", func(c *gin.Context) {
+		// Ignores its context for a while, then writes a response nobody should see
+		time.Sleep(100 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"late": true})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if body := w.Body.String(); body == "" || strings.Contains(body, "late") {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestTimeoutMiddlewarePassesFastResponsesThrough(t *testing.T) {
+	router := gin.New()
+	router.Use(TimeoutMiddleware(time.Second))
+	router.POST("/fast", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); !ok {
+			t.Error("expected a deadline on the request context")
+		}
+		c.Header("X-Test", "1")
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/fast", nil))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if w.Header().Get("X-Test") != "1" {
+		t.Fatal("handler header was lost")
+	}
+	if w.Body.String() != `{"ok":true}` {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+}
+
+func TestTimeoutMiddlewareSkipsExemptRoutesOnly(t *testing.T) {
+	router := gin.New()
+	router.Use(TimeoutMiddleware(time.Second, "GET /files/:id/stream"))
+
+	hasDeadline := func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	}
+	router.GET("/files/:id/stream", hasDeadline)
+	router.GET("/files/:id/downstream", hasDeadline)
+	router.HEAD("/files/:id/stream", hasDeadline)
+
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/files/abc/stream", `{"deadline":false}`},
+		// Matching is by exact route, not by suffix or method-less path
+		{http.MethodGet, "/files/abc/downstream", `{"deadline":true}`},
+		{http.MethodHead, "/files/abc/stream", `{"deadline":true}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("%s %s: body = %q, want %q", tt.method, tt.path, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestTimeoutMiddlewareRepanicsOnRequestGoroutine(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.Recovery(), TimeoutMiddleware(time.Second))
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditLog records a privileged action or a change to a file or folder for later review
+type AuditLog struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action     string             `bson:"action" json:"action"`
+	ActorID    string             `bson:"actor_id" json:"actor_id"`
+	TargetID   string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	TargetType string             `bson:"target_type,omitempty" json:"target_type,omitempty"` // "file" or "folder" for resource events
+	IPAddress  string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	Details    map[string]string  `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
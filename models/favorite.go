@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Favorite records that a user starred a file or folder. Stars are per user, so starring a
+// shared item does not change what its owner or other collaborators see.
+type Favorite struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ResourceID   primitive.ObjectID `bson:"resource_id" json:"resource_id"`
+	ResourceType string             `bson:"resource_type" json:"resource_type"` // "file" or "folder"
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
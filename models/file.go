@@ -18,22 +18,28 @@ type File struct {
 	B2FileName   string              `bson:"b2_file_name" json:"b2_file_name"`
 	B2BucketID   string              `bson:"b2_bucket_id" json:"b2_bucket_id"`
 	RelativePath string              `bson:"relative_path" json:"relative_path"`
-	Permissions  []Permission        `bson:"permissions" json:"permissions"`
-	Versions     []FileVersion       `bson:"versions" json:"versions"`
+	Permissions  []Permission        `bson:"permissions" json:"permissions,omitempty"`
+	Versions     []FileVersion       `bson:"versions" json:"versions,omitempty"`
 	IsDeleted    bool                `bson:"is_deleted" json:"is_deleted"`
 	DeletedAt    *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy    *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	DeleteReason string              `bson:"delete_reason,omitempty" json:"delete_reason,omitempty"`
 	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
 	Extension    string              `bson:"extension" json:"extension"`
 	SHA1Hash     string              `bson:"sha1_hash" json:"sha1_hash"`
 	ContentType  string              `bson:"content_type" json:"content_type"`
 	ParentID     *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Tags         []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	Description  string              `bson:"description,omitempty" json:"description,omitempty"`
 }
 
 type FileVersion struct {
-	VersionID  primitive.ObjectID `bson:"version_id" json:"version_id"`
-	B2FileID   string             `bson:"b2_file_id" json:"b2_file_id"`
-	B2FileName string             `bson:"b2_file_name" json:"b2_file_name"`
-	Size       int64              `bson:"size" json:"size"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	VersionID   primitive.ObjectID `bson:"version_id" json:"version_id"`
+	B2FileID    string             `bson:"b2_file_id" json:"b2_file_id"`
+	B2FileName  string             `bson:"b2_file_name" json:"b2_file_name"`
+	Size        int64              `bson:"size" json:"size"`
+	SHA1Hash    string             `bson:"sha1_hash,omitempty" json:"sha1_hash,omitempty"`
+	ContentType string             `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 }
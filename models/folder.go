@@ -12,9 +12,14 @@ type Folder struct {
 	ParentID    *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
 	OwnerID     primitive.ObjectID  `bson:"owner_id" json:"owner_id"`
 	Path        string              `bson:"path" json:"path"` // Full path for easy lookup
-	Permissions []Permission        `bson:"permissions" json:"permissions"`
+	Description string              `bson:"description,omitempty" json:"description,omitempty"`
+	Permissions []Permission        `bson:"permissions" json:"permissions,omitempty"`
 	IsDeleted   bool                `bson:"is_deleted" json:"is_deleted"`
 	DeletedAt   *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+
+	// Who moved the folder to trash and why; cleared on restore
+	DeletedBy    *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	DeleteReason string              `bson:"delete_reason,omitempty" json:"delete_reason,omitempty"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrphanedObject is a B2 object whose metadata was purged but whose delete failed.
+// The trash cleanup job retries these until the delete succeeds.
+type OrphanedObject struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	B2FileID      string             `bson:"b2_file_id" json:"b2_file_id"`
+	OwnerID       primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	LastError     string             `bson:"last_error" json:"last_error"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	LastAttemptAt time.Time          `bson:"last_attempt_at" json:"last_attempt_at"`
+}
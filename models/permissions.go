@@ -15,4 +15,6 @@ type Permission struct {
 	GrantedBy    string             `bson:"granted_by" json:"granted_by"`       
 	GrantedAt    time.Time          `bson:"granted_at" json:"granted_at"`
 	IsActive     bool               `bson:"is_active" json:"is_active"`
+	ExpiresAt    *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // grant stops authorizing after this time
+	SuspendedAt  *time.Time         `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"` // set while the resource is in trash
 }
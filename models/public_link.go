@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PublicLink exposes a file or folder to anyone holding the token, no account required
+type PublicLink struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Token         string             `bson:"token" json:"token"`
+	ResourceID    string             `bson:"resource_id" json:"resource_id"`
+	ResourceType  string             `bson:"resource_type" json:"resource_type"`
+	PasswordHash  string             `bson:"password_hash,omitempty" json:"-"`
+	ExpiresAt     *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	MaxDownloads  int                `bson:"max_downloads,omitempty" json:"max_downloads,omitempty"`
+	DownloadCount int                `bson:"download_count" json:"download_count"`
+	CreatedBy     string             `bson:"created_by" json:"created_by"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	IsActive      bool               `bson:"is_active" json:"is_active"`
+	RevokedAt     *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
@@ -18,12 +18,31 @@ type Share struct {
 	IsActive     bool               `bson:"is_active" json:"is_active"`
 	RevokedAt    *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
 	RevokedBy    string             `bson:"revoked_by,omitempty" json:"revoked_by,omitempty"`
+	DeclinedAt   *time.Time         `bson:"declined_at,omitempty" json:"declined_at,omitempty"` // set when the recipient removed the share themselves
+	ExpiresAt    *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`   // access ends at this time; nil never expires
+	SuspendedAt  *time.Time         `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"` // set while the resource is in trash
 	UpdatedAt    *time.Time         `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
 	UpdatedBy    string             `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
 	FirstName    string             `bson:"first_name,omitempty" json:"first_name,omitempty"` 
 	LastName     string             `bson:"last_name,omitempty" json:"last_name,omitempty"`   
 }
 
+// ShareLink is an internal "copy link" token. Any signed-in user holding the token can
+// redeem it for Role on the resource; it never grants anonymous access.
+type ShareLink struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Token        string             `bson:"token" json:"token"`
+	ResourceID   string             `bson:"resource_id" json:"resource_id"`
+	ResourceType string             `bson:"resource_type" json:"resource_type"`
+	Role         string             `bson:"role" json:"role"`
+	CreatedBy    string             `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt    *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	IsActive     bool               `bson:"is_active" json:"is_active"`
+	RedeemCount  int                `bson:"redeem_count" json:"redeem_count"`
+	RevokedAt    *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
 // ShareActivity represents sharing activity logs
 type ShareActivity struct {
 	ID           primitive.ObjectID     `bson:"_id" json:"id"`
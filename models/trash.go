@@ -7,13 +7,16 @@ import (
 )
 
 type TrashItem struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	ItemID       primitive.ObjectID `bson:"item_id" json:"item_id"`     
-	ItemType     string             `bson:"item_type" json:"item_type"` 
-	Name         string             `bson:"name" json:"name"`
-	OriginalPath string             `bson:"original_path" json:"original_path"`
-	OwnerID      primitive.ObjectID `bson:"owner_id" json:"owner_id"`
-	Size         int64              `bson:"size" json:"size"` 
-	DeletedAt    time.Time          `bson:"deleted_at" json:"deleted_at"`
-	AutoPurgeAt  time.Time          `bson:"auto_purge_at" json:"auto_purge_at"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ItemID        primitive.ObjectID  `bson:"item_id" json:"item_id"`
+	ItemType      string              `bson:"item_type" json:"item_type"`
+	Name          string              `bson:"name" json:"name"`
+	OriginalPath  string              `bson:"original_path" json:"original_path"`
+	OwnerID       primitive.ObjectID  `bson:"owner_id" json:"owner_id"`
+	Size          int64               `bson:"size" json:"size"`
+	DeletedAt     time.Time           `bson:"deleted_at" json:"deleted_at"`
+	AutoPurgeAt   time.Time           `bson:"auto_purge_at" json:"auto_purge_at"`
+	DeletedBy     *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	DeletedByName string              `bson:"deleted_by_name,omitempty" json:"deleted_by_name,omitempty"`
+	DeleteReason  string              `bson:"delete_reason,omitempty" json:"delete_reason,omitempty"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UploadInbox lets anyone holding the token upload files into a folder. It never grants
+// read access to the folder or to what has been uploaded.
+type UploadInbox struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Token        string             `bson:"token" json:"token"`
+	FolderID     primitive.ObjectID `bson:"folder_id" json:"folder_id"`
+	OwnerID      primitive.ObjectID `bson:"owner_id" json:"owner_id"` // uploads count against this user's quota
+	CreatedBy    string             `bson:"created_by" json:"created_by"`
+	MaxFileSize  int64              `bson:"max_file_size" json:"max_file_size"`
+	MaxFiles     int                `bson:"max_files" json:"max_files"`
+	AllowedTypes []string           `bson:"allowed_types,omitempty" json:"allowed_types,omitempty"` // file extensions; empty allows any
+	UploadCount  int                `bson:"upload_count" json:"upload_count"`
+	ExpiresAt    *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	IsActive     bool               `bson:"is_active" json:"is_active"`
+	RevokedAt    *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Upload session states
+const (
+	UploadStatusActive     = "active"
+	UploadStatusCompleting = "completing"
+	UploadStatusCompleted  = "completed"
+	UploadStatusAborted    = "aborted"
+)
+
+// UploadSession tracks a resumable chunked upload. Each part goes straight to an unfinished
+// B2 large file; the file only appears in the drive once the session is completed.
+type UploadSession struct {
+	ID           primitive.ObjectID    `bson:"_id" json:"id"`
+	OwnerID      primitive.ObjectID    `bson:"owner_id" json:"owner_id"`
+	Filename     string                `bson:"filename" json:"filename"`
+	RelativePath string                `bson:"relative_path" json:"relative_path"`
+	ContentType  string                `bson:"content_type" json:"content_type"`
+	Size         int64                 `bson:"size" json:"size"`
+	PartSize     int64                 `bson:"part_size" json:"part_size"` // every part but the last must be exactly this long
+	PartCount    int                   `bson:"part_count" json:"part_count"`
+	SHA1         string                `bson:"sha1,omitempty" json:"sha1,omitempty"` // optional whole-file checksum checked on completion
+	ObjectName   string                `bson:"object_name" json:"-"`
+	Parts        map[string]UploadPart `bson:"parts" json:"-"`                // keyed by part number so a retried part replaces the old one
+	HashState    []byte                `bson:"hash_state,omitempty" json:"-"` // running whole-file SHA1 over parts 1..HashedParts
+	HashedParts  int                   `bson:"hashed_parts" json:"-"`
+	Status       string                `bson:"status" json:"status"`
+	FileID       *primitive.ObjectID   `bson:"file_id,omitempty" json:"file_id,omitempty"` // set once completed
+	CreatedAt    time.Time             `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time             `bson:"updated_at" json:"updated_at"`
+	ExpiresAt    time.Time             `bson:"expires_at" json:"expires_at"`
+}
+
+// UploadPart records a part B2 has accepted
+type UploadPart struct {
+	SHA1       string    `bson:"sha1" json:"sha1"`
+	Size       int64     `bson:"size" json:"size"`
+	UploadedAt time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
@@ -17,8 +17,16 @@ type User struct {
 	MaxStorage   int64              `bson:"max_storage" json:"max_storage"`
 	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
-	RefreshToken string             `json:"refresh_token,omitempty" bson:"refresh_token,omitempty"`
+	RefreshToken string             `json:"-" bson:"refresh_token,omitempty"` // Google refresh token, encrypted with utils.EncryptToken
 	FirstName    string             `bson:"first_name,omitempty" json:"first_name,omitempty"`
 	LastName     string             `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	Preferences  *UserPreferences   `bson:"preferences,omitempty" json:"preferences,omitempty"`
+	TokenVersion int64              `bson:"token_version" json:"-"` // bumped to revoke every token issued before
 
 }
+
+// UserPreferences holds UI defaults applied when a request doesn't specify them.
+type UserPreferences struct {
+	SortField     string `bson:"sort_field,omitempty" json:"sort_field,omitempty"`
+	SortDirection string `bson:"sort_direction,omitempty" json:"sort_direction,omitempty"`
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+	"phynixdrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterActivityRoutes(rg *gin.RouterGroup, jwtSecret string, auditService *services.AuditService) {
+	activityController := controllers.NewActivityController(auditService)
+
+	activity := rg.Group("")
+	activity.Use(middleware.AuthMiddleware(jwtSecret)) // Owners and resource admins only; checked in the service
+	{
+		activity.GET("/files/:id/activity", activityController.GetFileActivity)     // GET /files/:id/activity?limit=&offset= (oldest first)
+		activity.GET("/folders/:id/activity", activityController.GetFolderActivity) // GET /folders/:id/activity?limit=&offset= (oldest first)
+	}
+}
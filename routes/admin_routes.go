@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterAdminRoutes registers operational endpoints restricted to the admin role
+func RegisterAdminRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string) {
+	adminController := controllers.NewAdminController(db, jwtSecret)
+
+	admin := rg.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(jwtSecret), middleware.RequireRole("admin"))
+	{
+		admin.GET("/maintenance", adminController.GetMaintenanceMode) // GET /admin/maintenance
+		admin.PUT("/maintenance", adminController.SetMaintenanceMode) // PUT /admin/maintenance {enabled}
+
+		// Users
+		admin.PATCH("/users/:id/quota", adminController.SetUserQuota) // PATCH /admin/users/:id/quota {max_storage}
+
+		// Storage
+		admin.POST("/reconcile-storage", adminController.ReconcileStorage) // POST /admin/reconcile-storage?user_id= - Recompute used_storage from live files
+
+		// Support
+		admin.POST("/impersonate/:userId", adminController.Impersonate) // POST /admin/impersonate/:userId (short-lived, audited)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"phynixdrive/config"
 	"phynixdrive/controllers"
 	"phynixdrive/middleware"
 
@@ -11,13 +12,21 @@ import (
 func RegisterAuthRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret, googleClientID, googleClientSecret, redirectURL string) {
 	authController := controllers.NewAuthController(db, jwtSecret, googleClientID, googleClientSecret, redirectURL)
 
+	// Sign-in endpoints are unauthenticated, so they are limited per IP
+	var rps, burst int
+	if config.AppConfig != nil {
+		rps, burst = int(config.AppConfig.AuthRateLimitRPS), int(config.AppConfig.AuthRateLimitBurst)
+	}
+	loginLimit := middleware.RateLimit(rps, burst)
+
 	auth := rg.Group("/auth")
 	{
 
-		auth.GET("/google", authController.GoogleAuth)
-		auth.GET("/google/callback", authController.GoogleCallback)
+		auth.GET("/google", loginLimit, authController.GoogleAuth)
+		auth.GET("/google/callback", loginLimit, authController.GoogleCallback)
 
-		auth.POST("/oauth-login", authController.OAuthLogin)
+		auth.POST("/oauth-login", loginLimit, authController.OAuthLogin)
+		auth.POST("/refresh-google", loginLimit, authController.RefreshWithGoogle) // POST /auth/refresh-google {refresh_token} or refresh cookie (works after the JWT has expired)
 
 		protected := auth.Group("")
 		protected.Use(middleware.AuthMiddleware(jwtSecret))
@@ -28,4 +37,13 @@ func RegisterAuthRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret, goog
 			protected.GET("/validate", authController.ValidateToken)
 		}
 	}
+
+	// Preferences and usage belong to the signed-in user rather than the session, so they live under /me
+	me := rg.Group("/me")
+	me.Use(middleware.AuthMiddleware(jwtSecret))
+	{
+		me.GET("/preferences", authController.GetPreferences)          // GET /me/preferences
+		me.PUT("/preferences", authController.UpdatePreferences)       // PUT /me/preferences {sort_field, sort_direction}
+		me.POST("/usage/recalculate", authController.RecalculateUsage) // POST /me/usage/recalculate (rate limited per user)
+	}
 }
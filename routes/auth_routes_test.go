@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUsageRecalculationIsServedUnderMe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("routes", func(mt *mtest.T) {
+		router := gin.New()
+		RegisterAuthRoutes(router.Group("/api"), mt.DB, "secret", "", "", "")
+
+		registered := map[string]bool{}
+		for _, route := range router.Routes() {
+			registered[route.Method+" "+route.Path] = true
+		}
+		if !registered["POST /api/me/usage/recalculate"] {
+			t.Fatal("POST /api/me/usage/recalculate is not registered")
+		}
+		if registered["POST /api/auth/me/usage/recalculate"] {
+			t.Fatal("usage recalculation is still served under /auth")
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+	"phynixdrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterFavoriteRoutes(rg *gin.RouterGroup, jwtSecret string, favoriteService *services.FavoriteService, permissionService *services.PermissionService) {
+	favoriteController := controllers.NewFavoriteController(favoriteService)
+
+	starred := rg.Group("")
+	starred.Use(middleware.AuthMiddleware(jwtSecret)) // Stars are per user, so every route needs a session
+	// Starring needs at least view access; unstarring is always allowed so lost access can be cleaned up
+	canView := middleware.PermissionMiddleware(permissionService, "viewer")
+	{
+		starred.POST("/files/:id/star", canView, favoriteController.StarFile)     // POST /files/:id/star
+		starred.DELETE("/files/:id/star", favoriteController.UnstarFile)          // DELETE /files/:id/star
+		starred.POST("/folders/:id/star", canView, favoriteController.StarFolder) // POST /folders/:id/star
+		starred.DELETE("/folders/:id/star", favoriteController.UnstarFolder)      // DELETE /folders/:id/star
+		starred.GET("/favorites", favoriteController.GetFavorites)                // GET /favorites (files with preview/download endpoints, then folders)
+	}
+}
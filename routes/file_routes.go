@@ -1,38 +1,83 @@
 package routes
 
 import (
+	"phynixdrive/config"
 	"phynixdrive/controllers"
 	"phynixdrive/middleware"
 	"phynixdrive/services"
+	"phynixdrive/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterFileRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string, folderService *services.FolderService, b2Service *services.B2Service, permissionService *services.PermissionService) {
+func RegisterFileRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string, folderService *services.FolderService, b2Service *services.B2Service, permissionService *services.PermissionService, shareService *services.ShareService, auditService *services.AuditService) {
 	// Initialize the file controller
-	fileController := controllers.NewFileController(db, folderService, b2Service, permissionService)
+	fileController := controllers.NewFileController(db, jwtSecret, folderService, b2Service, permissionService, shareService, auditService)
 
 	files := rg.Group("/files")
 	files.Use(middleware.AuthMiddleware(jwtSecret)) // All file routes require authentication with JWT secret
 	{
 		// File metadata and operations
 		files.GET("/:id", fileController.GetFileMetadata)
+		files.GET("/:id/properties", fileController.GetFileProperties)
+		files.POST("/:id/verify", fileController.VerifyIntegrity) // POST /files/:id/verify (re-hash the stored content)
 		files.DELETE("/:id", fileController.DeleteFile)
 		files.PATCH("/:id/rename", fileController.RenameFile)
+		files.PATCH("/:id/move", fileController.MoveFile)       // PATCH /files/:id/move {target_folder_id}
+		files.POST("/:id/copy", fileController.CopyFile)        // POST /files/:id/copy {target_folder_id?}
+		files.POST("/bulk-tag", fileController.BulkTagFiles)    // POST /files/bulk-tag {ids, add, remove}
+		files.POST("/batch-delete", fileController.DeleteFiles) // POST /files/batch-delete {ids}
+		files.GET("/duplicates", fileController.FindDuplicates) // GET /files/duplicates (same SHA1 + size)
+		files.GET("/exists", fileController.FileExists)         // GET /files/exists?sha1=&size= (skip re-uploading known content)
+
+		// Cross-folder views
+		files.GET("/by-category/:category", fileController.GetFilesByCategory) // GET /files/by-category/:category?limit=&offset= (images|documents|videos|audio|other)
 
 		// File access URLs
 		files.GET("/:id/download", fileController.DownloadFile) // GET /files/:id/download (B2 signed URL for download)
 		files.GET("/:id/preview", fileController.PreviewFile)   // GET /files/:id/preview (B2 signed URL for preview)
+		files.GET("/:id/raw", fileController.GetRawFile)        // GET /files/:id/raw (bytes inline when small, else redirect)
+		files.GET("/:id/stream", fileController.StreamFile)     // GET /files/:id/stream (previewable types inline, Range supported for seeking)
+		files.GET("/:id/urls", fileController.GetFileURLs)      // GET /files/:id/urls (download + preview URLs in one call)
+
+		// Sharing
+		files.GET("/:id/permissions", middleware.FilePermissionMiddleware(permissionService, "admin"), fileController.GetFilePermissions) // GET /files/:id/permissions (file admins only)
+
+		// Versions
+		files.POST("/:id/versions/:versionId/restore", middleware.RequireFeature(config.FeatureVersioning), fileController.RestoreVersion)
+		files.DELETE("/:id/versions/:versionId", middleware.RequireFeature(config.FeatureVersioning), fileController.DeleteVersion)
 
+		// External app access
+		files.POST("/:id/access-token", fileController.IssueAccessToken) // POST /files/:id/access-token {action: read|write}
 	}
 
+	// Content endpoints for external apps authenticate with a scoped X-File-Access-Token header instead of a session JWT.
+	// Signed-in users can also stream through GET /files/:id/content instead of fetching a signed URL.
+	rg.GET("/files/:id/content", middleware.AuthUnlessAccessToken(jwtSecret, utils.FileActionRead), fileController.GetFileContent)
+	rg.PUT("/files/:id/content", middleware.FileAccessMiddleware(jwtSecret, utils.FileActionWrite), middleware.RequireFeature(config.FeatureVersioning), fileController.PutFileContent)
+
+	var maxConcurrentUploads, uploadRPS, uploadBurst int
+	if config.AppConfig != nil {
+		maxConcurrentUploads = int(config.AppConfig.MaxConcurrentUploads)
+		uploadRPS, uploadBurst = int(config.AppConfig.UploadRateLimitRPS), int(config.AppConfig.UploadRateLimitBurst)
+	}
+	uploadRate := middleware.RateLimit(uploadRPS, uploadBurst)
+	uploadLimit := middleware.UploadConcurrencyMiddleware(maxConcurrentUploads)
+
 	// File upload and listing routes (separate from /files/:id pattern to avoid conflicts)
 	upload := rg.Group("")
 	upload.Use(middleware.AuthMiddleware(jwtSecret)) // Use JWT secret for authentication
 	{
-		upload.POST("/uploadfiles", fileController.UploadFiles) // POST /uploadfiles (with relativePath[] support)
-		upload.GET("/allfiles", fileController.GetAllFiles)     // GET /allfiles (root-level files)
+		upload.POST("/uploadfiles", uploadRate, uploadLimit, fileController.UploadFiles) // POST /uploadfiles (with relativePath[] support, per-user rate and concurrency limits)
+		upload.GET("/allfiles", fileController.GetAllFiles)                              // GET /allfiles (root-level files)
+	}
+
+	// Files in one folder, with preview/download endpoints, for the folder's viewers
+	folderFiles := rg.Group("/folders")
+	folderFiles.Use(middleware.AuthMiddleware(jwtSecret), middleware.FolderPermissionMiddleware(permissionService, "viewer"))
+	{
+		folderFiles.GET("/:id/files", fileController.GetFolderFiles) // GET /folders/:id/files
 	}
 
 }
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"phynixdrive/config"
 	"phynixdrive/controllers"
 	"phynixdrive/middleware"
 	"phynixdrive/services"
@@ -8,9 +9,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterFolderRoutes(rg *gin.RouterGroup, jwtSecret string, folderService *services.FolderService, b2Service *services.B2Service) {
+func RegisterFolderRoutes(rg *gin.RouterGroup, jwtSecret string, folderService *services.FolderService, b2Service *services.B2Service, inboxService *services.UploadInboxService, auditService *services.AuditService) {
 	// Initialize the folder controller with both services (passing b2Service as pointer)
-	folderController := controllers.NewFolderController(folderService, b2Service)
+	folderController := controllers.NewFolderController(folderService, b2Service, auditService)
+	inboxController := controllers.NewUploadInboxController(inboxService)
+
+	var maxConcurrentDownloads int
+	if config.AppConfig != nil {
+		maxConcurrentDownloads = int(config.AppConfig.MaxConcurrentDownloads)
+	}
+	downloadLimit := middleware.DownloadConcurrencyMiddleware(maxConcurrentDownloads)
 
 	folders := rg.Group("/folders")
 	folders.Use(middleware.AuthMiddleware(jwtSecret)) // All folder routes require JWT authentication
@@ -18,16 +26,27 @@ func RegisterFolderRoutes(rg *gin.RouterGroup, jwtSecret string, folderService *
 		// Core folder operations (matching API specification)
 		folders.POST("/", folderController.CreateFolder)                 // POST /folders - Create folder
 		folders.GET("/", folderController.ListRootFolders)               // GET /folders - List root folders
-		folders.GET("/:id/contents", folderController.GetFolderContents) // GET /folders/:id/contents
+		folders.POST("/resolve", folderController.ResolvePaths)          // POST /folders/resolve {paths} - Map paths to folder IDs, creating nothing
+		folders.GET("/:id/contents", folderController.GetFolderContents) // GET /folders/:id/contents?type=folder|file|images|documents&sort=&order=&limit=&offset=&include_size=true
+		folders.GET("/:id/view", folderController.GetFolderView)         // GET /folders/:id/view - Contents, breadcrumb and role in one call
+		folders.GET("/:id/breadcrumb", folderController.GetBreadcrumb)   // GET /folders/:id/breadcrumb - Ancestor folders, root first
+		folders.GET("/:id/size", folderController.GetFolderSize)         // GET /folders/:id/size - Total bytes in the subtree (cached briefly)
 		// POST /folders/:id/share - Share folder with inheritance
-		folders.GET("/:id/download", folderController.DownloadFolder) // GET /folders/:id/download - Download folder as ZIP
+		folders.GET("/:id/download", downloadLimit, folderController.DownloadFolder) // GET /folders/:id/download - Download folder as ZIP (per-user concurrency limit)
 
 		// Additional folder operations
 		folders.GET("/:id", folderController.GetFolder)             // GET /folders/:id - Get specific folder
 		folders.PATCH("/:id/rename", folderController.RenameFolder) // PATCH /folders/:id/rename - Rename folder
-		folders.DELETE("/:id", folderController.DeleteFolder)       // DELETE /folders/:id - Delete folder (soft delete)
+		folders.PATCH("/:id/move", folderController.MoveFolder)     // PATCH /folders/:id/move - Move folder {parent_id}
+		folders.DELETE("/:id", folderController.DeleteFolder)       // DELETE /folders/:id?reason= - Delete folder (soft delete, reason shown in trash)
 
-		// GET /folders/:id/files - Get files in folder
+		folders.POST("/:id/merge-into/:destId", folderController.MergeFolder) // POST /folders/:id/merge-into/:destId?on_conflict=rename|skip|fail&delete_source=true
+
+		// GET /folders/:id/files - Get files in folder (registered with the file routes)
 		folders.DELETE("/:id/files/:fileId", folderController.DeleteFileFromFolder) // DELETE /folders/:id/files/:fileId - Delete file from folder
+
+		// Anonymous upload inbox
+		folders.POST("/:id/inbox", inboxController.CreateInbox)    // POST /folders/:id/inbox - Create or rotate the upload inbox token
+		folders.DELETE("/:id/inbox", inboxController.DisableInbox) // DELETE /folders/:id/inbox - Stop accepting anonymous uploads
 	}
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"phynixdrive/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthRoutes adds the unauthenticated probes load balancers and orchestrators poll
+func RegisterHealthRoutes(router gin.IRouter, container *ServiceContainer) {
+	healthController := controllers.NewHealthController(container.DB, container.B2Service)
+
+	router.GET("/health", healthController.Ready)       // GET /health (same as /health/ready)
+	router.GET("/health/ready", healthController.Ready) // GET /health/ready (503 with per-dependency status if MongoDB or B2 is down)
+	router.GET("/health/live", healthController.Live)   // GET /health/live (process only, no dependency checks)
+}
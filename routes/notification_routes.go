@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterNotificationRoutes registers the in-app notification inbox
+func RegisterNotificationRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string) {
+	notificationController := controllers.NewNotificationController(db)
+
+	notifications := rg.Group("/notifications")
+	notifications.Use(middleware.AuthMiddleware(jwtSecret))
+	{
+		notifications.GET("/", notificationController.ListNotifications)       // GET /notifications?limit=&offset= (newest first)
+		notifications.GET("/unread-count", notificationController.UnreadCount) // GET /notifications/unread-count
+		notifications.PATCH("/:id/read", notificationController.MarkRead)      // PATCH /notifications/:id/read
+		notifications.POST("/read-all", notificationController.MarkAllRead)    // POST /notifications/read-all
+	}
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"phynixdrive/config"
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+	"phynixdrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterPublicRoutes registers unauthenticated public link endpoints
+func RegisterPublicRoutes(rg *gin.RouterGroup, shareService *services.ShareService, folderService *services.FolderService, b2Service *services.B2Service, inboxService *services.UploadInboxService, auditService *services.AuditService) {
+	publicController := controllers.NewPublicController(shareService, folderService, b2Service, auditService)
+	inboxController := controllers.NewUploadInboxController(inboxService)
+
+	// Inbox uploads are anonymous, so the upload limiter falls back to keying them by IP
+	var uploadRPS, uploadBurst int
+	if config.AppConfig != nil {
+		uploadRPS, uploadBurst = int(config.AppConfig.UploadRateLimitRPS), int(config.AppConfig.UploadRateLimitBurst)
+	}
+	inboxRate := middleware.RateLimit(uploadRPS, uploadBurst)
+
+	public := rg.Group("/public")
+	public.Use(middleware.RequireFeature(config.FeaturePublicLinks))
+	{
+		public.GET("/:token", publicController.Open)                     // GET /public/:token (file redirect or folder ZIP)
+		public.GET("/:token/meta", publicController.GetLinkMeta)         // GET /public/:token/meta
+		public.GET("/:token/download", publicController.DownloadFolder)  // GET /public/:token/download (folder ZIP, size limited)
+		public.POST("/:token/upload", inboxRate, inboxController.Upload) // POST /public/:token/upload (upload inbox, write only, rate limited per IP)
+	}
+}
@@ -4,6 +4,7 @@ package routes
 import (
 	"phynixdrive/controllers"
 	"phynixdrive/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,9 +12,13 @@ import (
 
 // B2Config holds the B2 service configuration
 type B2Config struct {
-	KeyID          string
-	ApplicationKey string
-	BucketName     string
+	KeyID            string
+	ApplicationKey   string
+	BucketName       string
+	ObjectPrefix     string
+	ObjectNameScheme string
+	BucketPublic     bool
+	URLExpiryMargin  time.Duration
 }
 
 // GoogleConfig holds the Google OAuth2 configuration
@@ -31,6 +36,9 @@ func SetupRoutes(api *gin.RouterGroup, db *mongo.Database, jwtSecret string, b2C
 	if err != nil {
 		return err
 	}
+	b2Service.SetObjectNaming(b2Config.ObjectPrefix, b2Config.ObjectNameScheme)
+	b2Service.SetBucketPublic(b2Config.BucketPublic)
+	b2Service.SetURLExpiryMargin(b2Config.URLExpiryMargin)
 
 	// Initialize permission service (required by folder + share service)
 	permissionService := services.NewPermissionService(db)
@@ -38,17 +46,31 @@ func SetupRoutes(api *gin.RouterGroup, db *mongo.Database, jwtSecret string, b2C
 	// Initialize folder service
 	folderService := services.NewFolderService(db, permissionService, b2Service)
 
-	// Initialize share service + controller ✅ (only db + permissionService)
-	shareService := services.NewShareService(db, permissionService)
-	shareController := controllers.NewShareController(shareService)
+	// Resource events from the folder, file, share, trash and public link controllers
+	auditService := services.NewAuditService(db)
+
+	// Initialize share service + controller
+	shareService := services.NewShareService(db, permissionService, services.NewNotificationServiceFromConfig(db))
+	shareController := controllers.NewShareController(shareService, auditService)
+
+	fileService := services.NewFileService(db, folderService, b2Service, permissionService)
+	inboxService := services.NewUploadInboxService(db, fileService, b2Service, permissionService)
+	favoriteService := services.NewFavoriteService(db, permissionService)
+	uploadService := services.NewChunkedUploadService(db, fileService, b2Service)
 
 	// Register all route groups
 	RegisterAuthRoutes(api, db, jwtSecret, googleConfig.ClientID, googleConfig.ClientSecret, googleConfig.RedirectURL)
-	RegisterFolderRoutes(api, jwtSecret, folderService, b2Service)
-	RegisterFileRoutes(api, db, jwtSecret, folderService, b2Service, permissionService)
-	RegisterTrashRoutes(api, db, jwtSecret, b2Service)
-	RegisterSearchRoutes(api, db, permissionService)
+	RegisterFolderRoutes(api, jwtSecret, folderService, b2Service, inboxService, auditService)
+	RegisterFileRoutes(api, db, jwtSecret, folderService, b2Service, permissionService, shareService, auditService)
+	RegisterTrashRoutes(api, db, jwtSecret, b2Service, auditService)
+	RegisterSearchRoutes(api, db, jwtSecret, permissionService)
 	RegisterShareRoutes(api, jwtSecret, shareController)
+	RegisterPublicRoutes(api, shareService, folderService, b2Service, inboxService, auditService)
+	RegisterNotificationRoutes(api, db, jwtSecret)
+	RegisterAdminRoutes(api, db, jwtSecret)
+	RegisterFavoriteRoutes(api, jwtSecret, favoriteService, permissionService)
+	RegisterActivityRoutes(api, jwtSecret, auditService)
+	RegisterChunkedUploadRoutes(api, jwtSecret, uploadService, auditService)
 
 	return nil
 }
@@ -62,15 +84,27 @@ func SetupRoutesWithServices(api *gin.RouterGroup,
 	permissionService *services.PermissionService,
 	googleConfig GoogleConfig) {
 
-	shareService := services.NewShareService(db, permissionService)
-	shareController := controllers.NewShareController(shareService)
+	auditService := services.NewAuditService(db)
+	shareService := services.NewShareService(db, permissionService, services.NewNotificationServiceFromConfig(db))
+	shareController := controllers.NewShareController(shareService, auditService)
+
+	fileService := services.NewFileService(db, folderService, b2Service, permissionService)
+	inboxService := services.NewUploadInboxService(db, fileService, b2Service, permissionService)
+	favoriteService := services.NewFavoriteService(db, permissionService)
+	uploadService := services.NewChunkedUploadService(db, fileService, b2Service)
 
 	RegisterAuthRoutes(api, db, jwtSecret, googleConfig.ClientID, googleConfig.ClientSecret, googleConfig.RedirectURL)
-	RegisterFolderRoutes(api, jwtSecret, folderService, b2Service)
-	RegisterFileRoutes(api, db, jwtSecret, folderService, b2Service, permissionService)
-	RegisterTrashRoutes(api, db, jwtSecret, b2Service)
-	RegisterSearchRoutes(api, db, permissionService)
+	RegisterFolderRoutes(api, jwtSecret, folderService, b2Service, inboxService, auditService)
+	RegisterFileRoutes(api, db, jwtSecret, folderService, b2Service, permissionService, shareService, auditService)
+	RegisterTrashRoutes(api, db, jwtSecret, b2Service, auditService)
+	RegisterSearchRoutes(api, db, jwtSecret, permissionService)
 	RegisterShareRoutes(api, jwtSecret, shareController)
+	RegisterPublicRoutes(api, shareService, folderService, b2Service, inboxService, auditService)
+	RegisterNotificationRoutes(api, db, jwtSecret)
+	RegisterAdminRoutes(api, db, jwtSecret)
+	RegisterFavoriteRoutes(api, jwtSecret, favoriteService, permissionService)
+	RegisterActivityRoutes(api, jwtSecret, auditService)
+	RegisterChunkedUploadRoutes(api, jwtSecret, uploadService, auditService)
 }
 
 // ServiceContainer holds all services and dependencies
@@ -90,6 +124,9 @@ func NewServiceContainer(db *mongo.Database, jwtSecret string, b2Config B2Config
 	if err != nil {
 		return nil, err
 	}
+	b2Service.SetObjectNaming(b2Config.ObjectPrefix, b2Config.ObjectNameScheme)
+	b2Service.SetBucketPublic(b2Config.BucketPublic)
+	b2Service.SetURLExpiryMargin(b2Config.URLExpiryMargin)
 
 	// Initialize permission service
 	permissionService := services.NewPermissionService(db)
@@ -110,17 +147,29 @@ func NewServiceContainer(db *mongo.Database, jwtSecret string, b2Config B2Config
 // SetupRoutesWithContainer configures all API routes using a service container
 func SetupRoutesWithContainer(api *gin.RouterGroup, container *ServiceContainer) {
 
-	shareService := services.NewShareService(container.DB, container.PermissionService)
-	shareController := controllers.NewShareController(shareService)
+	auditService := services.NewAuditService(container.DB)
+	shareService := services.NewShareService(container.DB, container.PermissionService, services.NewNotificationServiceFromConfig(container.DB))
+	shareController := controllers.NewShareController(shareService, auditService)
+
+	fileService := services.NewFileService(container.DB, container.FolderService, container.B2Service, container.PermissionService)
+	inboxService := services.NewUploadInboxService(container.DB, fileService, container.B2Service, container.PermissionService)
+	favoriteService := services.NewFavoriteService(container.DB, container.PermissionService)
+	uploadService := services.NewChunkedUploadService(container.DB, fileService, container.B2Service)
 
 	RegisterAuthRoutes(api, container.DB, container.JWTSecret,
 		container.GoogleConfig.ClientID,
 		container.GoogleConfig.ClientSecret,
 		container.GoogleConfig.RedirectURL)
 
-	RegisterFolderRoutes(api, container.JWTSecret, container.FolderService, container.B2Service)
-	RegisterFileRoutes(api, container.DB, container.JWTSecret, container.FolderService, container.B2Service, container.PermissionService)
-	RegisterTrashRoutes(api, container.DB, container.JWTSecret, container.B2Service)
-	RegisterSearchRoutes(api, container.DB, container.PermissionService)
+	RegisterFolderRoutes(api, container.JWTSecret, container.FolderService, container.B2Service, inboxService, auditService)
+	RegisterFileRoutes(api, container.DB, container.JWTSecret, container.FolderService, container.B2Service, container.PermissionService, shareService, auditService)
+	RegisterTrashRoutes(api, container.DB, container.JWTSecret, container.B2Service, auditService)
+	RegisterSearchRoutes(api, container.DB, container.JWTSecret, container.PermissionService)
 	RegisterShareRoutes(api, container.JWTSecret, shareController)
+	RegisterPublicRoutes(api, shareService, container.FolderService, container.B2Service, inboxService, auditService)
+	RegisterNotificationRoutes(api, container.DB, container.JWTSecret)
+	RegisterAdminRoutes(api, container.DB, container.JWTSecret)
+	RegisterFavoriteRoutes(api, container.JWTSecret, favoriteService, container.PermissionService)
+	RegisterActivityRoutes(api, container.JWTSecret, auditService)
+	RegisterChunkedUploadRoutes(api, container.JWTSecret, uploadService, auditService)
 }
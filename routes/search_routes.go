@@ -9,12 +9,12 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterSearchRoutes(rg *gin.RouterGroup, db *mongo.Database, permService *services.PermissionService) {
+func RegisterSearchRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string, permService *services.PermissionService) {
 	// Initialize the search controller
 	searchController := controllers.NewSearchController(db, permService)
 
 	search := rg.Group("/search")
-	search.Use(middleware.AuthMiddleware("your-jwt-secret-here")) // All search routes require authentication
+	search.Use(middleware.AuthMiddleware(jwtSecret)) // All search routes require authentication
 	{
 		search.GET("/", searchController.Search)                   // GET /search?q=term
 		search.GET("/files", searchController.SearchFilesOnly)     // GET /search/files?q=term
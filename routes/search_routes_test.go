@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"phynixdrive/models"
+	"phynixdrive/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSearchRoutesAcceptTokensSignedWithConfiguredSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "configured-secret"
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("secret", func(mt *mtest.T) {
+		router := gin.New()
+		RegisterSearchRoutes(router.Group("/api"), mt.DB, secret, nil)
+
+		sign := func(key string) string {
+			t.Helper()
+			token, err := utils.GenerateJWTTokenWithSecret(&models.User{ID: primitive.NewObjectID(), Email: "u@example.com"}, key, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+		serve := func(token string) int {
+			req := httptest.NewRequest(http.MethodGet, "/api/search/?q=foo&sort=name", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.permissions", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.files", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.folders", mtest.FirstBatch),
+		)
+		if code := serve(sign(secret)); code != http.StatusOK {
+			t.Fatalf("configured secret: status = %d, want %d", code, http.StatusOK)
+		}
+		if code := serve(sign("your-jwt-secret-here")); code != http.StatusUnauthorized {
+			t.Fatalf("other secret: status = %d, want %d", code, http.StatusUnauthorized)
+		}
+	})
+}
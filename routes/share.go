@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"phynixdrive/config"
 	"phynixdrive/controllers"
 	"phynixdrive/middleware"
 
@@ -14,17 +15,29 @@ func RegisterShareRoutes(api *gin.RouterGroup, jwtSecret string, shareController
 	shareGroup.Use(middleware.AuthMiddleware(jwtSecret))
 
 	// Core sharing endpoints
-	shareGroup.POST("/", shareController.ShareResource) // Share a resource
-	shareGroup.POST("/bulk", shareController.BulkShare) // Bulk share resources
+	shareGroup.POST("/", shareController.ShareResource)        // Share a resource
+	shareGroup.POST("/bulk", shareController.BulkShare)        // Bulk share resources
+	shareGroup.GET("/validate", shareController.ValidateShare) // Dry-run a share for the share dialog
 
 	// Get shared resources
 	shareGroup.GET("/by-me", shareController.GetSharedByMe)
 	shareGroup.GET("/with-me", shareController.GetSharedWithMe)
+	shareGroup.DELETE("/with-me/:share_id", shareController.DeclineShare) // Recipient removes a share from their view
 	shareGroup.GET("/all", shareController.GetAllSharedResources)
+	shareGroup.GET("/effective", shareController.GetEffectiveAccess) // Direct and inherited access
 
 	// Permission management (fixed routes to avoid conflicts)
 	shareGroup.GET("/resource/:resource_type/:resource_id/permissions", shareController.GetResourcePermissions)
 	shareGroup.GET("/details/:share_id", shareController.GetShareDetails)
 	shareGroup.DELETE("/:share_id/revoke", shareController.RevokePermission)
 	shareGroup.PUT("/:share_id/update", shareController.UpdatePermission)
+
+	// Internal "copy link" tokens (login required, no per-email invite)
+	shareGroup.POST("/links", shareController.CreateShareLink)
+	shareGroup.POST("/links/:token/redeem", shareController.RedeemShareLink)
+	shareGroup.DELETE("/links/:link_id", shareController.RevokeShareLink)
+
+	// Public links (no account needed to open; served under /public/:token)
+	shareGroup.POST("/public-links", middleware.RequireFeature(config.FeaturePublicLinks), shareController.CreatePublicLink)
+	shareGroup.DELETE("/public-links/:link_id", shareController.RevokePublicLink)
 }
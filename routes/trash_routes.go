@@ -9,20 +9,23 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterTrashRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string, b2Service *services.B2Service) {
+func RegisterTrashRoutes(rg *gin.RouterGroup, db *mongo.Database, jwtSecret string, b2Service *services.B2Service, auditService *services.AuditService) {
 	// Initialize the trash controller
-	trashController := controllers.NewTrashController(db, b2Service)
+	trashController := controllers.NewTrashController(db, b2Service, auditService)
 
 	trash := rg.Group("/trash")
 	trash.Use(middleware.AuthMiddleware(jwtSecret)) // All trash routes require authentication with JWT secret
 	{
 		trash.GET("/", trashController.GetTrashItems)                 // GET /trash
-		trash.PATCH("/:id/restore", trashController.RestoreFromTrash) // PATCH /trash/:id/restore
+		trash.GET("/summary", trashController.GetTrashSummary)        // GET /trash/summary (counts, reclaimable bytes, next expiry)
+		trash.PATCH("/:id/restore", trashController.RestoreFromTrash) // PATCH /trash/:id/restore?type=file|folder&target_folder_id= (optional new location)
 		trash.DELETE("/:id/purge", trashController.PurgeFromTrash)    // DELETE /trash/:id/purge (permanent delete)
 
 		// Bulk operations
 		trash.POST("/restore-multiple", trashController.RestoreMultipleItems) // POST /trash/restore-multiple
-		trash.DELETE("/purge-all", trashController.PurgeAllTrash)             // DELETE /trash/purge-all
+		trash.POST("/purge-all/request", trashController.RequestPurgeAll)     // POST /trash/purge-all/request (confirmation token)
+		trash.DELETE("/purge-all", trashController.PurgeAllTrash)             // DELETE /trash/purge-all?confirmation_token=
+		trash.DELETE("/purge-expired", trashController.PurgeExpired)          // DELETE /trash/purge-expired (only items past retention)
 
 	}
 }
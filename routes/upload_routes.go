@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"phynixdrive/config"
+	"phynixdrive/controllers"
+	"phynixdrive/middleware"
+	"phynixdrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterChunkedUploadRoutes(rg *gin.RouterGroup, jwtSecret string, uploadService *services.ChunkedUploadService, auditService *services.AuditService) {
+	uploadController := controllers.NewChunkedUploadController(uploadService, auditService)
+
+	var maxConcurrentUploads int
+	if config.AppConfig != nil {
+		maxConcurrentUploads = int(config.AppConfig.MaxConcurrentUploads)
+	}
+
+	uploads := rg.Group("/uploads")
+	uploads.Use(middleware.AuthMiddleware(jwtSecret), middleware.RequireFeature(config.FeatureChunkedUpload))
+	{
+		uploads.POST("/init", uploadController.InitUpload)                                                                      // POST /uploads/init {filename, size, relative_path?, sha1?}
+		uploads.GET("/:id", uploadController.GetUpload)                                                                         // GET /uploads/:id (received and missing parts, for resuming)
+		uploads.PUT("/:id/parts/:n", middleware.UploadConcurrencyMiddleware(maxConcurrentUploads), uploadController.UploadPart) // PUT /uploads/:id/parts/:n (raw bytes, optional X-Content-SHA1)
+		uploads.POST("/:id/complete", uploadController.CompleteUpload)                                                          // POST /uploads/:id/complete
+		uploads.DELETE("/:id", uploadController.AbortUpload)                                                                    // DELETE /uploads/:id
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdminService backs support tooling that acts across user accounts
+type AdminService struct {
+	userCollection *mongo.Collection
+	auditService   *AuditService
+	jwtSecret      string
+}
+
+// ImpersonationToken is a short-lived token that acts as another user
+type ImpersonationToken struct {
+	Token          string    `json:"token"`
+	UserID         string    `json:"user_id"`
+	ImpersonatedBy string    `json:"impersonated_by"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func NewAdminService(db *mongo.Database, jwtSecret string) *AdminService {
+	return &AdminService{
+		userCollection: db.Collection("users"),
+		auditService:   NewAuditService(db),
+		jwtSecret:      jwtSecret,
+	}
+}
+
+func impersonationTTL() time.Duration {
+	if config.AppConfig != nil && config.AppConfig.ImpersonationTokenTTL > 0 {
+		return config.AppConfig.ImpersonationTokenTTL
+	}
+	return 15 * time.Minute
+}
+
+// Impersonate issues a token acting as targetID on behalf of adminID. The grant is audited
+// before the token is returned, so an impersonation can never happen without a record.
+// Other admins cannot be impersonated, which keeps the token from carrying admin rights.
+func (s *AdminService) Impersonate(ctx context.Context, adminID, targetID, ipAddress string) (*ImpersonationToken, error) {
+	targetObjID, err := primitive.ObjectIDFromHex(targetID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if adminID == targetID {
+		return nil, fmt.Errorf("cannot impersonate yourself")
+	}
+
+	var target models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": targetObjID}).Decode(&target)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if target.Role == "admin" {
+		return nil, fmt.Errorf("cannot impersonate an admin")
+	}
+
+	ttl := impersonationTTL()
+	err = s.auditService.Record(ctx, models.AuditLog{
+		Action:    AuditActionImpersonate,
+		ActorID:   adminID,
+		TargetID:  targetID,
+		IPAddress: ipAddress,
+		Details:   map[string]string{"ttl": ttl.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := utils.GenerateImpersonationToken(&target, adminID, s.jwtSecret, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &ImpersonationToken{
+		Token:          token,
+		UserID:         targetID,
+		ImpersonatedBy: adminID,
+		ExpiresAt:      expiresAt,
+	}, nil
+}
+
+// SetUserQuota sets a user's storage quota in bytes. Zero clears it so the configured
+// default applies again. Lowering a quota below current usage only blocks new uploads.
+func (s *AdminService) SetUserQuota(ctx context.Context, adminID, userID string, maxStorage int64) (*models.User, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if maxStorage < 0 {
+		return nil, fmt.Errorf("invalid quota: must not be negative")
+	}
+
+	var user models.User
+	err = s.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userObjID},
+		bson.M{"$set": bson.M{"max_storage": maxStorage, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	invalidateUser(userObjID)
+
+	err = s.auditService.Record(ctx, models.AuditLog{
+		Action:   AuditActionSetQuota,
+		ActorID:  adminID,
+		TargetID: userID,
+		Details:  map[string]string{"max_storage": strconv.FormatInt(maxStorage, 10)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"phynixdrive/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestImpersonateIssuesAuditedTokenForTargetUser(t *testing.T) {
+	const secret = "test-secret"
+	adminID := primitive.NewObjectID().Hex()
+
+	mt := newMockDB(t)
+	mt.Run("user", func(mt *mtest.T) {
+		service := NewAdminService(mt.DB, secret)
+		mt.ClearEvents()
+		targetID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.users", bson.D{
+				{Key: "_id", Value: targetID},
+				{Key: "email", Value: "user@example.com"},
+				{Key: "role", Value: "user"},
+			}),
+			mtest.CreateSuccessResponse(), // audit log insert
+		)
+
+		result, err := service.Impersonate(context.Background(), adminID, targetID.Hex(), "192.0.2.1")
+		if err != nil {
+			t.Fatalf("Impersonate: %v", err)
+		}
+		if result.UserID != targetID.Hex() || result.ImpersonatedBy != adminID {
+			t.Fatalf("result = %+v, want a token for the target issued by the admin", result)
+		}
+
+		claims, err := utils.VerifyJWTTokenWithSecret(result.Token, secret)
+		if err != nil {
+			t.Fatalf("token does not verify: %v", err)
+		}
+		if claims.UserID != targetID.Hex() || claims.Email != "user@example.com" || claims.ImpersonatedBy != adminID {
+			t.Fatalf("claims = %+v, want the target user flagged with the admin", claims)
+		}
+
+		inserts := commands(mt, "insert")
+		if len(inserts) != 1 {
+			t.Fatalf("got %d inserts, want the audit entry", len(inserts))
+		}
+		entry := inserts[0].Command.Lookup("documents", "0").Document()
+		if entry.Lookup("action").StringValue() != AuditActionImpersonate ||
+			entry.Lookup("actor_id").StringValue() != adminID ||
+			entry.Lookup("target_id").StringValue() != targetID.Hex() ||
+			entry.Lookup("ip_address").StringValue() != "192.0.2.1" {
+			t.Fatalf("audit entry = %v", entry)
+		}
+	})
+
+	mt.Run("admin", func(mt *mtest.T) {
+		service := NewAdminService(mt.DB, secret)
+		mt.ClearEvents()
+		targetID := primitive.NewObjectID()
+
+		mt.AddMockResponses(cursor("test.users", bson.D{
+			{Key: "_id", Value: targetID},
+			{Key: "role", Value: "admin"},
+		}))
+
+		_, err := service.Impersonate(context.Background(), adminID, targetID.Hex(), "192.0.2.1")
+		if err == nil || err.Error() != "cannot impersonate an admin" {
+			t.Fatalf("err = %v, want admins refused", err)
+		}
+		if inserts := commands(mt, "insert"); len(inserts) != 0 {
+			t.Fatal("a refused impersonation must not be recorded as granted")
+		}
+	})
+}
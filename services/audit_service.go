@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"phynixdrive/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions
+const (
+	AuditActionImpersonate = "impersonate"
+	AuditActionSetQuota    = "set_quota"
+
+	// Resource events, shown in a file or folder's activity
+	AuditActionCreate   = "create"
+	AuditActionRename   = "rename"
+	AuditActionMove     = "move"
+	AuditActionDelete   = "delete"
+	AuditActionShare    = "share"
+	AuditActionDownload = "download"
+	AuditActionRestore  = "restore"
+	AuditActionPurge    = "purge"
+)
+
+// AuditService appends entries to the audit_logs collection
+type AuditService struct {
+	auditCollection   *mongo.Collection
+	fileCollection    *mongo.Collection
+	folderCollection  *mongo.Collection
+	permissionService *PermissionService
+}
+
+func NewAuditService(db *mongo.Database) *AuditService {
+	service := &AuditService{
+		auditCollection:   db.Collection("audit_logs"),
+		fileCollection:    db.Collection("files"),
+		folderCollection:  db.Collection("folders"),
+		permissionService: NewPermissionService(db),
+	}
+	service.createIndexes()
+	return service
+}
+
+func (s *AuditService) createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.auditCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create audit log indexes: %v", err)
+	}
+}
+
+// Record stores an audit entry, stamping its time
+func (s *AuditService) Record(ctx context.Context, entry models.AuditLog) error {
+	entry.CreatedAt = time.Now()
+	if _, err := s.auditCollection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// RecordActivity stores an event on a file or folder. It runs after the operation has
+// already succeeded, so a failed write is logged rather than returned.
+func (s *AuditService) RecordActivity(ctx context.Context, action, actorID, resourceType, resourceID, ipAddress string, details map[string]string) {
+	err := s.Record(ctx, models.AuditLog{
+		Action:     action,
+		ActorID:    actorID,
+		TargetID:   resourceID,
+		TargetType: resourceType,
+		IPAddress:  ipAddress,
+		Details:    details,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to record %s of %s %s: %v", action, resourceType, resourceID, err)
+	}
+}
+
+// GetResourceActivity returns one page of a file or folder's events, oldest first, and the
+// total count. The owner can always read it, even while the resource is in trash, so they
+// can find out who deleted it; anyone else needs admin on the resource.
+func (s *AuditService) GetResourceActivity(ctx context.Context, userID, resourceType, resourceID string, limit, offset int) ([]models.AuditLog, int64, error) {
+	collection := s.folderCollection
+	switch resourceType {
+	case "file":
+		collection = s.fileCollection
+	case "folder":
+	default:
+		return nil, 0, fmt.Errorf("invalid resource type: %s", resourceType)
+	}
+
+	objID, err := primitive.ObjectIDFromHex(resourceID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid %s ID: %w", resourceType, err)
+	}
+
+	var resource struct {
+		OwnerID primitive.ObjectID `bson:"owner_id"`
+	}
+	err = collection.FindOne(ctx, bson.M{"_id": objID},
+		options.FindOne().SetProjection(bson.M{"owner_id": 1})).Decode(&resource)
+	if err == mongo.ErrNoDocuments {
+		return nil, 0, fmt.Errorf("%s not found", resourceType)
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+
+	if resource.OwnerID.Hex() != userID {
+		if err := s.permissionService.CheckAccess(ctx, userID, resourceType, resourceID, "admin"); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	filter := bson.M{"target_type": resourceType, "target_id": resourceID}
+	total, err := s.auditCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count activity: %w", err)
+	}
+
+	cursor, err := s.auditCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get activity: %w", err)
+	}
+
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode activity: %w", err)
+	}
+	return entries, total, nil
+}
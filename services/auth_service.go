@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"phynixdrive/config"
 	"phynixdrive/models"
 	"phynixdrive/utils"
 	"strings"
@@ -28,10 +29,13 @@ var (
 	ErrEmailNotVerified = errors.New("email not verified")
 	ErrInvalidProvider  = errors.New("unsupported authentication provider")
 	ErrInvalidState     = errors.New("invalid or expired OAuth state")
+	// ErrGoogleReauthRequired means the stored Google refresh token is missing or was revoked
+	ErrGoogleReauthRequired = errors.New("google authorization expired or revoked")
 )
 
 type AuthService struct {
 	userCollection     *mongo.Collection
+	refreshCollection  *mongo.Collection
 	jwtSecret          string
 	googleClientID     string
 	googleClientSecret string
@@ -45,9 +49,10 @@ type StateManager struct {
 }
 
 type StateInfo struct {
-	CreatedAt time.Time
-	ExpiresAt time.Time
-	Used      bool
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Used        bool
+	RedirectURL string
 }
 
 func NewStateManager() *StateManager {
@@ -73,6 +78,25 @@ func (sm *StateManager) Store(state string, duration time.Duration) {
 	log.Printf("[StateManager] Stored state: %s, expires at: %s", state, now.Add(duration).Format(time.RFC3339))
 }
 
+// SetRedirect attaches a post-login destination to a stored state
+func (sm *StateManager) SetRedirect(state, redirectURL string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if info, exists := sm.states[state]; exists {
+		info.RedirectURL = redirectURL
+		sm.states[state] = info
+	}
+}
+
+// Redirect returns the destination stored with a state without consuming it
+func (sm *StateManager) Redirect(state string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.states[state].RedirectURL
+}
+
 func (sm *StateManager) Validate(state string) bool {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -170,6 +194,7 @@ func (fb *FlexibleBool) UnmarshalJSON(data []byte) error {
 func NewAuthService(db *mongo.Database, jwtSecret, googleClientID, googleClientSecret, redirectURL string) *AuthService {
 	service := &AuthService{
 		userCollection:     db.Collection("users"),
+		refreshCollection:  db.Collection("refresh_tokens"),
 		jwtSecret:          jwtSecret,
 		googleClientID:     googleClientID,
 		googleClientSecret: googleClientSecret,
@@ -199,6 +224,15 @@ func (s *AuthService) createIndexes() {
 	if err != nil {
 		log.Printf("Warning: Failed to create indexes: %v", err)
 	}
+
+	_, err = s.refreshCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		// Records only matter until the token they back has expired
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create refresh token indexes: %v", err)
+	}
 }
 
 const OAuthStateExpiration = 10 * time.Minute
@@ -218,6 +252,16 @@ func (s *AuthService) GenerateState() (string, error) {
 	return state, nil
 }
 
+// SetStateRedirect remembers where to send the user once the OAuth flow for state completes
+func (s *AuthService) SetStateRedirect(state, redirectURL string) {
+	s.stateManager.SetRedirect(state, redirectURL)
+}
+
+// StateRedirect returns the destination stored for state; call it before ValidateState consumes it
+func (s *AuthService) StateRedirect(state string) string {
+	return s.stateManager.Redirect(state)
+}
+
 func (s *AuthService) ValidateState(state string) bool {
 	log.Printf("[AuthService] Validating state: %s", state)
 
@@ -373,6 +417,14 @@ func (s *AuthService) createOrUpdateUser(googleInfo *GoogleTokenInfo, refreshTok
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if refreshToken != "" {
+		encrypted, err := utils.EncryptToken(refreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+		refreshToken = encrypted
+	}
+
 	var user models.User
 
 	err := s.userCollection.FindOne(ctx, bson.M{"email": googleInfo.Email}).Decode(&user)
@@ -386,7 +438,7 @@ func (s *AuthService) createOrUpdateUser(googleInfo *GoogleTokenInfo, refreshTok
 			ProfilePic:   googleInfo.Picture,
 			Role:         "user",
 			UsedStorage:  0,
-			MaxStorage:   2 * 1024 * 1024 * 1024,
+			MaxStorage:   configuredStorageLimit(),
 			RefreshToken: refreshToken,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
@@ -419,6 +471,7 @@ func (s *AuthService) createOrUpdateUser(googleInfo *GoogleTokenInfo, refreshTok
 		if err != nil {
 			return nil, fmt.Errorf("failed to update user: %w", err)
 		}
+		invalidateUser(user.ID)
 
 		err = s.userCollection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(&user)
 		if err != nil {
@@ -430,6 +483,205 @@ func (s *AuthService) createOrUpdateUser(googleInfo *GoogleTokenInfo, refreshTok
 	return &user, nil
 }
 
+// refreshTokenRecord backs one outstanding refresh token. It is deleted when the token is
+// redeemed or revoked, so a token without a record is no longer accepted.
+type refreshTokenRecord struct {
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// IssueRefreshToken returns a long-lived, single-use token for /auth/refresh-google, or ""
+// when the user has no stored Google refresh token to refresh with
+func (s *AuthService) IssueRefreshToken(ctx context.Context, user *models.User) (string, error) {
+	if user.RefreshToken == "" {
+		return "", nil
+	}
+
+	ttl := 30 * 24 * time.Hour
+	if config.AppConfig != nil && config.AppConfig.RefreshTokenTTL > 0 {
+		ttl = config.AppConfig.RefreshTokenTTL
+	}
+
+	now := time.Now()
+	record := refreshTokenRecord{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if _, err := s.refreshCollection.InsertOne(ctx, record); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return utils.GenerateRefreshToken(user.ID.Hex(), record.ID, user.TokenVersion, s.jwtSecret, ttl)
+}
+
+// RevokeRefreshToken retires one refresh token of the user. Tokens that don't verify or
+// belong to someone else are ignored: there is nothing of theirs to revoke.
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, userID, refreshToken string) error {
+	claims, err := utils.VerifyRefreshToken(refreshToken, s.jwtSecret)
+	if err != nil || claims.ID == "" || claims.UserID != userID {
+		return nil
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil
+	}
+
+	if _, err := s.refreshCollection.DeleteOne(ctx, bson.M{"_id": claims.ID, "user_id": userObjID}); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllRefreshTokens retires every refresh token issued to the user
+func (s *AuthService) RevokeAllRefreshTokens(ctx context.Context, userID string) error {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if _, err := s.refreshCollection.DeleteMany(ctx, bson.M{"user_id": userObjID}); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// redeemRefreshToken deletes the token's record, so a second use of the same token fails
+func (s *AuthService) redeemRefreshToken(ctx context.Context, tokenID string, userID primitive.ObjectID) error {
+	result, err := s.refreshCollection.DeleteOne(ctx, bson.M{"_id": tokenID, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RefreshWithGoogle mints a new session once the JWT has expired. The refresh token only
+// identifies the user; Google has to accept their stored refresh token and return an ID token
+// for the same account, so revoking the app in Google also ends these refreshes.
+// Each refresh token is redeemed on first use, before Google is asked, so a replayed token
+// fails even when the original request is still in flight.
+// It returns the user, a new JWT and a new refresh token.
+func (s *AuthService) RefreshWithGoogle(ctx context.Context, refreshToken string) (*models.User, string, string, error) {
+	claims, err := utils.VerifyRefreshToken(refreshToken, s.jwtSecret)
+	if err != nil || claims.ID == "" {
+		return nil, "", "", ErrInvalidToken
+	}
+	userObjID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, "", "", ErrInvalidToken
+	}
+	if err := s.redeemRefreshToken(ctx, claims.ID, userObjID); err != nil {
+		return nil, "", "", err
+	}
+
+	var user models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, "", "", ErrInvalidToken
+	} else if err != nil {
+		return nil, "", "", fmt.Errorf("database error: %w", err)
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, "", "", ErrInvalidToken
+	}
+	if user.RefreshToken == "" {
+		return nil, "", "", ErrGoogleReauthRequired
+	}
+
+	googleRefreshToken, err := utils.DecryptToken(user.RefreshToken)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read stored refresh token: %w", err)
+	}
+
+	tokenResponse, err := s.refreshGoogleTokens(googleRefreshToken)
+	if err == ErrGoogleReauthRequired {
+		if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": user.ID},
+			bson.M{"$unset": bson.M{"refresh_token": ""}}); err != nil {
+			log.Printf("[AuthService] Failed to clear revoked refresh token for %s: %v", user.Email, err)
+		}
+		invalidateUser(user.ID)
+		return nil, "", "", ErrGoogleReauthRequired
+	} else if err != nil {
+		return nil, "", "", err
+	}
+
+	googleInfo, err := s.ValidateGoogleIDToken(tokenResponse.IDToken)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if googleInfo.ID != user.GoogleID {
+		return nil, "", "", ErrInvalidToken
+	}
+
+	// Google may rotate the refresh token; tokens stored before encryption are sealed now too
+	if tokenResponse.RefreshToken != "" || !utils.IsEncryptedToken(user.RefreshToken) {
+		if tokenResponse.RefreshToken != "" {
+			googleRefreshToken = tokenResponse.RefreshToken
+		}
+		encrypted, err := utils.EncryptToken(googleRefreshToken)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+		if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": user.ID},
+			bson.M{"$set": bson.M{"refresh_token": encrypted, "updated_at": time.Now()}}); err != nil {
+			return nil, "", "", fmt.Errorf("failed to update user: %w", err)
+		}
+		invalidateUser(user.ID)
+		user.RefreshToken = encrypted
+	}
+
+	jwtToken, err := utils.GenerateJWTTokenWithSecret(&user, s.jwtSecret, 24)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate JWT: %w", err)
+	}
+	newRefreshToken, err := s.IssueRefreshToken(ctx, &user)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return &user, jwtToken, newRefreshToken, nil
+}
+
+// refreshGoogleTokens trades a Google refresh token for a fresh ID token
+func (s *AuthService) refreshGoogleTokens(refreshToken string) (*GoogleTokenResponse, error) {
+	data := url.Values{
+		"client_id":     {s.googleClientID},
+		"client_secret": {s.googleClientSecret},
+		"refresh_token": {refreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm("https://oauth2.googleapis.com/token", data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh Google tokens: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse GoogleTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	// invalid_grant is Google's answer for a revoked or expired refresh token
+	if tokenResponse.Error == "invalid_grant" {
+		return nil, ErrGoogleReauthRequired
+	}
+	if tokenResponse.Error != "" {
+		return nil, fmt.Errorf("OAuth token refresh error: %s", tokenResponse.Error)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("no ID token received")
+	}
+
+	return &tokenResponse, nil
+}
+
 func (s *AuthService) GenerateJWT(userID, email string) (string, error) {
 	user, err := s.GetUserProfile(userID)
 	if err != nil {
@@ -468,3 +720,49 @@ func (s *AuthService) GetUserProfile(userID string) (*models.User, error) {
 
 	return &user, nil
 }
+
+// GetPreferences returns the user's stored UI preferences, or empty ones if none are set.
+func (s *AuthService) GetPreferences(userID string) (*models.UserPreferences, error) {
+	user, err := s.GetUserProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Preferences == nil {
+		return &models.UserPreferences{}, nil
+	}
+	return user.Preferences, nil
+}
+
+// UpdatePreferences validates and stores the user's default sort preference.
+// An empty sort field clears the preference.
+func (s *AuthService) UpdatePreferences(userID string, prefs models.UserPreferences) (*models.UserPreferences, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	sortOpt, err := ParseSortOption(prefs.SortField, prefs.SortDirection)
+	if err != nil {
+		return nil, err
+	}
+	stored := models.UserPreferences{SortField: sortOpt.Field, SortDirection: sortOpt.Direction}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+		"$set": bson.M{
+			"preferences": stored,
+			"updated_at":  time.Now(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrUserNotFound
+	}
+	invalidateUser(objID)
+
+	return &stored, nil
+}
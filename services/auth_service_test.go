@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+const testJWTSecret = "test-secret"
+
+func TestIssueRefreshTokenStoresItsJTI(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("issue", func(mt *mtest.T) {
+		service := NewAuthService(mt.DB, testJWTSecret, "", "", "")
+		user := &models.User{ID: primitive.NewObjectID(), RefreshToken: "sealed"}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		token, err := service.IssueRefreshToken(context.Background(), user)
+		if err != nil {
+			t.Fatalf("IssueRefreshToken: %v", err)
+		}
+
+		claims, err := utils.VerifyRefreshToken(token, testJWTSecret)
+		if err != nil {
+			t.Fatalf("VerifyRefreshToken: %v", err)
+		}
+		inserts := commands(mt, "insert")
+		if len(inserts) != 1 {
+			t.Fatalf("got %d inserts, want 1", len(inserts))
+		}
+		stored := inserts[0].Command.Lookup("documents", "0", "_id").StringValue()
+		if claims.ID == "" || claims.ID != stored {
+			t.Fatalf("jti %q does not match the stored record %q", claims.ID, stored)
+		}
+	})
+}
+
+func TestRefreshWithGoogleRejectsSpentToken(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("spent", func(mt *mtest.T) {
+		service := NewAuthService(mt.DB, testJWTSecret, "", "", "")
+		userID := primitive.NewObjectID()
+		token, err := utils.GenerateRefreshToken(userID.Hex(), primitive.NewObjectID().Hex(), 0, testJWTSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The record is already gone: the token was redeemed or revoked
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if _, _, _, err := service.RefreshWithGoogle(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("err = %v, want ErrInvalidToken", err)
+		}
+		if finds := commands(mt, "find"); len(finds) != 0 {
+			t.Fatal("a spent token must be rejected before the user is loaded")
+		}
+	})
+}
+
+func TestRefreshWithGoogleRejectsTokenWithoutJTI(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("no jti", func(mt *mtest.T) {
+		service := NewAuthService(mt.DB, testJWTSecret, "", "", "")
+		token, err := utils.GenerateRefreshToken(primitive.NewObjectID().Hex(), "", 0, testJWTSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, _, err := service.RefreshWithGoogle(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("err = %v, want ErrInvalidToken", err)
+		}
+		if deletes := commands(mt, "delete"); len(deletes) != 0 {
+			t.Fatal("a token without a jti has no record to redeem")
+		}
+	})
+}
+
+func TestNewUsersGetConfiguredStorageLimit(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{MaxUserStorage: 5 << 30}
+	defer func() { config.AppConfig = previous }()
+
+	mt := newMockDB(t)
+	mt.Run("new user", func(mt *mtest.T) {
+		service := NewAuthService(mt.DB, testJWTSecret, "", "", "")
+
+		mt.AddMockResponses(cursor("test.users"), mtest.CreateSuccessResponse())
+		user, err := service.createOrUpdateUser(&GoogleTokenInfo{ID: "g1", Email: "new@example.com"}, "")
+		if err != nil {
+			t.Fatalf("createOrUpdateUser: %v", err)
+		}
+
+		if user.MaxStorage != 5<<30 {
+			t.Fatalf("MaxStorage = %d, want %d", user.MaxStorage, int64(5<<30))
+		}
+		inserted := commands(mt, "insert")[0].Command.Lookup("documents", "0", "max_storage").Int64()
+		if inserted != 5<<30 {
+			t.Fatalf("stored max_storage = %d, want %d", inserted, int64(5<<30))
+		}
+	})
+}
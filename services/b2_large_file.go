@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kurin/blazer/base"
+)
+
+// largeFileClient drives B2's large file API for chunked uploads, which the high level client
+// only uses internally. The base package keeps large file IDs private, so unfinished uploads
+// are found again by object name; names are unique per upload session.
+type largeFileClient struct {
+	keyID          string
+	applicationKey string
+	bucketName     string
+
+	mu      sync.Mutex
+	account *base.B2
+	bucket  *base.Bucket
+	files   map[string]*base.File
+}
+
+func newLargeFileClient(keyID, applicationKey, bucketName string) *largeFileClient {
+	return &largeFileClient{
+		keyID:          keyID,
+		applicationKey: applicationKey,
+		bucketName:     bucketName,
+		files:          make(map[string]*base.File),
+	}
+}
+
+func (l *largeFileClient) connect(ctx context.Context) (*base.Bucket, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.bucket != nil {
+		return l.bucket, nil
+	}
+
+	account, err := base.AuthorizeAccount(ctx, l.keyID, l.applicationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize B2 account: %w", err)
+	}
+	buckets, err := account.ListBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list B2 buckets: %w", err)
+	}
+	for _, bucket := range buckets {
+		if bucket.Name == l.bucketName {
+			l.account, l.bucket = account, bucket
+			return bucket, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get bucket %s", l.bucketName)
+}
+
+// do runs op, re-authorizing and retrying once if B2 reports the account token has expired.
+// Handles share the account, so refreshing it in place also refreshes them.
+func (l *largeFileClient) do(ctx context.Context, op func(bucket *base.Bucket) error) error {
+	bucket, err := l.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = op(bucket)
+	if err == nil || base.Action(err) != base.ReAuthenticate {
+		return err
+	}
+
+	account, authErr := base.AuthorizeAccount(ctx, l.keyID, l.applicationKey)
+	if authErr != nil {
+		return fmt.Errorf("failed to authorize B2 account: %w", authErr)
+	}
+	l.mu.Lock()
+	l.account.Update(account)
+	l.mu.Unlock()
+
+	return op(bucket)
+}
+
+// unfinished returns the handle of the unfinished large file stored as objectName
+func (l *largeFileClient) unfinished(ctx context.Context, bucket *base.Bucket, objectName string) (*base.File, error) {
+	l.mu.Lock()
+	file, ok := l.files[objectName]
+	l.mu.Unlock()
+	if ok {
+		return file, nil
+	}
+
+	continuation := ""
+	for {
+		files, next, err := bucket.ListUnfinishedLargeFiles(ctx, 100, continuation)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.Name == objectName {
+				l.mu.Lock()
+				l.files[objectName] = f
+				l.mu.Unlock()
+				return f, nil
+			}
+		}
+		if next == "" || len(files) == 0 {
+			return nil, fmt.Errorf("upload not found in storage")
+		}
+		continuation = next
+	}
+}
+
+func (l *largeFileClient) forget(objectName string) {
+	l.mu.Lock()
+	delete(l.files, objectName)
+	l.mu.Unlock()
+}
+
+// StartLargeFile begins a B2 large file that parts can then be uploaded to in any order
+func (s *B2Service) StartLargeFile(ctx context.Context, objectName, contentType string) error {
+	err := s.largeFiles.do(ctx, func(bucket *base.Bucket) error {
+		_, err := bucket.StartLargeFile(ctx, objectName, contentType, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start large file in B2: %w", err)
+	}
+	return nil
+}
+
+// UploadPart stores one part of an unfinished large file. Part numbers start at 1 and
+// uploading the same number again replaces the earlier part.
+func (s *B2Service) UploadPart(ctx context.Context, objectName string, partNumber int, data []byte, sha1Hex string) error {
+	err := s.largeFiles.do(ctx, func(bucket *base.Bucket) error {
+		file, err := s.largeFiles.unfinished(ctx, bucket, objectName)
+		if err != nil {
+			return err
+		}
+		chunk, err := file.CompileParts(0, nil).GetUploadPartURL(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = chunk.UploadPart(ctx, bytes.NewReader(data), sha1Hex, len(data), partNumber)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload part %d to B2: %w", partNumber, err)
+	}
+	return nil
+}
+
+// FinishLargeFile assembles the uploaded parts into a regular object. partSHA1s must hold
+// every part, keyed by part number.
+func (s *B2Service) FinishLargeFile(ctx context.Context, objectName string, size int64, partSHA1s map[int]string) error {
+	err := s.largeFiles.do(ctx, func(bucket *base.Bucket) error {
+		file, err := s.largeFiles.unfinished(ctx, bucket, objectName)
+		if err != nil {
+			return err
+		}
+		_, err = file.CompileParts(size, partSHA1s).FinishLargeFile(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to finish large file in B2: %w", err)
+	}
+	s.largeFiles.forget(objectName)
+	return nil
+}
+
+// CancelLargeFile discards an unfinished large file and all of its parts
+func (s *B2Service) CancelLargeFile(ctx context.Context, objectName string) error {
+	err := s.largeFiles.do(ctx, func(bucket *base.Bucket) error {
+		file, err := s.largeFiles.unfinished(ctx, bucket, objectName)
+		if err != nil {
+			return err
+		}
+		return file.CompileParts(0, nil).CancelLargeFile(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel large file in B2: %w", err)
+	}
+	s.largeFiles.forget(objectName)
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
@@ -15,16 +16,21 @@ import (
 )
 
 type B2Service struct {
-	client     *b2.Client
-	bucketName string
-	bucket     *b2.Bucket
+	client       *b2.Client
+	bucketName   string
+	bucket       *b2.Bucket
+	objectPrefix string
+	objectScheme string
+	publicBucket bool
+	expiryMargin time.Duration
+	largeFiles   *largeFileClient
 }
 
 type UploadResult struct {
 	FileID      string
 	FileName    string
-	DownloadURL string // Signed URL for download (longer expiry)
-	PreviewURL  string // Signed URL for preview (shorter expiry)
+	DownloadURL string // Signed URL for download (longer expiry), or the plain URL on a public bucket
+	PreviewURL  string // Signed URL for preview (shorter expiry), or the plain URL on a public bucket
 	Size        int64
 	SHA1        string
 }
@@ -36,6 +42,14 @@ const (
 	URLTypePreview  URLType = "preview"
 )
 
+// Object name schemes: "path" mirrors the client's folder layout, "flat" keeps only the file ID
+const (
+	ObjectSchemePath = "path"
+	ObjectSchemeFlat = "flat"
+)
+
+const maxObjectSegmentLength = 100
+
 func NewB2Service(keyID, applicationKey, bucketName string) (*B2Service, error) {
 	ctx := context.Background()
 
@@ -50,33 +64,119 @@ func NewB2Service(keyID, applicationKey, bucketName string) (*B2Service, error)
 	}
 
 	return &B2Service{
-		client:     client,
-		bucketName: bucketName,
-		bucket:     bucket,
+		client:       client,
+		bucketName:   bucketName,
+		bucket:       bucket,
+		objectPrefix: "users",
+		objectScheme: ObjectSchemePath,
+		largeFiles:   newLargeFileClient(keyID, applicationKey, bucketName),
 	}, nil
 }
 
-func (s *B2Service) UploadFile(file multipart.File, filename string, userID string, relativePath string) (*UploadResult, error) {
-	ctx := context.Background()
+// SetObjectNaming overrides the key prefix and scheme used by BuildObjectName
+func (s *B2Service) SetObjectNaming(prefix, scheme string) {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		s.objectPrefix = prefix
+	}
+	if scheme == ObjectSchemePath || scheme == ObjectSchemeFlat {
+		s.objectScheme = scheme
+	}
+}
+
+// SetBucketPublic switches URL generation between plain public URLs (allPublic buckets)
+// and signed authorization URLs (allPrivate buckets)
+func (s *B2Service) SetBucketPublic(public bool) {
+	s.publicBucket = public
+}
+
+// SetURLExpiryMargin adds a safety margin to every signed URL so clients with a skewed
+// clock don't see URLs expire early. Negative values are ignored.
+func (s *B2Service) SetURLExpiryMargin(margin time.Duration) {
+	if margin >= 0 {
+		s.expiryMargin = margin
+	}
+}
+
+// BuildObjectName derives a safe, unique B2 key for an upload. Client supplied path segments
+// are sanitized and the file ID is appended so two uploads never collide on the same key.
+func (s *B2Service) BuildObjectName(userID, fileID, relativePath, filename string) string {
+	ext := sanitizeObjectSegment(strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."))
+	if ext != "" {
+		ext = "." + ext
+	}
+	parts := []string{s.objectPrefix, sanitizeObjectSegment(userID)}
 
-	// Create object path
-	cleanPath := strings.TrimPrefix(relativePath, "/")
-	objectName := fmt.Sprintf("users/%s/%s", userID, cleanPath)
-	if cleanPath == "" {
-		objectName = fmt.Sprintf("users/%s/%s", userID, filename)
+	if s.objectScheme == ObjectSchemeFlat {
+		return strings.Join(append(parts, fileID+ext), "/")
 	}
 
+	if relativePath != "" {
+		for _, segment := range strings.Split(filepath.ToSlash(filepath.Dir(relativePath)), "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				continue
+			}
+			if clean := sanitizeObjectSegment(segment); clean != "" {
+				parts = append(parts, clean)
+			}
+		}
+	}
+
+	stem := sanitizeObjectSegment(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	if stem == "" {
+		return strings.Join(append(parts, fileID+ext), "/")
+	}
+	return strings.Join(append(parts, stem+"_"+fileID+ext), "/")
+}
+
+// sanitizeObjectSegment keeps ASCII letters, digits, dot, dash and underscore, replacing
+// anything else with an underscore, and trims the result to a sane length
+func sanitizeObjectSegment(segment string) string {
+	var b strings.Builder
+	lastUnderscore := false
+	for _, r := range segment {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			b.WriteRune(r)
+			lastUnderscore = false
+		default:
+			if !lastUnderscore {
+				b.WriteByte('_')
+				lastUnderscore = true
+			}
+		}
+	}
+
+	clean := strings.Trim(b.String(), "._")
+	if len(clean) > maxObjectSegmentLength {
+		clean = clean[:maxObjectSegmentLength]
+	}
+	return clean
+}
+
+// UploadFile streams the file to B2 as objectName. contentType is stored on the object so
+// direct B2 and CDN responses carry the right type; empty falls back to the extension.
+func (s *B2Service) UploadFile(file multipart.File, objectName, filename, contentType string) (*UploadResult, error) {
+	return s.UploadStream(file, objectName, filename, contentType)
+}
+
+// UploadStream uploads from any reader, recording the number of bytes written in Size
+func (s *B2Service) UploadStream(content io.Reader, objectName, filename, contentType string) (*UploadResult, error) {
+	ctx := context.Background()
+
 	// Create a B2 writer
 	obj := s.bucket.Object(objectName)
-	writer := obj.NewWriter(ctx)
-	// writer.ContentType = s.getContentType(filename)
+	if contentType == "" {
+		contentType = s.getContentType(filename)
+	}
+	writer := obj.NewWriter(ctx, b2.WithAttrsOption(&b2.Attrs{ContentType: contentType}))
 
 	// Instead of reading into memory, stream directly
 	hasher := sha1.New()
 	multiWriter := io.MultiWriter(writer, hasher)
 
 	// Copy from request → B2 → hash calculator
-	if _, err := io.Copy(multiWriter, file); err != nil {
+	size, err := io.Copy(multiWriter, content)
+	if err != nil {
 		writer.Close()
 		return nil, fmt.Errorf("failed to upload file to B2: %w", err)
 	}
@@ -101,33 +201,52 @@ func (s *B2Service) UploadFile(file multipart.File, filename string, userID stri
 		FileName:    filename,
 		DownloadURL: downloadURL,
 		PreviewURL:  previewURL,
+		Size:        size,
 		SHA1:        sha1Hash,
 	}, nil
 }
 
 // GetSignedURL generates a signed URL based on the type (download or preview)
 func (s *B2Service) GetSignedURL(objectName string, urlType URLType) (string, error) {
-	var duration time.Duration
+	return s.GetDownloadURL(objectName, urlDuration(urlType))
+}
 
+// urlDuration is the nominal lifetime of a signed URL of the given type
+func urlDuration(urlType URLType) time.Duration {
 	switch urlType {
 	case URLTypeDownload:
-		duration = 24 * time.Hour // 24 hours for download
+		return 24 * time.Hour // 24 hours for download
 	case URLTypePreview:
-		duration = 1 * time.Hour // 1 hour for preview
+		return 1 * time.Hour // 1 hour for preview
 	default:
-		duration = 1 * time.Hour
+		return 1 * time.Hour
 	}
+}
+
+// SignedURLExpiry is how long a signed URL of the given type actually stays valid,
+// including the clock skew margin
+func (s *B2Service) SignedURLExpiry(urlType URLType) time.Duration {
+	return urlDuration(urlType) + s.expiryMargin
+}
 
-	return s.GetDownloadURL(objectName, duration)
+// URLCacheTTL is how long a signed URL may be cached and reused. It stops at the nominal
+// lifetime so the margin is still left when a cached URL reaches a skewed client.
+func (s *B2Service) URLCacheTTL(urlType URLType) time.Duration {
+	return urlDuration(urlType)
 }
 
-// GetDownloadURL generates a signed download URL for private buckets
+// GetDownloadURL generates a signed download URL for private buckets, or the plain
+// object URL for public ones where no authorization is needed
 func (s *B2Service) GetDownloadURL(objectName string, duration time.Duration) (string, error) {
 	ctx := context.Background()
 	obj := s.bucket.Object(objectName)
 
+	if s.publicBucket {
+		return obj.URL(), nil
+	}
+
 	// Generate signed URL for GET requests
-	urlObj, err := obj.AuthURL(ctx, duration, "GET")
+	urlObj, err := obj.AuthURL(ctx, duration+s.expiryMargin, "GET")
 	if err != nil {
 		return "", fmt.Errorf("failed to generate signed URL: %w", err)
 	}
@@ -140,10 +259,14 @@ func (s *B2Service) GetDownloadURLWithHeaders(objectName, filename string, durat
 	ctx := context.Background()
 	obj := s.bucket.Object(objectName)
 
+	if s.publicBucket {
+		return obj.URL(), nil
+	}
+
 	// For download, we want to force download with proper filename
 	// Note: B2 doesn't support custom response headers in signed URLs directly
 	// This would need to be handled at the application level
-	urlObj, err := obj.AuthURL(ctx, duration, "GET")
+	urlObj, err := obj.AuthURL(ctx, duration+s.expiryMargin, "GET")
 	if err != nil {
 		return "", fmt.Errorf("failed to generate signed download URL: %w", err)
 	}
@@ -176,6 +299,47 @@ func (s *B2Service) RefreshURLs(objectName string) (downloadURL, previewURL stri
 	return downloadURL, previewURL, nil
 }
 
+// OpenReader streams an object's content from B2. The object is looked up first because
+// the reader itself only reports a missing object on the first Read.
+func (s *B2Service) OpenReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	obj := s.bucket.Object(objectName)
+	if _, err := obj.Attrs(ctx); err != nil {
+		return nil, fmt.Errorf("failed to open file in B2: %w", err)
+	}
+	return obj.NewReader(ctx), nil
+}
+
+// OpenRangeReader streams length bytes of an object starting at offset. A negative
+// length reads to the end.
+func (s *B2Service) OpenRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	obj := s.bucket.Object(objectName)
+	if _, err := obj.Attrs(ctx); err != nil {
+		return nil, fmt.Errorf("failed to open file in B2: %w", err)
+	}
+	return obj.NewRangeReader(ctx, offset, length), nil
+}
+
+// CopyObject duplicates an object under a new name by streaming it back through UploadStream,
+// which also recomputes the SHA1 for the copy
+func (s *B2Service) CopyObject(ctx context.Context, srcObjectName, dstObjectName, filename, contentType string) (*UploadResult, error) {
+	reader, err := s.OpenReader(ctx, srcObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return s.UploadStream(reader, dstObjectName, filename, contentType)
+}
+
+// CheckBucket confirms B2 is reachable and the credentials can still see the bucket.
+// It looks the bucket up through the client so the cached handle is left untouched.
+func (s *B2Service) CheckBucket(ctx context.Context) error {
+	if _, err := s.client.Bucket(ctx, s.bucketName); err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.bucketName, err)
+	}
+	return nil
+}
+
 func (s *B2Service) DeleteFile(objectName string) error {
 	ctx := context.Background()
 	obj := s.bucket.Object(objectName)
@@ -201,3 +365,11 @@ func (s *B2Service) IsPreviewableFile(filename string) bool {
 	}
 	return previewableExts[ext]
 }
+
+// getContentType derives a MIME type from the file extension
+func (s *B2Service) getContentType(filename string) string {
+	if ct := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kurin/blazer/b2"
+)
+
+// stubB2 answers just enough of the B2 API for uploads and signed URLs, recording what it was sent
+type stubB2 struct {
+	mu           sync.Mutex
+	contentTypes map[string]string // object name -> Content-Type of its upload
+	authDuration []int             // validDurationInSeconds of each download authorization
+}
+
+func newStubB2Service(t *testing.T) (*B2Service, *stubB2) {
+	t.Helper()
+	stub := &stubB2{contentTypes: map[string]string{}}
+
+	var srv *httptest.Server
+	reply := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b2api/v1/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{
+			"accountId": "acct", "authorizationToken": "token", "apiUrl": srv.URL, "downloadUrl": srv.URL,
+			"minimumPartSize": 5e6, "recommendedPartSize": 1e8, "absoluteMinimumPartSize": 5e6,
+		})
+	})
+	mux.HandleFunc("/b2api/v1/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"buckets": []map[string]interface{}{
+			{"bucketId": "bucket-id", "bucketName": "bucket", "bucketType": "allPrivate"},
+		}})
+	})
+	mux.HandleFunc("/b2api/v1/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"bucketId": "bucket-id", "uploadUrl": srv.URL + "/upload", "authorizationToken": "upload-token"})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		size, _ := io.Copy(io.Discard, r.Body)
+		name := r.Header.Get("X-Bz-File-Name")
+		stub.mu.Lock()
+		stub.contentTypes[name] = r.Header.Get("Content-Type")
+		stub.mu.Unlock()
+		reply(w, map[string]interface{}{
+			"fileId": "id-" + name, "fileName": name, "bucketId": "bucket-id", "contentLength": size,
+			"contentSha1": r.Header.Get("X-Bz-Content-Sha1"), "contentType": r.Header.Get("Content-Type"), "action": "upload",
+		})
+	})
+	mux.HandleFunc("/b2api/v1/b2_get_download_authorization", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Prefix   string `json:"fileNamePrefix"`
+			Duration int    `json:"validDurationInSeconds"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		stub.mu.Lock()
+		stub.authDuration = append(stub.authDuration, req.Duration)
+		stub.mu.Unlock()
+		reply(w, map[string]interface{}{"bucketId": "bucket-id", "fileNamePrefix": req.Prefix, "authorizationToken": "download-token"})
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	client, err := b2.NewClient(ctx, "acct", "key", b2.APIBase(srv.URL))
+	if err != nil {
+		t.Fatalf("stub client: %v", err)
+	}
+	bucket, err := client.Bucket(ctx, "bucket")
+	if err != nil {
+		t.Fatalf("stub bucket: %v", err)
+	}
+	return &B2Service{client: client, bucketName: "bucket", bucket: bucket, objectPrefix: "users", objectScheme: ObjectSchemePath}, stub
+}
+
+func (s *stubB2) contentType(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.contentTypes[name]
+}
+
+func TestUploadStreamPassesContentTypeToWriter(t *testing.T) {
+	service, stub := newStubB2Service(t)
+
+	tests := []struct {
+		name, filename, contentType, want string
+	}{
+		{"explicit", "report.bin", "application/pdf", "application/pdf"},
+		{"from extension", "photo.png", "", "image/png"},
+		{"unknown extension", "blob.zzz", "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		objectName := "users/u/" + tt.filename
+		if _, err := service.UploadStream(strings.NewReader("content"), objectName, tt.filename, tt.contentType); err != nil {
+			t.Fatalf("%s: UploadStream: %v", tt.name, err)
+		}
+		if got := stub.contentType(objectName); got != tt.want {
+			t.Errorf("%s: content type = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildObjectNameIsSafeAndUnique(t *testing.T) {
+	service := &B2Service{objectPrefix: "users", objectScheme: ObjectSchemePath}
+	safe := regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+	first := service.BuildObjectName("u1", "id1", "My Docs/Résumé ✓/x.pdf", "Résumé final ✓.PDF")
+	second := service.BuildObjectName("u1", "id2", "My Docs/Résumé ✓/x.pdf", "Résumé final ✓.PDF")
+
+	if want := "users/u1/My_Docs/R_sum/R_sum_final_id1.pdf"; first != want {
+		t.Fatalf("object name = %q, want %q", first, want)
+	}
+	if !safe.MatchString(first) {
+		t.Fatalf("object name %q has unsafe characters", first)
+	}
+	if first == second {
+		t.Fatal("same name and path must still yield distinct keys per file ID")
+	}
+
+	if got := service.BuildObjectName("u1", "id1", "../../etc/passwd", "passwd"); got != "users/u1/etc/passwd_id1" {
+		t.Fatalf("traversal segments kept: %q", got)
+	}
+
+	service.objectScheme = ObjectSchemeFlat
+	if got := service.BuildObjectName("u1", "id1", "a/b/c.txt", "c.txt"); got != "users/u1/id1.txt" {
+		t.Fatalf("flat scheme object name = %q", got)
+	}
+}
+
+func TestSignedURLExpiryIncludesSkewMargin(t *testing.T) {
+	service, stub := newStubB2Service(t)
+	service.SetURLExpiryMargin(2 * time.Minute)
+	service.SetURLExpiryMargin(-time.Minute) // ignored
+
+	if got := service.SignedURLExpiry(URLTypePreview); got != time.Hour+2*time.Minute {
+		t.Fatalf("preview expiry = %v, want 1h2m", got)
+	}
+	// Cached URLs are only reused for the nominal lifetime so the margin survives the cache
+	if got := service.URLCacheTTL(URLTypePreview); got != time.Hour {
+		t.Fatalf("preview cache TTL = %v, want 1h", got)
+	}
+
+	if _, err := service.GetPreviewURL("users/u/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GetDownloadURLForFile("users/u/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	want := []int{3720, 86520}
+	if len(stub.authDuration) != len(want) || stub.authDuration[0] != want[0] || stub.authDuration[1] != want[1] {
+		t.Fatalf("authorized durations = %v, want %v", stub.authDuration, want)
+	}
+}
+
+func TestURLFormFollowsBucketVisibility(t *testing.T) {
+	for _, public := range []bool{false, true} {
+		service, stub := newStubB2Service(t)
+		service.SetBucketPublic(public)
+
+		preview, err := service.GetPreviewURL("users/u/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		download, err := service.GetDownloadURLForFile("users/u/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stub.mu.Lock()
+		authorized := len(stub.authDuration)
+		stub.mu.Unlock()
+		for _, u := range []string{preview, download} {
+			signed := strings.Contains(u, "Authorization=")
+			if !strings.HasSuffix(strings.SplitN(u, "?", 2)[0], "/file/bucket/users/u/a.txt") {
+				t.Fatalf("public=%t: url %q does not address the object", public, u)
+			}
+			if signed == public {
+				t.Fatalf("public=%t: url %q signed=%t", public, u, signed)
+			}
+		}
+		// A public bucket needs no download authorization at all
+		if (public && authorized != 0) || (!public && authorized != 2) {
+			t.Fatalf("public=%t: %d download authorizations", public, authorized)
+		}
+	}
+}
@@ -0,0 +1,698 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"path/filepath"
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// B2 rejects parts under 5MB (other than the last) and large files with fewer than two parts
+const minChunkedPartSize = 5 * 1024 * 1024
+
+var checksumPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+const (
+	// backgroundHashTimeout bounds finishHash, which reads the unhashed rest of a file from B2
+	backgroundHashTimeout = time.Hour
+	// staleCompletingAfter is how long a session may sit in "completing" before the cleanup
+	// job treats the process that claimed it as gone
+	staleCompletingAfter = time.Hour
+)
+
+// ChunkedUploadService uploads large files in parts that can be retried and resumed.
+// Parts are sent straight to a B2 large file, which B2 assembles when the upload completes.
+type ChunkedUploadService struct {
+	sessionCollection *mongo.Collection
+	fileCollection    *mongo.Collection
+	userCollection    *mongo.Collection
+	fileService       *FileService
+	b2Service         *B2Service
+}
+
+// ChunkedUploadRequest starts a chunked upload
+type ChunkedUploadRequest struct {
+	Filename     string `json:"filename" binding:"required"`
+	RelativePath string `json:"relative_path"` // defaults to the filename, i.e. the root folder
+	Size         int64  `json:"size" binding:"required"`
+	ContentType  string `json:"content_type"` // used only when the extension is not recognised
+	SHA1         string `json:"sha1"`
+}
+
+// UploadSessionStatus is what a client needs to resume: the parts B2 already holds and those still missing
+type UploadSessionStatus struct {
+	*models.UploadSession
+	ReceivedParts []int `json:"received_parts"`
+	MissingParts  []int `json:"missing_parts"`
+}
+
+func NewChunkedUploadService(db *mongo.Database, fileService *FileService, b2Service *B2Service) *ChunkedUploadService {
+	return &ChunkedUploadService{
+		sessionCollection: db.Collection("upload_sessions"),
+		fileCollection:    db.Collection("files"),
+		userCollection:    db.Collection("users"),
+		fileService:       fileService,
+		b2Service:         b2Service,
+	}
+}
+
+// chunkedUploadLimits returns the part size, the largest file accepted and how long a session
+// stays open. Unless CHUNKED_UPLOAD_MAX_FILE_SIZE raises it, chunked uploads are held to the
+// same MAX_FILE_SIZE as regular uploads; chunking makes them resumable, not bigger.
+func chunkedUploadLimits() (partSize, maxFileSize int64, ttl time.Duration) {
+	partSize, maxFileSize, ttl = 10*1024*1024, 100*1024*1024, 24*time.Hour
+	if config.AppConfig != nil {
+		if config.AppConfig.ChunkedUploadPartSize > 0 {
+			partSize = max(config.AppConfig.ChunkedUploadPartSize, minChunkedPartSize)
+		}
+		if config.AppConfig.ChunkedUploadMaxFileSize > 0 {
+			maxFileSize = config.AppConfig.ChunkedUploadMaxFileSize
+		} else if config.AppConfig.MaxFileSize > 0 {
+			maxFileSize = config.AppConfig.MaxFileSize
+		}
+		if config.AppConfig.UploadSessionTTL > 0 {
+			ttl = config.AppConfig.UploadSessionTTL
+		}
+	}
+	return partSize, maxFileSize, ttl
+}
+
+// InitUpload validates the file against the user's limits and opens a session for its parts.
+// The file is checked against the quota again on completion since usage may change meanwhile.
+func (s *ChunkedUploadService) InitUpload(ctx context.Context, userID string, request ChunkedUploadRequest) (*UploadSessionStatus, error) {
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	name := filepath.Base(strings.ReplaceAll(request.Filename, "\\", "/"))
+	if err := utils.ValidateFileName(name); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateFileType(name); err != nil {
+		return nil, err
+	}
+
+	relativePath := strings.Trim(strings.ReplaceAll(request.RelativePath, "\\", "/"), "/")
+	if relativePath == "" {
+		relativePath = name
+	}
+	if err := utils.ValidateUploadPairing(name, relativePath); err != nil {
+		return nil, fmt.Errorf("invalid relative path: %w", err)
+	}
+	for _, segment := range strings.Split(relativePath, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid relative path: %s", relativePath)
+		}
+	}
+
+	checksum := strings.ToLower(strings.TrimSpace(request.SHA1))
+	if checksum != "" && !checksumPattern.MatchString(checksum) {
+		return nil, fmt.Errorf("invalid SHA1 checksum")
+	}
+
+	partSize, maxFileSize, ttl := chunkedUploadLimits()
+	if request.Size <= 0 {
+		return nil, fmt.Errorf("invalid file size")
+	}
+	if request.Size > maxFileSize {
+		return nil, fmt.Errorf("file too large: limit is %d bytes", maxFileSize)
+	}
+	partCount := int((request.Size + partSize - 1) / partSize)
+	if partCount < 2 {
+		return nil, fmt.Errorf("file too small for chunked upload: use a regular upload for files up to %d bytes", partSize)
+	}
+
+	if err := s.fileService.CheckQuota(userID, request.Size); err != nil {
+		return nil, err
+	}
+	if err := s.fileService.CheckFileCountLimit(ctx, userObjID, 1); err != nil {
+		return nil, err
+	}
+
+	contentType := s.fileService.getMimeType(name)
+	if contentType == "application/octet-stream" && request.ContentType != "" {
+		contentType = request.ContentType
+	}
+
+	now := time.Now()
+	session := models.UploadSession{
+		ID:           primitive.NewObjectID(),
+		OwnerID:      userObjID,
+		Filename:     name,
+		RelativePath: relativePath,
+		ContentType:  contentType,
+		Size:         request.Size,
+		PartSize:     partSize,
+		PartCount:    partCount,
+		SHA1:         checksum,
+		Parts:        map[string]models.UploadPart{},
+		Status:       models.UploadStatusActive,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	session.ObjectName = s.b2Service.BuildObjectName(userID, session.ID.Hex(), relativePath, name)
+
+	if err := s.b2Service.StartLargeFile(ctx, session.ObjectName, contentType); err != nil {
+		return nil, err
+	}
+	if _, err := s.sessionCollection.InsertOne(ctx, session); err != nil {
+		s.b2Service.CancelLargeFile(ctx, session.ObjectName)
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return sessionStatus(&session), nil
+}
+
+// GetUpload reports a session's progress so an interrupted client knows which parts to resend
+func (s *ChunkedUploadService) GetUpload(ctx context.Context, uploadID, userID string) (*UploadSessionStatus, error) {
+	session, err := s.findSession(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return sessionStatus(session), nil
+}
+
+// UploadPart stores part partNumber (starting at 1). Every part but the last must be exactly
+// PartSize bytes. Resending a part replaces it, so failed parts can simply be retried.
+func (s *ChunkedUploadService) UploadPart(ctx context.Context, uploadID, userID string, partNumber int, content io.Reader, expectedSHA1 string) (*UploadSessionStatus, error) {
+	session, err := s.activeSession(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if partNumber < 1 || partNumber > session.PartCount {
+		return nil, fmt.Errorf("invalid part number: expected 1 to %d", session.PartCount)
+	}
+	expectedSize := session.PartSize
+	if partNumber == session.PartCount {
+		expectedSize = session.Size - session.PartSize*int64(session.PartCount-1)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, expectedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read part %d: %w", partNumber, err)
+	}
+	if int64(len(data)) != expectedSize {
+		return nil, fmt.Errorf("invalid part size: part %d must be %d bytes", partNumber, expectedSize)
+	}
+
+	sum := sha1.Sum(data)
+	sha1Hex := hex.EncodeToString(sum[:])
+	if expectedSHA1 != "" && !strings.EqualFold(expectedSHA1, sha1Hex) {
+		return nil, fmt.Errorf("checksum mismatch for part %d", partNumber)
+	}
+
+	// The first part carries the file's signature, so it gets the same content check as a regular upload
+	if partNumber == 1 {
+		if _, err := utils.DetectFileType(session.Filename, data[:min(len(data), utils.SniffLength)]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.b2Service.UploadPart(ctx, session.ObjectName, partNumber, data, sha1Hex); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	part := models.UploadPart{SHA1: sha1Hex, Size: expectedSize, UploadedAt: now}
+	result, err := s.sessionCollection.UpdateOne(ctx, bson.M{
+		"_id":    session.ID,
+		"status": models.UploadStatusActive,
+	}, bson.M{"$set": bson.M{
+		"parts." + strconv.Itoa(partNumber): part,
+		"updated_at":                        now,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record part %d: %w", partNumber, err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("upload is no longer active")
+	}
+
+	session.Parts[strconv.Itoa(partNumber)] = part
+	session.UpdatedAt = now
+	s.hashPart(ctx, session, partNumber, data, sha1Hex)
+	return sessionStatus(session), nil
+}
+
+// hashPart folds a part into the session's running whole-file SHA1 when it is the next one in
+// order, so a sequentially uploaded file needs no second read on completion. Parts that arrive
+// out of order are left for finishHash. Both updates are conditional: resending a part that is
+// already hashed discards the running hash, and a part replaced by a concurrent resend is not
+// hashed at all.
+func (s *ChunkedUploadService) hashPart(ctx context.Context, session *models.UploadSession, partNumber int, data []byte, sha1Hex string) {
+	if _, err := s.sessionCollection.UpdateOne(ctx, bson.M{
+		"_id":          session.ID,
+		"hashed_parts": bson.M{"$gte": partNumber},
+	}, bson.M{
+		"$set":   bson.M{"hashed_parts": 0},
+		"$unset": bson.M{"hash_state": ""},
+	}); err != nil {
+		log.Printf("Failed to reset hash for upload session %s: %v", session.ID.Hex(), err)
+		return
+	}
+
+	if partNumber != session.HashedParts+1 {
+		return
+	}
+	state, err := advanceSHA1(session.HashState, data)
+	if err != nil {
+		log.Printf("Failed to hash part %d of upload session %s: %v", partNumber, session.ID.Hex(), err)
+		return
+	}
+	result, err := s.sessionCollection.UpdateOne(ctx, bson.M{
+		"_id":          session.ID,
+		"status":       models.UploadStatusActive,
+		"hashed_parts": partNumber - 1,
+		"hash_state":   session.HashState,
+		"parts." + strconv.Itoa(partNumber) + ".sha1": sha1Hex,
+	}, bson.M{"$set": bson.M{"hash_state": state, "hashed_parts": partNumber}})
+	if err != nil {
+		log.Printf("Failed to record hash for upload session %s: %v", session.ID.Hex(), err)
+		return
+	}
+	if result.MatchedCount > 0 {
+		session.HashState, session.HashedParts = state, partNumber
+	}
+}
+
+// advanceSHA1 resumes a SHA1 from its marshalled state (empty for a new hash), writes data
+// and returns the new state
+func advanceSHA1(state, data []byte) ([]byte, error) {
+	hasher, err := resumeSHA1(state)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(data)
+	return hasher.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+func resumeSHA1(state []byte) (hash.Hash, error) {
+	hasher := sha1.New()
+	if len(state) > 0 {
+		if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			return nil, err
+		}
+	}
+	return hasher, nil
+}
+
+// CompleteUpload has B2 assemble the parts and adds the result to the drive. As with regular
+// uploads, a file of the same name in the target folder gets the content as a new version.
+func (s *ChunkedUploadService) CompleteUpload(ctx context.Context, uploadID, userID string) (*models.File, error) {
+	session, err := s.activeSession(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := sessionStatus(session)
+	if len(status.MissingParts) > 0 {
+		return nil, fmt.Errorf("upload incomplete: missing parts %v", status.MissingParts)
+	}
+
+	// Claim the session so a concurrent complete or abort cannot also act on it
+	result, err := s.sessionCollection.UpdateOne(ctx, bson.M{
+		"_id":    session.ID,
+		"status": models.UploadStatusActive,
+	}, bson.M{"$set": bson.M{"status": models.UploadStatusCompleting, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("upload is no longer active")
+	}
+
+	// Parts can't change once claimed; reload to pick up hashing done by in-flight part uploads
+	if claimed, err := s.findSession(ctx, uploadID, userID); err == nil {
+		session = claimed
+	}
+
+	partSHA1s := make(map[int]string, len(session.Parts))
+	for key, part := range session.Parts {
+		number, _ := strconv.Atoi(key)
+		partSHA1s[number] = part.SHA1
+	}
+	if err := s.b2Service.FinishLargeFile(ctx, session.ObjectName, session.Size, partSHA1s); err != nil {
+		s.setStatus(ctx, session.ID, models.UploadStatusActive)
+		return nil, err
+	}
+
+	// The parts are gone once B2 assembles them, so from here a failure ends the session
+	file, err := s.store(ctx, session)
+	if err != nil {
+		s.b2Service.DeleteFile(session.ObjectName)
+		s.setStatus(ctx, session.ID, models.UploadStatusAborted)
+		return nil, err
+	}
+
+	if _, err := s.sessionCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": bson.M{
+		"status":     models.UploadStatusCompleted,
+		"file_id":    file.ID,
+		"updated_at": time.Now(),
+	}}); err != nil {
+		log.Printf("Failed to mark upload session %s completed: %v", session.ID.Hex(), err)
+	}
+
+	if session.HashedParts < session.PartCount {
+		go s.finishHash(*session, file.ID)
+	}
+
+	return file, nil
+}
+
+// finishHash completes the checksum of a file stored before all of its parts were hashed,
+// reading only the parts that were not hashed on arrival. A mismatch with the checksum the
+// client declared can no longer fail the upload, so it is logged and the real checksum kept.
+func (s *ChunkedUploadService) finishHash(session models.UploadSession, fileID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundHashTimeout)
+	defer cancel()
+
+	hasher, err := resumeSHA1(session.HashState)
+	if err != nil {
+		log.Printf("Failed to restore checksum for upload session %s: %v", session.ID.Hex(), err)
+		return
+	}
+	offset := int64(session.HashedParts) * session.PartSize
+	reader, err := s.b2Service.OpenRangeReader(ctx, session.ObjectName, offset, -1)
+	if err != nil {
+		log.Printf("Failed to read %s to finish its checksum: %v", session.ObjectName, err)
+		return
+	}
+	_, err = io.Copy(hasher, reader)
+	reader.Close()
+	if err != nil {
+		log.Printf("Failed to read %s to finish its checksum: %v", session.ObjectName, err)
+		return
+	}
+
+	sha1Hex := hex.EncodeToString(hasher.Sum(nil))
+	if session.SHA1 != "" && session.SHA1 != sha1Hex {
+		log.Printf("Chunked upload %s: declared SHA1 %s does not match stored content %s", session.ID.Hex(), session.SHA1, sha1Hex)
+	}
+
+	// The upload may already have been replaced by a newer version
+	result, err := s.fileCollection.UpdateOne(ctx, bson.M{"_id": fileID, "b2_file_id": session.ObjectName},
+		bson.M{"$set": bson.M{"sha1_hash": sha1Hex}})
+	if err == nil && result.MatchedCount == 0 {
+		_, err = s.fileCollection.UpdateOne(ctx, bson.M{"_id": fileID, "versions.b2_file_id": session.ObjectName},
+			bson.M{"$set": bson.M{"versions.$.sha1_hash": sha1Hex}})
+	}
+	if err != nil {
+		log.Printf("Failed to record checksum for %s: %v", session.ObjectName, err)
+	}
+}
+
+// store records the assembled object in the drive the same way UploadFiles does. B2 keeps no
+// whole-file SHA1 for large files; when every part was hashed as it arrived the checksum is
+// known and verified now, otherwise the file is stored without one and finishHash fills it in.
+func (s *ChunkedUploadService) store(ctx context.Context, session *models.UploadSession) (*models.File, error) {
+	size := session.Size
+	sha1Hex := ""
+	if session.HashedParts == session.PartCount {
+		hasher, err := resumeSHA1(session.HashState)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore checksum for %s: %w", session.Filename, err)
+		}
+		sha1Hex = hex.EncodeToString(hasher.Sum(nil))
+		if session.SHA1 != "" && session.SHA1 != sha1Hex {
+			return nil, fmt.Errorf("checksum mismatch for %s", session.Filename)
+		}
+	}
+
+	userID := session.OwnerID.Hex()
+	if err := s.fileService.CheckQuota(userID, size); err != nil {
+		return nil, err
+	}
+
+	var err error
+	var folderID *primitive.ObjectID
+	if folderPath := filepath.Dir(session.RelativePath); folderPath != "." {
+		folderID, err = s.fileService.folderService.GetOrCreateFolderPath(folderPath, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create folder structure for %s: %w", session.RelativePath, err)
+		}
+	}
+
+	uploadResult := &UploadResult{
+		FileID:   session.ObjectName,
+		FileName: session.Filename,
+		Size:     size,
+		SHA1:     sha1Hex,
+	}
+
+	var existing models.File
+	err = s.fileCollection.FindOne(ctx, bson.M{
+		"owner_id":   session.OwnerID,
+		"folder_id":  folderID,
+		"name":       session.Filename,
+		"deleted_at": nil,
+	}).Decode(&existing)
+	if err == nil {
+		if err := s.fileService.pushVersion(ctx, &existing, uploadResult, session.ContentType); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	} else if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to check for existing file %s: %w", session.Filename, err)
+	}
+
+	if err := s.fileService.CheckFileCountLimit(ctx, session.OwnerID, 1); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	fileDoc := models.File{
+		ID:           primitive.NewObjectID(),
+		Name:         session.Filename,
+		OriginalName: session.Filename,
+		Size:         size,
+		MimeType:     session.ContentType,
+		ContentType:  session.ContentType,
+		Extension:    strings.ToLower(filepath.Ext(session.Filename)),
+		OwnerID:      session.OwnerID,
+		B2FileID:     uploadResult.FileID,
+		B2FileName:   uploadResult.FileName,
+		SHA1Hash:     sha1Hex,
+		FolderID:     folderID,
+		RelativePath: session.RelativePath,
+		Versions:     []models.FileVersion{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := s.fileCollection.InsertOne(ctx, fileDoc); err != nil {
+		return nil, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": session.OwnerID},
+		bson.M{"$inc": bson.M{"used_storage": size}}); err != nil {
+		log.Printf("Chunked upload %s stored but failed to update storage usage: %v", session.ID.Hex(), err)
+	}
+
+	return &fileDoc, nil
+}
+
+// AbortUpload discards the parts uploaded so far
+func (s *ChunkedUploadService) AbortUpload(ctx context.Context, uploadID, userID string) error {
+	session, err := s.activeSession(ctx, uploadID, userID)
+	if err != nil {
+		return err
+	}
+	return s.abort(ctx, session)
+}
+
+func (s *ChunkedUploadService) abort(ctx context.Context, session *models.UploadSession) error {
+	result, err := s.sessionCollection.UpdateOne(ctx, bson.M{
+		"_id":    session.ID,
+		"status": models.UploadStatusActive,
+	}, bson.M{"$set": bson.M{"status": models.UploadStatusAborted, "updated_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("upload is no longer active")
+	}
+	return s.b2Service.CancelLargeFile(ctx, session.ObjectName)
+}
+
+// ExpireSessions aborts active sessions past their expiry so B2 does not keep their parts,
+// and settles sessions stuck mid-completion
+func (s *ChunkedUploadService) ExpireSessions(ctx context.Context) (int, error) {
+	cursor, err := s.sessionCollection.Find(ctx, bson.M{
+		"status":     models.UploadStatusActive,
+		"expires_at": bson.M{"$lt": time.Now()},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired upload sessions: %w", err)
+	}
+	var sessions []models.UploadSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0, fmt.Errorf("failed to decode expired upload sessions: %w", err)
+	}
+
+	expired := 0
+	for i := range sessions {
+		if err := s.abort(ctx, &sessions[i]); err != nil {
+			log.Printf("Failed to expire upload session %s: %v", sessions[i].ID.Hex(), err)
+			continue
+		}
+		expired++
+	}
+
+	reaped, err := s.reapStaleCompletions(ctx)
+	return expired + reaped, err
+}
+
+// reapStaleCompletions settles sessions left in "completing" by a process that stopped midway.
+// If the file made it into the drive the session is marked completed; otherwise whatever B2
+// holds for it, assembled or still in parts, is deleted and the session aborted.
+func (s *ChunkedUploadService) reapStaleCompletions(ctx context.Context) (int, error) {
+	cursor, err := s.sessionCollection.Find(ctx, bson.M{
+		"status":     models.UploadStatusCompleting,
+		"updated_at": bson.M{"$lt": time.Now().Add(-staleCompletingAfter)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stale upload sessions: %w", err)
+	}
+	var sessions []models.UploadSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0, fmt.Errorf("failed to decode stale upload sessions: %w", err)
+	}
+
+	reaped := 0
+	for _, session := range sessions {
+		claim := bson.M{"_id": session.ID, "status": models.UploadStatusCompleting}
+
+		var file models.File
+		err := s.fileCollection.FindOne(ctx, bson.M{"$or": bson.A{
+			bson.M{"b2_file_id": session.ObjectName},
+			bson.M{"versions.b2_file_id": session.ObjectName},
+		}}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&file)
+		switch {
+		case err == nil:
+			_, err = s.sessionCollection.UpdateOne(ctx, claim, bson.M{"$set": bson.M{
+				"status":     models.UploadStatusCompleted,
+				"file_id":    file.ID,
+				"updated_at": time.Now(),
+			}})
+		case err == mongo.ErrNoDocuments:
+			var result *mongo.UpdateResult
+			result, err = s.sessionCollection.UpdateOne(ctx, claim,
+				bson.M{"$set": bson.M{"status": models.UploadStatusAborted, "updated_at": time.Now()}})
+			if err == nil && result.MatchedCount > 0 {
+				// Only one of these applies, depending on whether B2 assembled the parts
+				if cancelErr := s.b2Service.CancelLargeFile(ctx, session.ObjectName); cancelErr != nil {
+					if deleteErr := s.b2Service.DeleteFile(session.ObjectName); deleteErr != nil {
+						log.Printf("Failed to delete B2 data for upload session %s: %v; %v", session.ID.Hex(), cancelErr, deleteErr)
+					}
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to reap upload session %s: %v", session.ID.Hex(), err)
+			continue
+		}
+		reaped++
+	}
+	return reaped, nil
+}
+
+// StartUploadSessionCleanupJob periodically expires abandoned chunked uploads
+func StartUploadSessionCleanupJob(service *ChunkedUploadService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			expired, err := service.ExpireSessions(context.Background())
+			if err != nil {
+				log.Printf("Upload session cleanup job failed: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("Upload session cleanup job expired %d sessions", expired)
+			}
+		}
+	}()
+}
+
+func (s *ChunkedUploadService) findSession(ctx context.Context, uploadID, userID string) (*models.UploadSession, error) {
+	uploadObjID, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload ID: %w", err)
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var session models.UploadSession
+	err = s.sessionCollection.FindOne(ctx, bson.M{"_id": uploadObjID, "owner_id": userObjID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("upload not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if session.Parts == nil {
+		session.Parts = map[string]models.UploadPart{}
+	}
+	return &session, nil
+}
+
+func (s *ChunkedUploadService) activeSession(ctx context.Context, uploadID, userID string) (*models.UploadSession, error) {
+	session, err := s.findSession(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadStatusActive {
+		return nil, fmt.Errorf("upload is no longer active")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, fmt.Errorf("upload expired")
+	}
+	return session, nil
+}
+
+func (s *ChunkedUploadService) setStatus(ctx context.Context, sessionID primitive.ObjectID, status string) {
+	if _, err := s.sessionCollection.UpdateOne(ctx, bson.M{"_id": sessionID},
+		bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}); err != nil {
+		log.Printf("Failed to set upload session %s to %s: %v", sessionID.Hex(), status, err)
+	}
+}
+
+func sessionStatus(session *models.UploadSession) *UploadSessionStatus {
+	status := &UploadSessionStatus{
+		UploadSession: session,
+		ReceivedParts: []int{},
+		MissingParts:  []int{},
+	}
+	for number := 1; number <= session.PartCount; number++ {
+		if _, ok := session.Parts[strconv.Itoa(number)]; ok {
+			status.ReceivedParts = append(status.ReceivedParts, number)
+		} else {
+			status.MissingParts = append(status.MissingParts, number)
+		}
+	}
+	return status
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Folder contents type filters. The empty filter returns everything.
+const (
+	ContentTypeFolder    = "folder"
+	ContentTypeFile      = "file"
+	ContentTypeImages    = "images"
+	ContentTypeDocuments = "documents"
+	ContentTypeVideos    = "videos"
+	ContentTypeAudio     = "audio"
+	ContentTypeOther     = "other"
+)
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".svg", ".tiff", ".heic"}
+
+var documentExtensions = []string{
+	".pdf", ".doc", ".docx", ".odt", ".rtf", ".txt", ".md",
+	".xls", ".xlsx", ".ods", ".csv", ".ppt", ".pptx", ".odp",
+}
+
+var videoExtensions = []string{".mp4", ".mov", ".avi", ".mkv", ".webm", ".m4v", ".wmv", ".flv"}
+
+var audioExtensions = []string{".mp3", ".wav", ".ogg", ".flac", ".aac", ".m4a", ".wma", ".opus"}
+
+var documentMimeTypes = []string{
+	"application/pdf",
+	"application/msword",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.oasis.opendocument.text",
+	"application/rtf",
+	"text/plain",
+	"text/markdown",
+	"text/csv",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.oasis.opendocument.spreadsheet",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/vnd.oasis.opendocument.presentation",
+}
+
+// ParseContentFilter validates the ?type= value for folder contents
+func ParseContentFilter(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", ContentTypeFolder, ContentTypeFile, ContentTypeImages, ContentTypeDocuments:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid type filter: %s", value)
+}
+
+// ParseFileCategory validates a category for GET /files/by-category/:category
+func ParseFileCategory(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case ContentTypeImages, ContentTypeDocuments, ContentTypeVideos, ContentTypeAudio, ContentTypeOther:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid category: %s", value)
+}
+
+// includesFolders reports whether subfolders belong in a listing with this filter
+func includesFolders(filter string) bool {
+	return filter == "" || filter == ContentTypeFolder
+}
+
+// fileCategoryFilter returns the extra file query terms for a filter, or nil when
+// files are not narrowed. Matches on either extension or MIME type since older
+// uploads may only have one of them set reliably.
+func fileCategoryFilter(filter string) bson.M {
+	switch filter {
+	case ContentTypeImages:
+		return bson.M{"$or": bson.A{
+			bson.M{"extension": bson.M{"$in": imageExtensions}},
+			bson.M{"mime_type": bson.M{"$regex": "^image/"}},
+		}}
+	case ContentTypeDocuments:
+		return bson.M{"$or": bson.A{
+			bson.M{"extension": bson.M{"$in": documentExtensions}},
+			bson.M{"mime_type": bson.M{"$in": documentMimeTypes}},
+		}}
+	case ContentTypeVideos:
+		return bson.M{"$or": bson.A{
+			bson.M{"extension": bson.M{"$in": videoExtensions}},
+			bson.M{"mime_type": bson.M{"$regex": "^video/"}},
+		}}
+	case ContentTypeAudio:
+		return bson.M{"$or": bson.A{
+			bson.M{"extension": bson.M{"$in": audioExtensions}},
+			bson.M{"mime_type": bson.M{"$regex": "^audio/"}},
+		}}
+	case ContentTypeOther:
+		return bson.M{"$nor": bson.A{
+			fileCategoryFilter(ContentTypeImages),
+			fileCategoryFilter(ContentTypeDocuments),
+			fileCategoryFilter(ContentTypeVideos),
+			fileCategoryFilter(ContentTypeAudio),
+		}}
+	}
+	return nil
+}
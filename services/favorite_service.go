@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"phynixdrive/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FavoriteService manages the files and folders each user has starred
+type FavoriteService struct {
+	favoriteCollection *mongo.Collection
+	fileCollection     *mongo.Collection
+	folderCollection   *mongo.Collection
+	permissionService  *PermissionService
+}
+
+// FavoritesResponse lists a user's starred items, most recently starred first
+type FavoritesResponse struct {
+	Files   []FileInfo   `json:"files"`
+	Folders []FolderInfo `json:"folders"`
+}
+
+func NewFavoriteService(db *mongo.Database, permissionService *PermissionService) *FavoriteService {
+	service := &FavoriteService{
+		favoriteCollection: db.Collection("favorites"),
+		fileCollection:     db.Collection("files"),
+		folderCollection:   db.Collection("folders"),
+		permissionService:  permissionService,
+	}
+	service.createIndexes()
+	return service
+}
+
+func (s *FavoriteService) createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.favoriteCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "resource_type", Value: 1},
+			{Key: "resource_id", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create favorite indexes: %v", err)
+	}
+}
+
+// Star adds a file or folder to the user's favorites. Any user who can view the item may
+// star it; starring it again is a no-op.
+func (s *FavoriteService) Star(ctx context.Context, userID, resourceType, resourceID string) error {
+	userObjID, resourceObjID, err := parseFavoriteIDs(userID, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, resourceType, resourceID, "viewer"); err != nil {
+			return err
+		}
+	}
+
+	collection, filter := s.folderCollection, bson.M{"_id": resourceObjID, "is_deleted": false}
+	if resourceType == "file" {
+		collection, filter = s.fileCollection, bson.M{"_id": resourceObjID, "deleted_at": nil}
+	}
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%s not found", resourceType)
+	}
+
+	_, err = s.favoriteCollection.UpdateOne(ctx, bson.M{
+		"user_id":       userObjID,
+		"resource_type": resourceType,
+		"resource_id":   resourceObjID,
+	}, bson.M{
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to star %s: %w", resourceType, err)
+	}
+	return nil
+}
+
+// Unstar removes an item from the user's favorites. No access check is made, so users can
+// clear stars on items that have since stopped being shared with them.
+func (s *FavoriteService) Unstar(ctx context.Context, userID, resourceType, resourceID string) error {
+	userObjID, resourceObjID, err := parseFavoriteIDs(userID, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.favoriteCollection.DeleteOne(ctx, bson.M{
+		"user_id":       userObjID,
+		"resource_type": resourceType,
+		"resource_id":   resourceObjID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unstar %s: %w", resourceType, err)
+	}
+	return nil
+}
+
+// GetFavorites lists the user's starred files and folders. Items that are in trash or no
+// longer visible to the user are left out but keep their star, so they reappear if restored
+// or shared again.
+func (s *FavoriteService) GetFavorites(ctx context.Context, userID string) (*FavoritesResponse, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := s.favoriteCollection.Find(ctx, bson.M{"user_id": userObjID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorites: %w", err)
+	}
+	var favorites []models.Favorite
+	if err := cursor.All(ctx, &favorites); err != nil {
+		return nil, fmt.Errorf("failed to decode favorites: %w", err)
+	}
+
+	var fileIDs, folderIDs []primitive.ObjectID
+	for _, favorite := range favorites {
+		if favorite.ResourceType == "file" {
+			fileIDs = append(fileIDs, favorite.ResourceID)
+		} else {
+			folderIDs = append(folderIDs, favorite.ResourceID)
+		}
+	}
+
+	files, err := s.favoriteFiles(ctx, userID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := s.favoriteFolders(ctx, userID, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &FavoritesResponse{Files: []FileInfo{}, Folders: []FolderInfo{}}
+	for _, favorite := range favorites {
+		if file, ok := files[favorite.ResourceID]; ok && favorite.ResourceType == "file" {
+			response.Files = append(response.Files, fileInfoWithEndpoints(file))
+		} else if folder, ok := folders[favorite.ResourceID]; ok && favorite.ResourceType == "folder" {
+			response.Folders = append(response.Folders, FolderInfo{
+				ID:   folder.ID,
+				Name: folder.Name,
+				Type: "folder",
+				Path: folder.Path,
+			})
+		}
+	}
+	return response, nil
+}
+
+// favoriteFiles loads the live files among ids that the user can still view
+func (s *FavoriteService) favoriteFiles(ctx context.Context, userID string, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.File, error) {
+	found := make(map[primitive.ObjectID]*models.File)
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	cursor, err := s.fileCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": nil},
+		options.Find().SetProjection(listViewProjection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorite files: %w", err)
+	}
+	var files []models.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode favorite files: %w", err)
+	}
+
+	accessible, err := s.accessible(ctx, userID, "file", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if accessible == nil || accessible[files[i].ID] {
+			found[files[i].ID] = &files[i]
+		}
+	}
+	return found, nil
+}
+
+// favoriteFolders loads the live folders among ids that the user can still view
+func (s *FavoriteService) favoriteFolders(ctx context.Context, userID string, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Folder, error) {
+	found := make(map[primitive.ObjectID]*models.Folder)
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	cursor, err := s.folderCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "is_deleted": false},
+		options.Find().SetProjection(bson.M{"name": 1, "path": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorite folders: %w", err)
+	}
+	var folders []models.Folder
+	if err := cursor.All(ctx, &folders); err != nil {
+		return nil, fmt.Errorf("failed to decode favorite folders: %w", err)
+	}
+
+	accessible, err := s.accessible(ctx, userID, "folder", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range folders {
+		if accessible == nil || accessible[folders[i].ID] {
+			found[folders[i].ID] = &folders[i]
+		}
+	}
+	return found, nil
+}
+
+// accessible returns nil when there is no permission service, meaning everything is visible
+func (s *FavoriteService) accessible(ctx context.Context, userID, resourceType string, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	if s.permissionService == nil {
+		return nil, nil
+	}
+	return s.permissionService.FilterAccessible(ctx, userID, resourceType, ids, "viewer")
+}
+
+func parseFavoriteIDs(userID, resourceType, resourceID string) (primitive.ObjectID, primitive.ObjectID, error) {
+	if resourceType != "file" && resourceType != "folder" {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("invalid resource type: %s", resourceType)
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("invalid user ID: %w", err)
+	}
+	resourceObjID, err := primitive.ObjectIDFromHex(resourceID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("invalid %s ID: %w", resourceType, err)
+	}
+	return userObjID, resourceObjID, nil
+}
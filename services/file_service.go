@@ -2,9 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -13,12 +18,16 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"phynixdrive/config"
 	"phynixdrive/models"
+	"phynixdrive/utils"
 )
 
 type FileService struct {
 	fileCollection    *mongo.Collection
 	userCollection    *mongo.Collection
+	folderCollection  *mongo.Collection
+	shareCollection   *mongo.Collection
 	folderService     *FolderService
 	b2Service         *B2Service
 	permissionService *PermissionService
@@ -31,19 +40,159 @@ type FileUploadRequest struct {
 	UserID       string
 }
 
+// StorageStatus reports quota usage after an upload. SoftLimitReached is set once usage
+// crosses the soft limit so clients can warn before uploads start failing.
+type StorageStatus struct {
+	UsedStorage      int64   `json:"used_storage"`
+	MaxStorage       int64   `json:"max_storage"`
+	UsagePercent     float64 `json:"usage_percent"`
+	SoftLimitReached bool    `json:"soft_limit_reached"`
+	Warning          string  `json:"warning,omitempty"`
+}
+
+// QuotaExceededError is returned when a write would take the user over their storage limit.
+// It carries the numbers a client needs to tell the user how much space to free.
+type QuotaExceededError struct {
+	Used      int64 `json:"used"`
+	Max       int64 `json:"max"`
+	Requested int64 `json:"requested"`
+	Remaining int64 `json:"remaining"`
+}
+
+func newQuotaExceededError(used, max, requested int64) *QuotaExceededError {
+	remaining := max - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &QuotaExceededError{Used: used, Max: max, Requested: requested, Remaining: remaining}
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("upload would exceed storage limit of %d bytes: requested %d bytes, %d remaining", e.Max, e.Requested, e.Remaining)
+}
+
+const defaultMaxUserStorage = 2 * 1024 * 1024 * 1024
+
+// userStorageLimit is the user's own quota, or the configured default when none is set
+func userStorageLimit(user *models.User) int64 {
+	if user.MaxStorage > 0 {
+		return user.MaxStorage
+	}
+	return configuredStorageLimit()
+}
+
+// configuredStorageLimit is MAX_USER_STORAGE, the quota new users start with
+func configuredStorageLimit() int64 {
+	if config.AppConfig != nil && config.AppConfig.MaxUserStorage > 0 {
+		return config.AppConfig.MaxUserStorage
+	}
+	return defaultMaxUserStorage
+}
+
+type UploadResponse struct {
+	Files   []models.File `json:"files"`
+	Storage StorageStatus `json:"storage"`
+}
+
+// BulkTagResult reports the outcome of a bulk tag operation for one file
+type BulkTagResult struct {
+	ID      string   `json:"id"`
+	Success bool     `json:"success"`
+	Tags    []string `json:"tags,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+const maxTagLength = 50
+
+// DeleteResult reports the outcome of a batch delete for one file
+type DeleteResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DuplicateFile is one member of a DuplicateGroup
+type DuplicateFile struct {
+	ID        primitive.ObjectID  `bson:"_id" json:"id"`
+	Name      string              `bson:"name" json:"name"`
+	FolderID  *primitive.ObjectID `bson:"folder_id,omitempty" json:"folder_id,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// DuplicateGroup is a set of files with identical content. ReclaimableBytes is what
+// deleting all but one copy would free.
+type DuplicateGroup struct {
+	SHA1             string          `bson:"sha1" json:"sha1"`
+	Size             int64           `bson:"size" json:"size"`
+	Count            int             `bson:"count" json:"count"`
+	ReclaimableBytes int64           `bson:"reclaimable_bytes" json:"reclaimable_bytes"`
+	Files            []DuplicateFile `bson:"files" json:"files"`
+}
+
+// listViewProjection drops the embedded permission and version arrays from list queries.
+// Those can grow large and are only needed by detail views, which load the full document.
+var listViewProjection = bson.M{"permissions": 0, "versions": 0}
+
+// FileOwnerInfo identifies the owner of a file in a properties payload
+type FileOwnerInfo struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// FileProperties is everything a properties dialog needs about a file in one payload
+type FileProperties struct {
+	ID           primitive.ObjectID  `json:"id"`
+	Name         string              `json:"name"`
+	Size         int64               `json:"size"`
+	MimeType     string              `json:"mime_type"`
+	Extension    string              `json:"extension"`
+	Hashes       map[string]string   `json:"hashes"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	Owner        FileOwnerInfo       `json:"owner"`
+	FolderID     *primitive.ObjectID `json:"folder_id,omitempty"`
+	FolderPath   string              `json:"folder_path"`
+	VersionCount int                 `json:"version_count"`
+	ShareCount   int                 `json:"share_count"`
+	Tags         []string            `json:"tags"`
+	Description  string              `json:"description,omitempty"`
+}
+
 func NewFileService(db *mongo.Database, folderService *FolderService, b2Service *B2Service, permissionService *PermissionService) *FileService {
 	return &FileService{
 		fileCollection:    db.Collection("files"),
 		userCollection:    db.Collection("users"),
+		folderCollection:  db.Collection("folders"),
+		shareCollection:   db.Collection("shares"),
 		folderService:     folderService,
 		b2Service:         b2Service,
 		permissionService: permissionService,
 	}
 }
 
-func (s *FileService) CheckStorageQuota(userID string, additionalSize int64) (bool, error) {
-	const maxUserStorage = 2 * 1024 * 1024 * 1024
+// CheckQuota returns a *QuotaExceededError when adding additionalSize bytes would take the
+// user over their storage limit
+func (s *FileService) CheckQuota(userID string, additionalSize int64) error {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var user models.User
+	err = s.userCollection.FindOne(context.Background(), bson.M{"_id": userObjID}).Decode(&user)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
 
+	maxStorage := userStorageLimit(&user)
+	if user.UsedStorage+additionalSize > maxStorage {
+		return newQuotaExceededError(user.UsedStorage, maxStorage, additionalSize)
+	}
+	return nil
+}
+
+func (s *FileService) CheckStorageQuota(userID string, additionalSize int64) (bool, error) {
 	ctx := context.Background()
 	userObjID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
@@ -56,12 +205,32 @@ func (s *FileService) CheckStorageQuota(userID string, additionalSize int64) (bo
 		return false, fmt.Errorf("user not found: %w", err)
 	}
 
-	return user.UsedStorage+additionalSize <= maxUserStorage, nil
+	return user.UsedStorage+additionalSize <= userStorageLimit(&user), nil
+}
+
+// CheckFileCountLimit enforces the optional MAX_FILES_PER_USER cap before adding files.
+// Only live files count; trash is excluded, as it is from the storage quota.
+func (s *FileService) CheckFileCountLimit(ctx context.Context, userObjID primitive.ObjectID, additional int) error {
+	if config.AppConfig == nil || config.AppConfig.MaxFilesPerUser <= 0 {
+		return nil
+	}
+	limit := config.AppConfig.MaxFilesPerUser
+
+	count, err := s.fileCollection.CountDocuments(ctx, bson.M{"owner_id": userObjID, "deleted_at": nil})
+	if err != nil {
+		return fmt.Errorf("failed to count files: %w", err)
+	}
+
+	if count+int64(additional) > limit {
+		return fmt.Errorf("file count limit exceeded: %d of %d files used", count, limit)
+	}
+	return nil
 }
 
-func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader, relativePaths []string) ([]models.File, error) {
+// UploadFiles stores a batch of files. checksums optionally holds the client's SHA1 (hex) for
+// each file by index; an empty or missing entry skips the check for that file.
+func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader, relativePaths []string, checksums []string) (*UploadResponse, error) {
 	const maxFileSize = 100 * 1024 * 1024
-	const maxUserStorage = 2 * 1024 * 1024 * 1024
 
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no files to upload")
@@ -88,12 +257,29 @@ func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader,
 		}
 	}
 
+	// Check every file's type before anything is stored, so a rejected file fails the whole batch cleanly
+	sniffedTypes := make([]string, len(files))
+	for i, file := range files {
+		if err := utils.ValidateFileType(file.Filename); err != nil {
+			return nil, err
+		}
+		if sniffedTypes[i], err = utils.SniffFileHeader(file); err != nil {
+			return nil, err
+		}
+	}
+
+	maxUserStorage := userStorageLimit(&user)
 	if user.UsedStorage+totalSize > maxUserStorage {
-		return nil, fmt.Errorf("upload would exceed storage limit of 2GB")
+		return nil, newQuotaExceededError(user.UsedStorage, maxUserStorage, totalSize)
+	}
+
+	if err := s.CheckFileCountLimit(ctx, userObjID, len(files)); err != nil {
+		return nil, err
 	}
 
-	var uploadedFiles []models.File
-	var uploadedSize int64
+	// versionedFiles already had their usage counted by pushVersion and are not rolled back
+	var uploadedFiles, versionedFiles []models.File
+	var uploadedSize, versionedSize int64
 
 	for i, fileHeader := range files {
 		file, err := fileHeader.Open()
@@ -121,19 +307,68 @@ func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader,
 			}
 		}
 
-		uploadResult, err := s.b2Service.UploadFile(file, fileHeader.Filename, userID, relativePath)
+		// Unknown extensions take the sniffed type before the client's claim
+		mimeType := s.getMimeType(fileHeader.Filename)
+		if mimeType == "application/octet-stream" {
+			if sniffed := sniffedTypes[i]; sniffed != "" && sniffed != "application/octet-stream" {
+				mimeType = sniffed
+			} else if headerType := fileHeader.Header.Get("Content-Type"); headerType != "" {
+				mimeType = headerType
+			}
+		}
+
+		// Re-uploading a name that already exists in the folder adds a version to that file
+		var existing models.File
+		err = s.fileCollection.FindOne(ctx, bson.M{
+			"owner_id":   userObjID,
+			"folder_id":  folderID,
+			"name":       fileHeader.Filename,
+			"deleted_at": nil,
+		}).Decode(&existing)
+		if err == nil {
+			versionID := primitive.NewObjectID()
+			objectName := s.b2Service.BuildObjectName(userID, versionID.Hex(), existing.RelativePath, existing.Name)
+			uploadResult, err := s.b2Service.UploadFile(file, objectName, fileHeader.Filename, mimeType)
+			if err != nil {
+				s.cleanupUploadedFiles(uploadedFiles)
+				return nil, fmt.Errorf("failed to upload %s to B2: %w", fileHeader.Filename, err)
+			}
+			if err := s.verifyUploadChecksum(fileHeader.Filename, checksumAt(checksums, i), uploadResult); err != nil {
+				s.cleanupUploadedFiles(uploadedFiles)
+				return nil, err
+			}
+			if err := s.pushVersion(ctx, &existing, uploadResult, mimeType); err != nil {
+				s.cleanupUploadedFiles(uploadedFiles)
+				return nil, err
+			}
+			versionedFiles = append(versionedFiles, existing)
+			versionedSize += uploadResult.Size
+			continue
+		} else if err != mongo.ErrNoDocuments {
+			s.cleanupUploadedFiles(uploadedFiles)
+			return nil, fmt.Errorf("failed to check for existing file %s: %w", fileHeader.Filename, err)
+		}
+
+		fileID := primitive.NewObjectID()
+		objectName := s.b2Service.BuildObjectName(userID, fileID.Hex(), relativePath, fileHeader.Filename)
+
+		uploadResult, err := s.b2Service.UploadFile(file, objectName, fileHeader.Filename, mimeType)
 		if err != nil {
 			s.cleanupUploadedFiles(uploadedFiles)
 			return nil, fmt.Errorf("failed to upload %s to B2: %w", fileHeader.Filename, err)
 		}
+		if err := s.verifyUploadChecksum(fileHeader.Filename, checksumAt(checksums, i), uploadResult); err != nil {
+			s.cleanupUploadedFiles(uploadedFiles)
+			return nil, err
+		}
 
 		fileDoc := models.File{
-			ID:           primitive.NewObjectID(),
+			ID:           fileID,
 			Name:         fileHeader.Filename,
 			OriginalName: fileHeader.Filename,
 			Size:         fileHeader.Size,
-			MimeType:     s.getMimeType(fileHeader.Filename),
-			ContentType:  s.getMimeType(fileHeader.Filename),
+			MimeType:     mimeType,
+			ContentType:  mimeType,
 			Extension:    strings.ToLower(filepath.Ext(fileHeader.Filename)),
 			OwnerID:      userObjID,
 			B2FileID:     uploadResult.FileID,
@@ -141,6 +376,7 @@ func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader,
 			SHA1Hash:     uploadResult.SHA1,
 			FolderID:     folderID,
 			RelativePath: relativePath,
+			Versions:     []models.FileVersion{},
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 			IsDeleted:    false,
@@ -161,11 +397,86 @@ func (s *FileService) UploadFiles(userID string, files []*multipart.FileHeader,
 		bson.M{"_id": userObjID},
 		bson.M{"$inc": bson.M{"used_storage": uploadedSize}},
 	)
+
+	response := &UploadResponse{
+		Files:   append(uploadedFiles, versionedFiles...),
+		Storage: buildStorageStatus(user.UsedStorage+uploadedSize+versionedSize, maxUserStorage),
+	}
+	if err != nil {
+		return response, fmt.Errorf("files uploaded but failed to update storage usage: %w", err)
+	}
+
+	return response, nil
+}
+
+func checksumAt(checksums []string, i int) string {
+	if i < len(checksums) {
+		return strings.ToLower(strings.TrimSpace(checksums[i]))
+	}
+	return ""
+}
+
+// verifyUploadChecksum compares the SHA1 computed while streaming to B2 with the one the
+// client sent. On a mismatch the stored object is deleted so no corrupt copy is left behind.
+func (s *FileService) verifyUploadChecksum(filename, expected string, result *UploadResult) error {
+	if expected == "" || strings.EqualFold(expected, result.SHA1) {
+		return nil
+	}
+	if err := s.b2Service.DeleteFile(result.FileID); err != nil {
+		fmt.Printf("Warning: failed to delete corrupt upload %s from B2: %v\n", result.FileID, err)
+	}
+	return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", filename, expected, result.SHA1)
+}
+
+// VerifyIntegrity re-reads a file from B2 and reports whether its SHA1 still matches the
+// hash recorded at upload time
+func (s *FileService) VerifyIntegrity(fileID, userID string) (bool, error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return false, err
+	}
+	if s.b2Service == nil {
+		return false, fmt.Errorf("storage service not available")
+	}
+	if file.SHA1Hash == "" {
+		return false, fmt.Errorf("file has no recorded checksum")
+	}
+
+	reader, err := s.b2Service.OpenReader(context.Background(), file.B2FileID)
 	if err != nil {
-		return uploadedFiles, fmt.Errorf("files uploaded but failed to update storage usage: %w", err)
+		return false, err
 	}
+	defer reader.Close()
 
-	return uploadedFiles, nil
+	hasher := sha1.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return false, fmt.Errorf("failed to read file from B2: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == strings.ToLower(file.SHA1Hash), nil
+}
+
+// buildStorageStatus flags usage at or above the configured soft limit percentage
+func buildStorageStatus(used, max int64) StorageStatus {
+	status := StorageStatus{
+		UsedStorage: used,
+		MaxStorage:  max,
+	}
+	if max <= 0 {
+		return status
+	}
+
+	status.UsagePercent = float64(used) * 100 / float64(max)
+
+	softLimit := int64(90)
+	if config.AppConfig != nil && config.AppConfig.StorageSoftLimitPercent > 0 {
+		softLimit = config.AppConfig.StorageSoftLimitPercent
+	}
+	if status.UsagePercent >= float64(softLimit) {
+		status.SoftLimitReached = true
+		status.Warning = fmt.Sprintf("You have used %.0f%% of your storage", status.UsagePercent)
+	}
+
+	return status
 }
 
 func (s *FileService) GetRootFiles(userID string) ([]models.File, error) {
@@ -206,7 +517,9 @@ func (s *FileService) GetFilesByFolder(folderID *string, userID string) ([]model
 		filter["folder_id"] = nil
 	}
 
-	cursor, err := s.fileCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	cursor, err := s.fileCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(listViewProjection))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
@@ -220,6 +533,98 @@ func (s *FileService) GetFilesByFolder(folderID *string, userID string) ([]model
 	return files, nil
 }
 
+// GetFolderFiles lists the live files directly in a folder the user can view, with the
+// preview and download endpoints the UI needs. Unlike GetFilesByFolder it is not limited
+// to the user's own files, so it also works for folders shared with them.
+func (s *FileService) GetFolderFiles(folderID, userID string) ([]FileInfo, error) {
+	ctx := context.Background()
+
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	count, err := s.folderCollection.CountDocuments(ctx, bson.M{"_id": folderObjID, "is_deleted": false})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("folder not found")
+	}
+
+	if s.permissionService != nil {
+		hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, folderID, "viewer")
+		if err != nil {
+			return nil, fmt.Errorf("permission check failed: %w", err)
+		}
+		if !hasPermission {
+			return nil, fmt.Errorf("insufficient permissions")
+		}
+	}
+
+	cursor, err := s.fileCollection.Find(ctx, bson.M{
+		"folder_id":  folderObjID,
+		"deleted_at": nil,
+	}, options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(listViewProjection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	var files []models.File
+	if err = cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	infos := make([]FileInfo, 0, len(files))
+	for i := range files {
+		infos = append(infos, fileInfoWithEndpoints(&files[i]))
+	}
+	return infos, nil
+}
+
+// GetFilesByCategory lists one page of the user's files in a category across all folders,
+// newest first, along with the total number of matches
+func (s *FileService) GetFilesByCategory(userID, category string, limit, offset int) ([]models.File, int64, error) {
+	ctx := context.Background()
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	filter := bson.M{
+		"owner_id":   userObjID,
+		"deleted_at": nil,
+	}
+	for key, value := range fileCategoryFilter(category) {
+		filter[key] = value
+	}
+
+	total, err := s.fileCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	cursor, err := s.fileCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)).
+		SetProjection(listViewProjection))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list files: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	files := []models.File{}
+	if err = cursor.All(ctx, &files); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	return files, total, nil
+}
+
 func (s *FileService) GetFileByID(fileID string, userID string) (*models.File, error) {
 	objID, err := primitive.ObjectIDFromHex(fileID)
 	if err != nil {
@@ -242,113 +647,1206 @@ func (s *FileService) GetFileByID(fileID string, userID string) (*models.File, e
 
 	// Check permissions if service is available
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFilePermission(ctx, userID, fileID, "viewer")
-		if err != nil {
-			return nil, fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return nil, fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "viewer"); err != nil {
+			return nil, err
 		}
 	}
 
 	return &file, nil
 }
 
-// GetDownloadURL generates a download URL with longer expiry
-func (s *FileService) GetDownloadURL(fileID string, userID string) (string, error) {
-	file, err := s.GetFileByID(fileID, userID)
-	if err != nil {
-		return "", err
+// CheckFileRole confirms the user can see the file and holds at least role on it
+func (s *FileService) CheckFileRole(fileID, userID, role string) error {
+	if _, err := s.GetFileByID(fileID, userID); err != nil {
+		return err
 	}
-
-	// Generate download URL from B2
-	url, err := s.b2Service.GetDownloadURLForFile(file.B2FileID)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate download URL: %w", err)
+	if s.permissionService != nil && role != "viewer" {
+		return s.permissionService.CheckAccess(context.Background(), userID, "file", fileID, role)
 	}
-
-	return url, nil
+	return nil
 }
 
-// GetPreviewURL generates a preview URL with shorter expiry
-func (s *FileService) GetPreviewURL(fileID string, userID string) (string, error) {
+// OpenFileContent streams a file's current content for a user with viewer access
+func (s *FileService) OpenFileContent(ctx context.Context, fileID, userID string) (io.ReadCloser, *models.File, error) {
 	file, err := s.GetFileByID(fileID, userID)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-
-	// Check if file is previewable
-	if !s.b2Service.IsPreviewableFile(file.Name) {
-		return "", fmt.Errorf("file type not previewable")
+	if s.b2Service == nil {
+		return nil, nil, fmt.Errorf("storage service not available")
 	}
 
-	// Generate preview URL from B2
-	url, err := s.b2Service.GetPreviewURL(file.B2FileID)
+	reader, err := s.b2Service.OpenReader(ctx, file.B2FileID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate preview URL: %w", err)
+		return nil, nil, err
 	}
+	return reader, file, nil
+}
 
-	return url, nil
+// OpenFileRange streams part of a file already fetched through GetFileByID, which is where
+// access is checked. A negative length reads to the end.
+func (s *FileService) OpenFileRange(ctx context.Context, file *models.File, offset, length int64) (io.ReadCloser, error) {
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+	return s.b2Service.OpenRangeReader(ctx, file.B2FileID, offset, length)
 }
 
-func (s *FileService) DeleteFile(fileID string, userID string) error {
-	objID, err := primitive.ObjectIDFromHex(fileID)
+// ReplaceContent uploads new content for a file, keeping the previous content as a version.
+// The new bytes count against the owner's storage since the old version is retained, so the
+// declared size is checked against the quota before anything is uploaded.
+func (s *FileService) ReplaceContent(fileID, userID string, content io.Reader, size int64, contentType string) (*models.File, error) {
+	file, err := s.GetFileByID(fileID, userID)
 	if err != nil {
-		return fmt.Errorf("invalid file ID: %w", err)
+		return nil, err
 	}
 
-	// Check permissions if service is available
 	ctx := context.Background()
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFilePermission(ctx, userID, fileID, "admin")
-		if err != nil {
-			return fmt.Errorf("permission check failed: %w", err)
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "editor"); err != nil {
+			return nil, err
 		}
-		if !hasPermission {
-			return fmt.Errorf("insufficient permissions")
+	}
+
+	// New content goes through the same type policy and signature check as an upload
+	if err := utils.ValidateFileType(file.Name); err != nil {
+		return nil, err
+	}
+	if _, content, err = utils.SniffReader(file.Name, content); err != nil {
+		return nil, err
+	}
+
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+
+	if err := s.CheckQuota(file.OwnerID.Hex(), size); err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return nil, err
 		}
+		return nil, fmt.Errorf("storage check failed: %w", err)
 	}
 
-	// Get file info before deletion
-	var file models.File
-	err = s.fileCollection.FindOne(ctx, bson.M{
-		"_id":        objID,
-		"deleted_at": nil,
-	}).Decode(&file)
+	if contentType == "" {
+		contentType = file.ContentType
+	}
 
-	if err == mongo.ErrNoDocuments {
-		return fmt.Errorf("file not found")
-	} else if err != nil {
-		return fmt.Errorf("database error: %w", err)
+	versionID := primitive.NewObjectID()
+	objectName := s.b2Service.BuildObjectName(file.OwnerID.Hex(), versionID.Hex(), file.RelativePath, file.Name)
+	uploadResult, err := s.b2Service.UploadStream(io.LimitReader(content, size), objectName, file.Name, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload new content: %w", err)
+	}
+	if uploadResult.Size != size {
+		s.b2Service.DeleteFile(uploadResult.FileID)
+		return nil, fmt.Errorf("content length mismatch: declared %d bytes, received %d", size, uploadResult.Size)
 	}
 
-	// Soft delete file
+	if err := s.pushVersion(ctx, file, uploadResult, contentType); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// pushVersion archives the file's live object in its versions and makes uploadResult the head.
+// The new bytes are added to the owner's usage since the old object is retained.
+// On failure the uploaded object is removed again.
+func (s *FileService) pushVersion(ctx context.Context, file *models.File, uploadResult *UploadResult, contentType string) error {
+	previous := currentVersion(file)
+
+	// Files inserted before versioning store versions as null, which $push rejects
+	if file.Versions == nil {
+		if _, err := s.fileCollection.UpdateOne(ctx, bson.M{"_id": file.ID, "versions": nil},
+			bson.M{"$set": bson.M{"versions": bson.A{}}}); err != nil {
+			s.b2Service.DeleteFile(uploadResult.FileID)
+			return fmt.Errorf("failed to save new version: %w", err)
+		}
+	}
+
+	// Matching on the old B2 object makes concurrent writers fail instead of dropping a version
 	now := time.Now()
-	update := bson.M{
+	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
+		"_id":        file.ID,
+		"b2_file_id": file.B2FileID,
+		"deleted_at": nil,
+	}, bson.M{
 		"$set": bson.M{
-			"deleted_at": &now,
-			"updated_at": now,
-			"is_deleted": true,
+			"b2_file_id":   uploadResult.FileID,
+			"b2_file_name": uploadResult.FileName,
+			"size":         uploadResult.Size,
+			"sha1_hash":    uploadResult.SHA1,
+			"content_type": contentType,
+			"updated_at":   now,
 		},
+		"$push": bson.M{"versions": previous},
+	})
+	if err != nil {
+		s.b2Service.DeleteFile(uploadResult.FileID)
+		return fmt.Errorf("failed to save new version: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		s.b2Service.DeleteFile(uploadResult.FileID)
+		return fmt.Errorf("file was modified concurrently")
+	}
+
+	file.B2FileID = uploadResult.FileID
+	file.B2FileName = uploadResult.FileName
+	file.Size = uploadResult.Size
+	file.SHA1Hash = uploadResult.SHA1
+	file.ContentType = contentType
+	file.UpdatedAt = now
+	file.Versions = append(file.Versions, previous)
+
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": file.OwnerID},
+		bson.M{"$inc": bson.M{"used_storage": uploadResult.Size}}); err != nil {
+		return fmt.Errorf("content replaced but failed to update storage usage: %w", err)
+	}
+	return nil
+}
+
+// storedBytes is what a file counts against its owner's storage: the head plus retained versions
+func storedBytes(file *models.File) int64 {
+	total := file.Size
+	for _, v := range file.Versions {
+		total += v.Size
+	}
+	return total
+}
+
+// currentVersion snapshots the file's live object so it can be archived in its versions
+func currentVersion(file *models.File) models.FileVersion {
+	return models.FileVersion{
+		VersionID:   primitive.NewObjectID(),
+		B2FileID:    file.B2FileID,
+		B2FileName:  file.B2FileName,
+		Size:        file.Size,
+		SHA1Hash:    file.SHA1Hash,
+		ContentType: file.ContentType,
+		CreatedAt:   file.UpdatedAt,
 	}
+}
 
-	_, err = s.fileCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+// RestoreVersion makes a previous version the live content again. The current object is
+// archived as a new version in the same transaction, so nothing is lost by reverting.
+// Storage usage is unchanged since no object is added or removed.
+func (s *FileService) RestoreVersion(fileID, versionID, userID string) (*models.File, error) {
+	file, err := s.GetFileByID(fileID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete file: %w", err)
+		return nil, err
 	}
 
-	// Update user's storage usage
-	userObjID, _ := primitive.ObjectIDFromHex(userID)
-	_, err = s.userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userObjID},
-		bson.M{"$inc": bson.M{"used_storage": -file.Size}},
-	)
+	ctx := context.Background()
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "editor"); err != nil {
+			return nil, err
+		}
+	}
+
+	versionObjID, err := primitive.ObjectIDFromHex(versionID)
 	if err != nil {
-		return fmt.Errorf("file deleted but failed to update storage usage: %w", err)
+		return nil, fmt.Errorf("version not found")
 	}
 
-	return nil
+	var target *models.FileVersion
+	for i := range file.Versions {
+		if file.Versions[i].VersionID == versionObjID {
+			target = &file.Versions[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("version not found")
+	}
+
+	archived := currentVersion(file)
+	contentType := target.ContentType
+	if contentType == "" {
+		contentType = file.ContentType
+	}
+	now := time.Now()
+
+	session, err := s.fileCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Matching on the live B2 object and the version makes a concurrent write or
+		// restore abort the transaction instead of dropping a version
+		result, err := s.fileCollection.UpdateOne(sc, bson.M{
+			"_id":                 file.ID,
+			"b2_file_id":          file.B2FileID,
+			"versions.version_id": versionObjID,
+			"deleted_at":          nil,
+		}, bson.M{
+			"$set": bson.M{
+				"b2_file_id":   target.B2FileID,
+				"b2_file_name": target.B2FileName,
+				"size":         target.Size,
+				"sha1_hash":    target.SHA1Hash,
+				"content_type": contentType,
+				"updated_at":   now,
+			},
+			"$pull": bson.M{"versions": bson.M{"version_id": versionObjID}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, fmt.Errorf("file was modified concurrently")
+		}
+
+		_, err = s.fileCollection.UpdateOne(sc, bson.M{"_id": file.ID},
+			bson.M{"$push": bson.M{"versions": archived}})
+		return nil, err
+	})
+	if err != nil {
+		if err.Error() == "file was modified concurrently" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to restore version: %w", err)
+	}
+
+	versions := make([]models.FileVersion, 0, len(file.Versions))
+	for _, v := range file.Versions {
+		if v.VersionID != versionObjID {
+			versions = append(versions, v)
+		}
+	}
+	restored := *target
+	file.B2FileID = restored.B2FileID
+	file.B2FileName = restored.B2FileName
+	file.Size = restored.Size
+	file.SHA1Hash = restored.SHA1Hash
+	file.ContentType = contentType
+	file.UpdatedAt = now
+	file.Versions = append(versions, archived)
+
+	return file, nil
+}
+
+// DeleteVersion permanently removes one historical version and its B2 object, leaving the
+// live content untouched. Only the file's admins (its owner included) may do this.
+func (s *FileService) DeleteVersion(fileID, versionID, userID string) error {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "admin"); err != nil {
+			return err
+		}
+	}
+
+	versionObjID, err := primitive.ObjectIDFromHex(versionID)
+	if err != nil {
+		return fmt.Errorf("version not found")
+	}
+
+	var target *models.FileVersion
+	for i := range file.Versions {
+		if file.Versions[i].VersionID == versionObjID {
+			target = &file.Versions[i]
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("version not found")
+	}
+
+	// The $pull only counts if the version was still there, so a concurrent delete or
+	// restore cannot reclaim its bytes twice
+	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
+		"_id":                 file.ID,
+		"versions.version_id": versionObjID,
+		"deleted_at":          nil,
+	}, bson.M{
+		"$pull": bson.M{"versions": bson.M{"version_id": versionObjID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		return fmt.Errorf("version not found")
+	}
+
+	if s.b2Service != nil {
+		if err := s.b2Service.DeleteFile(target.B2FileID); err != nil {
+			fmt.Printf("Warning: failed to delete version %s from B2 storage: %v\n", versionID, err)
+		}
+	}
+
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": file.OwnerID},
+		bson.M{"$inc": bson.M{"used_storage": -target.Size}}); err != nil {
+		return fmt.Errorf("version deleted but failed to update storage usage: %w", err)
+	}
+
+	return nil
+}
+
+// URLCacheTTL reports how long a URL from GetDownloadURL or GetPreviewURL may be cached
+func (s *FileService) URLCacheTTL(urlType URLType) time.Duration {
+	if s.b2Service == nil {
+		return 0
+	}
+	return s.b2Service.URLCacheTTL(urlType)
+}
+
+// GetDownloadURL generates a download URL with longer expiry
+func (s *FileService) GetDownloadURL(fileID string, userID string) (string, error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate download URL from B2
+	url, err := s.b2Service.GetDownloadURLForFile(file.B2FileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate download URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// GetPreviewableFile returns a file the user may view, provided browsers can preview its type
+func (s *FileService) GetPreviewableFile(fileID string, userID string) (*models.File, error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+	if !s.b2Service.IsPreviewableFile(file.Name) {
+		return nil, fmt.Errorf("file type not previewable")
+	}
+	return file, nil
+}
+
+// GetPreviewURL generates a preview URL with shorter expiry
+func (s *FileService) GetPreviewURL(fileID string, userID string) (string, error) {
+	file, err := s.GetPreviewableFile(fileID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate preview URL from B2
+	url, err := s.b2Service.GetPreviewURL(file.B2FileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate preview URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// GetFileURLs returns both access URLs for a file in one call. The preview URL is empty
+// for types browsers cannot preview.
+func (s *FileService) GetFileURLs(fileID string, userID string) (download, preview string, err error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if s.b2Service == nil {
+		return "", "", fmt.Errorf("storage service not available")
+	}
+
+	download, err = s.b2Service.GetDownloadURLForFile(file.B2FileID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate download URL: %w", err)
+	}
+
+	if s.b2Service.IsPreviewableFile(file.Name) {
+		preview, err = s.b2Service.GetPreviewURL(file.B2FileID)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate preview URL: %w", err)
+		}
+	}
+
+	return download, preview, nil
+}
+
+const defaultRawInlineMaxSize = 1024 * 1024
+
+// RawFile resolves how GET /files/:id/raw should serve a file. Small previewable files are
+// returned inline, so the URL is empty; anything else gets a signed URL to redirect to.
+func (s *FileService) RawFile(fileID string, userID string) (*models.File, string, error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.b2Service == nil {
+		return nil, "", fmt.Errorf("storage service not available")
+	}
+
+	maxInline := int64(defaultRawInlineMaxSize)
+	if config.AppConfig != nil && config.AppConfig.RawInlineMaxSize > 0 {
+		maxInline = config.AppConfig.RawInlineMaxSize
+	}
+
+	previewable := s.b2Service.IsPreviewableFile(file.Name)
+	if previewable && file.Size <= maxInline {
+		return file, "", nil
+	}
+
+	var url string
+	if previewable {
+		url, err = s.b2Service.GetPreviewURL(file.B2FileID)
+	} else {
+		url, err = s.b2Service.GetDownloadURLForFile(file.B2FileID)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate file URL: %w", err)
+	}
+	return file, url, nil
+}
+
+// RenameFile renames a file in place. OriginalName keeps the name it was uploaded with,
+// while the extension and MIME type follow the new name.
+func (s *FileService) RenameFile(fileID, newName, userID string) error {
+	ctx := context.Background()
+
+	newName = strings.TrimSpace(newName)
+	if err := utils.ValidateFileName(newName); err != nil {
+		return err
+	}
+	if err := utils.ValidateFileType(newName); err != nil {
+		return err
+	}
+	if strings.ContainsAny(newName, "/\\") {
+		return fmt.Errorf("filename contains invalid character: /")
+	}
+
+	if err := s.CheckFileRole(fileID, userID, "editor"); err != nil {
+		return err
+	}
+
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return err
+	}
+	if file.Name == newName {
+		return nil
+	}
+
+	count, err := s.fileCollection.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$ne": file.ID},
+		"name":       newName,
+		"owner_id":   file.OwnerID,
+		"folder_id":  file.FolderID,
+		"deleted_at": nil,
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("file with name '%s' already exists", newName)
+	}
+
+	relativePath := newName
+	if dir := filepath.Dir(file.RelativePath); dir != "." && dir != "" {
+		relativePath = dir + "/" + newName
+	}
+	mimeType := s.getMimeType(newName)
+
+	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
+		"_id":        file.ID,
+		"deleted_at": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"name":          newName,
+			"extension":     strings.ToLower(filepath.Ext(newName)),
+			"mime_type":     mimeType,
+			"content_type":  mimeType,
+			"relative_path": relativePath,
+			"updated_at":    time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("file not found")
+	}
+
+	return nil
+}
+
+// CopyFile duplicates a file, content included, into targetFolderID. The copy belongs to the
+// user making it, so the target must be one of their own folders; an empty target means the
+// source's folder when the user owns it and the root otherwise. On a name clash the copy is
+// named "name (copy)", then "name (copy 2)" and so on.
+func (s *FileService) CopyFile(fileID, targetFolderID, userID string) (*models.File, error) {
+	ctx := context.Background()
+
+	source, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// A copy is a new file, so it must pass today's type policy even if the source predates it
+	if err := utils.ValidateFileType(source.Name); err != nil {
+		return nil, err
+	}
+	if err := s.sniffStoredFile(ctx, source); err != nil {
+		return nil, err
+	}
+
+	var folderObjID *primitive.ObjectID
+	folderPath := ""
+	if targetFolderID == "" && source.FolderID != nil && source.OwnerID == userObjID {
+		targetFolderID = source.FolderID.Hex()
+	}
+	if targetFolderID != "" {
+		targetObjID, err := primitive.ObjectIDFromHex(targetFolderID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid folder ID: %w", err)
+		}
+		folderObjID = &targetObjID
+
+		var target models.Folder
+		err = s.folderCollection.FindOne(ctx, bson.M{
+			"_id":        targetObjID,
+			"is_deleted": false,
+		}).Decode(&target)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("folder not found")
+		} else if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if target.OwnerID != userObjID {
+			return nil, fmt.Errorf("cannot copy file into another user's folder")
+		}
+		folderPath = target.Path
+	}
+
+	if err := s.CheckQuota(userID, source.Size); err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("storage check failed: %w", err)
+	}
+	if err := s.CheckFileCountLimit(ctx, userObjID, 1); err != nil {
+		return nil, err
+	}
+
+	name, err := s.availableCopyName(ctx, userObjID, folderObjID, source.Name)
+	if err != nil {
+		return nil, err
+	}
+	relativePath := name
+	if folderPath != "" {
+		relativePath = folderPath + "/" + name
+	}
+
+	copyID := primitive.NewObjectID()
+	objectName := s.b2Service.BuildObjectName(userID, copyID.Hex(), relativePath, name)
+	uploadResult, err := s.b2Service.CopyObject(ctx, source.B2FileID, objectName, name, source.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file content: %w", err)
+	}
+
+	now := time.Now()
+	copyDoc := models.File{
+		ID:           copyID,
+		Name:         name,
+		OriginalName: source.OriginalName,
+		Size:         uploadResult.Size,
+		MimeType:     source.MimeType,
+		ContentType:  source.ContentType,
+		Extension:    source.Extension,
+		OwnerID:      userObjID,
+		B2FileID:     uploadResult.FileID,
+		B2FileName:   uploadResult.FileName,
+		SHA1Hash:     uploadResult.SHA1,
+		FolderID:     folderObjID,
+		ParentID:     folderObjID,
+		RelativePath: relativePath,
+		Tags:         source.Tags,
+		Description:  source.Description,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if _, err := s.fileCollection.InsertOne(ctx, copyDoc); err != nil {
+		s.b2Service.DeleteFile(uploadResult.FileID)
+		return nil, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": userObjID},
+		bson.M{"$inc": bson.M{"used_storage": uploadResult.Size}}); err != nil {
+		return &copyDoc, fmt.Errorf("file copied but failed to update storage usage: %w", err)
+	}
+
+	return &copyDoc, nil
+}
+
+// sniffStoredFile runs the upload content check on the first bytes of a stored file
+func (s *FileService) sniffStoredFile(ctx context.Context, file *models.File) error {
+	reader, err := s.b2Service.OpenRangeReader(ctx, file.B2FileID, 0, utils.SniffLength)
+	if err != nil {
+		return fmt.Errorf("failed to read file content: %w", err)
+	}
+	defer reader.Close()
+
+	_, _, err = utils.SniffReader(file.Name, reader)
+	return err
+}
+
+// availableCopyName returns name unchanged if it is free in the folder, otherwise the first
+// free "base (copy)" / "base (copy N)" variant, keeping the extension
+func (s *FileService) availableCopyName(ctx context.Context, ownerID primitive.ObjectID, folderID *primitive.ObjectID, name string) (string, error) {
+	return availableName(ctx, s.fileCollection, bson.M{
+		"owner_id":   ownerID,
+		"folder_id":  folderID,
+		"deleted_at": nil,
+	}, "file", name)
+}
+
+// availableName finds the first copy-style variant of name that no document matching filter uses
+func availableName(ctx context.Context, collection *mongo.Collection, filter bson.M, kind, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; i <= 100; i++ {
+		filter["name"] = candidate
+		count, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return "", fmt.Errorf("database error: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		if i == 1 {
+			candidate = fmt.Sprintf("%s (copy)%s", base, ext)
+		} else {
+			candidate = fmt.Sprintf("%s (copy %d)%s", base, i, ext)
+		}
+	}
+	return "", fmt.Errorf("%s with name '%s' already exists", kind, name)
+}
+
+// MoveFile moves a file into targetFolderID, or to the root when it is nil or empty.
+// The user needs editor access on both the folder the file leaves and the one it enters.
+func (s *FileService) MoveFile(fileID, targetFolderID, userID string) error {
+	ctx := context.Background()
+
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return err
+	}
+
+	if s.permissionService != nil {
+		if file.FolderID != nil {
+			hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, file.FolderID.Hex(), "editor")
+			if err != nil {
+				return fmt.Errorf("permission check failed: %w", err)
+			}
+			if !hasPermission {
+				return fmt.Errorf("insufficient permissions")
+			}
+		} else if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "editor"); err != nil {
+			return err
+		}
+	}
+
+	var folderObjID *primitive.ObjectID
+	newPath := file.Name
+
+	if targetFolderID != "" {
+		targetObjID, err := primitive.ObjectIDFromHex(targetFolderID)
+		if err != nil {
+			return fmt.Errorf("invalid folder ID: %w", err)
+		}
+		folderObjID = &targetObjID
+
+		var target models.Folder
+		err = s.folderCollection.FindOne(ctx, bson.M{
+			"_id":        targetObjID,
+			"is_deleted": false,
+		}).Decode(&target)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("folder not found")
+		} else if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		// Storage is billed to the owner, so files stay inside their owner's tree
+		if target.OwnerID != file.OwnerID {
+			return fmt.Errorf("cannot move file into another user's folder")
+		}
+
+		if s.permissionService != nil {
+			hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, targetFolderID, "editor")
+			if err != nil {
+				return fmt.Errorf("permission check failed: %w", err)
+			}
+			if !hasPermission {
+				return fmt.Errorf("insufficient permissions")
+			}
+		}
+
+		newPath = target.Path + "/" + file.Name
+	} else if file.OwnerID.Hex() != userID {
+		// Only the owner can pull a file up to the top level of their own tree
+		return fmt.Errorf("insufficient permissions")
+	}
+
+	count, err := s.fileCollection.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$ne": file.ID},
+		"name":       file.Name,
+		"owner_id":   file.OwnerID,
+		"folder_id":  folderObjID,
+		"deleted_at": nil,
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("file with name '%s' already exists", file.Name)
+	}
+
+	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
+		"_id":        file.ID,
+		"deleted_at": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"folder_id":     folderObjID,
+			"parent_id":     folderObjID,
+			"relative_path": newPath,
+			"updated_at":    time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("file not found")
+	}
+
+	return nil
+}
+
+func (s *FileService) DeleteFile(fileID string, userID string, reason string) error {
+	objID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	// Check permissions if service is available
+	ctx := context.Background()
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "admin"); err != nil {
+			return err
+		}
+	}
+
+	// Trashing the file, suspending its shares and freeing its storage commit together, so a
+	// failure part way through never leaves a trashed file still counted or still shared
+	session, err := s.fileCollection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var file models.File
+		err := s.fileCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": objID, "deleted_at": nil},
+			bson.M{"$set": trashFields(time.Now(), userID, reason)},
+		).Decode(&file)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("file not found")
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to delete file: %w", err)
+		}
+
+		if s.permissionService != nil {
+			if err := s.permissionService.SuspendResourcePermissions(sc, []string{fileID}); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := s.userCollection.UpdateOne(sc,
+			bson.M{"_id": file.OwnerID},
+			bson.M{"$inc": bson.M{"used_storage": -storedBytes(&file)}},
+		); err != nil {
+			return nil, fmt.Errorf("failed to update storage usage: %w", err)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// GetFileProperties assembles the properties dialog payload for a file. Beyond the file itself
+// it only does small projected lookups for the owner and folder plus one count of active shares.
+func (s *FileService) GetFileProperties(fileID string, userID string) (*FileProperties, error) {
+	file, err := s.GetFileByID(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	props := &FileProperties{
+		ID:           file.ID,
+		Name:         file.Name,
+		Size:         file.Size,
+		MimeType:     file.MimeType,
+		Extension:    file.Extension,
+		Hashes:       map[string]string{},
+		CreatedAt:    file.CreatedAt,
+		UpdatedAt:    file.UpdatedAt,
+		Owner:        FileOwnerInfo{ID: file.OwnerID.Hex()},
+		FolderID:     file.FolderID,
+		FolderPath:   "/",
+		VersionCount: len(file.Versions),
+		Tags:         file.Tags,
+		Description:  file.Description,
+	}
+	if file.SHA1Hash != "" {
+		props.Hashes["sha1"] = file.SHA1Hash
+	}
+	if props.Tags == nil {
+		props.Tags = []string{}
+	}
+
+	var owner models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": file.OwnerID},
+		options.FindOne().SetProjection(bson.M{"name": 1, "email": 1})).Decode(&owner)
+	if err == nil {
+		props.Owner.Name = owner.Name
+		props.Owner.Email = owner.Email
+	} else if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to get owner: %w", err)
+	}
+
+	if file.FolderID != nil {
+		var folder models.Folder
+		err = s.folderCollection.FindOne(ctx, bson.M{"_id": *file.FolderID},
+			options.FindOne().SetProjection(bson.M{"path": 1})).Decode(&folder)
+		if err == nil {
+			props.FolderPath = folder.Path
+		} else if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to get folder: %w", err)
+		}
+	}
+
+	shareCount, err := s.shareCollection.CountDocuments(ctx, bson.M{
+		"resource_id":   file.ID.Hex(),
+		"resource_type": "file",
+		"is_active":     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count shares: %w", err)
+	}
+	props.ShareCount = int(shareCount)
+
+	return props, nil
+}
+
+// FindDuplicates groups the user's live files by SHA1 and size, returning only groups with
+// more than one file, largest reclaimable space first
+func (s *FileService) FindDuplicates(userID string) ([]DuplicateGroup, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	ctx := context.Background()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"owner_id":   userObjID,
+			"deleted_at": nil,
+			"sha1_hash":  bson.M{"$nin": bson.A{nil, ""}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"sha1": "$sha1_hash", "size": "$size"},
+			"count": bson.M{"$sum": 1},
+			"files": bson.M{"$push": bson.M{
+				"_id":        "$_id",
+				"name":       "$name",
+				"folder_id":  "$folder_id",
+				"created_at": "$created_at",
+			}},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":               0,
+			"sha1":              "$_id.sha1",
+			"size":              "$_id.size",
+			"count":             1,
+			"files":             1,
+			"reclaimable_bytes": bson.M{"$multiply": bson.A{"$_id.size", bson.M{"$subtract": bson.A{"$count", 1}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "reclaimable_bytes", Value: -1}, {Key: "sha1", Value: 1}}}},
+	}
+
+	cursor, err := s.fileCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicates: %w", err)
+	}
+
+	groups := []DuplicateGroup{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode duplicates: %w", err)
+	}
+
+	return groups, nil
+}
+
+var sha1Pattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// FindBySHA1 returns one of the user's live files with the given content hash, or nil when
+// there is none, so sync clients can skip uploading content the server already has. A
+// positive size narrows the match to the same key FindDuplicates groups by.
+func (s *FileService) FindBySHA1(userID, sha1 string, size int64) (*models.File, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	sha1 = strings.ToLower(strings.TrimSpace(sha1))
+	if !sha1Pattern.MatchString(sha1) {
+		return nil, fmt.Errorf("invalid sha1: expected 40 hex characters")
+	}
+
+	filter := bson.M{
+		"owner_id":   userObjID,
+		"sha1_hash":  sha1,
+		"deleted_at": nil,
+	}
+	if size > 0 {
+		filter["size"] = size
+	}
+
+	var file models.File
+	err = s.fileCollection.FindOne(context.Background(), filter, options.FindOne().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(listViewProjection)).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &file, nil
+}
+
+// DeleteFiles soft-deletes many files, checking admin access per file. Files that cannot be
+// deleted are reported per ID rather than aborting the batch. As in DeleteFile, trashing the
+// files, suspending their shares and freeing their storage commit together, so an error means
+// nothing was deleted.
+func (s *FileService) DeleteFiles(fileIDs []string, userID string, reason string) ([]DeleteResult, error) {
+	ctx := context.Background()
+	var ordered []string
+	seen := make(map[string]bool, len(fileIDs))
+	failures := map[string]string{}
+	type candidate struct {
+		id    string
+		objID primitive.ObjectID
+	}
+	var candidates []candidate
+
+	for _, fileID := range fileIDs {
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+		ordered = append(ordered, fileID)
+
+		objID, err := s.checkDeleteAccess(ctx, fileID, userID)
+		if err != nil {
+			failures[fileID] = err.Error()
+			continue
+		}
+		candidates = append(candidates, candidate{id: fileID, objID: objID})
+	}
+
+	if len(candidates) > 0 {
+		session, err := s.fileCollection.Database().Client().StartSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start session: %w", err)
+		}
+		defer session.EndSession(ctx)
+
+		var missing []string
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			// The callback can be retried, so its findings start over on each attempt
+			missing = missing[:0]
+			var deletedIDs []string
+			freed := map[primitive.ObjectID]int64{}
+
+			now := time.Now()
+			for _, c := range candidates {
+				var file models.File
+				err := s.fileCollection.FindOneAndUpdate(sc,
+					bson.M{"_id": c.objID, "deleted_at": nil},
+					bson.M{"$set": trashFields(now, userID, reason)},
+				).Decode(&file)
+				if err == mongo.ErrNoDocuments {
+					// Already deleted concurrently, so it is never counted twice
+					missing = append(missing, c.id)
+					continue
+				} else if err != nil {
+					return nil, fmt.Errorf("failed to delete file: %w", err)
+				}
+				deletedIDs = append(deletedIDs, c.id)
+				freed[file.OwnerID] += storedBytes(&file)
+			}
+
+			if s.permissionService != nil && len(deletedIDs) > 0 {
+				if err := s.permissionService.SuspendResourcePermissions(sc, deletedIDs); err != nil {
+					return nil, err
+				}
+			}
+			for ownerID, bytes := range freed {
+				if _, err := s.userCollection.UpdateOne(sc,
+					bson.M{"_id": ownerID},
+					bson.M{"$inc": bson.M{"used_storage": -bytes}},
+				); err != nil {
+					return nil, fmt.Errorf("failed to update storage usage: %w", err)
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, fileID := range missing {
+			failures[fileID] = "file not found"
+		}
+	}
+
+	results := make([]DeleteResult, 0, len(ordered))
+	for _, fileID := range ordered {
+		if message, failed := failures[fileID]; failed {
+			results = append(results, DeleteResult{ID: fileID, Error: message})
+		} else {
+			results = append(results, DeleteResult{ID: fileID, Success: true})
+		}
+	}
+	return results, nil
+}
+
+// checkDeleteAccess parses fileID and checks the user may delete the file
+func (s *FileService) checkDeleteAccess(ctx context.Context, fileID, userID string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "file", fileID, "admin"); err != nil {
+			return primitive.NilObjectID, err
+		}
+	}
+	return objID, nil
+}
+
+// BulkTagFiles adds and removes tags across many files, checking editor access per file.
+// Failures are reported per ID rather than aborting the whole batch.
+func (s *FileService) BulkTagFiles(userID string, fileIDs, add, remove []string) ([]BulkTagResult, error) {
+	add = normalizeTags(add)
+	remove = normalizeTags(remove)
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, fmt.Errorf("no tags to add or remove")
+	}
+
+	ctx := context.Background()
+	results := make([]BulkTagResult, 0, len(fileIDs))
+
+	for _, fileID := range fileIDs {
+		result := BulkTagResult{ID: fileID}
+
+		objID, err := primitive.ObjectIDFromHex(fileID)
+		if err != nil {
+			result.Error = "invalid file ID"
+			results = append(results, result)
+			continue
+		}
+
+		if s.permissionService != nil {
+			hasPermission, err := s.permissionService.HasFilePermission(ctx, userID, fileID, "editor")
+			if err != nil {
+				if err.Error() == "file not found" {
+					result.Error = "file not found"
+				} else {
+					result.Error = "permission check failed"
+				}
+				results = append(results, result)
+				continue
+			}
+			if !hasPermission {
+				result.Error = "insufficient permissions"
+				results = append(results, result)
+				continue
+			}
+		}
+
+		filter := bson.M{"_id": objID, "deleted_at": nil}
+
+		// $addToSet and $pull cannot target the same field in one update
+		if len(add) > 0 {
+			_, err = s.fileCollection.UpdateOne(ctx, filter, bson.M{
+				"$addToSet": bson.M{"tags": bson.M{"$each": add}},
+				"$set":      bson.M{"updated_at": time.Now()},
+			})
+		}
+		if err == nil && len(remove) > 0 {
+			_, err = s.fileCollection.UpdateOne(ctx, filter, bson.M{
+				"$pullAll": bson.M{"tags": remove},
+				"$set":     bson.M{"updated_at": time.Now()},
+			})
+		}
+		if err != nil {
+			result.Error = "failed to update tags"
+			results = append(results, result)
+			continue
+		}
+
+		var file models.File
+		if err := s.fileCollection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"tags": 1})).Decode(&file); err != nil {
+			result.Error = "file not found"
+			results = append(results, result)
+			continue
+		}
+
+		result.Success = true
+		result.Tags = file.Tags
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags, dropping empty or oversized ones
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxTagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
 func (s *FileService) cleanupUploadedFiles(files []models.File) {
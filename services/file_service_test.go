@@ -0,0 +1,722 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"phynixdrive/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func withConfig(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	previous := config.AppConfig
+	config.AppConfig = cfg
+	t.Cleanup(func() { config.AppConfig = previous })
+}
+
+func fileDoc(id, ownerID primitive.ObjectID, name string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: name},
+		{Key: "owner_id", Value: ownerID},
+		{Key: "b2_file_id", Value: "b2-" + id.Hex()},
+		{Key: "size", Value: int64(10)},
+	}
+}
+
+func TestReplaceContentAppliesFileTypePolicy(t *testing.T) {
+	withConfig(t, &config.Config{BlockedExtensions: []string{".exe"}, VerifyFileContent: true})
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")
+
+	tests := []struct {
+		name, fileName string
+		content        []byte
+		wantPrefix     string
+	}{
+		// A real PNG passes the checks and only stops at the (absent) storage backend
+		{"png allowed", "photo.png", png, "storage service not available"},
+		{"exe blocked", "setup.exe", exe, "file type not allowed"},
+		{"disguised exe", "photo.png", exe, "file content does not match"},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewFileService(mt.DB, nil, nil, nil)
+			id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+			mt.AddMockResponses(cursor("test.files", fileDoc(id, ownerID, tt.fileName)))
+
+			_, err := service.ReplaceContent(id.Hex(), ownerID.Hex(), bytes.NewReader(tt.content), int64(len(tt.content)), "")
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantPrefix) {
+				t.Fatalf("err = %v, want prefix %q", err, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestDeleteFileRollsBackWhenStorageUpdateFails(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("storage", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(id, ownerID, "a.txt")}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		err := service.DeleteFile(id.Hex(), ownerID.Hex(), "")
+		if err == nil || !strings.HasPrefix(err.Error(), "failed to update storage usage") {
+			t.Fatalf("err = %v, want failed to update storage usage", err)
+		}
+
+		trash := commands(mt, "findAndModify")
+		if len(trash) != 1 {
+			t.Fatalf("got %d findAndModify, want 1", len(trash))
+		}
+		if _, err := trash[0].Command.LookupErr("txnNumber"); err != nil {
+			t.Fatal("file was trashed outside the transaction")
+		}
+		if len(commands(mt, "abortTransaction")) != 1 {
+			t.Fatal("the trash update was not rolled back")
+		}
+		if len(commands(mt, "commitTransaction")) != 0 {
+			t.Fatal("a failed delete must not commit")
+		}
+	})
+}
+
+func TestDeleteFilesTrashesBatchInOneTransaction(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("partial", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		mt.ClearEvents()
+		trashed, gone, ownerID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(trashed, ownerID, "a.txt")}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}), // already in trash
+			writeResult(1),                // used_storage
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		results, err := service.DeleteFiles([]string{trashed.Hex(), gone.Hex(), trashed.Hex(), "bad"}, ownerID.Hex(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []DeleteResult{
+			{ID: trashed.Hex(), Success: true},
+			{ID: gone.Hex(), Error: "file not found"},
+		}
+		if len(results) != len(want)+1 {
+			t.Fatalf("results = %+v, want one per distinct ID", results)
+		}
+		for i := range want {
+			if results[i] != want[i] {
+				t.Fatalf("result %d = %+v, want %+v", i, results[i], want[i])
+			}
+		}
+		if bad := results[2]; bad.ID != "bad" || bad.Success || !strings.HasPrefix(bad.Error, "invalid file ID") {
+			t.Fatalf("result 2 = %+v, want the invalid ID reported", bad)
+		}
+
+		for _, name := range []string{"findAndModify", "update"} {
+			for _, evt := range commands(mt, name) {
+				if _, err := evt.Command.LookupErr("txnNumber"); err != nil {
+					t.Fatalf("%s ran outside the transaction", name)
+				}
+			}
+		}
+		if inc := commands(mt, "update")[0].Command.Lookup("updates", "0", "u", "$inc", "used_storage").AsInt64(); inc != -10 {
+			t.Fatalf("used_storage $inc = %d, want -10", inc)
+		}
+	})
+
+	mt.Run("storage fails", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		mt.ClearEvents()
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(id, ownerID, "a.txt")}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		results, err := service.DeleteFiles([]string{id.Hex()}, ownerID.Hex(), "")
+		if err == nil || results != nil {
+			t.Fatalf("results = %+v, err = %v, want the batch to fail as a whole", results, err)
+		}
+		if len(commands(mt, "abortTransaction")) != 1 || len(commands(mt, "commitTransaction")) != 0 {
+			t.Fatal("the trash update was not rolled back")
+		}
+	})
+}
+
+func TestDeleteVersionKeepsLiveFile(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("delete", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		fileID, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+		oldID, keptID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		file := append(fileDoc(fileID, ownerID, "report.pdf"), bson.E{Key: "versions", Value: bson.A{
+			bson.D{{Key: "version_id", Value: oldID}, {Key: "b2_file_id", Value: "b2-old"}, {Key: "size", Value: int64(7)}},
+			bson.D{{Key: "version_id", Value: keptID}, {Key: "b2_file_id", Value: "b2-kept"}, {Key: "size", Value: int64(8)}},
+		}})
+		mt.AddMockResponses(cursor("test.files", file), writeResult(1), writeResult(1))
+
+		if err := service.DeleteVersion(fileID.Hex(), oldID.Hex(), ownerID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 2 {
+			t.Fatalf("updates = %d, want 2", len(updates))
+		}
+		// Only the version is pulled; the live object and the other versions are untouched
+		u := updates[0].Command.Lookup("updates", "0", "u").Document()
+		if got := u.Lookup("$pull", "versions", "version_id").ObjectID(); got != oldID {
+			t.Fatalf("pulled version %s, want %s", got.Hex(), oldID.Hex())
+		}
+		if _, err := u.LookupErr("$set", "b2_file_id"); err == nil {
+			t.Fatal("deleting a version must not touch the live content")
+		}
+		if len(commands(mt, "delete")) != 0 {
+			t.Fatal("the file itself was deleted")
+		}
+		if got := updates[1].Command.Lookup("updates", "0", "u", "$inc", "used_storage").AsInt64(); got != -7 {
+			t.Fatalf("storage change = %d, want -7", got)
+		}
+	})
+
+	mt.Run("unknown version", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		fileID, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(cursor("test.files", fileDoc(fileID, ownerID, "report.pdf")))
+
+		err := service.DeleteVersion(fileID.Hex(), primitive.NewObjectID().Hex(), ownerID.Hex())
+		if err == nil || err.Error() != "version not found" {
+			t.Fatalf("err = %v, want version not found", err)
+		}
+		if len(commands(mt, "update")) != 0 {
+			t.Fatal("nothing should be written for an unknown version")
+		}
+	})
+}
+
+func TestRawFileInlinesSmallFilesOnly(t *testing.T) {
+	withConfig(t, &config.Config{RawInlineMaxSize: 100})
+
+	tests := []struct {
+		name       string
+		file       string
+		size       int64
+		wantInline bool
+	}{
+		{"small text", "notes.txt", 10, true},
+		{"large text", "notes.txt", 101, false},
+		{"small binary", "data.bin", 10, false},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			b2Service, _ := newStubB2Service(t)
+			service := NewFileService(mt.DB, nil, b2Service, nil)
+			id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+			doc := fileDoc(id, ownerID, tt.file)
+			for i := range doc {
+				if doc[i].Key == "size" {
+					doc[i].Value = tt.size
+				}
+			}
+			mt.AddMockResponses(cursor("test.files", doc))
+
+			file, url, err := service.RawFile(id.Hex(), ownerID.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.ID != id {
+				t.Fatalf("resolved file %s, want %s", file.ID.Hex(), id.Hex())
+			}
+			if inline := url == ""; inline != tt.wantInline {
+				t.Fatalf("inline = %t (url %q), want %t", inline, url, tt.wantInline)
+			}
+		})
+	}
+}
+
+func TestGetFilesByCategoryFiltersAcrossFolders(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("videos", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		ownerID, clip := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor("test.files", bson.D{{Key: "n", Value: int32(1)}}),
+			cursor("test.files", append(fileDoc(clip, ownerID, "clip.mp4"), bson.E{Key: "extension", Value: ".mp4"})),
+		)
+
+		files, total, err := service.GetFilesByCategory(ownerID.Hex(), ContentTypeVideos, 20, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(files) != 1 || files[0].ID != clip {
+			t.Fatalf("files = %+v (total %d), want only the video", files, total)
+		}
+
+		finds := commands(mt, "find")
+		if len(finds) != 1 {
+			t.Fatalf("finds = %d, want 1", len(finds))
+		}
+		filter := finds[0].Command.Lookup("filter").Document()
+		if filter.Lookup("owner_id").ObjectID() != ownerID {
+			t.Fatal("listing is not scoped to the caller")
+		}
+		if _, err := filter.LookupErr("folder_id"); err == nil {
+			t.Fatal("a category listing must span every folder")
+		}
+		extensions, err := filter.Lookup("$or", "0", "extension", "$in").Array().Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(extensions) != len(videoExtensions) || extensions[0].StringValue() != videoExtensions[0] {
+			t.Fatalf("video filter = %v, want the video extensions", extensions)
+		}
+	})
+
+	mt.Run("other", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		mt.AddMockResponses(cursor("test.files"), cursor("test.files"))
+
+		if _, _, err := service.GetFilesByCategory(primitive.NewObjectID().Hex(), ContentTypeOther, 20, 0); err != nil {
+			t.Fatal(err)
+		}
+		// Everything outside the four named categories
+		excluded, err := commands(mt, "find")[0].Command.Lookup("filter", "$nor").Array().Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(excluded) != 4 {
+			t.Fatalf("other excludes %d categories, want 4", len(excluded))
+		}
+	})
+}
+
+func TestFindBySHA1ReportsHitAndMiss(t *testing.T) {
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	mt := newMockDB(t)
+
+	mt.Run("hit", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		ownerID, id := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(cursor("test.files", append(fileDoc(id, ownerID, "a.txt"), bson.E{Key: "sha1_hash", Value: hash})))
+
+		// Hashes are matched case-insensitively, as clients may send either
+		file, err := service.FindBySHA1(ownerID.Hex(), strings.ToUpper(hash), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file == nil || file.ID != id {
+			t.Fatalf("file = %+v, want the existing file", file)
+		}
+		filter := commands(mt, "find")[0].Command.Lookup("filter").Document()
+		if filter.Lookup("sha1_hash").StringValue() != hash || filter.Lookup("owner_id").ObjectID() != ownerID ||
+			filter.Lookup("size").AsInt64() != 10 {
+			t.Fatalf("filter = %v, want the caller's files with this hash and size", filter)
+		}
+	})
+
+	mt.Run("miss", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		mt.AddMockResponses(cursor("test.files"))
+
+		file, err := service.FindBySHA1(primitive.NewObjectID().Hex(), hash, 0)
+		if err != nil || file != nil {
+			t.Fatalf("file = %+v, err = %v, want no match", file, err)
+		}
+		if _, err := commands(mt, "find")[0].Command.LookupErr("filter", "size"); err == nil {
+			t.Fatal("an unknown size must not narrow the match")
+		}
+	})
+
+	mt.Run("malformed", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		if _, err := service.FindBySHA1(primitive.NewObjectID().Hex(), "not-a-hash", 0); err == nil ||
+			!strings.HasPrefix(err.Error(), "invalid sha1") {
+			t.Fatalf("err = %v, want invalid sha1", err)
+		}
+	})
+}
+
+func TestListViewOmitsHeavyArraysThatDetailKeeps(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("list and detail", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		ownerID, id := primitive.NewObjectID(), primitive.NewObjectID()
+		full := append(fileDoc(id, ownerID, "report.pdf"), bson.E{Key: "versions", Value: bson.A{bson.D{
+			{Key: "version_id", Value: primitive.NewObjectID()},
+			{Key: "b2_file_id", Value: "b2-old"},
+			{Key: "size", Value: int64(7)},
+		}}})
+
+		// The server applies the projection, so the list reply carries no arrays
+		mt.AddMockResponses(cursor("test.files", fileDoc(id, ownerID, "report.pdf")), cursor("test.files", full))
+
+		listed, err := service.GetRootFiles(ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		detail, err := service.GetFileByID(id.Hex(), ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		finds := commands(mt, "find")
+		projection := finds[0].Command.Lookup("projection").Document()
+		for _, field := range []string{"permissions", "versions"} {
+			if v, err := projection.LookupErr(field); err != nil || v.AsInt64() != 0 {
+				t.Fatalf("list projection = %v, want %s excluded", projection, field)
+			}
+		}
+		if _, err := finds[1].Command.LookupErr("projection"); err == nil {
+			t.Fatal("the detail lookup must load the full document")
+		}
+
+		listJSON, _ := json.Marshal(listed)
+		detailJSON, _ := json.Marshal(detail)
+		if strings.Contains(string(listJSON), `"versions"`) || strings.Contains(string(listJSON), `"permissions"`) {
+			t.Fatalf("list response = %s, want no version or permission arrays", listJSON)
+		}
+		if !strings.Contains(string(detailJSON), `"versions"`) {
+			t.Fatalf("detail response = %s, want the versions", detailJSON)
+		}
+	})
+}
+
+func TestReplaceContentChecksQuotaBeforeUploading(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("quota", func(mt *mtest.T) {
+		// A zero B2Service would fail on any upload; the quota check must stop the call first
+		service := NewFileService(mt.DB, nil, &B2Service{}, nil)
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+		content := []byte("plain text")
+
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(id, ownerID, "notes.txt")),
+			cursor("test.users", bson.D{
+				{Key: "_id", Value: ownerID},
+				{Key: "used_storage", Value: int64(95)},
+				{Key: "max_storage", Value: int64(100)},
+			}),
+		)
+
+		_, err := service.ReplaceContent(id.Hex(), ownerID.Hex(), bytes.NewReader(content), int64(len(content)), "")
+		var quotaErr *QuotaExceededError
+		if !errors.As(err, &quotaErr) {
+			t.Fatalf("err = %v, want a QuotaExceededError", err)
+		}
+	})
+}
+
+func TestCheckFileCountLimitAtBoundary(t *testing.T) {
+	withConfig(t, &config.Config{MaxFilesPerUser: 3})
+
+	tests := []struct {
+		name       string
+		live       int
+		additional int
+		wantErr    bool
+	}{
+		{"reaches limit", 2, 1, false},
+		{"one over", 3, 1, true},
+		{"batch over", 1, 3, true},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewFileService(mt.DB, nil, nil, nil)
+			mt.AddMockResponses(cursor("test.files", bson.D{{Key: "n", Value: int32(tt.live)}}))
+
+			err := service.CheckFileCountLimit(context.Background(), primitive.NewObjectID(), tt.additional)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "file count limit exceeded") {
+				t.Fatalf("err = %v, want file count limit exceeded", err)
+			}
+
+			count := commands(mt, "aggregate")[0].Command
+			match := count.Lookup("pipeline", "0", "$match", "deleted_at")
+			if match.Type != bson.TypeNull {
+				t.Fatal("trashed files must not count toward the limit")
+			}
+		})
+	}
+}
+
+func TestQuotaSoftLimitWarnsAndHardLimitBlocks(t *testing.T) {
+	withConfig(t, &config.Config{StorageSoftLimitPercent: 90})
+
+	tests := []struct {
+		name     string
+		used     int64
+		upload   int64
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"under soft limit", 50, 10, false, false},
+		{"crosses soft limit", 85, 10, false, true},
+		{"fills quota exactly", 90, 10, false, true},
+		{"crosses hard limit", 95, 10, true, false},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewFileService(mt.DB, nil, nil, nil)
+			userID := primitive.NewObjectID()
+			mt.AddMockResponses(cursor("test.users", bson.D{
+				{Key: "_id", Value: userID},
+				{Key: "used_storage", Value: tt.used},
+				{Key: "max_storage", Value: int64(100)},
+			}))
+
+			err := service.CheckQuota(userID.Hex(), tt.upload)
+			if tt.wantErr {
+				var quotaErr *QuotaExceededError
+				if !errors.As(err, &quotaErr) {
+					t.Fatalf("err = %v, want a QuotaExceededError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upload blocked below the hard limit: %v", err)
+			}
+
+			status := buildStorageStatus(tt.used+tt.upload, 100)
+			if status.SoftLimitReached != tt.wantWarn || (status.Warning != "") != tt.wantWarn {
+				t.Fatalf("status = %+v, want warning %t", status, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestBulkTagFilesAddsAcrossFilesAndRemovesFromSubset(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("bulk tag", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, NewPermissionService(mt.DB))
+		userID := primitive.NewObjectID()
+		a, b, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(a, userID, "a.txt")),
+			writeResult(1),
+			cursor("test.files", bson.D{{Key: "_id", Value: a}, {Key: "tags", Value: bson.A{"urgent"}}}),
+			cursor("test.files", fileDoc(b, userID, "b.txt")),
+			writeResult(1),
+			cursor("test.files", bson.D{{Key: "_id", Value: b}, {Key: "tags", Value: bson.A{"urgent"}}}),
+			// Someone else's file with no grant for this user
+			cursor("test.files", fileDoc(other, primitive.NewObjectID(), "c.txt")),
+			cursor("test.permissions"),
+		)
+
+		results, err := service.BulkTagFiles(userID.Hex(), []string{a.Hex(), b.Hex(), other.Hex()}, []string{" Urgent "}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("results = %+v", results)
+		}
+		for _, result := range results[:2] {
+			if !result.Success || len(result.Tags) != 1 || result.Tags[0] != "urgent" {
+				t.Fatalf("result = %+v, want urgent added", result)
+			}
+		}
+		if results[2].Success || results[2].Error != "insufficient permissions" {
+			t.Fatalf("result = %+v, want insufficient permissions", results[2])
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(a, userID, "a.txt")),
+			writeResult(1),
+			cursor("test.files", bson.D{{Key: "_id", Value: a}, {Key: "tags", Value: bson.A{}}}),
+		)
+
+		results, err = service.BulkTagFiles(userID.Hex(), []string{a.Hex()}, nil, []string{"urgent"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !results[0].Success || len(results[0].Tags) != 0 {
+			t.Fatalf("results = %+v, want urgent removed", results)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 1 {
+			t.Fatalf("updates = %d, want 1", len(updates))
+		}
+		pulled := updates[0].Command.Lookup("updates", "0", "u", "$pullAll", "tags", "0")
+		if pulled.StringValue() != "urgent" {
+			t.Fatalf("update = %v, want $pullAll of urgent", updates[0].Command)
+		}
+	})
+}
+
+func TestGetFilePropertiesPopulatesSharedVersionedFile(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("properties", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		fileID, ownerID, folderID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		created := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+
+		file := append(fileDoc(fileID, ownerID, "report.pdf"),
+			bson.E{Key: "mime_type", Value: "application/pdf"},
+			bson.E{Key: "extension", Value: ".pdf"},
+			bson.E{Key: "sha1_hash", Value: "abc123"},
+			bson.E{Key: "folder_id", Value: folderID},
+			bson.E{Key: "tags", Value: bson.A{"finance"}},
+			bson.E{Key: "versions", Value: bson.A{bson.D{{Key: "size", Value: int64(8)}}, bson.D{{Key: "size", Value: int64(9)}}}},
+			bson.E{Key: "created_at", Value: created},
+			bson.E{Key: "updated_at", Value: created.Add(time.Minute)},
+		)
+		mt.AddMockResponses(
+			cursor("test.files", file),
+			cursor("test.users", bson.D{{Key: "_id", Value: ownerID}, {Key: "name", Value: "Ada"}, {Key: "email", Value: "ada@example.com"}}),
+			cursor("test.folders", bson.D{{Key: "_id", Value: folderID}, {Key: "path", Value: "/Work/Reports"}}),
+			cursor("test.shares", bson.D{{Key: "n", Value: int32(2)}}),
+		)
+
+		props, err := service.GetFileProperties(fileID.Hex(), ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case props.ID != fileID, props.Name != "report.pdf", props.Size != 10:
+			t.Fatalf("identity = %+v", props)
+		case props.MimeType != "application/pdf", props.Extension != ".pdf", props.Hashes["sha1"] != "abc123":
+			t.Fatalf("type and hashes = %+v", props)
+		case !props.CreatedAt.Equal(created), !props.UpdatedAt.Equal(created.Add(time.Minute)):
+			t.Fatalf("timestamps = %v %v", props.CreatedAt, props.UpdatedAt)
+		case props.Owner.ID != ownerID.Hex(), props.Owner.Name != "Ada", props.Owner.Email != "ada@example.com":
+			t.Fatalf("owner = %+v", props.Owner)
+		case props.FolderID == nil || *props.FolderID != folderID, props.FolderPath != "/Work/Reports":
+			t.Fatalf("folder = %v %q", props.FolderID, props.FolderPath)
+		case props.VersionCount != 2, props.ShareCount != 2:
+			t.Fatalf("versions = %d shares = %d, want 2 and 2", props.VersionCount, props.ShareCount)
+		case len(props.Tags) != 1 || props.Tags[0] != "finance":
+			t.Fatalf("tags = %v", props.Tags)
+		}
+	})
+}
+
+func TestFindDuplicatesGroupsIdenticalContentOnly(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("duplicates", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		userID := primitive.NewObjectID()
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+		// The server answers with the one group of two identical files
+		mt.AddMockResponses(cursor("test.files", bson.D{
+			{Key: "sha1", Value: "aaaa"},
+			{Key: "size", Value: int64(100)},
+			{Key: "count", Value: int32(2)},
+			{Key: "reclaimable_bytes", Value: int64(100)},
+			{Key: "files", Value: bson.A{
+				bson.D{{Key: "_id", Value: first}, {Key: "name", Value: "a.txt"}},
+				bson.D{{Key: "_id", Value: second}, {Key: "name", Value: "copy of a.txt"}},
+			}},
+		}))
+
+		groups, err := service.FindDuplicates(userID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].Count != 2 || groups[0].ReclaimableBytes != 100 ||
+			len(groups[0].Files) != 2 || groups[0].Files[0].ID != first || groups[0].Files[1].ID != second {
+			t.Fatalf("groups = %+v", groups)
+		}
+
+		pipeline := commands(mt, "aggregate")[0].Command.Lookup("pipeline")
+		match := pipeline.Array().Index(0).Value().Document().Lookup("$match")
+		if match.Document().Lookup("owner_id").ObjectID() != userID || match.Document().Lookup("deleted_at").Type != bson.TypeNull {
+			t.Fatalf("first stage = %v, want the user's live files", match)
+		}
+		// Files group by hash and size, and a group of one (unique content) is dropped
+		key := pipeline.Array().Index(2).Value().Document().Lookup("$group", "_id").Document()
+		if key.Lookup("sha1").StringValue() != "$sha1_hash" || key.Lookup("size").StringValue() != "$size" {
+			t.Fatalf("group key = %v, want sha1 and size", key)
+		}
+		if min := pipeline.Array().Index(3).Value().Document().Lookup("$match", "count", "$gt"); min.Int32() != 1 {
+			t.Fatalf("groups kept when count > %v, want > 1", min)
+		}
+	})
+}
+
+func TestRestoreVersionArchivesCurrentContent(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("restore", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, nil)
+		fileID, ownerID, versionID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		current := "b2-" + fileID.Hex()
+
+		file := append(fileDoc(fileID, ownerID, "report.pdf"), bson.E{Key: "versions", Value: bson.A{bson.D{
+			{Key: "version_id", Value: versionID},
+			{Key: "b2_file_id", Value: "b2-old"},
+			{Key: "size", Value: int64(7)},
+		}}})
+		mt.AddMockResponses(
+			cursor("test.files", file),
+			writeResult(1),
+			writeResult(1),
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		restored, err := service.RestoreVersion(fileID.Hex(), versionID.Hex(), ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.B2FileID != "b2-old" || restored.Size != 7 {
+			t.Fatalf("live content = %s (%d bytes), want the restored version", restored.B2FileID, restored.Size)
+		}
+		if len(restored.Versions) != 1 || restored.Versions[0].B2FileID != current || restored.Versions[0].Size != 10 {
+			t.Fatalf("versions = %+v, want the previous content archived", restored.Versions)
+		}
+
+		// Both writes run in one transaction and the second keeps the old live object
+		updates := commands(mt, "update")
+		if len(updates) != 2 {
+			t.Fatalf("updates = %d, want 2", len(updates))
+		}
+		for _, update := range updates {
+			if _, err := update.Command.LookupErr("txnNumber"); err != nil {
+				t.Fatal("version restore must be transactional")
+			}
+		}
+		if got := updates[0].Command.Lookup("updates", "0", "q", "b2_file_id").StringValue(); got != current {
+			t.Fatalf("swap is conditional on %q, want the current object", got)
+		}
+		if got := updates[1].Command.Lookup("updates", "0", "u", "$push", "versions", "b2_file_id").StringValue(); got != current {
+			t.Fatalf("archived %q, want the previous live object", got)
+		}
+		if len(commands(mt, "commitTransaction")) != 1 {
+			t.Fatal("transaction was not committed")
+		}
+	})
+}
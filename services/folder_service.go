@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"path"
+	"phynixdrive/config"
 	"phynixdrive/models"
 	"strings"
 	"time"
@@ -33,6 +34,7 @@ type FolderContentsResponse struct {
 	Subfolders []SubfolderInfo `json:"subfolders"`
 	Files      []FileInfo      `json:"files"`
 	Counts     ContentCounts   `json:"counts"`
+	TotalSize  *int64          `json:"total_size,omitempty"` // bytes of live files in the whole subtree; only with include_size
 }
 type FolderSummary struct {
 	ID             primitive.ObjectID `json:"id"`
@@ -60,6 +62,29 @@ type SubfolderInfo struct {
 	CreatedAt time.Time          `json:"created_at"`
 }
 
+// BreadcrumbItem is one folder on the path from the top of what the user can see down to
+// the current folder
+type BreadcrumbItem struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+	Path string             `json:"path"`
+}
+
+// FolderView bundles what a client needs to render a folder in one response
+type FolderView struct {
+	Contents   *FolderContentsResponse `json:"contents"`
+	Breadcrumb []BreadcrumbItem        `json:"breadcrumb"`
+	Role       string                  `json:"role"`
+}
+
+// ResolvedPath maps one requested path to its folder. FolderID is nil for the root.
+type ResolvedPath struct {
+	Path     string              `json:"path"`
+	FolderID *primitive.ObjectID `json:"folder_id"`
+	Found    bool                `json:"found"`
+	Error    string              `json:"error,omitempty"`
+}
+
 type ContentCounts struct {
 	Subfolders int `json:"subfolders"`
 	Files      int `json:"files"`
@@ -85,7 +110,9 @@ func NewFolderService(db *mongo.Database, permissionService *PermissionService,
 	}
 }
 
-func (s *FolderService) GetFolderContents(folderID, userID string) (*FolderContentsResponse, error) {
+// GetFolderContents lists one page of a folder's subfolders and files. typeFilter is one of the
+// ContentType values, or empty for everything. Counts always cover the whole folder.
+func (s *FolderService) GetFolderContents(folderID, userID string, sortOpt SortOption, typeFilter string, limit, offset int) (*FolderContentsResponse, error) {
 	ctx := context.Background()
 
 	folderObjID, err := primitive.ObjectIDFromHex(folderID)
@@ -94,12 +121,8 @@ func (s *FolderService) GetFolderContents(folderID, userID string) (*FolderConte
 	}
 
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, folderID, "viewer")
-		if err != nil {
-			return nil, fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return nil, fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "viewer"); err != nil {
+			return nil, err
 		}
 	}
 
@@ -122,14 +145,53 @@ func (s *FolderService) GetFolderContents(folderID, userID string) (*FolderConte
 		canShare, _ = s.permissionService.HasFolderPermission(ctx, userID, folderID, "admin")
 	}
 
-	subfolders, err := s.getSubfoldersWithCounts(ctx, folderObjID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get subfolders: %w", err)
+	sortDoc := resolveSortOption(ctx, s.userCollection, userID, sortOpt).sortDocument()
+
+	// Subfolders come first, then files; the page is a window over that combined list
+	subfolders := []SubfolderInfo{}
+	subfolderTotal := 0
+	if includesFolders(typeFilter) {
+		visible, err := s.visibleSubfolders(ctx, folderObjID, userID, sortDoc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subfolders: %w", err)
+		}
+		subfolderTotal = len(visible)
+
+		if offset < len(visible) {
+			visible = visible[offset:]
+			if len(visible) > limit {
+				visible = visible[:limit]
+			}
+			subfolders = s.withFileCounts(ctx, visible)
+		}
 	}
 
-	files, err := s.getFilesWithEndpoints(ctx, folderObjID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get files: %w", err)
+	files := []FileInfo{}
+	var fileTotal int64
+	if typeFilter != ContentTypeFolder {
+		filter := bson.M{
+			"folder_id":  folderObjID,
+			"deleted_at": nil,
+		}
+		for key, value := range fileCategoryFilter(typeFilter) {
+			filter[key] = value
+		}
+
+		fileTotal, err = s.fileCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count files: %w", err)
+		}
+
+		fileOffset := offset - subfolderTotal
+		if fileOffset < 0 {
+			fileOffset = 0
+		}
+		if fileLimit := limit - len(subfolders); fileLimit > 0 {
+			files, err = s.getFilesWithEndpoints(ctx, filter, sortDoc, int64(fileOffset), int64(fileLimit))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get files: %w", err)
+			}
+		}
 	}
 
 	response := &FolderContentsResponse{
@@ -144,32 +206,225 @@ func (s *FolderService) GetFolderContents(folderID, userID string) (*FolderConte
 		Subfolders: subfolders,
 		Files:      files,
 		Counts: ContentCounts{
-			Subfolders: len(subfolders),
-			Files:      len(files),
+			Subfolders: subfolderTotal,
+			Files:      int(fileTotal),
 		},
 	}
 
 	return response, nil
 }
 
-func (s *FolderService) getSubfoldersWithCounts(ctx context.Context, parentID primitive.ObjectID) ([]SubfolderInfo, error) {
+// GetFolderView returns one page of a folder's contents together with its breadcrumb and
+// the caller's effective role on it
+func (s *FolderService) GetFolderView(folderID, userID string, sortOpt SortOption, typeFilter string, limit, offset int) (*FolderView, error) {
+	contents, err := s.GetFolderContents(folderID, userID, sortOpt, typeFilter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	breadcrumb, err := s.GetBreadcrumb(ctx, contents.Folder.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build breadcrumb: %w", err)
+	}
+
+	role := "owner"
+	if s.permissionService != nil {
+		role, err = s.permissionService.EffectiveRole(ctx, userID, "folder", folderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &FolderView{
+		Contents:   contents,
+		Breadcrumb: breadcrumb,
+		Role:       role,
+	}, nil
+}
+
+// GetBreadcrumb lists the folder's ancestors, root first, ending with the folder itself.
+// The walk stops below the first ancestor the user cannot view, so a folder shared on its
+// own does not reveal the owner's folders above it.
+func (s *FolderService) GetBreadcrumb(ctx context.Context, folderObjID primitive.ObjectID, userID string) ([]BreadcrumbItem, error) {
+	chain, _, err := s.visibleAncestry(ctx, folderObjID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	breadcrumb := make([]BreadcrumbItem, len(chain))
+	for i, folder := range chain {
+		breadcrumb[i] = BreadcrumbItem{ID: folder.ID, Name: folder.Name, Path: folder.Path}
+	}
+	return breadcrumb, nil
+}
+
+// maxAncestorDepth bounds parent walks so corrupt data cannot loop forever
+const maxAncestorDepth = 100
+
+// visibleAncestry walks up from the folder through its parents and returns the part of the
+// chain the user can view, root first, ending with the folder itself. The walk is bounded by
+// maxAncestorDepth and never revisits a folder. broken explains why the visible chain ends
+// short of a root folder, if it does; a cut at an ancestor the user cannot view is not broken.
+func (s *FolderService) visibleAncestry(ctx context.Context, folderObjID primitive.ObjectID, userID string) (chain []models.Folder, broken error, err error) {
+	visited := map[primitive.ObjectID]bool{}
+	nextID := &folderObjID
+	for nextID != nil {
+		if visited[*nextID] {
+			broken = fmt.Errorf("folder hierarchy is broken: cycle at %s", nextID.Hex())
+			break
+		}
+		if len(chain) >= maxAncestorDepth {
+			broken = fmt.Errorf("folder hierarchy is broken: deeper than %d levels", maxAncestorDepth)
+			break
+		}
+		visited[*nextID] = true
+
+		var folder models.Folder
+		err := s.folderCollection.FindOne(ctx, bson.M{"_id": *nextID, "is_deleted": false},
+			options.FindOne().SetProjection(bson.M{"name": 1, "path": 1, "parent_id": 1, "owner_id": 1})).Decode(&folder)
+		if err == mongo.ErrNoDocuments {
+			if len(chain) > 0 {
+				broken = fmt.Errorf("folder hierarchy is broken: parent %s not found", nextID.Hex())
+			}
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, folder)
+		nextID = folder.ParentID
+	}
+
+	if s.permissionService != nil && len(chain) > 0 {
+		ids := make([]primitive.ObjectID, len(chain))
+		for i, folder := range chain {
+			ids[i] = folder.ID
+		}
+		accessible, err := s.permissionService.FilterAccessible(ctx, userID, "folder", ids, "viewer")
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, folder := range chain {
+			if !accessible[folder.ID] {
+				chain, broken = chain[:i], nil
+				break
+			}
+		}
+	}
+
+	// Collected from the folder upwards; callers want the root first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, broken, nil
+}
+
+// GetAncestors lists the folder's parents, root first, not including the folder itself.
+// It is GetBreadcrumb's walk, so it also stops below the first ancestor the user cannot
+// view; unlike GetBreadcrumb, a parent that is missing, trashed or part of a cycle is
+// reported as an error.
+func (s *FolderService) GetAncestors(folderID, userID string) ([]FolderInfo, error) {
+	ctx := context.Background()
+
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "viewer"); err != nil {
+			return nil, err
+		}
+	}
+
+	chain, broken, err := s.visibleAncestry(ctx, folderObjID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if broken != nil {
+		return nil, broken
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("folder not found")
+	}
+	chain = chain[:len(chain)-1]
+
+	ancestors := make([]FolderInfo, len(chain))
+	for i, parent := range chain {
+		ancestors[i] = FolderInfo{ID: parent.ID, Name: parent.Name, Type: "folder", Path: parent.Path, CanEdit: true, CanShare: true}
+	}
+	if s.permissionService == nil || len(chain) == 0 {
+		return ancestors, nil
+	}
+
+	// Every visible ancestor is below the last one the user cannot view, so roles resolve top
+	// down from the direct grants alone: each folder gets the stronger of its own grant and
+	// its parent's role, as in EffectiveRole
+	ids := make([]string, len(chain))
+	for i, parent := range chain {
+		ids[i] = parent.ID.Hex()
+	}
+	direct, err := s.permissionService.directRoles(ctx, userID, "folder", ids)
+	if err != nil {
+		return nil, err
+	}
+	role := ""
+	for i, parent := range chain {
+		switch {
+		case parent.OwnerID.Hex() == userID:
+			role = "owner"
+		case roleRank(direct[ids[i]]) > roleRank(role):
+			role = direct[ids[i]]
+		}
+		ancestors[i].CanEdit = hasRequiredRole(role, "editor")
+		ancestors[i].CanShare = hasRequiredRole(role, "admin")
+	}
+	return ancestors, nil
+}
+
+// visibleSubfolders lists the direct subfolders of parentID the user can view, in sort order.
+// Access is checked in one batch instead of per folder.
+func (s *FolderService) visibleSubfolders(ctx context.Context, parentID primitive.ObjectID, userID string, sortDoc bson.D) ([]models.Folder, error) {
 	cursor, err := s.folderCollection.Find(ctx, bson.M{
 		"parent_id":  parentID,
 		"is_deleted": false,
-	}, options.Find().SetSort(bson.M{"name": 1}))
-
+	}, options.Find().SetSort(sortDoc).SetProjection(bson.M{"permissions": 0}))
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var subfolders []SubfolderInfo
-	for cursor.Next(ctx) {
-		var folder models.Folder
-		if err := cursor.Decode(&folder); err != nil {
-			continue
+	var folders []models.Folder
+	if err := cursor.All(ctx, &folders); err != nil {
+		return nil, err
+	}
+
+	if s.permissionService == nil || len(folders) == 0 {
+		return folders, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(folders))
+	for i, folder := range folders {
+		ids[i] = folder.ID
+	}
+	accessible, err := s.permissionService.FilterAccessible(ctx, userID, "folder", ids, "viewer")
+	if err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+
+	visible := folders[:0]
+	for _, folder := range folders {
+		if accessible[folder.ID] {
+			visible = append(visible, folder)
 		}
+	}
+	return visible, nil
+}
 
+// withFileCounts builds the subfolder entries for one page, counting files only for those
+func (s *FolderService) withFileCounts(ctx context.Context, folders []models.Folder) []SubfolderInfo {
+	subfolders := make([]SubfolderInfo, 0, len(folders))
+	for _, folder := range folders {
 		fileCount, err := s.fileCollection.CountDocuments(ctx, bson.M{
 			"folder_id":  folder.ID,
 			"deleted_at": nil,
@@ -187,47 +442,49 @@ func (s *FolderService) getSubfoldersWithCounts(ctx context.Context, parentID pr
 			CreatedAt: folder.CreatedAt,
 		})
 	}
-
-	return subfolders, nil
+	return subfolders
 }
 
-// getFilesWithEndpoints gets files in folder with preview/download endpoints (not permanent URLs)
-func (s *FolderService) getFilesWithEndpoints(ctx context.Context, folderID primitive.ObjectID) ([]FileInfo, error) {
-	cursor, err := s.fileCollection.Find(ctx, bson.M{
-		"folder_id":  folderID,
-		"deleted_at": nil,
-	}, options.Find().SetSort(bson.M{"name": 1}))
+// getFilesWithEndpoints gets one page of files with preview/download endpoints (not permanent URLs)
+func (s *FolderService) getFilesWithEndpoints(ctx context.Context, filter bson.M, sortDoc bson.D, skip, limit int64) ([]FileInfo, error) {
+	cursor, err := s.fileCollection.Find(ctx, filter, options.Find().
+		SetSort(sortDoc).
+		SetSkip(skip).
+		SetLimit(limit).
+		SetProjection(listViewProjection))
 
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var files []FileInfo
+	files := []FileInfo{}
 	for cursor.Next(ctx) {
 		var file models.File
 		if err := cursor.Decode(&file); err != nil {
 			continue
 		}
 
-		// Convert models.File to FileInfo with endpoints
-		fileInfo := FileInfo{
-			ID:               file.ID,
-			Name:             file.Name,
-			Type:             "file",
-			MimeType:         file.MimeType,
-			Size:             file.Size,
-			CreatedAt:        file.CreatedAt,
-			PreviewEndpoint:  fmt.Sprintf("/api/files/%s/preview", file.ID.Hex()),
-			DownloadEndpoint: fmt.Sprintf("/api/files/%s/download", file.ID.Hex()),
-		}
-
-		files = append(files, fileInfo)
+		files = append(files, fileInfoWithEndpoints(&file))
 	}
 
 	return files, nil
 }
-func (s *FolderService) ListRootFoldersWithCounts(userID string) ([]FolderSummary, error) {
+
+// fileInfoWithEndpoints converts a file to its listing entry with preview/download endpoints
+func fileInfoWithEndpoints(file *models.File) FileInfo {
+	return FileInfo{
+		ID:               file.ID,
+		Name:             file.Name,
+		Type:             "file",
+		MimeType:         file.MimeType,
+		Size:             file.Size,
+		CreatedAt:        file.CreatedAt,
+		PreviewEndpoint:  fmt.Sprintf("/api/files/%s/preview", file.ID.Hex()),
+		DownloadEndpoint: fmt.Sprintf("/api/files/%s/download", file.ID.Hex()),
+	}
+}
+func (s *FolderService) ListRootFoldersWithCounts(userID string, sortOpt SortOption) ([]FolderSummary, error) {
 	ctx := context.Background()
 
 	ownerObjID, err := primitive.ObjectIDFromHex(userID)
@@ -242,7 +499,8 @@ func (s *FolderService) ListRootFoldersWithCounts(userID string) ([]FolderSummar
 		"is_deleted": false,
 	}
 
-	cursor, err := s.folderCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	sortDoc := resolveSortOption(ctx, s.userCollection, userID, sortOpt).sortDocument()
+	cursor, err := s.folderCollection.Find(ctx, filter, options.Find().SetSort(sortDoc))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list folders: %w", err)
 	}
@@ -293,7 +551,7 @@ func (s *FolderService) ListRootFoldersWithCounts(userID string) ([]FolderSummar
 }
 
 // CreateFolder creates a new folder
-func (s *FolderService) CreateFolder(name string, parentID *string, ownerID string) (*models.Folder, error) {
+func (s *FolderService) CreateFolder(name, description string, parentID *string, ownerID string) (*models.Folder, error) {
 	ctx := context.Background()
 
 	// Validate owner ID
@@ -373,6 +631,7 @@ func (s *FolderService) CreateFolder(name string, parentID *string, ownerID stri
 		OwnerID:     ownerObjID,
 		ParentID:    parentObjID,
 		Path:        path,
+		Description: strings.TrimSpace(description),
 		Permissions: []models.Permission{},
 		IsDeleted:   false,
 		CreatedAt:   time.Now(),
@@ -490,6 +749,67 @@ func (s *FolderService) GetOrCreateFolderPath(path string, ownerID string) (*pri
 	return currentParentID, nil
 }
 
+// ResolveFolderPaths maps each of the owner's slash-separated folder paths to a folder ID
+// without creating anything. Paths are walked by name like GetOrCreateFolderPath, and
+// shared prefixes are looked up once.
+func (s *FolderService) ResolveFolderPaths(paths []string, ownerID string) ([]ResolvedPath, error) {
+	ownerObjID, err := primitive.ObjectIDFromHex(ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner ID: %w", err)
+	}
+
+	ctx := context.Background()
+	resolved := map[string]*primitive.ObjectID{"": nil}
+	results := make([]ResolvedPath, 0, len(paths))
+
+	for _, requested := range paths {
+		var parts []string
+		for _, part := range strings.Split(requested, "/") {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		result := ResolvedPath{Path: requested, Found: true}
+		prefix := ""
+		for _, part := range parts {
+			parentID := resolved[prefix]
+			if prefix == "" {
+				prefix = part
+			} else {
+				prefix = prefix + "/" + part
+			}
+			if _, ok := resolved[prefix]; ok {
+				continue
+			}
+
+			filter := bson.M{
+				"name":       part,
+				"owner_id":   ownerObjID,
+				"parent_id":  parentID,
+				"is_deleted": false,
+			}
+			var folder models.Folder
+			err := s.folderCollection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&folder)
+			if err == mongo.ErrNoDocuments {
+				result.Found = false
+				result.Error = "folder not found"
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("database error: %w", err)
+			}
+			resolved[prefix] = &folder.ID
+		}
+
+		if result.Found {
+			result.FolderID = resolved[prefix]
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 func (s *FolderService) ListRootFolders(userID string) ([]models.Folder, error) {
 	ctx := context.Background()
 
@@ -504,7 +824,9 @@ func (s *FolderService) ListRootFolders(userID string) ([]models.Folder, error)
 		"is_deleted": false,
 	}
 
-	cursor, err := s.folderCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	cursor, err := s.folderCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(listViewProjection))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list folders: %w", err)
 	}
@@ -540,19 +862,18 @@ func (s *FolderService) GetFolderByID(folderID string, userID string) (*models.F
 
 	// Check permissions if service is available
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(context.Background(), userID, folderID, "viewer")
-		if err != nil {
-			return nil, fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return nil, fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(context.Background(), userID, "folder", folderID, "viewer"); err != nil {
+			return nil, err
 		}
 	}
 
 	return &folder, nil
 }
 
-func (s *FolderService) RenameFolder(folderID string, newName string, userID string) error {
+// RenameFolder renames a folder and rewrites the paths below it. When expectedUpdatedAt is
+// set the rename only applies if the folder is unchanged since the client read it; either
+// way a write that races another rename or move fails instead of overwriting it.
+func (s *FolderService) RenameFolder(folderID string, newName string, userID string, expectedUpdatedAt *time.Time) error {
 	objID, err := primitive.ObjectIDFromHex(folderID)
 	if err != nil {
 		return fmt.Errorf("invalid folder ID: %w", err)
@@ -560,12 +881,8 @@ func (s *FolderService) RenameFolder(folderID string, newName string, userID str
 
 	// Check permissions if service is available
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(context.Background(), userID, folderID, "editor")
-		if err != nil {
-			return fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(context.Background(), userID, "folder", folderID, "editor"); err != nil {
+			return err
 		}
 	}
 
@@ -583,124 +900,631 @@ func (s *FolderService) RenameFolder(folderID string, newName string, userID str
 	} else if err != nil {
 		return fmt.Errorf("database error: %w", err)
 	}
-
-	// Update path
-	newPath := newName
-	if currentFolder.ParentID != nil {
-		parentPath, err := s.getFolderPath(*currentFolder.ParentID)
-		if err != nil {
-			return fmt.Errorf("failed to get parent path: %w", err)
-		}
-		newPath = parentPath + "/" + newName
+	if err := checkExpectedUpdatedAt(&currentFolder, expectedUpdatedAt); err != nil {
+		return err
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"name":       newName,
-			"path":       newPath,
-			"updated_at": time.Now(),
-		},
+	session, err := s.folderCollection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
 	}
+	defer session.EndSession(ctx)
 
-	result, err := s.folderCollection.UpdateOne(ctx, bson.M{
-		"_id":        objID,
-		"is_deleted": false,
-	}, update)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		newPath, err := s.childPath(sc, currentFolder.ParentID, newName)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := s.folderCollection.UpdateOne(sc, bson.M{
+			"_id":        objID,
+			"is_deleted": false,
+			"updated_at": unchangedSince(&currentFolder),
+		}, bson.M{
+			"$set": bson.M{
+				"name":       newName,
+				"path":       newPath,
+				"updated_at": time.Now(),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, fmt.Errorf("folder was modified concurrently")
+		}
 
+		return nil, s.rewriteDescendantPaths(sc, objID, newPath)
+	})
 	if err != nil {
+		if err.Error() == "folder was modified concurrently" || err.Error() == "parent folder not found" {
+			return err
+		}
 		return fmt.Errorf("failed to rename folder: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("folder not found")
-	}
+	return nil
+}
 
+// checkExpectedUpdatedAt rejects a write based on a stale read of the folder. Timestamps are
+// compared at the millisecond precision MongoDB stores.
+func checkExpectedUpdatedAt(folder *models.Folder, expectedUpdatedAt *time.Time) error {
+	if expectedUpdatedAt == nil {
+		return nil
+	}
+	if !folder.UpdatedAt.Truncate(time.Millisecond).Equal(expectedUpdatedAt.Truncate(time.Millisecond)) {
+		return fmt.Errorf("folder was modified concurrently")
+	}
 	return nil
 }
 
-func (s *FolderService) DeleteFolder(ctx context.Context, folderID string, userID string) error {
+// unchangedSince is the updated_at filter value matching the folder only as it was read
+func unchangedSince(folder *models.Folder) interface{} {
+	if folder.UpdatedAt.IsZero() {
+		return bson.M{"$exists": false}
+	}
+	return folder.UpdatedAt
+}
+
+// MoveFolder re-parents a folder, or moves it to the top level when newParentID is nil or empty.
+// Folders only move within their owner's tree, so owner_id and storage usage never change hands;
+// the paths of the folder and all its descendants are rewritten in one transaction.
+// expectedUpdatedAt works as in RenameFolder.
+func (s *FolderService) MoveFolder(folderID string, newParentID *string, userID string, expectedUpdatedAt *time.Time) error {
+	ctx := context.Background()
+
 	objID, err := primitive.ObjectIDFromHex(folderID)
 	if err != nil {
 		return fmt.Errorf("invalid folder ID: %w", err)
 	}
 
-	// --- Permission check ---
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, folderID, "admin")
-		if err != nil {
-			return fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "editor"); err != nil {
+			return err
 		}
 	}
 
-	// --- Check if folder exists and is not already deleted ---
 	var folder models.Folder
 	err = s.folderCollection.FindOne(ctx, bson.M{
 		"_id":        objID,
 		"is_deleted": false,
 	}).Decode(&folder)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("folder not found or already deleted")
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("folder not found")
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if err := checkExpectedUpdatedAt(&folder, expectedUpdatedAt); err != nil {
+		return err
+	}
+
+	// Taking a folder out of its current parent changes that parent's contents too
+	if s.permissionService != nil && folder.ParentID != nil {
+		hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, folder.ParentID.Hex(), "editor")
+		if err != nil {
+			return fmt.Errorf("permission check failed: %w", err)
+		}
+		if !hasPermission {
+			return fmt.Errorf("insufficient permissions")
 		}
-		return fmt.Errorf("failed to find folder: %w", err)
 	}
 
-	now := time.Now()
+	var parentObjID *primitive.ObjectID
+	if newParentID != nil && *newParentID != "" {
+		parentObjIDTemp, err := primitive.ObjectIDFromHex(*newParentID)
+		if err != nil {
+			return fmt.Errorf("invalid parent ID: %w", err)
+		}
+		parentObjID = &parentObjIDTemp
 
-	// --- Use transaction for atomicity ---
-	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
-		// Mark the main folder as deleted
-		update := bson.M{
-			"$set": bson.M{
-				"is_deleted": true,
-				"deleted_at": now,
-				"updated_at": now,
-			},
+		if parentObjIDTemp == objID {
+			return fmt.Errorf("cannot move a folder into itself")
 		}
 
-		result, err := s.folderCollection.UpdateOne(sessCtx, bson.M{
-			"_id":        objID,
+		var parent models.Folder
+		err = s.folderCollection.FindOne(ctx, bson.M{
+			"_id":        parentObjIDTemp,
 			"is_deleted": false,
-		}, update)
-		if err != nil {
-			return nil, fmt.Errorf("failed to delete folder: %w", err)
-		}
-		if result.MatchedCount == 0 {
-			return nil, fmt.Errorf("folder not found or already deleted")
+		}).Decode(&parent)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("parent folder not found")
+		} else if err != nil {
+			return fmt.Errorf("database error: %w", err)
 		}
 
-		// Cascade soft-delete subfolders recursively
-		if err := s.softDeleteSubfolders(sessCtx, objID, now); err != nil {
-			return nil, fmt.Errorf("failed to delete subfolders: %w", err)
+		// Moving across owners would leave descendants owned and billed to someone
+		// other than the owner of the tree they now live in
+		if parent.OwnerID != folder.OwnerID {
+			return fmt.Errorf("cannot move folder into another user's folder")
 		}
 
-		// Soft-delete all files in this folder and subfolders
-		if err := s.softDeleteFiles(sessCtx, objID, now); err != nil {
-			return nil, fmt.Errorf("failed to delete files: %w", err)
+		if s.permissionService != nil {
+			hasPermission, err := s.permissionService.HasFolderPermission(ctx, userID, *newParentID, "editor")
+			if err != nil {
+				return fmt.Errorf("permission check failed: %w", err)
+			}
+			if !hasPermission {
+				return fmt.Errorf("insufficient permissions")
+			}
 		}
 
-		return nil, nil
+		isDescendant, err := s.isDescendantOf(ctx, parentObjIDTemp, objID)
+		if err != nil {
+			return fmt.Errorf("failed to check folder hierarchy: %w", err)
+		}
+		if isDescendant {
+			return fmt.Errorf("cannot move a folder into itself")
+		}
+	} else if folder.OwnerID.Hex() != userID {
+		// Only the owner can pull a folder up to the top level of their own tree
+		return fmt.Errorf("insufficient permissions")
 	}
 
-	session, err := s.folderCollection.Database().Client().StartSession()
+	// Check if folder with same name exists in the destination
+	filter := bson.M{
+		"_id":        bson.M{"$ne": objID},
+		"name":       folder.Name,
+		"owner_id":   folder.OwnerID,
+		"parent_id":  nil,
+		"is_deleted": false,
+	}
+	if parentObjID != nil {
+		filter["parent_id"] = *parentObjID
+	}
+	count, err := s.folderCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("folder with name '%s' already exists", folder.Name)
+	}
+
+	session, err := s.folderCollection.Database().Client().StartSession()
 	if err != nil {
 		return fmt.Errorf("failed to start session: %w", err)
 	}
 	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(ctx, callback)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Re-read the parent's path here so a concurrent rename of it is either seen or conflicts
+		newPath, err := s.childPath(sc, parentObjID, folder.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := s.folderCollection.UpdateOne(sc, bson.M{
+			"_id":        objID,
+			"owner_id":   folder.OwnerID,
+			"is_deleted": false,
+			"updated_at": unchangedSince(&folder),
+		}, bson.M{
+			"$set": bson.M{
+				"parent_id":  parentObjID,
+				"path":       newPath,
+				"updated_at": time.Now(),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, fmt.Errorf("folder was modified concurrently")
+		}
+
+		return nil, s.rewriteDescendantPaths(sc, objID, newPath)
+	})
 	if err != nil {
-		return err
+		if err.Error() == "folder was modified concurrently" || err.Error() == "parent folder not found" {
+			return err
+		}
+		return fmt.Errorf("failed to move folder: %w", err)
+	}
+
+	return nil
+}
+
+// isDescendantOf walks up from folderID and reports whether ancestorID is on the way to the root.
+// Like the other parent walks it is bounded by maxAncestorDepth, and a cycle is an error.
+func (s *FolderService) isDescendantOf(ctx context.Context, folderID, ancestorID primitive.ObjectID) (bool, error) {
+	current := folderID
+	visited := map[primitive.ObjectID]bool{}
+	for depth := 0; ; depth++ {
+		if visited[current] {
+			return false, fmt.Errorf("folder hierarchy is broken: cycle at %s", current.Hex())
+		}
+		if depth >= maxAncestorDepth {
+			return false, fmt.Errorf("folder hierarchy is broken: deeper than %d levels", maxAncestorDepth)
+		}
+		visited[current] = true
+
+		var folder models.Folder
+		err := s.folderCollection.FindOne(ctx, bson.M{"_id": current},
+			options.FindOne().SetProjection(bson.M{"parent_id": 1})).Decode(&folder)
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if folder.ParentID == nil {
+			return false, nil
+		}
+		if *folder.ParentID == ancestorID {
+			return true, nil
+		}
+		current = *folder.ParentID
+	}
+}
+
+// childPath is the path of a folder called name under parentID (nil for the top level). Callers
+// read it inside the transaction that writes the folder: a concurrent rename of the parent also
+// rewrites the folder's path, so the two writes conflict and the transaction retries with the
+// new parent path instead of committing a stale one.
+func (s *FolderService) childPath(ctx context.Context, parentID *primitive.ObjectID, name string) (string, error) {
+	if parentID == nil {
+		return name, nil
+	}
+
+	var parent models.Folder
+	err := s.folderCollection.FindOne(ctx, bson.M{"_id": *parentID, "is_deleted": false},
+		options.FindOne().SetProjection(bson.M{"path": 1})).Decode(&parent)
+	if err == mongo.ErrNoDocuments {
+		return "", fmt.Errorf("parent folder not found")
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get parent path: %w", err)
+	}
+	return parent.Path + "/" + name, nil
+}
+
+// rewriteDescendantPaths recomputes the path of every folder below parentID level by level,
+// along with the relative_path of the files they contain.
+// It follows parent_id rather than matching path prefixes, since paths are not unique across users.
+func (s *FolderService) rewriteDescendantPaths(ctx mongo.SessionContext, parentID primitive.ObjectID, parentPath string) error {
+	parents := map[primitive.ObjectID]string{parentID: parentPath}
+	// Bumping updated_at makes edits based on a descendant's old path fail their concurrency check
+	now := time.Now()
+
+	for len(parents) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(parents))
+		for id, path := range parents {
+			ids = append(ids, id)
+
+			// Files keep their folder's path in relative_path, which downloads and restores rely on
+			if _, err := s.fileCollection.UpdateMany(ctx, bson.M{"folder_id": id}, mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"relative_path": bson.M{"$concat": bson.A{path + "/", "$name"}}}}},
+			}); err != nil {
+				return err
+			}
+		}
+
+		cursor, err := s.folderCollection.Find(ctx, bson.M{"parent_id": bson.M{"$in": ids}},
+			options.Find().SetProjection(bson.M{"name": 1, "parent_id": 1}))
+		if err != nil {
+			return err
+		}
+
+		var children []models.Folder
+		if err := cursor.All(ctx, &children); err != nil {
+			return err
+		}
+
+		next := make(map[primitive.ObjectID]string, len(children))
+		for _, child := range children {
+			childPath := parents[*child.ParentID] + "/" + child.Name
+			if _, err := s.folderCollection.UpdateOne(ctx, bson.M{"_id": child.ID},
+				bson.M{"$set": bson.M{"path": childPath, "updated_at": now}}); err != nil {
+				return err
+			}
+			next[child.ID] = childPath
+		}
+		parents = next
 	}
 
 	return nil
 }
 
-// Recursively soft-delete subfolders
-func (s *FolderService) softDeleteSubfolders(ctx context.Context, parentID primitive.ObjectID, now time.Time) error {
+// Name collision policies for MergeFolder
+const (
+	MergeConflictRename = "rename"
+	MergeConflictSkip   = "skip"
+	MergeConflictFail   = "fail"
+)
+
+// ParseMergeConflict validates the on_conflict flag of a merge, defaulting to rename
+func ParseMergeConflict(raw string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(raw)); policy {
+	case "":
+		return MergeConflictRename, nil
+	case MergeConflictRename, MergeConflictSkip, MergeConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy: %s", raw)
+	}
+}
+
+// MergeResult reports what MergeFolder did with the source folder's direct children
+type MergeResult struct {
+	FilesMoved    int      `json:"files_moved"`
+	FoldersMoved  int      `json:"folders_moved"`
+	Renamed       int      `json:"renamed"`
+	Skipped       []string `json:"skipped"`
+	SourceDeleted bool     `json:"source_deleted"`
+}
+
+// MergeFolder moves every file and subfolder of sourceID into destID. Name collisions are
+// renamed, skipped (left in the source) or abort the merge depending on onConflict.
+// With deleteSource the source is moved to trash afterwards, provided nothing was left behind.
+func (s *FolderService) MergeFolder(ctx context.Context, sourceID, destID, userID, onConflict string, deleteSource bool) (*MergeResult, error) {
+	sourceObjID, err := primitive.ObjectIDFromHex(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+	destObjID, err := primitive.ObjectIDFromHex(destID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+	if sourceObjID == destObjID {
+		return nil, fmt.Errorf("cannot move a folder into itself")
+	}
+
+	if s.permissionService != nil {
+		sourceRole := "editor"
+		if deleteSource {
+			sourceRole = "admin"
+		}
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", sourceID, sourceRole); err != nil {
+			return nil, err
+		}
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", destID, "editor"); err != nil {
+			return nil, err
+		}
+	}
+
+	var source, dest models.Folder
+	if err := s.folderCollection.FindOne(ctx, bson.M{"_id": sourceObjID, "is_deleted": false}).Decode(&source); err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("folder not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if err := s.folderCollection.FindOne(ctx, bson.M{"_id": destObjID, "is_deleted": false}).Decode(&dest); err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("parent folder not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if source.OwnerID != dest.OwnerID {
+		return nil, fmt.Errorf("cannot move folder into another user's folder")
+	}
+	isDescendant, err := s.isDescendantOf(ctx, destObjID, sourceObjID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check folder hierarchy: %w", err)
+	}
+	if isDescendant {
+		return nil, fmt.Errorf("cannot move a folder into itself")
+	}
+
+	fileCursor, err := s.fileCollection.Find(ctx, bson.M{"folder_id": sourceObjID, "deleted_at": nil},
+		options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	var files []models.File
+	if err := fileCursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	folderCursor, err := s.folderCollection.Find(ctx, bson.M{"parent_id": sourceObjID, "is_deleted": false},
+		options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	var subfolders []models.Folder
+	if err := folderCursor.All(ctx, &subfolders); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	fileFilter := func() bson.M {
+		return bson.M{"owner_id": dest.OwnerID, "folder_id": destObjID, "deleted_at": nil}
+	}
+	folderFilter := func() bson.M {
+		return bson.M{"owner_id": dest.OwnerID, "parent_id": destObjID, "is_deleted": false}
+	}
+
+	session, err := s.folderCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	var result *MergeResult
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		result = &MergeResult{Skipped: []string{}}
+		now := time.Now()
+
+		for _, file := range files {
+			name, err := s.mergeName(sc, s.fileCollection, fileFilter(), "file", file.Name, onConflict)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				result.Skipped = append(result.Skipped, file.Name)
+				continue
+			}
+			if name != file.Name {
+				result.Renamed++
+			}
+
+			if _, err := s.fileCollection.UpdateOne(sc, bson.M{"_id": file.ID}, bson.M{"$set": bson.M{
+				"name":          name,
+				"folder_id":     destObjID,
+				"parent_id":     destObjID,
+				"relative_path": dest.Path + "/" + name,
+				"updated_at":    now,
+			}}); err != nil {
+				return nil, err
+			}
+			result.FilesMoved++
+		}
+
+		for _, folder := range subfolders {
+			name, err := s.mergeName(sc, s.folderCollection, folderFilter(), "folder", folder.Name, onConflict)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				result.Skipped = append(result.Skipped, folder.Name)
+				continue
+			}
+			if name != folder.Name {
+				result.Renamed++
+			}
+
+			path := dest.Path + "/" + name
+			if _, err := s.folderCollection.UpdateOne(sc, bson.M{"_id": folder.ID}, bson.M{"$set": bson.M{
+				"name":       name,
+				"parent_id":  destObjID,
+				"path":       path,
+				"updated_at": now,
+			}}); err != nil {
+				return nil, err
+			}
+			if err := s.rewriteDescendantPaths(sc, folder.ID, path); err != nil {
+				return nil, err
+			}
+			result.FoldersMoved++
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to merge folder: %w", err)
+	}
+
+	if deleteSource && len(result.Skipped) == 0 {
+		if err := s.DeleteFolder(ctx, sourceID, userID, ""); err != nil {
+			return result, fmt.Errorf("contents merged but failed to delete source folder: %w", err)
+		}
+		result.SourceDeleted = true
+	}
+
+	return result, nil
+}
+
+// mergeName picks the name an item gets in the merge destination. An empty name means skip it.
+func (s *FolderService) mergeName(ctx context.Context, collection *mongo.Collection, filter bson.M, kind, name, onConflict string) (string, error) {
+	if onConflict == MergeConflictRename {
+		return availableName(ctx, collection, filter, kind, name)
+	}
+
+	filter["name"] = name
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+	if count == 0 {
+		return name, nil
+	}
+	if onConflict == MergeConflictSkip {
+		return "", nil
+	}
+	return "", fmt.Errorf("%s with name '%s' already exists", kind, name)
+}
+
+func (s *FolderService) DeleteFolder(ctx context.Context, folderID string, userID string, reason string) error {
+	objID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	// --- Permission check ---
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "admin"); err != nil {
+			return err
+		}
+	}
+
+	// --- Check if folder exists and is not already deleted ---
+	var folder models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{
+		"_id":        objID,
+		"is_deleted": false,
+	}).Decode(&folder)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("folder not found or already deleted")
+		}
+		return fmt.Errorf("failed to find folder: %w", err)
+	}
+
+	// Collected up front since the subtree is no longer "live" once deleted
+	subtreeIDs, err := subtreeResourceIDs(ctx, s.folderCollection, s.fileCollection, &folder, bson.M{"deleted_at": nil})
+	if err != nil {
+		return fmt.Errorf("failed to collect folder contents: %w", err)
+	}
+
+	// Everything in the subtree records the same deletion time, actor and reason
+	trash := trashFields(time.Now(), userID, reason)
+
+	// --- Use transaction for atomicity ---
+	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Mark the main folder as deleted
+		update := bson.M{"$set": trash}
+
+		result, err := s.folderCollection.UpdateOne(sessCtx, bson.M{
+			"_id":        objID,
+			"is_deleted": false,
+		}, update)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete folder: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return nil, fmt.Errorf("folder not found or already deleted")
+		}
+
+		// Cascade soft-delete subfolders recursively
+		subfolderBytes, err := s.softDeleteSubfolders(sessCtx, objID, trash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete subfolders: %w", err)
+		}
+
+		// Soft-delete all files in this folder and subfolders
+		fileBytes, err := s.softDeleteFiles(sessCtx, objID, trash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete files: %w", err)
+		}
+
+		// Trashed files no longer count against the owner's storage; restoring adds them back
+		if freed := subfolderBytes + fileBytes; freed > 0 {
+			if _, err := s.userCollection.UpdateOne(sessCtx, bson.M{"_id": folder.OwnerID},
+				bson.M{"$inc": bson.M{"used_storage": -freed}}); err != nil {
+				return nil, fmt.Errorf("failed to update storage usage: %w", err)
+			}
+		}
+
+		// Shares are suspended in the same transaction, as in FileService.DeleteFile
+		if s.permissionService != nil {
+			if err := s.permissionService.SuspendResourcePermissions(sessCtx, subtreeIDs); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	session, err := s.folderCollection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, callback)
+	return err
+}
+
+// Recursively soft-delete subfolders, returning the stored bytes of the files deleted with them
+func (s *FolderService) softDeleteSubfolders(ctx context.Context, parentID primitive.ObjectID, trash bson.M) (int64, error) {
 	// Use bulk operations for better performance
 	var bulkOps []mongo.WriteModel
 
@@ -709,7 +1533,7 @@ func (s *FolderService) softDeleteSubfolders(ctx context.Context, parentID primi
 		"is_deleted": false,
 	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer cursor.Close(ctx)
 
@@ -717,7 +1541,7 @@ func (s *FolderService) softDeleteSubfolders(ctx context.Context, parentID primi
 	for cursor.Next(ctx) {
 		var subFolder models.Folder
 		if err := cursor.Decode(&subFolder); err != nil {
-			return err
+			return 0, err
 		}
 
 		subfolderIDs = append(subfolderIDs, subFolder.ID)
@@ -725,63 +1549,66 @@ func (s *FolderService) softDeleteSubfolders(ctx context.Context, parentID primi
 		// Prepare bulk update operation
 		updateModel := mongo.NewUpdateOneModel().
 			SetFilter(bson.M{"_id": subFolder.ID}).
-			SetUpdate(bson.M{"$set": bson.M{
-				"is_deleted": true,
-				"deleted_at": now,
-				"updated_at": now,
-			}})
+			SetUpdate(bson.M{"$set": trash})
 		bulkOps = append(bulkOps, updateModel)
 	}
 
 	if err := cursor.Err(); err != nil {
-		return err
+		return 0, err
 	}
 
+	var freed int64
+
 	// Execute bulk operations
 	if len(bulkOps) > 0 {
 		_, err := s.folderCollection.BulkWrite(ctx, bulkOps)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		// Recursively process subfolders
 		for _, subfolderID := range subfolderIDs {
-			if err := s.softDeleteSubfolders(ctx, subfolderID, now); err != nil {
-				return err
+			bytes, err := s.softDeleteSubfolders(ctx, subfolderID, trash)
+			if err != nil {
+				return 0, err
 			}
-			if err := s.softDeleteFiles(ctx, subfolderID, now); err != nil {
-				return err
+			freed += bytes
+
+			bytes, err = s.softDeleteFiles(ctx, subfolderID, trash)
+			if err != nil {
+				return 0, err
 			}
+			freed += bytes
 		}
 	}
 
-	return nil
+	return freed, nil
 }
 
-// Soft-delete all files inside a folder
-func (s *FolderService) softDeleteFiles(ctx context.Context, folderID primitive.ObjectID, now time.Time) error {
-	_, err := s.fileCollection.UpdateMany(ctx, bson.M{
+// Soft-delete all files inside a folder, returning their stored bytes
+func (s *FolderService) softDeleteFiles(ctx context.Context, folderID primitive.ObjectID, trash bson.M) (int64, error) {
+	filter := bson.M{
 		"folder_id":  folderID,
 		"is_deleted": false,
-	}, bson.M{
-		"$set": bson.M{
-			"is_deleted": true,
-			"deleted_at": now,
-			"updated_at": now,
-		},
-	})
-	return err
+	}
+
+	freed, err := sumStoredBytes(ctx, s.fileCollection, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = s.fileCollection.UpdateMany(ctx, filter, bson.M{"$set": trash})
+	if err != nil {
+		return 0, err
+	}
+	return freed, nil
 }
 
 func (s *FolderService) DeleteFileFromFolder(folderID string, fileID string, userID string) error {
 	// Check if user has permission to modify the folder
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(context.Background(), userID, folderID, "editor")
-		if err != nil {
-			return fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(context.Background(), userID, "folder", folderID, "editor"); err != nil {
+			return err
 		}
 	}
 
@@ -797,14 +1624,7 @@ func (s *FolderService) DeleteFileFromFolder(folderID string, fileID string, use
 	}
 
 	// Soft delete the file
-	now := time.Now()
-	update := bson.M{
-		"$set": bson.M{
-			"deleted_at": &now,
-			"updated_at": now,
-			"is_deleted": true,
-		},
-	}
+	update := bson.M{"$set": trashFields(time.Now(), userID, "")}
 
 	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
 		"_id":        fileObjID,
@@ -820,6 +1640,12 @@ func (s *FolderService) DeleteFileFromFolder(folderID string, fileID string, use
 		return fmt.Errorf("file not found in folder")
 	}
 
+	if s.permissionService != nil {
+		if err := s.permissionService.SuspendResourcePermissions(ctx, []string{fileID}); err != nil {
+			return fmt.Errorf("file deleted but %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -832,12 +1658,8 @@ func (s *FolderService) DownloadFolder(ctx context.Context, w http.ResponseWrite
 	}
 
 	if s.permissionService != nil {
-		hasPermission, err := s.permissionService.HasFolderPermission(context.Background(), userID, folderID, "viewer")
-		if err != nil {
-			return fmt.Errorf("permission check failed: %w", err)
-		}
-		if !hasPermission {
-			return fmt.Errorf("insufficient permissions")
+		if err := s.permissionService.CheckAccess(context.Background(), userID, "folder", folderID, "viewer"); err != nil {
+			return err
 		}
 	}
 
@@ -854,6 +1676,23 @@ func (s *FolderService) DownloadFolder(ctx context.Context, w http.ResponseWrite
 		return fmt.Errorf("database error: %w", err)
 	}
 
+	// Refuse oversized folders before any bytes are written so one request can't stream
+	// for hours; the budget re-checks while streaming in case files are added meanwhile
+	var maxBytes int64
+	if config.AppConfig != nil {
+		maxBytes = config.AppConfig.FolderDownloadMaxBytes
+	}
+	budget := &zipBudget{maxBytes: maxBytes}
+	if maxBytes > 0 {
+		totalBytes, _, err := s.measureSubtree(ctx, folderObjID)
+		if err != nil {
+			return err
+		}
+		if totalBytes > maxBytes {
+			return fmt.Errorf("download too large")
+		}
+	}
+
 	// Set headers for zip download
 	zipFileName := fmt.Sprintf("%s_%d.zip", strings.ReplaceAll(folder.Name, " ", "_"), time.Now().Unix())
 	w.Header().Set("Content-Type", "application/zip")
@@ -865,11 +1704,161 @@ func (s *FolderService) DownloadFolder(ctx context.Context, w http.ResponseWrite
 	defer zipWriter.Close()
 
 	// Recursively add folder contents
-	return s.AddFolderContentsToZip(ctx, zipWriter, folderObjID, "")
+	return s.addFolderContentsToZip(ctx, zipWriter, folderObjID, "", budget)
+}
+
+// zipBudget caps how much a single folder download may stream
+type zipBudget struct {
+	maxBytes int64
+	maxFiles int64
+	bytes    int64
+	files    int64
+}
+
+// add charges a file against the budget and reports whether it still fits
+func (b *zipBudget) add(size int64) bool {
+	b.files++
+	b.bytes += size
+	return (b.maxFiles <= 0 || b.files <= b.maxFiles) && (b.maxBytes <= 0 || b.bytes <= b.maxBytes)
+}
+
+// DownloadPublicFolder streams a folder reached through a public link as a ZIP. The subtree
+// is measured first so an oversized download is refused before any bytes are written, and the
+// walk re-checks the limits in case files are added while it streams. onAccept, if set, runs
+// once the folder is within the limits and before anything is written; its error aborts.
+func (s *FolderService) DownloadPublicFolder(ctx context.Context, w http.ResponseWriter, folderObjID primitive.ObjectID, maxBytes, maxFiles int64, onAccept func() error) error {
+	var folder models.Folder
+	err := s.folderCollection.FindOne(ctx, bson.M{
+		"_id":        folderObjID,
+		"is_deleted": false,
+	}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("folder not found")
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	totalBytes, totalFiles, err := s.measureSubtree(ctx, folderObjID)
+	if err != nil {
+		return err
+	}
+	budget := &zipBudget{maxBytes: maxBytes, maxFiles: maxFiles}
+	if (maxFiles > 0 && totalFiles > maxFiles) || (maxBytes > 0 && totalBytes > maxBytes) {
+		return fmt.Errorf("download too large")
+	}
+	if onAccept != nil {
+		if err := onAccept(); err != nil {
+			return err
+		}
+	}
+
+	zipFileName := fmt.Sprintf("%s_%d.zip", strings.ReplaceAll(folder.Name, " ", "_"), time.Now().Unix())
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipFileName))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	return s.addFolderContentsToZip(ctx, zipWriter, folderObjID, "", budget)
+}
+
+// GetFolderSize returns the total bytes of live files under a folder, including subfolders
+func (s *FolderService) GetFolderSize(folderID, userID string) (int64, error) {
+	ctx := context.Background()
+
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "viewer"); err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := s.folderCollection.CountDocuments(ctx, bson.M{"_id": folderObjID, "is_deleted": false})
+	if err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("folder not found")
+	}
+
+	return s.folderSize(ctx, folderObjID)
+}
+
+// folderSize is measureSubtree's byte total, read through the short-lived size cache
+func (s *FolderService) folderSize(ctx context.Context, folderObjID primitive.ObjectID) (int64, error) {
+	if size, ok := folderSizes.get(folderObjID); ok {
+		return size, nil
+	}
+	size, _, err := s.measureSubtree(ctx, folderObjID)
+	if err != nil {
+		return 0, err
+	}
+	folderSizes.set(folderObjID, size)
+	return size, nil
+}
+
+// measureSubtree totals the size and count of live files under a folder, including subfolders
+func (s *FolderService) measureSubtree(ctx context.Context, rootID primitive.ObjectID) (int64, int64, error) {
+	folderIDs := []primitive.ObjectID{rootID}
+	queue := []primitive.ObjectID{rootID}
+	// A corrupted parent_id cycle would otherwise keep the walk going forever
+	visited := map[primitive.ObjectID]bool{rootID: true}
+	for len(queue) > 0 {
+		cursor, err := s.folderCollection.Find(ctx, bson.M{
+			"parent_id":  bson.M{"$in": queue},
+			"is_deleted": false,
+		}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get subfolders: %w", err)
+		}
+		var children []models.Folder
+		if err := cursor.All(ctx, &children); err != nil {
+			return 0, 0, fmt.Errorf("failed to decode subfolders: %w", err)
+		}
+
+		queue = queue[:0]
+		for _, child := range children {
+			if visited[child.ID] {
+				continue
+			}
+			visited[child.ID] = true
+			folderIDs = append(folderIDs, child.ID)
+			queue = append(queue, child.ID)
+		}
+	}
+
+	cursor, err := s.fileCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"folder_id": bson.M{"$in": folderIDs}, "deleted_at": nil}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "bytes": bson.M{"$sum": "$size"}, "files": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to measure folder: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var totals struct {
+		Bytes int64 `bson:"bytes"`
+		Files int64 `bson:"files"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&totals); err != nil {
+			return 0, 0, fmt.Errorf("failed to decode folder size: %w", err)
+		}
+	}
+	return totals.Bytes, totals.Files, nil
 }
 
 // AddFolderContentsToZip recursively adds all files and subfolders to the zip, streaming from B2
 func (s *FolderService) AddFolderContentsToZip(ctx context.Context, zipWriter *zip.Writer, folderID primitive.ObjectID, currentPath string) error {
+	return s.addFolderContentsToZip(ctx, zipWriter, folderID, currentPath, nil)
+}
+
+func (s *FolderService) addFolderContentsToZip(ctx context.Context, zipWriter *zip.Writer, folderID primitive.ObjectID, currentPath string, budget *zipBudget) error {
 	// Check context cancellation
 	select {
 	case <-ctx.Done():
@@ -902,6 +1891,10 @@ func (s *FolderService) AddFolderContentsToZip(ctx context.Context, zipWriter *z
 		default:
 		}
 
+		if budget != nil && !budget.add(file.Size) {
+			return fmt.Errorf("download too large")
+		}
+
 		zipPath := path.Join(currentPath, file.Name)
 		zipEntry, err := zipWriter.Create(zipPath)
 		if err != nil {
@@ -950,7 +1943,7 @@ func (s *FolderService) AddFolderContentsToZip(ctx context.Context, zipWriter *z
 			fmt.Printf("Warning: failed to create folder entry for %s\n", subFolderPath)
 		}
 
-		err = s.AddFolderContentsToZip(ctx, zipWriter, subFolder.ID, subFolderPath)
+		err = s.addFolderContentsToZip(ctx, zipWriter, subFolder.ID, subFolderPath, budget)
 		if err != nil {
 			return fmt.Errorf("failed to process subfolder %s: %w", subFolder.Name, err)
 		}
@@ -0,0 +1,616 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"phynixdrive/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func folderDoc(id primitive.ObjectID, name, path string, parentID *primitive.ObjectID, updatedAt time.Time) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: name},
+		{Key: "path", Value: path},
+		{Key: "is_deleted", Value: false},
+		{Key: "updated_at", Value: updatedAt},
+	}
+	if parentID != nil {
+		doc = append(doc, bson.E{Key: "parent_id", Value: *parentID})
+	}
+	return doc
+}
+
+func TestRenameFolderRejectsStaleExpectedUpdatedAt(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("stale", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+		current := time.Now().Truncate(time.Millisecond)
+		stale := current.Add(-time.Minute)
+
+		mt.AddMockResponses(cursor("test.folders", folderDoc(id, "a", "a", nil, current)))
+
+		err := service.RenameFolder(id.Hex(), "b", primitive.NewObjectID().Hex(), &stale)
+		if err == nil || err.Error() != "folder was modified concurrently" {
+			t.Fatalf("err = %v, want folder was modified concurrently", err)
+		}
+		if updates := commands(mt, "update"); len(updates) != 0 {
+			t.Fatalf("a stale rename must not write, got %d updates", len(updates))
+		}
+	})
+}
+
+func TestRenameFolderFailsWhenFolderChangedAfterRead(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("concurrent", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+		readAt := time.Now().Truncate(time.Millisecond)
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "a", "a", nil, readAt)),
+			// Another rename committed in between, so the guarded update matches nothing
+			writeResult(0),
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		err := service.RenameFolder(id.Hex(), "b", primitive.NewObjectID().Hex(), nil)
+		if err == nil || err.Error() != "folder was modified concurrently" {
+			t.Fatalf("err = %v, want folder was modified concurrently", err)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 1 {
+			t.Fatalf("got %d updates, want 1", len(updates))
+		}
+		guard := updates[0].Command.Lookup("updates", "0", "q", "updated_at")
+		if guard.Time().UnixMilli() != readAt.UnixMilli() {
+			t.Fatalf("update not guarded by the updated_at that was read: %v", guard)
+		}
+	})
+}
+
+func TestRenameFolderRewritesDescendantsAndBumpsUpdatedAt(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("descendants", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+		childID := primitive.NewObjectID()
+		before := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "a", "a", nil, before)),
+			writeResult(1), // the folder itself
+			writeResult(0), // files directly in it
+			cursor("test.folders", folderDoc(childID, "c", "a/c", &id, before)),
+			writeResult(1), // the child's path
+			writeResult(0), // files in the child
+			cursor("test.folders"),
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.RenameFolder(id.Hex(), "b", primitive.NewObjectID().Hex(), nil); err != nil {
+			t.Fatalf("RenameFolder: %v", err)
+		}
+
+		var childUpdate bson.Raw
+		for _, evt := range commands(mt, "update") {
+			if id, ok := evt.Command.Lookup("updates", "0", "q", "_id").ObjectIDOK(); ok && id == childID {
+				childUpdate = evt.Command
+			}
+		}
+		if childUpdate == nil {
+			t.Fatal("child folder was not updated")
+		}
+		if path := childUpdate.Lookup("updates", "0", "u", "$set", "path").StringValue(); path != "b/c" {
+			t.Fatalf("child path = %q, want b/c", path)
+		}
+		bumped := childUpdate.Lookup("updates", "0", "u", "$set", "updated_at")
+		if bumped.Type != bson.TypeDateTime || !bumped.Time().After(before) {
+			t.Fatalf("child updated_at not bumped: %v", bumped)
+		}
+	})
+}
+
+func TestRenameFolderReadsParentPathInsideTransaction(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("parent", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		parentID := primitive.NewObjectID()
+		id := primitive.NewObjectID()
+		now := time.Now().Truncate(time.Millisecond)
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "a", "old/a", &parentID, now)),
+			// The parent was renamed after the folder was read; its current path must be used
+			cursor("test.folders", bson.D{{Key: "_id", Value: parentID}, {Key: "path", Value: "renamed"}}),
+			writeResult(1),
+			writeResult(0),
+			cursor("test.folders"),
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := service.RenameFolder(id.Hex(), "b", primitive.NewObjectID().Hex(), nil); err != nil {
+			t.Fatalf("RenameFolder: %v", err)
+		}
+
+		finds := commands(mt, "find")
+		if len(finds) < 2 {
+			t.Fatalf("got %d finds, want the parent lookup", len(finds))
+		}
+		if _, err := finds[1].Command.LookupErr("txnNumber"); err != nil {
+			t.Fatal("parent path was read outside the transaction")
+		}
+		update := commands(mt, "update")[0].Command
+		if path := update.Lookup("updates", "0", "u", "$set", "path").StringValue(); path != "renamed/b" {
+			t.Fatalf("path = %q, want renamed/b", path)
+		}
+	})
+}
+
+func TestMoveFolderStaysWithinOwnersTree(t *testing.T) {
+	ownerID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+	ownedBy := func(owner primitive.ObjectID, doc bson.D) bson.D {
+		return append(doc, bson.E{Key: "owner_id", Value: owner})
+	}
+
+	mt := newMockDB(t)
+	mt.Run("other user's folder", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		mt.ClearEvents()
+		id, destID := primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders", ownedBy(ownerID, folderDoc(id, "a", "a", nil, now))),
+			cursor("test.folders", ownedBy(otherID, folderDoc(destID, "dest", "dest", nil, now))),
+		)
+
+		dest := destID.Hex()
+		err := service.MoveFolder(id.Hex(), &dest, ownerID.Hex(), nil)
+		if err == nil || err.Error() != "cannot move folder into another user's folder" {
+			t.Fatalf("err = %v, want the cross-owner move rejected", err)
+		}
+		if updates := commands(mt, "update"); len(updates) != 0 {
+			t.Fatalf("a rejected move must not write, got %d updates", len(updates))
+		}
+	})
+
+	mt.Run("own folder", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		mt.ClearEvents()
+		id, destID := primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders", ownedBy(ownerID, folderDoc(id, "a", "a", nil, now))),
+			cursor("test.folders", ownedBy(ownerID, folderDoc(destID, "dest", "dest", nil, now))),
+			cursor("test.folders", bson.D{{Key: "_id", Value: destID}}), // dest is not below the folder
+			cursor("test.folders"), // no name collision
+			cursor("test.folders", bson.D{{Key: "_id", Value: destID}, {Key: "path", Value: "dest"}}),
+			writeResult(1),
+			writeResult(0),
+			cursor("test.folders"),
+			mtest.CreateSuccessResponse(),
+		)
+
+		dest := destID.Hex()
+		if err := service.MoveFolder(id.Hex(), &dest, ownerID.Hex(), nil); err != nil {
+			t.Fatalf("MoveFolder: %v", err)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 2 {
+			t.Fatalf("got %d updates, want the folder and its files", len(updates))
+		}
+		move := updates[0].Command
+		if owner := move.Lookup("updates", "0", "q", "owner_id").ObjectID(); owner != ownerID {
+			t.Fatalf("move guarded by owner %s, want %s", owner.Hex(), ownerID.Hex())
+		}
+		set := move.Lookup("updates", "0", "u", "$set").Document()
+		if set.Lookup("parent_id").ObjectID() != destID || set.Lookup("path").StringValue() != "dest/a" {
+			t.Fatalf("$set = %v, want the folder under dest", set)
+		}
+		for _, evt := range updates {
+			if _, err := evt.Command.LookupErr("updates", "0", "u", "$set", "owner_id"); err == nil {
+				t.Fatalf("a move must not change ownership: %v", evt.Command)
+			}
+		}
+	})
+}
+
+func TestDownloadPublicFolderOnlyAcceptsWithinLimits(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("oversized", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "a", "a", nil, time.Now())),
+			cursor("test.folders"),
+			cursor("test.files", bson.D{{Key: "bytes", Value: int64(5000)}, {Key: "files", Value: int64(1)}}),
+		)
+
+		accepted := false
+		w := httptest.NewRecorder()
+		err := service.DownloadPublicFolder(context.Background(), w, id, 100, 0, func() error {
+			accepted = true
+			return nil
+		})
+		if err == nil || err.Error() != "download too large" {
+			t.Fatalf("err = %v, want download too large", err)
+		}
+		if accepted {
+			t.Fatal("an oversized download must not be counted")
+		}
+		if w.Body.Len() != 0 {
+			t.Fatal("nothing should be written for a refused download")
+		}
+	})
+}
+
+func TestDownloadFolderRefusesOversizeAndStreamsSmall(t *testing.T) {
+	withConfig(t, &config.Config{FolderDownloadMaxBytes: 100})
+	mt := newMockDB(t)
+
+	mt.Run("oversize", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "big", "big", nil, time.Now())),
+			cursor("test.folders"),
+			cursor("test.files", bson.D{{Key: "bytes", Value: int64(101)}, {Key: "files", Value: int64(2)}}),
+		)
+
+		w := httptest.NewRecorder()
+		err := service.DownloadFolder(context.Background(), w, id.Hex(), primitive.NewObjectID().Hex())
+		if err == nil || err.Error() != "download too large" {
+			t.Fatalf("err = %v, want download too large", err)
+		}
+		if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+			t.Fatal("nothing should be written for a refused download")
+		}
+	})
+
+	mt.Run("small", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "small", "small", nil, time.Now())),
+			cursor("test.folders"),
+			cursor("test.files", bson.D{{Key: "bytes", Value: int64(10)}, {Key: "files", Value: int64(1)}}),
+			cursor("test.files", fileDoc(primitive.NewObjectID(), primitive.NewObjectID(), "a.txt")),
+			cursor("test.folders"),
+		)
+
+		w := httptest.NewRecorder()
+		if err := service.DownloadFolder(context.Background(), w, id.Hex(), primitive.NewObjectID().Hex()); err != nil {
+			t.Fatal(err)
+		}
+		if w.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("Content-Type = %q, want application/zip", w.Header().Get("Content-Type"))
+		}
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(archive.File) != 1 || archive.File[0].Name != "a.txt" {
+			t.Fatalf("zip entries = %v, want a.txt", archive.File)
+		}
+	})
+}
+
+func TestResolveFolderPathsReportsEachEntry(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("resolve", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		ownerID, a, b := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.folders", bson.D{{Key: "_id", Value: a}}),
+			cursor("test.folders", bson.D{{Key: "_id", Value: b}}),
+			cursor("test.folders"), // a/missing
+		)
+
+		results, err := service.ResolveFolderPaths([]string{"a/b", "a", "", "a/missing"}, ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 4 {
+			t.Fatalf("results = %d, want one per path", len(results))
+		}
+		if r := results[0]; !r.Found || r.FolderID == nil || *r.FolderID != b {
+			t.Fatalf("a/b = %+v, want %s", r, b.Hex())
+		}
+		if r := results[1]; !r.Found || r.FolderID == nil || *r.FolderID != a {
+			t.Fatalf("a = %+v, want %s", r, a.Hex())
+		}
+		if r := results[2]; !r.Found || r.FolderID != nil {
+			t.Fatalf("root = %+v, want found with no ID", r)
+		}
+		if r := results[3]; r.Found || r.FolderID != nil || r.Error != "folder not found" {
+			t.Fatalf("a/missing = %+v, want not found", r)
+		}
+
+		// Prefixes already resolved are not looked up again, and nothing is created
+		if finds := commands(mt, "find"); len(finds) != 3 {
+			t.Fatalf("finds = %d, want 3", len(finds))
+		}
+		if len(commands(mt, "insert")) != 0 {
+			t.Fatal("resolving paths must not create folders")
+		}
+	})
+}
+
+func TestMergeFolderHandlesCollidingFileName(t *testing.T) {
+	mt := newMockDB(t)
+	for _, onConflict := range []string{MergeConflictRename, MergeConflictSkip, MergeConflictFail} {
+		mt.Run(onConflict, func(mt *mtest.T) {
+			service := NewFolderService(mt.DB, nil, nil)
+			ownerID, sourceID, destID, fileID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+			owned := bson.E{Key: "owner_id", Value: ownerID}
+			responses := []bson.D{
+				cursor("test.folders", append(folderDoc(sourceID, "src", "/src", nil, time.Now()), owned)),
+				cursor("test.folders", append(folderDoc(destID, "dest", "/dest", nil, time.Now()), owned)),
+				cursor("test.folders", bson.D{{Key: "_id", Value: destID}}), // dest is not under src
+				cursor("test.files", bson.D{{Key: "_id", Value: fileID}, {Key: "name", Value: "report.pdf"}}),
+				cursor("test.folders"),
+				cursor("test.files", bson.D{{Key: "n", Value: int32(1)}}), // dest already has report.pdf
+			}
+			switch onConflict {
+			case MergeConflictRename:
+				responses = append(responses, cursor("test.files"), writeResult(1), mtest.CreateSuccessResponse())
+			case MergeConflictSkip:
+				responses = append(responses, mtest.CreateSuccessResponse())
+			case MergeConflictFail:
+				responses = append(responses, mtest.CreateSuccessResponse()) // abortTransaction
+			}
+			mt.AddMockResponses(responses...)
+
+			result, err := service.MergeFolder(context.Background(), sourceID.Hex(), destID.Hex(), ownerID.Hex(), onConflict, false)
+			updates := commands(mt, "update")
+
+			switch onConflict {
+			case MergeConflictRename:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.FilesMoved != 1 || result.Renamed != 1 {
+					t.Fatalf("result = %+v, want one file moved under a new name", result)
+				}
+				if len(updates) != 1 {
+					t.Fatalf("updates = %d, want 1", len(updates))
+				}
+				set := updates[0].Command.Lookup("updates", "0", "u", "$set").Document()
+				if set.Lookup("name").StringValue() != "report (copy).pdf" || set.Lookup("folder_id").ObjectID() != destID ||
+					set.Lookup("relative_path").StringValue() != "/dest/report (copy).pdf" {
+					t.Fatalf("moved file = %v, want it renamed into dest", set)
+				}
+			case MergeConflictSkip:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.FilesMoved != 0 || len(result.Skipped) != 1 || result.Skipped[0] != "report.pdf" {
+					t.Fatalf("result = %+v, want report.pdf skipped", result)
+				}
+				if len(updates) != 0 {
+					t.Fatal("a skipped file must stay where it is")
+				}
+			case MergeConflictFail:
+				if err == nil || err.Error() != "file with name 'report.pdf' already exists" {
+					t.Fatalf("err = %v, want the name collision", err)
+				}
+				if len(updates) != 0 || len(commands(mt, "commitTransaction")) != 0 {
+					t.Fatal("a failed merge must not move anything")
+				}
+			}
+		})
+	}
+}
+
+func TestMeasureSubtreeStopsOnParentCycle(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("cycle", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		root, child := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.folders", bson.D{{Key: "_id", Value: child}}),
+			// A corrupted parent_id points the root back under its own child
+			cursor("test.folders", bson.D{{Key: "_id", Value: root}}),
+			cursor("test.files", bson.D{{Key: "bytes", Value: int64(7)}, {Key: "files", Value: int64(1)}}),
+		)
+
+		bytes, files, err := service.measureSubtree(context.Background(), root)
+		if err != nil {
+			t.Fatalf("measureSubtree: %v", err)
+		}
+		if bytes != 7 || files != 1 {
+			t.Fatalf("got %d bytes in %d files", bytes, files)
+		}
+		if finds := commands(mt, "find"); len(finds) != 2 {
+			t.Fatalf("walked %d levels, want 2", len(finds))
+		}
+	})
+}
+
+func TestGetAncestorsListsParentsRootFirst(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("chain", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		root, parent, id := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "c", "r/p/c", &parent, now)),
+			cursor("test.folders", folderDoc(parent, "p", "r/p", &root, now)),
+			cursor("test.folders", folderDoc(root, "r", "r", nil, now)),
+		)
+
+		ancestors, err := service.GetAncestors(id.Hex(), primitive.NewObjectID().Hex())
+		if err != nil {
+			t.Fatalf("GetAncestors: %v", err)
+		}
+		if len(ancestors) != 2 || ancestors[0].ID != root || ancestors[1].ID != parent {
+			t.Fatalf("ancestors = %+v, want root then parent", ancestors)
+		}
+	})
+}
+
+func TestGetAncestorsReportsCycle(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("cycle", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		parent, id := primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(id, "c", "p/c", &parent, now)),
+			// The parent points back at its own child
+			cursor("test.folders", folderDoc(parent, "p", "p", &id, now)),
+		)
+
+		_, err := service.GetAncestors(id.Hex(), primitive.NewObjectID().Hex())
+		if err == nil || !strings.HasPrefix(err.Error(), "folder hierarchy is broken: cycle") {
+			t.Fatalf("err = %v, want a cycle error", err)
+		}
+	})
+}
+
+func TestIsDescendantOfStopsOnParentCycle(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("cycle", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		a, b := primitive.NewObjectID(), primitive.NewObjectID()
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(a, "a", "b/a", &b, now)),
+			cursor("test.folders", folderDoc(b, "b", "a/b", &a, now)),
+		)
+
+		_, err := service.isDescendantOf(context.Background(), a, primitive.NewObjectID())
+		if err == nil || !strings.HasPrefix(err.Error(), "folder hierarchy is broken: cycle") {
+			t.Fatalf("err = %v, want a cycle error", err)
+		}
+		if finds := commands(mt, "find"); len(finds) != 2 {
+			t.Fatalf("walked %d levels, want 2", len(finds))
+		}
+	})
+}
+
+func TestVisibleSubfoldersOmitsFoldersUserCannotView(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("omitted", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, NewPermissionService(mt.DB), nil)
+		ownerID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+		parent, shared, private := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		owned := func(doc bson.D) bson.D { return append(doc, bson.E{Key: "owner_id", Value: ownerID}) }
+		now := time.Now()
+
+		mt.AddMockResponses(
+			cursor("test.folders",
+				owned(folderDoc(shared, "shared", "p/shared", &parent, now)),
+				owned(folderDoc(private, "private", "p/private", &parent, now))),
+			// FilterAccessible: ownership, then the user's direct grants in one batch
+			cursor("test.folders",
+				owned(bson.D{{Key: "_id", Value: shared}, {Key: "parent_id", Value: parent}}),
+				owned(bson.D{{Key: "_id", Value: private}, {Key: "parent_id", Value: parent}})),
+			cursor("test.permissions", bson.D{
+				{Key: "user_id", Value: userID.Hex()},
+				{Key: "resource_id", Value: shared.Hex()},
+				{Key: "resource_type", Value: "folder"},
+				{Key: "role", Value: "viewer"},
+				{Key: "is_active", Value: true},
+			}),
+			// Nothing is inherited from the parent either
+			cursor("test.folders", owned(folderDoc(parent, "p", "p", nil, now))),
+			cursor("test.permissions"),
+		)
+
+		folders, err := service.visibleSubfolders(context.Background(), parent, userID.Hex(), bson.D{{Key: "name", Value: 1}})
+		if err != nil {
+			t.Fatalf("visibleSubfolders: %v", err)
+		}
+		if len(folders) != 1 || folders[0].ID != shared {
+			t.Fatalf("got %d folders, want only the shared one", len(folders))
+		}
+		if finds := commands(mt, "find"); len(finds) != 5 {
+			t.Fatalf("got %d finds, want access resolved in one batch (5)", len(finds))
+		}
+	})
+}
+
+func TestGetFolderContentsFiltersByType(t *testing.T) {
+	byName := SortOption{Field: "name", Direction: SortAscending}
+	mt := newMockDB(t)
+
+	mt.Run("folders only", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		parent, child := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(parent, "p", "p", nil, time.Now())),
+			cursor("test.folders", folderDoc(child, "c", "p/c", &parent, time.Now())),
+			cursor("test.files", bson.D{{Key: "n", Value: int32(3)}}),
+		)
+
+		contents, err := service.GetFolderContents(parent.Hex(), primitive.NewObjectID().Hex(), byName, ContentTypeFolder, 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contents.Subfolders) != 1 || len(contents.Files) != 0 || contents.Counts.Files != 0 {
+			t.Fatalf("contents = %+v, want only the subfolder", contents)
+		}
+		for _, find := range commands(mt, "find") {
+			if find.Command.Lookup("find").StringValue() == "files" {
+				t.Fatal("files were listed for a folder-only filter")
+			}
+		}
+	})
+
+	mt.Run("images only", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		parent, photo := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor("test.folders", folderDoc(parent, "p", "p", nil, time.Now())),
+			cursor("test.files", bson.D{{Key: "n", Value: int32(1)}}),
+			cursor("test.files", append(fileDoc(photo, primitive.NewObjectID(), "photo.png"), bson.E{Key: "extension", Value: ".png"})),
+		)
+
+		contents, err := service.GetFolderContents(parent.Hex(), primitive.NewObjectID().Hex(), byName, ContentTypeImages, 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contents.Subfolders) != 0 || contents.Counts.Subfolders != 0 || len(contents.Files) != 1 || contents.Files[0].ID != photo {
+			t.Fatalf("contents = %+v, want only the image", contents)
+		}
+
+		finds := commands(mt, "find")
+		if len(finds) != 2 || finds[1].Command.Lookup("find").StringValue() != "files" {
+			t.Fatal("subfolders were listed for a file category filter")
+		}
+		extensions, err := finds[1].Command.Lookup("filter", "$or", "0", "extension", "$in").Array().Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range extensions {
+			if ext.StringValue() == ".pdf" {
+				t.Fatal("image filter matches documents")
+			}
+		}
+		if len(extensions) != len(imageExtensions) {
+			t.Fatalf("image filter has %d extensions, want %d", len(extensions), len(imageExtensions))
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"phynixdrive/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCachedFolderSizes bounds the folder size cache
+const maxCachedFolderSizes = 1000
+
+// folderSizes remembers recent subtree sizes so repeated size requests for a large folder do
+// not re-walk it every time. Sizes may lag uploads and deletes by FOLDER_SIZE_CACHE_TTL.
+var folderSizes = newTTLCache[primitive.ObjectID, int64](maxCachedFolderSizes, folderSizeCacheTTL)
+
+func folderSizeCacheTTL() time.Duration {
+	if config.AppConfig != nil {
+		return config.AppConfig.FolderSizeCacheTTL
+	}
+	return 30 * time.Second
+}
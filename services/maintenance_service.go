@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maintenanceSettingID = "maintenance"
+	// maintenanceCacheTTL bounds how long an instance keeps enforcing a stale flag after
+	// another instance toggles it
+	maintenanceCacheTTL = 5 * time.Second
+)
+
+// MaintenanceService stores the maintenance mode flag in the settings collection so that
+// toggling it on one instance applies to every instance sharing the database. Each instance
+// caches the flag briefly to keep it off the hot path of every write request.
+type MaintenanceService struct {
+	settingsCollection *mongo.Collection
+	cache              *ttlCache[string, bool]
+	lastKnown          atomic.Bool // served when the database cannot be read
+}
+
+// MaintenanceSetting is the stored flag along with who last changed it
+type MaintenanceSetting struct {
+	ID        string    `bson:"_id"`
+	Enabled   bool      `bson:"enabled"`
+	UpdatedBy string    `bson:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func NewMaintenanceService(db *mongo.Database) *MaintenanceService {
+	return &MaintenanceService{
+		settingsCollection: db.Collection("settings"),
+		cache:              newTTLCache[string, bool](1, func() time.Duration { return maintenanceCacheTTL }),
+	}
+}
+
+// IsEnabled reports whether maintenance mode is on. A database error is logged and the last
+// value read is used instead, so an unreachable database neither blocks nor unblocks writes.
+func (s *MaintenanceService) IsEnabled(ctx context.Context) bool {
+	if enabled, ok := s.cache.get(maintenanceSettingID); ok {
+		return enabled
+	}
+
+	var setting MaintenanceSetting
+	err := s.settingsCollection.FindOne(ctx, bson.M{"_id": maintenanceSettingID}).Decode(&setting)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Warning: failed to read maintenance mode, keeping %t: %v", s.lastKnown.Load(), err)
+		return s.lastKnown.Load()
+	}
+
+	s.remember(setting.Enabled)
+	return setting.Enabled
+}
+
+// SetEnabled stores the flag for every instance; this one applies it straight away
+func (s *MaintenanceService) SetEnabled(ctx context.Context, enabled bool, actorID string) error {
+	_, err := s.settingsCollection.UpdateOne(ctx,
+		bson.M{"_id": maintenanceSettingID},
+		bson.M{"$set": bson.M{"enabled": enabled, "updated_by": actorID, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store maintenance mode: %w", err)
+	}
+
+	s.remember(enabled)
+	return nil
+}
+
+func (s *MaintenanceService) remember(enabled bool) {
+	s.lastKnown.Store(enabled)
+	s.cache.set(maintenanceSettingID, enabled)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMaintenanceModeIsSharedThroughDatabase(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("toggle", func(mt *mtest.T) {
+		ctx := context.Background()
+		// Two instances sharing one database
+		first, second := NewMaintenanceService(mt.DB), NewMaintenanceService(mt.DB)
+
+		mt.AddMockResponses(writeResult(1))
+		if err := first.SetEnabled(ctx, true, "admin-1"); err != nil {
+			t.Fatal(err)
+		}
+		updates := commands(mt, "update")
+		if len(updates) != 1 || !updates[0].Command.Lookup("updates", "0", "upsert").Boolean() {
+			t.Fatal("the flag was not upserted into the settings collection")
+		}
+		if set := updates[0].Command.Lookup("updates", "0", "u", "$set").Document(); !set.Lookup("enabled").Boolean() ||
+			set.Lookup("updated_by").StringValue() != "admin-1" {
+			t.Fatalf("$set = %v", set)
+		}
+		if !first.IsEnabled(ctx) {
+			t.Fatal("the instance that toggled the flag must apply it straight away")
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(cursor("test.settings", bson.D{{Key: "_id", Value: "maintenance"}, {Key: "enabled", Value: true}}))
+		if !second.IsEnabled(ctx) {
+			t.Fatal("another instance did not see the flag")
+		}
+		if !second.IsEnabled(ctx) {
+			t.Fatal("cached flag lost")
+		}
+		if finds := commands(mt, "find"); len(finds) != 1 {
+			t.Fatalf("got %d reads, want the second check served from cache", len(finds))
+		}
+	})
+
+	mt.Run("unreadable", func(mt *mtest.T) {
+		service := NewMaintenanceService(mt.DB)
+		// Read as on before, with the cached copy since expired
+		service.lastKnown.Store(true)
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		if !service.IsEnabled(context.Background()) {
+			t.Fatal("an unreadable flag must fall back to the last known value")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockDB starts a mock deployment: no server is contacted, each command consumes the
+// next response queued with mt.AddMockResponses
+func newMockDB(t *testing.T) *mtest.T {
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+}
+
+// cursor is a single, exhausted batch as a find or aggregate would return it
+func cursor(ns string, docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...)
+}
+
+// writeResult acknowledges a write that matched n documents and modified them all
+func writeResult(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// commands returns the started command events with the given name, in order
+func commands(mt *mtest.T, name string) []*event.CommandStartedEvent {
+	var matched []*event.CommandStartedEvent
+	for _, evt := range mt.GetAllStartedEvents() {
+		if evt.CommandName == name {
+			matched = append(matched, evt)
+		}
+	}
+	return matched
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"phynixdrive/config"
 	"phynixdrive/models"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type NotificationService struct {
@@ -33,27 +35,125 @@ func NewNotificationService(db *mongo.Database, mailgunAPIKey, mailgunDomain, fr
 	}
 }
 
+// NewNotificationServiceFromConfig builds the service from the loaded config. It returns nil
+// when notifications are disabled, which callers treat as "don't notify". Without a mail
+// provider configured, notifications are still recorded in-app but no email is sent.
+func NewNotificationServiceFromConfig(db *mongo.Database) *NotificationService {
+	cfg := config.AppConfig
+	if cfg == nil || !cfg.NotificationsEnabled {
+		return nil
+	}
+	return NewNotificationService(db, cfg.MailgunAPIKey, cfg.MailgunDomain, cfg.FromEmail)
+}
+
 // --- Public API ---
 
-func (s *NotificationService) SendFileSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, fileName string) error {
+func (s *NotificationService) SendFileSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, fileID, fileName string) error {
 	subject := fmt.Sprintf("File shared with you: %s", fileName)
 	text := fmt.Sprintf("A file has been shared with you: %s", fileName)
 	html := fmt.Sprintf("<h2>File Shared With You</h2><p>A file has been shared with you: <b>%s</b></p>", fileName)
 
-	return s.sendSharedNotification(ctx, sharedWithUserID, sharedByUserID, subject, text, html, "file_shared")
+	return s.sendSharedNotification(ctx, sharedWithUserID, sharedByUserID, fileID, "file", subject, text, html, "file_shared")
 }
 
-func (s *NotificationService) SendFolderSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, folderName string) error {
+func (s *NotificationService) SendFolderSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, folderID, folderName string) error {
 	subject := fmt.Sprintf("Folder shared with you: %s", folderName)
 	text := fmt.Sprintf("A folder has been shared with you: %s", folderName)
 	html := fmt.Sprintf("<h2>Folder Shared With You</h2><p>A folder has been shared with you: <b>%s</b></p>", folderName)
 
-	return s.sendSharedNotification(ctx, sharedWithUserID, sharedByUserID, subject, text, html, "folder_shared")
+	return s.sendSharedNotification(ctx, sharedWithUserID, sharedByUserID, folderID, "folder", subject, text, html, "folder_shared")
+}
+
+// ListNotifications returns one page of the user's notifications, newest first, and the total
+func (s *NotificationService) ListNotifications(ctx context.Context, userID string, limit, offset int) ([]models.NotificationLog, int64, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	filter := bson.M{"user_id": userObjID}
+	total, err := s.notificationCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	cursor, err := s.notificationCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.NotificationLog{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode notifications: %w", err)
+	}
+	return notifications, total, nil
+}
+
+// UnreadCount counts the user's unread notifications
+func (s *NotificationService) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	count, err := s.notificationCollection.CountDocuments(ctx, bson.M{"user_id": userObjID, "is_read": false})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications as read. Marking an already read
+// notification is not an error.
+func (s *NotificationService) MarkRead(ctx context.Context, userID, notificationID string) error {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	notificationObjID, err := primitive.ObjectIDFromHex(notificationID)
+	if err != nil {
+		return fmt.Errorf("invalid notification ID: %w", err)
+	}
+
+	result, err := s.notificationCollection.UpdateOne(ctx,
+		bson.M{"_id": notificationObjID, "user_id": userObjID},
+		bson.M{"$set": bson.M{"is_read": true}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications as read and reports how many changed
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID string) (int64, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := s.notificationCollection.UpdateMany(ctx,
+		bson.M{"user_id": userObjID, "is_read": false},
+		bson.M{"$set": bson.M{"is_read": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update notifications: %w", err)
+	}
+	return result.ModifiedCount, nil
 }
 
 // --- Private Helpers ---
 
-func (s *NotificationService) sendSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, subject, text, html, notifType string) error {
+// sendSharedNotification records the in-app notification first so it exists even when the
+// email can't be sent, then emails the recipient if a mail provider is configured
+func (s *NotificationService) sendSharedNotification(ctx context.Context, sharedWithUserID, sharedByUserID, itemID, itemType, subject, text, html, notifType string) error {
 	var sharedWithUser, sharedByUser models.User
 
 	// Parse ObjectIDs
@@ -65,39 +165,50 @@ func (s *NotificationService) sendSharedNotification(ctx context.Context, shared
 	if err != nil {
 		return fmt.Errorf("invalid sharedBy user ID: %w", err)
 	}
+	itemObjID, err := primitive.ObjectIDFromHex(itemID)
+	if err != nil {
+		return fmt.Errorf("invalid item ID: %w", err)
+	}
 
 	// Lookup users
-	if err := s.userCollection.FindOne(ctx, bson.M{"_id": sharedWithObjID}).Decode(&sharedWithUser); err != nil {
+	if sharedWithUser, err = lookupUser(ctx, s.userCollection, sharedWithObjID); err != nil {
 		return fmt.Errorf("sharedWith user not found: %w", err)
 	}
-	if err := s.userCollection.FindOne(ctx, bson.M{"_id": sharedByObjID}).Decode(&sharedByUser); err != nil {
+	if sharedByUser, err = lookupUser(ctx, s.userCollection, sharedByObjID); err != nil {
 		return fmt.Errorf("sharedBy user not found: %w", err)
 	}
 
-	// Personalize message
-	textBody := fmt.Sprintf("Hi %s,\n\n%s has shared something with you: %s\n\nBest,\nPhynixDrive Team",
-		sharedWithUser.Name, sharedByUser.Name, text)
-	htmlBody := fmt.Sprintf("<p>Hi %s,</p><p><strong>%s</strong> has shared something with you.</p>%s<p>Best regards,<br>PhynixDrive Team</p>",
-		sharedWithUser.Name, sharedByUser.Name, html)
-
-	// Send email
-	if err := s.sendEmail(ctx, sharedWithUser.Email, subject, textBody, htmlBody); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
-	}
-
 	// Log notification
 	notification := models.NotificationLog{
 		ID:        primitive.NewObjectID(),
 		UserID:    sharedWithObjID,
 		Type:      notifType,
-		Message:   textBody,
+		Title:     subject,
+		Message:   fmt.Sprintf("%s shared a %s with you", sharedByUser.Name, itemType),
+		ItemID:    itemObjID,
+		ItemType:  itemType,
+		IsRead:    false,
 		CreatedAt: time.Now(),
 	}
-
 	if _, err := s.notificationCollection.InsertOne(ctx, notification); err != nil {
 		return fmt.Errorf("failed to log notification: %w", err)
 	}
 
+	if s.mailgunAPIKey == "" || s.mailgunDomain == "" {
+		return nil
+	}
+
+	// Personalize message
+	textBody := fmt.Sprintf("Hi %s,\n\n%s has shared something with you: %s\n\nBest,\nPhynixDrive Team",
+		sharedWithUser.Name, sharedByUser.Name, text)
+	htmlBody := fmt.Sprintf("<p>Hi %s,</p><p><strong>%s</strong> has shared something with you.</p>%s<p>Best regards,<br>PhynixDrive Team</p>",
+		sharedWithUser.Name, sharedByUser.Name, html)
+
+	// Send email
+	if err := s.sendEmail(ctx, sharedWithUser.Email, subject, textBody, htmlBody); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
 	return nil
 }
 
@@ -3,12 +3,16 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
+	"phynixdrive/config"
 	"phynixdrive/models"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PermissionService struct {
@@ -37,11 +41,15 @@ func (s *PermissionService) HasResourcePermission(ctx context.Context, userID, r
 		return ok, nil
 	}
 
-	if err.Error() == "file not found" {
-		return s.HasFolderPermission(ctx, userID, resourceID, requiredRole)
+	if err.Error() != "file not found" {
+		return false, err
 	}
 
-	return s.HasFolderPermission(ctx, userID, resourceID, requiredRole)
+	ok, err = s.HasFolderPermission(ctx, userID, resourceID, requiredRole)
+	if err != nil && err.Error() == "folder not found" {
+		return false, fmt.Errorf("resource not found")
+	}
+	return ok, err
 }
 
 // HasFilePermission checks permission on a file (owner, inherited from folder, direct)
@@ -119,7 +127,7 @@ func (s *PermissionService) HasFolderPermission(ctx context.Context, userID, fol
 }
 
 // ShareFolder grants a permission for a folder to a user (create or update permission doc)
-func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWithUserID, role, sharedByUserID string) error {
+func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWithUserID, role, sharedByUserID string, expiresAt *time.Time) error {
 	// Validate role
 	if !isValidRole(role) {
 		return fmt.Errorf("invalid role: %s", role)
@@ -130,8 +138,7 @@ func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWit
 	if err != nil {
 		return fmt.Errorf("invalid user id: %w", err)
 	}
-	var u models.User
-	if err := s.userCollection.FindOne(ctx, bson.M{"_id": sharedWithObjID}).Decode(&u); err != nil {
+	if _, err := lookupUser(ctx, s.userCollection, sharedWithObjID); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return fmt.Errorf("user not found")
 		}
@@ -171,6 +178,7 @@ func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWit
 			GrantedBy:    sharedByUserID,
 			GrantedAt:    now,
 			IsActive:     true,
+			ExpiresAt:    expiresAt,
 		}
 		if _, insErr := s.permissionCollection.InsertOne(ctx, perm); insErr != nil {
 			return fmt.Errorf("failed to create permission: %w", insErr)
@@ -187,6 +195,7 @@ func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWit
 			"granted_by": sharedByUserID,
 			"granted_at": now,
 			"is_active":  true,
+			"expires_at": expiresAt,
 			"updated_at": now,
 			"updated_by": sharedByUserID,
 		},
@@ -198,8 +207,46 @@ func (s *PermissionService) ShareFolder(ctx context.Context, folderID, sharedWit
 	return nil
 }
 
+// GrantFolderPermissions upserts the same grant on many folders in one bulk write. It is meant
+// for inherited shares, where the caller's admin role was already checked on the shared ancestor.
+func (s *PermissionService) GrantFolderPermissions(ctx context.Context, folderIDs []string, sharedWithUserID, role, sharedByUserID string, expiresAt *time.Time) error {
+	if !isValidRole(role) {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+	if len(folderIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(folderIDs))
+	for _, folderID := range folderIDs {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"user_id":       sharedWithUserID,
+				"resource_id":   folderID,
+				"resource_type": "folder",
+			}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"role":       role,
+					"granted_by": sharedByUserID,
+					"granted_at": now,
+					"is_active":  true,
+					"expires_at": expiresAt,
+				},
+				"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+			}).
+			SetUpsert(true))
+	}
+
+	if _, err := s.permissionCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to grant permissions: %w", err)
+	}
+	return nil
+}
+
 // ShareFile grants permission for a file to a user (create or update permission doc)
-func (s *PermissionService) ShareFile(ctx context.Context, fileID, sharedWithUserID, role, sharedByUserID string) error {
+func (s *PermissionService) ShareFile(ctx context.Context, fileID, sharedWithUserID, role, sharedByUserID string, expiresAt *time.Time) error {
 	// Validate role
 	if !isValidRole(role) {
 		return fmt.Errorf("invalid role: %s", role)
@@ -210,8 +257,7 @@ func (s *PermissionService) ShareFile(ctx context.Context, fileID, sharedWithUse
 	if err != nil {
 		return fmt.Errorf("invalid user id: %w", err)
 	}
-	var u models.User
-	if err := s.userCollection.FindOne(ctx, bson.M{"_id": sharedWithObjID}).Decode(&u); err != nil {
+	if _, err := lookupUser(ctx, s.userCollection, sharedWithObjID); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return fmt.Errorf("user not found")
 		}
@@ -251,6 +297,7 @@ func (s *PermissionService) ShareFile(ctx context.Context, fileID, sharedWithUse
 			GrantedBy:    sharedByUserID,
 			GrantedAt:    now,
 			IsActive:     true,
+			ExpiresAt:    expiresAt,
 		}
 		if _, insErr := s.permissionCollection.InsertOne(ctx, perm); insErr != nil {
 			return fmt.Errorf("failed to create permission: %w", insErr)
@@ -267,6 +314,7 @@ func (s *PermissionService) ShareFile(ctx context.Context, fileID, sharedWithUse
 			"granted_by": sharedByUserID,
 			"granted_at": now,
 			"is_active":  true,
+			"expires_at": expiresAt,
 			"updated_at": now,
 			"updated_by": sharedByUserID,
 		},
@@ -332,6 +380,30 @@ func (s *PermissionService) RevokeFolderPermission(ctx context.Context, folderID
 	return nil
 }
 
+// RelinquishPermission deactivates a user's own grant on a resource. Unlike the Revoke
+// methods it needs no admin role, since users may always give up their own access.
+func (s *PermissionService) RelinquishPermission(ctx context.Context, userID, resourceType, resourceID string) error {
+	now := time.Now()
+	_, err := s.permissionCollection.UpdateMany(ctx, bson.M{
+		"user_id":       userID,
+		"resource_id":   resourceID,
+		"resource_type": resourceType,
+		"is_active":     true,
+	}, bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"revoked_at": now,
+			"revoked_by": userID,
+			"updated_at": now,
+			"updated_by": userID,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to relinquish permission: %w", err)
+	}
+	return nil
+}
+
 // RevokeFilePermission revokes a user's permission on a file (only admin can revoke)
 func (s *PermissionService) RevokeFilePermission(ctx context.Context, fileID, targetUserID, revokedByUserID string) error {
 	// Validate revokedBy has admin on the file (or parent folder)
@@ -490,8 +562,423 @@ func (s *PermissionService) UpdateFilePermission(ctx context.Context, fileID, ta
 	return nil
 }
 
+// FilterAccessible returns the subset of resourceIDs the user holds at least requiredRole on.
+// Ownership and direct grants are resolved in one query each; inherited access is checked once
+// per distinct parent folder rather than once per resource.
+func (s *PermissionService) FilterAccessible(ctx context.Context, userID, resourceType string, resourceIDs []primitive.ObjectID, requiredRole string) (map[primitive.ObjectID]bool, error) {
+	accessible := make(map[primitive.ObjectID]bool, len(resourceIDs))
+	if len(resourceIDs) == 0 {
+		return accessible, nil
+	}
+
+	collection := s.folderCollection
+	parentField := "parent_id"
+	if resourceType == "file" {
+		collection = s.fileCollection
+		parentField = "folder_id"
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"_id":        bson.M{"$in": resourceIDs},
+		"deleted_at": nil,
+	}, options.Find().SetProjection(bson.M{"owner_id": 1, parentField: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching resources: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID       primitive.ObjectID  `bson:"_id"`
+		OwnerID  primitive.ObjectID  `bson:"owner_id"`
+		ParentID *primitive.ObjectID `bson:"parent_id,omitempty"`
+		FolderID *primitive.ObjectID `bson:"folder_id,omitempty"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding resources: %w", err)
+	}
+
+	var pending []primitive.ObjectID
+	parents := make(map[primitive.ObjectID]*primitive.ObjectID, len(docs))
+	for _, doc := range docs {
+		if doc.OwnerID.Hex() == userID {
+			accessible[doc.ID] = true
+			continue
+		}
+		parent := doc.ParentID
+		if resourceType == "file" {
+			parent = doc.FolderID
+		}
+		parents[doc.ID] = parent
+		pending = append(pending, doc.ID)
+	}
+	if len(pending) == 0 {
+		return accessible, nil
+	}
+
+	// Direct grants for everything not owned, in a single query
+	hexIDs := make([]string, len(pending))
+	for i, id := range pending {
+		hexIDs[i] = id.Hex()
+	}
+	permCursor, err := s.permissionCollection.Find(ctx, bson.M{
+		"user_id":       userID,
+		"resource_id":   bson.M{"$in": hexIDs},
+		"resource_type": resourceType,
+		"is_active":     true,
+		"$or":           unexpiredGrant(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+	defer permCursor.Close(ctx)
+
+	var permissions []models.Permission
+	if err := permCursor.All(ctx, &permissions); err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+	direct := make(map[string]bool, len(permissions))
+	for _, perm := range permissions {
+		if hasRequiredRole(perm.Role, requiredRole) {
+			direct[perm.ResourceID] = true
+		}
+	}
+
+	// Inherited access, resolved once per distinct parent folder
+	parentAccess := make(map[primitive.ObjectID]bool)
+	for _, id := range pending {
+		parent := parents[id]
+
+		// Files inside a folder follow the folder, matching HasFilePermission
+		if resourceType != "file" || parent == nil {
+			if direct[id.Hex()] {
+				accessible[id] = true
+				continue
+			}
+		}
+		if parent == nil {
+			continue
+		}
+
+		allowed, checked := parentAccess[*parent]
+		if !checked {
+			allowed, err = s.HasFolderPermission(ctx, userID, parent.Hex(), requiredRole)
+			if err != nil && err.Error() != "folder not found" {
+				return nil, err
+			}
+			parentAccess[*parent] = allowed
+		}
+		if allowed {
+			accessible[id] = true
+		}
+	}
+
+	return accessible, nil
+}
+
+// EffectiveRole returns the strongest role the user holds on a resource: "owner", a granted
+// role (direct or inherited from a parent folder), or "" when the user has no access at all
+func (s *PermissionService) EffectiveRole(ctx context.Context, userID, resourceType, resourceID string) (string, error) {
+	objID, err := primitive.ObjectIDFromHex(resourceID)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s ID: %w", resourceType, err)
+	}
+
+	if resourceType == "file" {
+		var file models.File
+		err = s.fileCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&file)
+		if err == mongo.ErrNoDocuments {
+			return "", fmt.Errorf("file not found")
+		} else if err != nil {
+			return "", fmt.Errorf("error fetching file: %w", err)
+		}
+		if file.OwnerID.Hex() == userID {
+			return "owner", nil
+		}
+		if file.FolderID != nil {
+			return s.EffectiveRole(ctx, userID, "folder", file.FolderID.Hex())
+		}
+		return s.directRole(ctx, userID, resourceID, "file")
+	}
+
+	var folder models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return "", fmt.Errorf("folder not found")
+	} else if err != nil {
+		return "", fmt.Errorf("error fetching folder: %w", err)
+	}
+	if folder.OwnerID.Hex() == userID {
+		return "owner", nil
+	}
+
+	role, err := s.directRole(ctx, userID, resourceID, "folder")
+	if err != nil {
+		return "", err
+	}
+	if folder.ParentID != nil {
+		inherited, err := s.EffectiveRole(ctx, userID, "folder", folder.ParentID.Hex())
+		if err != nil && err.Error() != "folder not found" {
+			return "", err
+		}
+		if role == "" || hasRequiredRole(inherited, role) {
+			role = inherited
+		}
+	}
+
+	return role, nil
+}
+
+// CheckAccess enforces requiredRole on a resource. Callers with no access at all get the
+// same "<type> not found" error as for a missing resource, so private resources are not
+// revealed; "insufficient permissions" is reserved for callers who can at least see it.
+// Set HIDE_INACCESSIBLE_RESOURCES=false to always report insufficient permissions.
+func (s *PermissionService) CheckAccess(ctx context.Context, userID, resourceType, resourceID, requiredRole string) error {
+	role, err := s.EffectiveRole(ctx, userID, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+
+	if hasRequiredRole(role, requiredRole) {
+		return nil
+	}
+
+	if role == "" && (config.AppConfig == nil || config.AppConfig.HideInaccessibleResources) {
+		return fmt.Errorf("%s not found", resourceType)
+	}
+	return fmt.Errorf("insufficient permissions")
+}
+
+// DeactivateExpiredGrants marks expired permissions and their share records inactive.
+// Access checks already ignore expired grants; this keeps listings and history accurate.
+func (s *PermissionService) DeactivateExpiredGrants(ctx context.Context) (int64, error) {
+	now := time.Now()
+	filter := bson.M{
+		"is_active":  true,
+		"expires_at": bson.M{"$ne": nil, "$lte": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"is_active":  false,
+		"revoked_at": now,
+		"updated_at": now,
+	}}
+
+	result, err := s.permissionCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire permissions: %w", err)
+	}
+	if _, err := s.permissionCollection.Database().Collection("shares").UpdateMany(ctx, filter, update); err != nil {
+		return result.ModifiedCount, fmt.Errorf("failed to expire shares: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// SetGrantExpiry sets, or clears when expiresAt is nil, the expiry of a user's active grant on a resource
+func (s *PermissionService) SetGrantExpiry(ctx context.Context, userID, resourceID, resourceType string, expiresAt *time.Time) error {
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	if expiresAt != nil {
+		update["$set"].(bson.M)["expires_at"] = *expiresAt
+	} else {
+		update["$unset"] = bson.M{"expires_at": ""}
+	}
+
+	_, err := s.permissionCollection.UpdateOne(ctx, bson.M{
+		"user_id":       userID,
+		"resource_id":   resourceID,
+		"resource_type": resourceType,
+		"is_active":     true,
+	}, update)
+	return err
+}
+
+// SuspendResourcePermissions deactivates the grants and shares on resources moved to trash.
+// They are marked suspended so a restore brings back exactly these and not revoked ones.
+func (s *PermissionService) SuspendResourcePermissions(ctx context.Context, resourceIDs []string) error {
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	filter := bson.M{"resource_id": bson.M{"$in": resourceIDs}, "is_active": true}
+	update := bson.M{"$set": bson.M{"is_active": false, "suspended_at": now}}
+
+	if _, err := s.permissionCollection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to suspend permissions: %w", err)
+	}
+	if _, err := s.permissionCollection.Database().Collection("shares").UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to suspend shares: %w", err)
+	}
+	return nil
+}
+
+// ResumeResourcePermissions reactivates grants and shares suspended when the resources were trashed
+func (s *PermissionService) ResumeResourcePermissions(ctx context.Context, resourceIDs []string) error {
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"resource_id": bson.M{"$in": resourceIDs}, "suspended_at": bson.M{"$ne": nil}}
+	update := bson.M{
+		"$set":   bson.M{"is_active": true},
+		"$unset": bson.M{"suspended_at": ""},
+	}
+
+	if _, err := s.permissionCollection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to resume permissions: %w", err)
+	}
+	if _, err := s.permissionCollection.Database().Collection("shares").UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to resume shares: %w", err)
+	}
+	return nil
+}
+
+// DeleteResourcePermissions removes every grant and share on purged resources
+func (s *PermissionService) DeleteResourcePermissions(ctx context.Context, resourceIDs []string) error {
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"resource_id": bson.M{"$in": resourceIDs}}
+	if _, err := s.permissionCollection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete permissions: %w", err)
+	}
+	if _, err := s.permissionCollection.Database().Collection("shares").DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete shares: %w", err)
+	}
+	return nil
+}
+
+// resourceIDs returns the hex IDs of the documents in collection matching filter
+func resourceIDs(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]string, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID.Hex())
+	}
+	return ids, cursor.Err()
+}
+
+// subtreeResourceIDs returns the IDs of folder, the folders under it and the files in any of
+// them, limited to documents that also match state (e.g. live or trashed)
+func subtreeResourceIDs(ctx context.Context, folderCollection, fileCollection *mongo.Collection, folder *models.Folder, state bson.M) ([]string, error) {
+	folderFilter := bson.M{
+		"owner_id": folder.OwnerID,
+		"path":     bson.M{"$regex": "^" + regexp.QuoteMeta(folder.Path) + "/"},
+	}
+	for k, v := range state {
+		folderFilter[k] = v
+	}
+	folderIDs, err := resourceIDs(ctx, folderCollection, folderFilter)
+	if err != nil {
+		return nil, err
+	}
+	folderIDs = append(folderIDs, folder.ID.Hex())
+
+	folderObjIDs := make([]primitive.ObjectID, 0, len(folderIDs))
+	for _, id := range folderIDs {
+		objID, _ := primitive.ObjectIDFromHex(id)
+		folderObjIDs = append(folderObjIDs, objID)
+	}
+	fileFilter := bson.M{"folder_id": bson.M{"$in": folderObjIDs}}
+	for k, v := range state {
+		fileFilter[k] = v
+	}
+	fileIDs, err := resourceIDs(ctx, fileCollection, fileFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(folderIDs, fileIDs...), nil
+}
+
+// StartGrantExpiryJob periodically deactivates expired grants
+func StartGrantExpiryJob(permissionService *PermissionService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			count, err := permissionService.DeactivateExpiredGrants(context.Background())
+			if err != nil {
+				log.Printf("Grant expiry job failed: %v", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("Grant expiry job deactivated %d permissions", count)
+			}
+		}
+	}()
+}
+
 // -- Internal helpers --
 
+// unexpiredGrant is the $or clause matching grants with no expiry or one still in the future
+func unexpiredGrant() bson.A {
+	return bson.A{
+		bson.M{"expires_at": nil},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}
+}
+
+// directRoles is directRole for many resources in one query, keyed by resource ID
+func (s *PermissionService) directRoles(ctx context.Context, userID, resourceType string, resourceIDs []string) (map[string]string, error) {
+	roles := make(map[string]string, len(resourceIDs))
+	if len(resourceIDs) == 0 {
+		return roles, nil
+	}
+
+	cursor, err := s.permissionCollection.Find(ctx, bson.M{
+		"user_id":       userID,
+		"resource_id":   bson.M{"$in": resourceIDs},
+		"resource_type": resourceType,
+		"is_active":     true,
+		"$or":           unexpiredGrant(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var permissions []models.Permission
+	if err := cursor.All(ctx, &permissions); err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+	for _, perm := range permissions {
+		if roleRank(perm.Role) > roleRank(roles[perm.ResourceID]) {
+			roles[perm.ResourceID] = perm.Role
+		}
+	}
+	return roles, nil
+}
+
+func (s *PermissionService) directRole(ctx context.Context, userID, resourceID, resourceType string) (string, error) {
+	var permission models.Permission
+	err := s.permissionCollection.FindOne(ctx, bson.M{
+		"user_id":       userID,
+		"resource_id":   resourceID,
+		"resource_type": resourceType,
+		"is_active":     true,
+		"$or":           unexpiredGrant(),
+	}).Decode(&permission)
+
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("permission check failed: %w", err)
+	}
+
+	return permission.Role, nil
+}
+
 func (s *PermissionService) checkDirectPermission(ctx context.Context, userID, resourceID, resourceType, requiredRole string) (bool, error) {
 	var permission models.Permission
 	err := s.permissionCollection.FindOne(ctx, bson.M{
@@ -499,6 +986,7 @@ func (s *PermissionService) checkDirectPermission(ctx context.Context, userID, r
 		"resource_id":   resourceID,
 		"resource_type": resourceType,
 		"is_active":     true,
+		"$or":           unexpiredGrant(),
 	}).Decode(&permission)
 
 	if err == mongo.ErrNoDocuments {
@@ -510,12 +998,19 @@ func (s *PermissionService) checkDirectPermission(ctx context.Context, userID, r
 	return hasRequiredRole(permission.Role, requiredRole), nil
 }
 
+var roleHierarchy = map[string]int{
+	"viewer": 1,
+	"editor": 2,
+	"admin":  3,
+	"owner":  4,
+}
+
+// roleRank orders roles from least to most privileged; unknown roles rank 0
+func roleRank(role string) int {
+	return roleHierarchy[role]
+}
+
 func hasRequiredRole(userRole, requiredRole string) bool {
-	roleHierarchy := map[string]int{
-		"viewer": 1,
-		"editor": 2,
-		"admin":  3,
-	}
 	ur, ok1 := roleHierarchy[userRole]
 	rr, ok2 := roleHierarchy[requiredRole]
 	return ok1 && ok2 && ur >= rr
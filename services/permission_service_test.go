@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"phynixdrive/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCheckAccessHidesPrivateFilesFromStrangers(t *testing.T) {
+	tests := []struct {
+		name    string
+		hide    bool
+		grant   string
+		wantErr string
+	}{
+		{"stranger", true, "", "file not found"},
+		{"viewer asking for admin", true, "viewer", "insufficient permissions"},
+		{"stranger with hiding off", false, "", "insufficient permissions"},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			withConfig(t, &config.Config{HideInaccessibleResources: tt.hide})
+			service := NewPermissionService(mt.DB)
+			fileID, callerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+			var grants []bson.D
+			if tt.grant != "" {
+				grants = append(grants, bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "user_id", Value: callerID.Hex()},
+					{Key: "role", Value: tt.grant},
+				})
+			}
+			mt.AddMockResponses(
+				cursor("test.files", fileDoc(fileID, primitive.NewObjectID(), "private.txt")),
+				cursor("test.permissions", grants...),
+			)
+
+			err := service.CheckAccess(context.Background(), callerID.Hex(), "file", fileID.Hex(), "admin")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpiredGrantDoesNotAuthorizeBeforeCleanup(t *testing.T) {
+	mt := newMockDB(t)
+	for _, resourceType := range []string{"file", "folder"} {
+		mt.Run(resourceType, func(mt *mtest.T) {
+			service := NewPermissionService(mt.DB)
+			resourceID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+			owner := primitive.NewObjectID()
+
+			// The user's grant is still flagged active but has expired, so the expiry bound in
+			// the lookup filters it out and no grant comes back
+			var err error
+			var allowed bool
+			if resourceType == "file" {
+				mt.AddMockResponses(cursor("test.files", fileDoc(resourceID, owner, "a.txt")), cursor("test.permissions"))
+				allowed, err = service.HasFilePermission(context.Background(), userID.Hex(), resourceID.Hex(), "viewer")
+			} else {
+				folder := append(folderDoc(resourceID, "f", "f", nil, time.Now()), bson.E{Key: "owner_id", Value: owner})
+				mt.AddMockResponses(cursor("test.folders", folder), cursor("test.permissions"))
+				allowed, err = service.HasFolderPermission(context.Background(), userID.Hex(), resourceID.Hex(), "viewer")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed {
+				t.Fatal("expired grant authorized access")
+			}
+
+			finds := commands(mt, "find")
+			filter := finds[len(finds)-1].Command.Lookup("filter").Document()
+			if !filter.Lookup("is_active").Boolean() {
+				t.Fatal("grant lookup does not require an active grant")
+			}
+			clauses, err := filter.Lookup("$or").Array().Values()
+			if err != nil || len(clauses) != 2 {
+				t.Fatalf("grant lookup has no expiry bound: %v", filter)
+			}
+			if clauses[0].Document().Lookup("expires_at").Type != bson.TypeNull {
+				t.Fatalf("first clause = %v, want grants without expiry", clauses[0])
+			}
+			bound := clauses[1].Document().Lookup("expires_at", "$gt").Time()
+			if time.Since(bound) < 0 || time.Since(bound) > time.Minute {
+				t.Fatalf("expiry bound = %v, want now", bound)
+			}
+			if len(commands(mt, "update")) != 0 {
+				t.Fatal("the access check must not depend on the cleanup job")
+			}
+		})
+	}
+}
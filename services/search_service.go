@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"phynixdrive/models"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,12 +17,31 @@ type SearchService struct {
 	fileCollection       *mongo.Collection
 	folderCollection     *mongo.Collection
 	permissionCollection *mongo.Collection
+	userCollection       *mongo.Collection
 	permissionService    *PermissionService
 }
 
+// Search result access values
+const (
+	AccessOwned  = "owned"
+	AccessShared = "shared"
+)
+
+// SearchFile is a file search hit, annotated with whether the user owns it or it was shared
+type SearchFile struct {
+	models.File `bson:",inline"`
+	Access      string `bson:"-" json:"access"`
+}
+
+// SearchFolder is a folder search hit, annotated like SearchFile
+type SearchFolder struct {
+	models.Folder `bson:",inline"`
+	Access        string `bson:"-" json:"access"`
+}
+
 type SearchResult struct {
-	Files   []models.File   `json:"files"`
-	Folders []models.Folder `json:"folders"`
+	Files   []SearchFile   `json:"files"`
+	Folders []SearchFolder `json:"folders"`
 }
 
 type SharedItem struct {
@@ -37,14 +57,15 @@ func NewSearchService(db *mongo.Database, permissionService *PermissionService)
 		fileCollection:       db.Collection("files"),
 		folderCollection:     db.Collection("folders"),
 		permissionCollection: db.Collection("permissions"),
+		userCollection:       db.Collection("users"),
 		permissionService:    permissionService,
 	}
 }
 
 // Search - Fixed method signature to match controller call
-func (s *SearchService) Search(userID string, query string, limit int, offset int) (*SearchResult, error) {
+func (s *SearchService) Search(userID string, query string, limit int, offset int, includeDescription bool, sortOpt SortOption) (*SearchResult, error) {
 	if query == "" {
-		return &SearchResult{Files: []models.File{}, Folders: []models.Folder{}}, nil
+		return &SearchResult{Files: []SearchFile{}, Folders: []SearchFolder{}}, nil
 	}
 
 	ctx := context.Background()
@@ -53,41 +74,48 @@ func (s *SearchService) Search(userID string, query string, limit int, offset in
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
+	sharedFileIDs, sharedFolderIDs, err := s.sharedResourceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create regex search filter (fallback if text index doesn't exist)
-	searchRegex := bson.M{"$regex": query, "$options": "i"}
+	searchRegex := containsPattern(query)
 
 	// Search files
 	fileFilter := bson.M{
 		"$and": []bson.M{
 			{
-				"$or": []bson.M{
-					{"name": searchRegex},
-					{"original_name": searchRegex},
-				},
+				"$or": nameMatch(searchRegex, includeDescription, "name", "original_name"),
 			},
 			{"deleted_at": nil},
-			{"owner_id": userObjID}, // For now, only search user's own files
+			fileAccessFilter(userObjID, sharedFileIDs, sharedFolderIDs),
 		},
 	}
 
-	findOptions := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	findOptions := options.Find().
+		SetSort(resolveSortOption(ctx, s.userCollection, userID, sortOpt).sortDocument()).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetProjection(listViewProjection)
 	fileCursor, err := s.fileCollection.Find(ctx, fileFilter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search files: %w", err)
 	}
 	defer fileCursor.Close(ctx)
 
-	var files []models.File
+	files := []SearchFile{}
 	if err = fileCursor.All(ctx, &files); err != nil {
 		return nil, fmt.Errorf("failed to decode files: %w", err)
 	}
+	annotateFiles(files, userObjID)
 
 	// Search folders
 	folderFilter := bson.M{
 		"$and": []bson.M{
-			{"name": searchRegex},
+			{"$or": nameMatch(searchRegex, includeDescription, "name")},
 			{"is_deleted": false},
-			{"owner_id": userObjID}, // For now, only search user's own folders
+			folderAccessFilter(userObjID, sharedFolderIDs),
 		},
 	}
 
@@ -97,10 +125,11 @@ func (s *SearchService) Search(userID string, query string, limit int, offset in
 	}
 	defer folderCursor.Close(ctx)
 
-	var folders []models.Folder
+	folders := []SearchFolder{}
 	if err = folderCursor.All(ctx, &folders); err != nil {
 		return nil, fmt.Errorf("failed to decode folders: %w", err)
 	}
+	annotateFolders(folders, userObjID)
 
 	return &SearchResult{
 		Files:   files,
@@ -109,9 +138,9 @@ func (s *SearchService) Search(userID string, query string, limit int, offset in
 }
 
 // SearchFilesOnly - New method for file-only search
-func (s *SearchService) SearchFilesOnly(userID string, query string, limit int, offset int) ([]models.File, error) {
+func (s *SearchService) SearchFilesOnly(userID string, query string, limit int, offset int, includeDescription bool, sortOpt SortOption) ([]SearchFile, error) {
 	if query == "" {
-		return []models.File{}, nil
+		return []SearchFile{}, nil
 	}
 
 	ctx := context.Background()
@@ -120,40 +149,47 @@ func (s *SearchService) SearchFilesOnly(userID string, query string, limit int,
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	searchRegex := bson.M{"$regex": query, "$options": "i"}
+	sharedFileIDs, sharedFolderIDs, err := s.sharedResourceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRegex := containsPattern(query)
 
 	fileFilter := bson.M{
 		"$and": []bson.M{
 			{
-				"$or": []bson.M{
-					{"name": searchRegex},
-					{"original_name": searchRegex},
-				},
+				"$or": nameMatch(searchRegex, includeDescription, "name", "original_name"),
 			},
 			{"deleted_at": nil},
-			{"owner_id": userObjID},
+			fileAccessFilter(userObjID, sharedFileIDs, sharedFolderIDs),
 		},
 	}
 
-	findOptions := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	findOptions := options.Find().
+		SetSort(resolveSortOption(ctx, s.userCollection, userID, sortOpt).sortDocument()).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetProjection(listViewProjection)
 	cursor, err := s.fileCollection.Find(ctx, fileFilter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search files: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var files []models.File
+	files := []SearchFile{}
 	if err = cursor.All(ctx, &files); err != nil {
 		return nil, fmt.Errorf("failed to decode files: %w", err)
 	}
+	annotateFiles(files, userObjID)
 
 	return files, nil
 }
 
 // SearchFoldersOnly - New method for folder-only search
-func (s *SearchService) SearchFoldersOnly(userID string, query string, limit int, offset int) ([]models.Folder, error) {
+func (s *SearchService) SearchFoldersOnly(userID string, query string, limit int, offset int, includeDescription bool, sortOpt SortOption) ([]SearchFolder, error) {
 	if query == "" {
-		return []models.Folder{}, nil
+		return []SearchFolder{}, nil
 	}
 
 	ctx := context.Background()
@@ -162,27 +198,37 @@ func (s *SearchService) SearchFoldersOnly(userID string, query string, limit int
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	searchRegex := bson.M{"$regex": query, "$options": "i"}
+	_, sharedFolderIDs, err := s.sharedResourceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRegex := containsPattern(query)
 
 	folderFilter := bson.M{
 		"$and": []bson.M{
-			{"name": searchRegex},
+			{"$or": nameMatch(searchRegex, includeDescription, "name")},
 			{"is_deleted": false},
-			{"owner_id": userObjID},
+			folderAccessFilter(userObjID, sharedFolderIDs),
 		},
 	}
 
-	findOptions := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	findOptions := options.Find().
+		SetSort(resolveSortOption(ctx, s.userCollection, userID, sortOpt).sortDocument()).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetProjection(listViewProjection)
 	cursor, err := s.folderCollection.Find(ctx, folderFilter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search folders: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var folders []models.Folder
+	folders := []SearchFolder{}
 	if err = cursor.All(ctx, &folders); err != nil {
 		return nil, fmt.Errorf("failed to decode folders: %w", err)
 	}
+	annotateFolders(folders, userObjID)
 
 	return folders, nil
 }
@@ -212,7 +258,9 @@ func (s *SearchService) GetRecentFiles(userID string, limit int, days int) ([]mo
 		SetSort(bson.D{
 			{Key: "updated_at", Value: -1},
 			{Key: "created_at", Value: -1},
-		})
+			{Key: "_id", Value: -1},
+		}).
+		SetProjection(listViewProjection)
 
 	cursor, err := s.fileCollection.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -246,7 +294,10 @@ func (s *SearchService) GetSharedWithMe(userID string, itemType string, limit in
 		}
 	}
 
-	findOptions := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "granted_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
 	cursor, err := s.permissionCollection.Find(ctx, filter, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get shared permissions: %w", err)
@@ -310,6 +361,93 @@ func (s *SearchService) GetSharedWithMe(userID string, itemType string, limit in
 	return sharedItems, nil
 }
 
+// sharedResourceIDs collects the files and folders the user holds an active permission on
+func (s *SearchService) sharedResourceIDs(ctx context.Context, userID string) ([]primitive.ObjectID, []primitive.ObjectID, error) {
+	cursor, err := s.permissionCollection.Find(ctx, bson.M{
+		"user_id":   userID,
+		"is_active": true,
+		"$or":       unexpiredGrant(),
+	}, options.Find().SetProjection(bson.M{"resource_id": 1, "resource_type": 1}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get shared permissions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var permissions []models.Permission
+	if err = cursor.All(ctx, &permissions); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode permissions: %w", err)
+	}
+
+	fileIDs := []primitive.ObjectID{}
+	folderIDs := []primitive.ObjectID{}
+	for _, perm := range permissions {
+		objID, err := primitive.ObjectIDFromHex(perm.ResourceID)
+		if err != nil {
+			continue
+		}
+		switch perm.ResourceType {
+		case "file":
+			fileIDs = append(fileIDs, objID)
+		case "folder":
+			folderIDs = append(folderIDs, objID)
+		}
+	}
+	return fileIDs, folderIDs, nil
+}
+
+// fileAccessFilter matches files the user owns, was shared directly, or that sit in a shared
+// folder. Folder shares are written to every descendant folder, so the folder_id check covers
+// nested files. One $or keeps each file to a single result.
+func fileAccessFilter(userObjID primitive.ObjectID, sharedFileIDs, sharedFolderIDs []primitive.ObjectID) bson.M {
+	clauses := []bson.M{{"owner_id": userObjID}}
+	if len(sharedFileIDs) > 0 {
+		clauses = append(clauses, bson.M{"_id": bson.M{"$in": sharedFileIDs}})
+	}
+	if len(sharedFolderIDs) > 0 {
+		clauses = append(clauses, bson.M{"folder_id": bson.M{"$in": sharedFolderIDs}})
+	}
+	return bson.M{"$or": clauses}
+}
+
+// folderAccessFilter matches folders the user owns or holds a permission on
+func folderAccessFilter(userObjID primitive.ObjectID, sharedFolderIDs []primitive.ObjectID) bson.M {
+	clauses := []bson.M{{"owner_id": userObjID}}
+	if len(sharedFolderIDs) > 0 {
+		clauses = append(clauses, bson.M{"_id": bson.M{"$in": sharedFolderIDs}})
+	}
+	return bson.M{"$or": clauses}
+}
+
+func annotateFiles(files []SearchFile, userObjID primitive.ObjectID) {
+	for i := range files {
+		files[i].Access = AccessShared
+		if files[i].OwnerID == userObjID {
+			files[i].Access = AccessOwned
+		}
+	}
+}
+
+func annotateFolders(folders []SearchFolder, userObjID primitive.ObjectID) {
+	for i := range folders {
+		folders[i].Access = AccessShared
+		if folders[i].OwnerID == userObjID {
+			folders[i].Access = AccessOwned
+		}
+	}
+}
+
+// nameMatch builds the $or clauses for a search, optionally matching descriptions too
+func nameMatch(searchRegex bson.M, includeDescription bool, fields ...string) []bson.M {
+	clauses := make([]bson.M, 0, len(fields)+1)
+	for _, field := range fields {
+		clauses = append(clauses, bson.M{field: searchRegex})
+	}
+	if includeDescription {
+		clauses = append(clauses, bson.M{"description": searchRegex})
+	}
+	return clauses
+}
+
 // CreateSearchIndexes - Enhanced version
 func (s *SearchService) CreateSearchIndexes() error {
 	ctx := context.Background()
@@ -319,6 +457,7 @@ func (s *SearchService) CreateSearchIndexes() error {
 		Keys: bson.D{
 			{Key: "name", Value: "text"},
 			{Key: "original_name", Value: "text"},
+			{Key: "description", Value: "text"},
 		},
 		Options: options.Index().SetName("file_search_index"),
 	}
@@ -332,6 +471,7 @@ func (s *SearchService) CreateSearchIndexes() error {
 	folderIndexModel := mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "name", Value: "text"},
+			{Key: "description", Value: "text"},
 		},
 		Options: options.Index().SetName("folder_search_index"),
 	}
@@ -367,3 +507,10 @@ func (s *SearchService) CreateSearchIndexes() error {
 
 	return nil
 }
+
+// containsPattern matches query as literal text anywhere in a field, ignoring case. The query
+// is escaped so user input can't inject regex syntax, such as a catastrophically backtracking
+// pattern.
+func containsPattern(query string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+}
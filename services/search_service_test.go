@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestContainsPatternMatchesQueryLiterally(t *testing.T) {
+	pattern := containsPattern("(a+)+$ report.pdf")["$regex"].(string)
+	re := regexp.MustCompile("(?i)" + pattern)
+
+	if !re.MatchString("Old (A+)+$ Report.PDF copy") {
+		t.Fatalf("pattern %q does not match the literal text", pattern)
+	}
+	if re.MatchString("aaaa report.pdf") || re.MatchString("(a+)+$ reportxpdf") {
+		t.Fatalf("pattern %q treats the query as regex syntax", pattern)
+	}
+}
+
+func TestSearchMatchesDescriptionOnlyWhenAsked(t *testing.T) {
+	mt := newMockDB(t)
+	for _, includeDescription := range []bool{true, false} {
+		mt.Run(fmt.Sprintf("description %t", includeDescription), func(mt *mtest.T) {
+			service := NewSearchService(mt.DB, nil)
+			userID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+			file := append(fileDoc(fileID, userID, "notes.txt"), bson.E{Key: "description", Value: "Quarterly figures"})
+			mt.AddMockResponses(
+				cursor("test.permissions"),
+				cursor("test.files", file),
+				cursor("test.folders"),
+			)
+
+			result, err := service.Search(userID.Hex(), "quarterly", 10, 0, includeDescription, SortOption{Field: "name", Direction: SortAscending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Files) != 1 || result.Files[0].Description != "Quarterly figures" || result.Files[0].Access != AccessOwned {
+				t.Fatalf("files = %+v", result.Files)
+			}
+
+			for _, find := range commands(mt, "find")[1:] {
+				values, err := find.Command.Lookup("filter", "$and", "0", "$or").Array().Values()
+				if err != nil {
+					t.Fatal(err)
+				}
+				matchesDescription := false
+				for _, clause := range values {
+					if _, err := clause.Document().LookupErr("description"); err == nil {
+						matchesDescription = true
+					}
+				}
+				if matchesDescription != includeDescription {
+					t.Fatalf("%s filter matches description = %t, want %t", find.Command.Lookup("find"), matchesDescription, includeDescription)
+				}
+			}
+		})
+	}
+}
@@ -2,22 +2,32 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"log"
 	"phynixdrive/models"
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type ShareService struct {
 	shareCollection   *mongo.Collection
+	linkCollection    *mongo.Collection
+	publicCollection  *mongo.Collection
 	folderCollection  *mongo.Collection
 	fileCollection    *mongo.Collection
 	userCollection    *mongo.Collection
 	permissionService *PermissionService
+
+	notificationService *NotificationService
 }
 
 type ShareRequest struct {
@@ -26,8 +36,18 @@ type ShareRequest struct {
 	Email             string `json:"email" validate:"required,email"`
 	Role              string `json:"role" validate:"required,oneof=viewer editor admin"`
 	InheritToChildren bool   `json:"inherit_to_children,omitempty"`
+	Upsert            bool   `json:"upsert,omitempty"` // update the role instead of failing when already shared
+	// ExpiresAt ends the grant automatically; omit for access that never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
+// Share actions reported in ShareResponse.Action
+const (
+	ShareActionCreated   = "created"
+	ShareActionUpdated   = "updated"
+	ShareActionUnchanged = "unchanged"
+)
+
 type ShareResponse struct {
 	ID               primitive.ObjectID `json:"id"`
 	ResourceID       string             `json:"resource_id"`
@@ -40,6 +60,34 @@ type ShareResponse struct {
 	SharedByName     string             `json:"shared_by_name"`
 	SharedAt         time.Time          `json:"shared_at"`
 	ChildrenAffected int                `json:"children_affected,omitempty"`
+	Action           string             `json:"action,omitempty"`
+	ExpiresAt        *time.Time         `json:"expires_at,omitempty"`
+}
+
+type ShareLinkRequest struct {
+	ResourceID     string `json:"resource_id" validate:"required"`
+	ResourceType   string `json:"resource_type" validate:"required,oneof=file folder"`
+	Role           string `json:"role" validate:"required,oneof=viewer editor"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty" validate:"omitempty,min=1,max=8760"`
+}
+
+// PublicLinkRequest creates a link that works without an account
+type PublicLinkRequest struct {
+	ResourceID     string `json:"resource_id" validate:"required"`
+	ResourceType   string `json:"resource_type" validate:"required,oneof=file folder"`
+	Password       string `json:"password,omitempty" validate:"omitempty,min=4,max=128"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty" validate:"omitempty,min=1,max=8760"`
+	MaxDownloads   int    `json:"max_downloads,omitempty" validate:"omitempty,min=1"`
+}
+
+// PublicLinkMeta is the non-sensitive view of a public link shown on its landing page
+type PublicLinkMeta struct {
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	Size             int64      `json:"size,omitempty"`
+	MimeType         string     `json:"mime_type,omitempty"`
+	PasswordRequired bool       `json:"password_required"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
 }
 
 type SharedResourcesResponse struct {
@@ -75,43 +123,65 @@ type PermissionInfo struct {
 	GrantedAt     time.Time          `json:"granted_at"`
 }
 
-func NewShareService(db *mongo.Database, permissionService *PermissionService) *ShareService {
+func NewShareService(db *mongo.Database, permissionService *PermissionService, notificationService *NotificationService) *ShareService {
 	return &ShareService{
 		shareCollection:   db.Collection("shares"),
+		linkCollection:    db.Collection("share_links"),
+		publicCollection:  db.Collection("public_links"),
 		folderCollection:  db.Collection("folders"),
 		fileCollection:    db.Collection("files"),
 		userCollection:    db.Collection("users"),
 		permissionService: permissionService,
+
+		notificationService: notificationService,
 	}
 }
 
-// ShareResource shares a file or folder with a user
-func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest, sharerID string) (*ShareResponse, error) {
-	// Validate sharer has permission to share
-	hasPermission, err := s.validateSharePermission(ctx, request.ResourceID, request.ResourceType, sharerID)
+// ShareValidation tells a sharer whether a share would succeed, and if not, why
+type ShareValidation struct {
+	Valid   bool   `json:"valid"`
+	Reason  string `json:"reason,omitempty"` // insufficient_permissions, user_not_found or already_shared
+	Message string `json:"message,omitempty"`
+	UserID  string `json:"user_id,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// ValidateShare runs ShareResource's precondition checks without creating anything.
+// Failed checks are reported in the result; only unexpected errors are returned.
+func (s *ShareService) ValidateShare(ctx context.Context, resourceID, resourceType, email, sharerID string) (*ShareValidation, error) {
+	targetUser, err := s.checkSharePreconditions(ctx, resourceID, resourceType, email, sharerID)
 	if err != nil {
-		return nil, fmt.Errorf("permission validation failed: %w", err)
-	}
-	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to share resource")
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "insufficient permissions"):
+			return &ShareValidation{Reason: "insufficient_permissions", Message: msg}, nil
+		case strings.HasPrefix(msg, "user with email"):
+			return &ShareValidation{Reason: "user_not_found", Message: msg}, nil
+		case strings.Contains(msg, "already shared"):
+			return &ShareValidation{Reason: "already_shared", Message: msg}, nil
+		}
+		return nil, err
 	}
 
-	// Find target user by email
-	var targetUser models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"email": request.Email}).Decode(&targetUser)
-	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("user with email %s not found", request.Email)
-	} else if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
-	}
+	return &ShareValidation{
+		Valid:  true,
+		UserID: targetUser.ID.Hex(),
+		Name:   targetUser.Name,
+	}, nil
+}
 
-	// Check if already shared
-	existingShare, err := s.getExistingShare(ctx, request.ResourceID, request.ResourceType, targetUser.ID.Hex())
-	if err != nil && err != mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("failed to check existing share: %w", err)
+// ShareResource shares a file or folder with a user
+func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest, sharerID string) (*ShareResponse, error) {
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiry must be in the future")
 	}
-	if existingShare != nil {
-		return nil, fmt.Errorf("resource already shared with this user")
+
+	targetUser, err := s.checkSharePreconditions(ctx, request.ResourceID, request.ResourceType, request.Email, sharerID)
+	if err != nil {
+		if request.Upsert && strings.Contains(err.Error(), "already shared") {
+			return s.upsertExistingShare(ctx, request, sharerID)
+		}
+		return nil, err
 	}
 
 	// Get resource info
@@ -121,9 +191,8 @@ func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest,
 	}
 
 	// Get sharer info
-	var sharer models.User
 	sharerObjID, _ := primitive.ObjectIDFromHex(sharerID)
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": sharerObjID}).Decode(&sharer)
+	sharer, err := lookupUser(ctx, s.userCollection, sharerObjID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sharer info: %w", err)
 	}
@@ -138,6 +207,7 @@ func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest,
 		Role:         request.Role,
 		SharedAt:     time.Now(),
 		IsActive:     true,
+		ExpiresAt:    request.ExpiresAt,
 	}
 
 	_, err = s.shareCollection.InsertOne(ctx, share)
@@ -147,9 +217,9 @@ func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest,
 
 	// Grant permission through permission service
 	if request.ResourceType == "folder" {
-		err = s.permissionService.ShareFolder(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID)
+		err = s.permissionService.ShareFolder(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID, request.ExpiresAt)
 	} else {
-		err = s.permissionService.ShareFile(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID)
+		err = s.permissionService.ShareFile(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID, request.ExpiresAt)
 	}
 	if err != nil {
 		// Cleanup share record on permission failure
@@ -160,13 +230,16 @@ func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest,
 	childrenAffected := 0
 	// Handle folder inheritance
 	if request.ResourceType == "folder" && request.InheritToChildren {
-		affected, err := s.shareChildFoldersRecursively(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID)
+		affected, err := s.shareDescendantFolders(ctx, request.ResourceID, targetUser.ID.Hex(), request.Role, sharerID, request.ExpiresAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to share child folders: %w", err)
 		}
 		childrenAffected = affected
 	}
 
+	// Children shared through inheritance are covered by the one email about the folder
+	s.notifyShared(targetUser.ID.Hex(), sharerID, request.ResourceType, request.ResourceID, resourceName)
+
 	response := &ShareResponse{
 		ID:               share.ID,
 		ResourceID:       request.ResourceID,
@@ -179,11 +252,115 @@ func (s *ShareService) ShareResource(ctx context.Context, request ShareRequest,
 		SharedByName:     sharer.FirstName + " " + sharer.LastName,
 		SharedAt:         share.SharedAt,
 		ChildrenAffected: childrenAffected,
+		Action:           ShareActionCreated,
+		ExpiresAt:        share.ExpiresAt,
+	}
+
+	return response, nil
+}
+
+// notifyShared notifies the recipient in the background so a slow mail provider never delays
+// or fails the share itself
+func (s *ShareService) notifyShared(sharedWithUserID, sharedByUserID, resourceType, resourceID, resourceName string) {
+	if s.notificationService == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var err error
+		if resourceType == "folder" {
+			err = s.notificationService.SendFolderSharedNotification(ctx, sharedWithUserID, sharedByUserID, resourceID, resourceName)
+		} else {
+			err = s.notificationService.SendFileSharedNotification(ctx, sharedWithUserID, sharedByUserID, resourceID, resourceName)
+		}
+		if err != nil {
+			log.Printf("Failed to send share notification to %s: %v", sharedWithUserID, err)
+		}
+	}()
+}
+
+// upsertExistingShare brings an existing share to the requested role and expiry. Re-sharing
+// with the same role and expiry is a no-op, so clients can call ShareResource with Upsert
+// without branching. A request without ExpiresAt clears any expiry on the existing share.
+func (s *ShareService) upsertExistingShare(ctx context.Context, request ShareRequest, sharerID string) (*ShareResponse, error) {
+	var targetUser models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"email": request.Email}).Decode(&targetUser)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user with email %s not found", request.Email)
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	existing, err := s.getExistingShare(ctx, request.ResourceID, request.ResourceType, targetUser.ID.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing share: %w", err)
 	}
 
+	sameExpiry := sameTime(existing.ExpiresAt, request.ExpiresAt)
+	if existing.Role == request.Role && sameExpiry {
+		response, err := s.buildShareResponse(ctx, *existing)
+		if err != nil {
+			return nil, err
+		}
+		response.Action = ShareActionUnchanged
+		return response, nil
+	}
+
+	if !sameExpiry {
+		if err := s.setShareExpiry(ctx, *existing, request.ExpiresAt, sharerID); err != nil {
+			return nil, err
+		}
+		existing.ExpiresAt = request.ExpiresAt
+	}
+
+	var response *ShareResponse
+	if existing.Role != request.Role {
+		response, err = s.UpdatePermission(ctx, existing.ID.Hex(), request.Role, sharerID)
+	} else {
+		response, err = s.buildShareResponse(ctx, *existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.ExpiresAt = request.ExpiresAt
+	response.Action = ShareActionUpdated
 	return response, nil
 }
 
+// setShareExpiry sets or, when expiresAt is nil, clears the expiry on a share and on the
+// grant backing it
+func (s *ShareService) setShareExpiry(ctx context.Context, share models.Share, expiresAt *time.Time, userID string) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"updated_at": now, "updated_by": userID},
+	}
+	if expiresAt != nil {
+		update["$set"].(bson.M)["expires_at"] = *expiresAt
+	} else {
+		update["$unset"] = bson.M{"expires_at": ""}
+	}
+
+	if _, err := s.shareCollection.UpdateOne(ctx, bson.M{"_id": share.ID}, update); err != nil {
+		return fmt.Errorf("failed to update share expiry: %w", err)
+	}
+	if err := s.permissionService.SetGrantExpiry(ctx, share.SharedWith, share.ResourceID, share.ResourceType, expiresAt); err != nil {
+		return fmt.Errorf("failed to update permission expiry: %w", err)
+	}
+	return nil
+}
+
+// sameTime reports whether two optional times are both unset or equal at the millisecond
+// precision MongoDB stores
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
+
 // GetSharedByMe returns all resources shared by the current user
 func (s *ShareService) GetSharedByMe(ctx context.Context, userID string, resourceType *string) ([]ShareResponse, error) {
 	filter := bson.M{
@@ -194,7 +371,7 @@ func (s *ShareService) GetSharedByMe(ctx context.Context, userID string, resourc
 		filter["resource_type"] = *resourceType
 	}
 
-	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"shared_at": -1}))
+	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "shared_at", Value: -1}, {Key: "_id", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get shared resources: %w", err)
 	}
@@ -222,12 +399,13 @@ func (s *ShareService) GetSharedWithMe(ctx context.Context, userID string, resou
 	filter := bson.M{
 		"shared_with": userID,
 		"is_active":   true,
+		"$or":         unexpiredGrant(),
 	}
 	if resourceType != nil && *resourceType != "" {
 		filter["resource_type"] = *resourceType
 	}
 
-	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"shared_at": -1}))
+	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "shared_at", Value: -1}, {Key: "_id", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get shared resources: %w", err)
 	}
@@ -250,6 +428,194 @@ func (s *ShareService) GetSharedWithMe(ctx context.Context, userID string, resou
 	return resources, nil
 }
 
+// EffectiveAccessItem is one resource the user can reach, either shared directly or through
+// a shared ancestor folder. InheritedFrom is the ID of the shared folder granting the access.
+type EffectiveAccessItem struct {
+	ID            primitive.ObjectID `json:"id"`
+	Name          string             `json:"name"`
+	Type          string             `json:"type"`
+	Size          int64              `json:"size,omitempty"`
+	Role          string             `json:"role"`
+	Inherited     bool               `json:"inherited"`
+	InheritedFrom string             `json:"inherited_from,omitempty"`
+}
+
+// GetEffectiveAccess lists everything shared with the user, expanding folder shares to all
+// descendant folders and files. Each resource appears once with its highest effective role.
+func (s *ShareService) GetEffectiveAccess(ctx context.Context, userID string) ([]EffectiveAccessItem, error) {
+	cursor, err := s.shareCollection.Find(ctx, bson.M{
+		"shared_with": userID,
+		"is_active":   true,
+		"$or":         unexpiredGrant(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared resources: %w", err)
+	}
+	var shares []models.Share
+	if err := cursor.All(ctx, &shares); err != nil {
+		return nil, fmt.Errorf("failed to decode shares: %w", err)
+	}
+
+	folders := make(map[primitive.ObjectID]*EffectiveAccessItem)
+	files := make(map[primitive.ObjectID]*EffectiveAccessItem)
+	var directFolderIDs, directFileIDs []primitive.ObjectID
+
+	for _, share := range shares {
+		objID, err := primitive.ObjectIDFromHex(share.ResourceID)
+		if err != nil {
+			continue
+		}
+		item := &EffectiveAccessItem{ID: objID, Type: share.ResourceType, Role: share.Role}
+		target := files
+		if share.ResourceType == "folder" {
+			target = folders
+		}
+		if existing, ok := target[objID]; ok && roleRank(existing.Role) >= roleRank(item.Role) {
+			continue
+		}
+		target[objID] = item
+		if share.ResourceType == "folder" {
+			directFolderIDs = append(directFolderIDs, objID)
+		} else {
+			directFileIDs = append(directFileIDs, objID)
+		}
+	}
+
+	// Fill in names for direct folder shares and drop deleted ones
+	if len(directFolderIDs) > 0 {
+		var found []models.Folder
+		if err := s.findAll(ctx, s.folderCollection, bson.M{"_id": bson.M{"$in": directFolderIDs}, "is_deleted": false}, &found); err != nil {
+			return nil, err
+		}
+		live := make(map[primitive.ObjectID]bool, len(found))
+		for _, folder := range found {
+			folders[folder.ID].Name = folder.Name
+			live[folder.ID] = true
+		}
+		for id := range folders {
+			if !live[id] {
+				delete(folders, id)
+			}
+		}
+	}
+
+	// Walk down from shared folders one level at a time. A folder is revisited only when
+	// a path with a higher role reaches it, so overlapping shares resolve to the best role.
+	frontier := make([]primitive.ObjectID, 0, len(folders))
+	for id := range folders {
+		frontier = append(frontier, id)
+	}
+	for len(frontier) > 0 {
+		var children []models.Folder
+		if err := s.findAll(ctx, s.folderCollection, bson.M{"parent_id": bson.M{"$in": frontier}, "is_deleted": false}, &children); err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, child := range children {
+			parent := folders[*child.ParentID]
+			if existing, ok := folders[child.ID]; ok && roleRank(existing.Role) >= roleRank(parent.Role) {
+				continue
+			}
+			folders[child.ID] = &EffectiveAccessItem{
+				ID:            child.ID,
+				Name:          child.Name,
+				Type:          "folder",
+				Role:          parent.Role,
+				Inherited:     true,
+				InheritedFrom: grantingFolder(parent),
+			}
+			frontier = append(frontier, child.ID)
+		}
+	}
+
+	// Files inside any reachable folder inherit that folder's role
+	if len(folders) > 0 {
+		folderIDs := make([]primitive.ObjectID, 0, len(folders))
+		for id := range folders {
+			folderIDs = append(folderIDs, id)
+		}
+		var inherited []models.File
+		if err := s.findAll(ctx, s.fileCollection, bson.M{"folder_id": bson.M{"$in": folderIDs}, "deleted_at": nil}, &inherited); err != nil {
+			return nil, err
+		}
+		for _, file := range inherited {
+			parent := folders[*file.FolderID]
+			if existing, ok := files[file.ID]; ok && roleRank(existing.Role) >= roleRank(parent.Role) {
+				continue
+			}
+			files[file.ID] = &EffectiveAccessItem{
+				ID:            file.ID,
+				Name:          file.Name,
+				Type:          "file",
+				Size:          file.Size,
+				Role:          parent.Role,
+				Inherited:     true,
+				InheritedFrom: grantingFolder(parent),
+			}
+		}
+	}
+
+	// Fill in details for direct file shares that weren't replaced by an inherited role
+	if len(directFileIDs) > 0 {
+		var found []models.File
+		if err := s.findAll(ctx, s.fileCollection, bson.M{"_id": bson.M{"$in": directFileIDs}, "deleted_at": nil}, &found); err != nil {
+			return nil, err
+		}
+		live := make(map[primitive.ObjectID]bool, len(found))
+		for _, file := range found {
+			live[file.ID] = true
+			if item := files[file.ID]; !item.Inherited {
+				item.Name = file.Name
+				item.Size = file.Size
+			}
+		}
+		for id, item := range files {
+			if !item.Inherited && !live[id] {
+				delete(files, id)
+			}
+		}
+	}
+
+	items := make([]EffectiveAccessItem, 0, len(folders)+len(files))
+	for _, item := range folders {
+		items = append(items, *item)
+	}
+	for _, item := range files {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Type != items[j].Type {
+			return items[i].Type == "folder"
+		}
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID.Hex() < items[j].ID.Hex()
+	})
+
+	return items, nil
+}
+
+// grantingFolder returns the ID of the directly shared folder an item's access comes from
+func grantingFolder(parent *EffectiveAccessItem) string {
+	if parent.Inherited {
+		return parent.InheritedFrom
+	}
+	return parent.ID.Hex()
+}
+
+func (s *ShareService) findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, results interface{}) error {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(listViewProjection))
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if err := cursor.All(ctx, results); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
 // GetAllSharedResources returns both shared by me and shared with me
 func (s *ShareService) GetAllSharedResources(ctx context.Context, userID string) (*SharedResourcesResponse, error) {
 	sharedByMe, err := s.GetSharedByMe(ctx, userID, nil)
@@ -300,9 +666,10 @@ func (s *ShareService) GetResourcePermissions(ctx context.Context, resourceID, r
 		"resource_id":   resourceID,
 		"resource_type": resourceType,
 		"is_active":     true,
+		"$or":           unexpiredGrant(),
 	}
 
-	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"shared_at": -1}))
+	cursor, err := s.shareCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "shared_at", Value: -1}, {Key: "_id", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get permissions: %w", err)
 	}
@@ -382,6 +749,50 @@ func (s *ShareService) RevokePermission(ctx context.Context, shareID, userID str
 	return nil
 }
 
+// DeclineShare lets the recipient of a share remove it from their own "shared with me".
+// Only the recipient may decline; anyone else gets "share not found".
+func (s *ShareService) DeclineShare(ctx context.Context, shareID, userID string) error {
+	shareObjID, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return fmt.Errorf("invalid share ID: %w", err)
+	}
+
+	var share models.Share
+	err = s.shareCollection.FindOne(ctx, bson.M{
+		"_id":         shareObjID,
+		"shared_with": userID,
+		"is_active":   true,
+	}).Decode(&share)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("share not found")
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if err := s.permissionService.RelinquishPermission(ctx, userID, share.ResourceType, share.ResourceID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = s.shareCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": shareObjID},
+		bson.M{
+			"$set": bson.M{
+				"is_active":   false,
+				"revoked_at":  now,
+				"revoked_by":  userID,
+				"declined_at": now,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update share record: %w", err)
+	}
+
+	return nil
+}
+
 // UpdatePermission changes the role of an existing permission
 func (s *ShareService) UpdatePermission(ctx context.Context, shareID, newRole, userID string) (*ShareResponse, error) {
 	shareObjID, err := primitive.ObjectIDFromHex(shareID)
@@ -441,8 +852,470 @@ func (s *ShareService) UpdatePermission(ctx context.Context, shareID, newRole, u
 	return s.buildShareResponse(ctx, share)
 }
 
+// CreateShareLink issues an internal link token for a resource the creator can share
+func (s *ShareService) CreateShareLink(ctx context.Context, request ShareLinkRequest, creatorID string) (*models.ShareLink, error) {
+	hasPermission, err := s.validateSharePermission(ctx, request.ResourceID, request.ResourceType, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("permission validation failed: %w", err)
+	}
+	if !hasPermission {
+		return nil, fmt.Errorf("insufficient permissions to share resource")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate link token: %w", err)
+	}
+
+	now := time.Now()
+	link := models.ShareLink{
+		ID:           primitive.NewObjectID(),
+		Token:        base64.RawURLEncoding.EncodeToString(tokenBytes),
+		ResourceID:   request.ResourceID,
+		ResourceType: request.ResourceType,
+		Role:         request.Role,
+		CreatedBy:    creatorID,
+		CreatedAt:    now,
+		IsActive:     true,
+	}
+	if request.ExpiresInHours > 0 {
+		expiresAt := now.Add(time.Duration(request.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if _, err := s.linkCollection.InsertOne(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// RedeemShareLink grants the link's role to an authenticated user. Users who already hold
+// an equal or higher role keep it; the grant is recorded as coming from the link creator.
+func (s *ShareService) RedeemShareLink(ctx context.Context, token, userID string) (*ShareResponse, error) {
+	var link models.ShareLink
+	err := s.linkCollection.FindOne(ctx, bson.M{
+		"token":     token,
+		"is_active": true,
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("share link not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, fmt.Errorf("share link expired")
+	}
+
+	var hasRole bool
+	if link.ResourceType == "folder" {
+		hasRole, err = s.permissionService.HasFolderPermission(ctx, userID, link.ResourceID, link.Role)
+	} else {
+		hasRole, err = s.permissionService.HasFilePermission(ctx, userID, link.ResourceID, link.Role)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+
+	existingShare, err := s.getExistingShare(ctx, link.ResourceID, link.ResourceType, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing share: %w", err)
+	}
+	if hasRole {
+		if existingShare != nil {
+			return s.buildShareResponse(ctx, *existingShare)
+		}
+		return nil, fmt.Errorf("you already have access to this resource")
+	}
+
+	// Count the redemption before granting anything. The update only matches a link that is
+	// still active and unexpired, so one revoked or expired since the read above grants nothing.
+	now := time.Now()
+	claimed, err := s.linkCollection.UpdateOne(ctx, bson.M{
+		"_id":       link.ID,
+		"is_active": true,
+		"$or": []bson.M{
+			{"expires_at": nil},
+			{"expires_at": bson.M{"$gt": now}},
+		},
+	}, bson.M{"$inc": bson.M{"redeem_count": 1}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem share link: %w", err)
+	}
+	if claimed.MatchedCount == 0 {
+		return nil, fmt.Errorf("share link not found")
+	}
+
+	if link.ResourceType == "folder" {
+		err = s.permissionService.ShareFolder(ctx, link.ResourceID, userID, link.Role, link.CreatedBy, nil)
+	} else {
+		err = s.permissionService.ShareFile(ctx, link.ResourceID, userID, link.Role, link.CreatedBy, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	var share models.Share
+	if existingShare != nil {
+		share = *existingShare
+		share.Role = link.Role
+		_, err = s.shareCollection.UpdateOne(ctx, bson.M{"_id": share.ID}, bson.M{
+			"$set": bson.M{
+				"role":       link.Role,
+				"updated_at": now,
+				"updated_by": link.CreatedBy,
+			},
+		})
+	} else {
+		share = models.Share{
+			ID:           primitive.NewObjectID(),
+			ResourceID:   link.ResourceID,
+			ResourceType: link.ResourceType,
+			SharedWith:   userID,
+			SharedBy:     link.CreatedBy,
+			Role:         link.Role,
+			SharedAt:     now,
+			IsActive:     true,
+		}
+		_, err = s.shareCollection.InsertOne(ctx, share)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record share: %w", err)
+	}
+
+	return s.buildShareResponse(ctx, share)
+}
+
+// RevokeShareLink deactivates a link; access already granted through it is kept
+func (s *ShareService) RevokeShareLink(ctx context.Context, linkID, userID string) error {
+	linkObjID, err := primitive.ObjectIDFromHex(linkID)
+	if err != nil {
+		return fmt.Errorf("invalid share link ID: %w", err)
+	}
+
+	var link models.ShareLink
+	err = s.linkCollection.FindOne(ctx, bson.M{
+		"_id":       linkObjID,
+		"is_active": true,
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("share link not found")
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if link.CreatedBy != userID {
+		hasPermission, err := s.validateSharePermission(ctx, link.ResourceID, link.ResourceType, userID)
+		if err != nil {
+			return fmt.Errorf("permission validation failed: %w", err)
+		}
+		if !hasPermission {
+			return fmt.Errorf("insufficient permissions to revoke share link")
+		}
+	}
+
+	_, err = s.linkCollection.UpdateOne(ctx, bson.M{"_id": linkObjID}, bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"revoked_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+
+	return nil
+}
+
+// GetPublicLinkMeta describes the resource behind a public link without serving it, so a
+// landing page can render before asking for the password
+func (s *ShareService) GetPublicLinkMeta(ctx context.Context, token string) (*PublicLinkMeta, error) {
+	link, err := s.getActivePublicLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	objID, err := primitive.ObjectIDFromHex(link.ResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("public link not found")
+	}
+
+	meta := &PublicLinkMeta{
+		Type:             link.ResourceType,
+		PasswordRequired: link.PasswordHash != "",
+		ExpiresAt:        link.ExpiresAt,
+	}
+
+	if link.ResourceType == "folder" {
+		var folder models.Folder
+		err = s.folderCollection.FindOne(ctx, bson.M{"_id": objID, "is_deleted": false}).Decode(&folder)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("public link not found")
+		} else if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		meta.Name = folder.Name
+	} else {
+		var file models.File
+		err = s.fileCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&file)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("public link not found")
+		} else if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		meta.Name = file.Name
+		meta.Size = file.Size
+		meta.MimeType = file.MimeType
+	}
+
+	return meta, nil
+}
+
+// CreatePublicLink issues a link anyone can open without an account. The optional password
+// is stored as a bcrypt hash.
+func (s *ShareService) CreatePublicLink(ctx context.Context, request PublicLinkRequest, creatorID string) (*models.PublicLink, error) {
+	hasPermission, err := s.validateSharePermission(ctx, request.ResourceID, request.ResourceType, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("permission validation failed: %w", err)
+	}
+	if !hasPermission {
+		return nil, fmt.Errorf("insufficient permissions to share resource")
+	}
+
+	if _, err := s.getResourceName(ctx, request.ResourceID, request.ResourceType); err != nil {
+		return nil, fmt.Errorf("%s not found", request.ResourceType)
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate link token: %w", err)
+	}
+
+	now := time.Now()
+	link := models.PublicLink{
+		ID:           primitive.NewObjectID(),
+		Token:        base64.RawURLEncoding.EncodeToString(tokenBytes),
+		ResourceID:   request.ResourceID,
+		ResourceType: request.ResourceType,
+		MaxDownloads: request.MaxDownloads,
+		CreatedBy:    creatorID,
+		CreatedAt:    now,
+		IsActive:     true,
+	}
+	if request.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash link password: %w", err)
+		}
+		link.PasswordHash = string(hash)
+	}
+	if request.ExpiresInHours > 0 {
+		expiresAt := now.Add(time.Duration(request.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if _, err := s.publicCollection.InsertOne(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to create public link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// RevokePublicLink deactivates a public link. The creator or anyone who can share the
+// resource may revoke it.
+func (s *ShareService) RevokePublicLink(ctx context.Context, linkID, userID string) error {
+	linkObjID, err := primitive.ObjectIDFromHex(linkID)
+	if err != nil {
+		return fmt.Errorf("invalid public link ID: %w", err)
+	}
+
+	var link models.PublicLink
+	err = s.publicCollection.FindOne(ctx, bson.M{
+		"_id":       linkObjID,
+		"is_active": true,
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("public link not found")
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if link.CreatedBy != userID {
+		hasPermission, err := s.validateSharePermission(ctx, link.ResourceID, link.ResourceType, userID)
+		if err != nil {
+			return fmt.Errorf("permission validation failed: %w", err)
+		}
+		if !hasPermission {
+			return fmt.Errorf("insufficient permissions to revoke public link")
+		}
+	}
+
+	_, err = s.publicCollection.UpdateOne(ctx, bson.M{"_id": linkObjID}, bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"revoked_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke public link: %w", err)
+	}
+
+	return nil
+}
+
+// OpenPublicFolderLink checks a folder link and its password. The download is not counted
+// yet: the caller does that with CountPublicDownload once the folder passed its size check.
+func (s *ShareService) OpenPublicFolderLink(ctx context.Context, token, password string) (*models.PublicLink, primitive.ObjectID, error) {
+	link, err := s.checkPublicLinkPassword(ctx, token, password)
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	if link.ResourceType != "folder" {
+		return nil, primitive.NilObjectID, fmt.Errorf("public link not found")
+	}
+
+	folderObjID, err := primitive.ObjectIDFromHex(link.ResourceID)
+	if err != nil {
+		return nil, primitive.NilObjectID, fmt.Errorf("public link not found")
+	}
+	return link, folderObjID, nil
+}
+
+// OpenPublicLink checks a link and its password and makes sure the resource still exists.
+// File is only set for file links, whose download is counted here; folder downloads are
+// counted with CountPublicDownload once they pass the size check.
+func (s *ShareService) OpenPublicLink(ctx context.Context, token, password string) (*models.PublicLink, *models.File, error) {
+	link, err := s.checkPublicLinkPassword(ctx, token, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objID, err := primitive.ObjectIDFromHex(link.ResourceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("public link not found")
+	}
+
+	var file *models.File
+	if link.ResourceType == "folder" {
+		count, err := s.folderCollection.CountDocuments(ctx, bson.M{"_id": objID, "is_deleted": false})
+		if err != nil {
+			return nil, nil, fmt.Errorf("database error: %w", err)
+		}
+		if count == 0 {
+			return nil, nil, fmt.Errorf("public link not found")
+		}
+	} else {
+		file = &models.File{}
+		err = s.fileCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(file)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, fmt.Errorf("public link not found")
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	if file != nil {
+		if err := s.CountPublicDownload(ctx, link); err != nil {
+			return nil, nil, err
+		}
+	}
+	return link, file, nil
+}
+
 // Helper methods
 
+// checkPublicLinkPassword loads an active link and verifies its password, if it has one
+func (s *ShareService) checkPublicLinkPassword(ctx context.Context, token, password string) (*models.PublicLink, error) {
+	link, err := s.getActivePublicLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.PasswordHash != "" {
+		if password == "" {
+			return nil, fmt.Errorf("public link password required")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return nil, fmt.Errorf("invalid public link password")
+		}
+	}
+	return link, nil
+}
+
+// CountPublicDownload records one download. The count only moves while the link is under
+// its download cap, so concurrent requests cannot overshoot MaxDownloads.
+func (s *ShareService) CountPublicDownload(ctx context.Context, link *models.PublicLink) error {
+	filter := bson.M{"_id": link.ID, "is_active": true}
+	if link.MaxDownloads > 0 {
+		filter["download_count"] = bson.M{"$lt": link.MaxDownloads}
+	}
+	result, err := s.publicCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"download_count": 1}})
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("public link download limit reached")
+	}
+	return nil
+}
+
+// getActivePublicLink loads a link by token, rejecting revoked, expired and exhausted links
+func (s *ShareService) getActivePublicLink(ctx context.Context, token string) (*models.PublicLink, error) {
+	var link models.PublicLink
+	err := s.publicCollection.FindOne(ctx, bson.M{
+		"token":     token,
+		"is_active": true,
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("public link not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, fmt.Errorf("public link expired")
+	}
+	if link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		return nil, fmt.Errorf("public link download limit reached")
+	}
+
+	return &link, nil
+}
+
+// checkSharePreconditions runs the checks a share must pass before it is created: the sharer
+// may share the resource, the target user exists, and it isn't already shared with them
+func (s *ShareService) checkSharePreconditions(ctx context.Context, resourceID, resourceType, email, sharerID string) (*models.User, error) {
+	// Validate sharer has permission to share
+	hasPermission, err := s.validateSharePermission(ctx, resourceID, resourceType, sharerID)
+	if err != nil {
+		return nil, fmt.Errorf("permission validation failed: %w", err)
+	}
+	if !hasPermission {
+		return nil, fmt.Errorf("insufficient permissions to share resource")
+	}
+
+	// Find target user by email
+	var targetUser models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&targetUser)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user with email %s not found", email)
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// Check if already shared
+	existingShare, err := s.getExistingShare(ctx, resourceID, resourceType, targetUser.ID.Hex())
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to check existing share: %w", err)
+	}
+	if existingShare != nil {
+		return nil, fmt.Errorf("resource already shared with this user")
+	}
+
+	return &targetUser, nil
+}
+
 func (s *ShareService) validateSharePermission(ctx context.Context, resourceID, resourceType, userID string) (bool, error) {
 	if s.permissionService == nil {
 		return true, nil // Skip validation if no permission service
@@ -504,16 +1377,14 @@ func (s *ShareService) buildShareResponse(ctx context.Context, share models.Shar
 
 	// Get shared with user info
 	sharedWithObjID, _ := primitive.ObjectIDFromHex(share.SharedWith)
-	var sharedWithUser models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": sharedWithObjID}).Decode(&sharedWithUser)
+	sharedWithUser, err := lookupUser(ctx, s.userCollection, sharedWithObjID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get shared by user info
 	sharedByObjID, _ := primitive.ObjectIDFromHex(share.SharedBy)
-	var sharedByUser models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": sharedByObjID}).Decode(&sharedByUser)
+	sharedByUser, err := lookupUser(ctx, s.userCollection, sharedByObjID)
 	if err != nil {
 		return nil, err
 	}
@@ -568,8 +1439,7 @@ func (s *ShareService) buildResourceInfo(ctx context.Context, share models.Share
 
 	// Get shared by user info
 	sharedByObjID, _ := primitive.ObjectIDFromHex(share.SharedBy)
-	var sharedByUser models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": sharedByObjID}).Decode(&sharedByUser)
+	sharedByUser, err := lookupUser(ctx, s.userCollection, sharedByObjID)
 	if err != nil {
 		return nil, err
 	}
@@ -590,16 +1460,14 @@ func (s *ShareService) buildPermissionInfo(ctx context.Context, share models.Sha
 
 	// Get user info
 	userObjID, _ := primitive.ObjectIDFromHex(share.SharedWith)
-	var user models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+	user, err := lookupUser(ctx, s.userCollection, userObjID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get granted by user info
 	grantedByObjID, _ := primitive.ObjectIDFromHex(share.SharedBy)
-	var grantedByUser models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": grantedByObjID}).Decode(&grantedByUser)
+	grantedByUser, err := lookupUser(ctx, s.userCollection, grantedByObjID)
 	if err != nil {
 		return nil, err
 	}
@@ -619,57 +1487,91 @@ func (s *ShareService) buildPermissionInfo(ctx context.Context, share models.Sha
 	}, nil
 }
 
-func (s *ShareService) shareChildFoldersRecursively(ctx context.Context, parentID, targetUserID, role, sharerID string) (int, error) {
+// shareDescendantFolders shares every folder below parentID with the target user using bulk
+// writes. Folders already shared with them are skipped; the count of new shares is returned.
+func (s *ShareService) shareDescendantFolders(ctx context.Context, parentID, targetUserID, role, sharerID string, expiresAt *time.Time) (int, error) {
 	parentObjID, err := primitive.ObjectIDFromHex(parentID)
 	if err != nil {
 		return 0, err
 	}
 
-	cursor, err := s.folderCollection.Find(ctx, bson.M{
-		"parent_id":  parentObjID,
-		"is_deleted": false,
-	})
+	// Collect the whole subtree first, one query per level
+	var descendantIDs []string
+	frontier := []primitive.ObjectID{parentObjID}
+	for len(frontier) > 0 {
+		cursor, err := s.folderCollection.Find(ctx, bson.M{
+			"parent_id":  bson.M{"$in": frontier},
+			"is_deleted": false,
+		}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return 0, err
+		}
+		var children []models.Folder
+		if err := cursor.All(ctx, &children); err != nil {
+			return 0, err
+		}
+
+		frontier = frontier[:0]
+		for _, child := range children {
+			frontier = append(frontier, child.ID)
+			descendantIDs = append(descendantIDs, child.ID.Hex())
+		}
+	}
+	if len(descendantIDs) == 0 {
+		return 0, nil
+	}
+
+	// Skip folders already shared with the target user
+	cursor, err := s.shareCollection.Find(ctx, bson.M{
+		"resource_id":   bson.M{"$in": descendantIDs},
+		"resource_type": "folder",
+		"shared_with":   targetUserID,
+		"is_active":     true,
+	}, options.Find().SetProjection(bson.M{"resource_id": 1}))
 	if err != nil {
 		return 0, err
 	}
-	defer cursor.Close(ctx)
+	var existing []models.Share
+	if err := cursor.All(ctx, &existing); err != nil {
+		return 0, err
+	}
+	alreadyShared := make(map[string]bool, len(existing))
+	for _, share := range existing {
+		alreadyShared[share.ResourceID] = true
+	}
 
-	affected := 0
-	for cursor.Next(ctx) {
-		var childFolder models.Folder
-		if err := cursor.Decode(&childFolder); err != nil {
+	now := time.Now()
+	var toShare []string
+	var shareWrites []mongo.WriteModel
+	for _, id := range descendantIDs {
+		if alreadyShared[id] {
 			continue
 		}
-
-		// Create share record for child folder
-		share := models.Share{
+		toShare = append(toShare, id)
+		shareWrites = append(shareWrites, mongo.NewInsertOneModel().SetDocument(models.Share{
 			ID:           primitive.NewObjectID(),
-			ResourceID:   childFolder.ID.Hex(),
+			ResourceID:   id,
 			ResourceType: "folder",
 			SharedWith:   targetUserID,
 			SharedBy:     sharerID,
 			Role:         role,
-			SharedAt:     time.Now(),
+			SharedAt:     now,
 			IsActive:     true,
-		}
-
-		_, err = s.shareCollection.InsertOne(ctx, share)
-		if err != nil {
-			continue
-		}
-
-		err = s.permissionService.ShareFolder(ctx, childFolder.ID.Hex(), targetUserID, role, sharerID)
-		if err != nil {
-			s.shareCollection.DeleteOne(ctx, bson.M{"_id": share.ID})
-			continue
-		}
+			ExpiresAt:    expiresAt,
+		}))
+	}
+	if len(shareWrites) == 0 {
+		return 0, nil
+	}
 
-		affected++
+	result, err := s.shareCollection.BulkWrite(ctx, shareWrites, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create share records: %w", err)
+	}
 
-		// Recursively share grandchildren
-		grandchildrenAffected, _ := s.shareChildFoldersRecursively(ctx, childFolder.ID.Hex(), targetUserID, role, sharerID)
-		affected += grandchildrenAffected
+	if err := s.permissionService.GrantFolderPermissions(ctx, toShare, targetUserID, role, sharerID, expiresAt); err != nil {
+		return 0, err
 	}
 
-	return affected, nil
+	return int(result.InsertedCount), nil
 }
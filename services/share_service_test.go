@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRedeemShareLinkGrantsNothingOnceLinkIsRevoked(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("revoked", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		linkID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.share_links", bson.D{
+				{Key: "_id", Value: linkID},
+				{Key: "token", Value: "tok"},
+				{Key: "resource_id", Value: fileID.Hex()},
+				{Key: "resource_type", Value: "file"},
+				{Key: "role", Value: "viewer"},
+				{Key: "is_active", Value: true},
+			}),
+			cursor("test.files", fileDoc(fileID, primitive.NewObjectID(), "a.txt")),
+			cursor("test.permissions"),
+			cursor("test.shares"),
+			// Revoked after it was read, so the guarded increment matches nothing
+			writeResult(0),
+		)
+
+		_, err := service.RedeemShareLink(context.Background(), "tok", primitive.NewObjectID().Hex())
+		if err == nil || err.Error() != "share link not found" {
+			t.Fatalf("err = %v, want share link not found", err)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 1 || len(commands(mt, "insert")) != 0 {
+			t.Fatal("no permission or share may be written for a revoked link")
+		}
+		if !updates[0].Command.Lookup("updates", "0", "q", "is_active").Boolean() {
+			t.Fatal("redeem_count increment is not conditional on an active link")
+		}
+	})
+}
+
+func TestRedeemShareLinkGrantsLinkRoleToRedeemer(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("granted", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		linkID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+		ownerID, redeemerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.share_links", bson.D{
+				{Key: "_id", Value: linkID},
+				{Key: "token", Value: "tok"},
+				{Key: "resource_id", Value: fileID.Hex()},
+				{Key: "resource_type", Value: "file"},
+				{Key: "role", Value: "viewer"},
+				{Key: "is_active", Value: true},
+				{Key: "created_by", Value: ownerID.Hex()},
+			}),
+			cursor("test.files", fileDoc(fileID, ownerID, "a.txt")),
+			cursor("test.permissions"),
+			cursor("test.shares"),
+			writeResult(1),
+			// ShareFile: redeemer exists, link creator owns the file, no earlier grant
+			cursor("test.users", bson.D{{Key: "_id", Value: redeemerID}, {Key: "email", Value: "r@example.com"}}),
+			cursor("test.files", fileDoc(fileID, ownerID, "a.txt")),
+			cursor("test.permissions"),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			// Response: resource name and the sharer (the redeemer is cached by now)
+			cursor("test.files", fileDoc(fileID, ownerID, "a.txt")),
+			cursor("test.users", bson.D{{Key: "_id", Value: ownerID}, {Key: "email", Value: "o@example.com"}}),
+		)
+
+		share, err := service.RedeemShareLink(context.Background(), "tok", redeemerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share.Role != "viewer" || share.SharedWith != "r@example.com" || share.SharedBy != "o@example.com" {
+			t.Fatalf("share = %+v", share)
+		}
+
+		inserts := commands(mt, "insert")
+		if len(inserts) != 2 {
+			t.Fatalf("inserts = %d, want a permission and a share", len(inserts))
+		}
+		perm := inserts[0].Command.Lookup("documents", "0")
+		if inserts[0].Command.Lookup("insert").StringValue() != "permissions" ||
+			perm.Document().Lookup("user_id").StringValue() != redeemerID.Hex() ||
+			perm.Document().Lookup("role").StringValue() != "viewer" {
+			t.Fatalf("permission insert = %v", inserts[0].Command)
+		}
+		if inserts[1].Command.Lookup("insert").StringValue() != "shares" {
+			t.Fatalf("second insert went to %v", inserts[1].Command.Lookup("insert"))
+		}
+	})
+}
+
+func TestValidateShareReportsEachFailureReason(t *testing.T) {
+	sharerID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+	target := bson.D{{Key: "_id", Value: targetID}, {Key: "email", Value: "t@example.com"}, {Key: "name", Value: "Tess"}}
+
+	tests := []struct {
+		name       string
+		owner      primitive.ObjectID
+		user       []bson.D
+		shares     []bson.D
+		wantReason string
+	}{
+		{"not allowed to share", primitive.NewObjectID(), nil, nil, "insufficient_permissions"},
+		{"unknown email", sharerID, nil, nil, "user_not_found"},
+		{"already shared", sharerID, []bson.D{target}, []bson.D{{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "is_active", Value: true}}}, "already_shared"},
+		{"would succeed", sharerID, []bson.D{target}, nil, ""},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+			fileID := primitive.NewObjectID()
+
+			mt.AddMockResponses(cursor("test.files", fileDoc(fileID, tt.owner, "a.txt")))
+			if tt.owner != sharerID {
+				mt.AddMockResponses(cursor("test.permissions"))
+			} else {
+				mt.AddMockResponses(cursor("test.users", tt.user...))
+				if tt.user != nil {
+					mt.AddMockResponses(cursor("test.shares", tt.shares...))
+				}
+			}
+
+			validation, err := service.ValidateShare(context.Background(), fileID.Hex(), "file", "t@example.com", sharerID.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if validation.Reason != tt.wantReason || validation.Valid != (tt.wantReason == "") {
+				t.Fatalf("validation = %+v, want reason %q", validation, tt.wantReason)
+			}
+			if validation.Valid && validation.UserID != targetID.Hex() {
+				t.Fatalf("user id = %s, want %s", validation.UserID, targetID.Hex())
+			}
+			if len(commands(mt, "insert")) != 0 || len(commands(mt, "update")) != 0 {
+				t.Fatal("validation must not write anything")
+			}
+		})
+	}
+}
+
+func TestShareResourceUpsert(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("upsert", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		sharerID, targetID, fileID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		file := cursor("test.files", fileDoc(fileID, sharerID, "a.txt"))
+		sharer := cursor("test.users", bson.D{{Key: "_id", Value: sharerID}, {Key: "email", Value: "s@example.com"}})
+		target := cursor("test.users", bson.D{{Key: "_id", Value: targetID}, {Key: "email", Value: "t@example.com"}})
+		existing := func(role string) bson.D {
+			return cursor("test.shares", bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "resource_id", Value: fileID.Hex()},
+				{Key: "resource_type", Value: "file"},
+				{Key: "shared_with", Value: targetID.Hex()},
+				{Key: "shared_by", Value: sharerID.Hex()},
+				{Key: "role", Value: role},
+				{Key: "is_active", Value: true},
+			})
+		}
+		request := ShareRequest{ResourceID: fileID.Hex(), ResourceType: "file", Email: "t@example.com", Upsert: true}
+
+		// First share creates the record and the grant
+		mt.AddMockResponses(
+			file, target, cursor("test.shares"),
+			file, sharer,
+			mtest.CreateSuccessResponse(),
+			target, file, cursor("test.permissions"), mtest.CreateSuccessResponse(),
+		)
+		request.Role = "viewer"
+		response, err := service.ShareResource(context.Background(), request, sharerID.Hex())
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if response.Action != ShareActionCreated || response.Role != "viewer" {
+			t.Fatalf("create: response = %+v", response)
+		}
+
+		// Sharing again at the same role changes nothing
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			file, target, existing("viewer"),
+			target, existing("viewer"),
+			file, // both users are cached since the first share
+		)
+		response, err = service.ShareResource(context.Background(), request, sharerID.Hex())
+		if err != nil {
+			t.Fatalf("re-share: %v", err)
+		}
+		if response.Action != ShareActionUnchanged || response.Role != "viewer" {
+			t.Fatalf("re-share: response = %+v", response)
+		}
+		if len(commands(mt, "insert")) != 0 || len(commands(mt, "update")) != 0 {
+			t.Fatal("re-share at the same role must not write")
+		}
+
+		// A higher role updates the grant and the share in place
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			file, target, existing("viewer"),
+			target, existing("viewer"),
+			existing("viewer"), file,
+			file, file, writeResult(1),
+			writeResult(1),
+			file,
+		)
+		request.Role = "editor"
+		response, err = service.ShareResource(context.Background(), request, sharerID.Hex())
+		if err != nil {
+			t.Fatalf("upgrade: %v", err)
+		}
+		if response.Action != ShareActionUpdated || response.Role != "editor" {
+			t.Fatalf("upgrade: response = %+v", response)
+		}
+		updates := commands(mt, "update")
+		if len(updates) != 2 || len(commands(mt, "insert")) != 0 {
+			t.Fatalf("upgrade: %d updates, want the grant and the share", len(updates))
+		}
+		for _, update := range updates {
+			if role := update.Command.Lookup("updates", "0", "u", "$set", "role").StringValue(); role != "editor" {
+				t.Fatalf("%s role = %q, want editor", update.Command.Lookup("update"), role)
+			}
+		}
+	})
+}
+
+func TestGetEffectiveAccessInheritsFromSharedAncestor(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("inherited", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		userID := primitive.NewObjectID().Hex()
+		top, sub, fileID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		share := func(id primitive.ObjectID, resourceType, role string) bson.D {
+			return bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "resource_id", Value: id.Hex()},
+				{Key: "resource_type", Value: resourceType},
+				{Key: "shared_with", Value: userID},
+				{Key: "role", Value: role},
+				{Key: "is_active", Value: true},
+			}
+		}
+		nested := append(fileDoc(fileID, primitive.NewObjectID(), "plan.txt"), bson.E{Key: "folder_id", Value: sub})
+
+		mt.AddMockResponses(
+			// The top folder is shared as editor; the file two levels down also directly as viewer
+			cursor("test.shares", share(top, "folder", "editor"), share(fileID, "file", "viewer")),
+			cursor("test.folders", folderDoc(top, "Team", "/Team", nil, time.Now())),
+			cursor("test.folders", folderDoc(sub, "Plans", "/Team/Plans", &top, time.Now())),
+			cursor("test.folders"),
+			cursor("test.files", nested),
+			cursor("test.files", nested),
+		)
+
+		items, err := service.GetEffectiveAccess(context.Background(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		byID := make(map[primitive.ObjectID]EffectiveAccessItem, len(items))
+		for _, item := range items {
+			if _, dup := byID[item.ID]; dup {
+				t.Fatalf("%s listed twice", item.ID.Hex())
+			}
+			byID[item.ID] = item
+		}
+		if len(byID) != 3 {
+			t.Fatalf("items = %+v, want the two folders and the file", items)
+		}
+		if item := byID[top]; item.Inherited || item.Role != "editor" {
+			t.Fatalf("shared folder = %+v", item)
+		}
+		for _, id := range []primitive.ObjectID{sub, fileID} {
+			item := byID[id]
+			if !item.Inherited || item.InheritedFrom != top.Hex() || item.Role != "editor" {
+				t.Fatalf("%s = %+v, want editor inherited from the shared folder", item.Name, item)
+			}
+		}
+	})
+}
+
+func TestShareDescendantFoldersBatchesWritesForLargeSubtree(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("subtree", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		root := primitive.NewObjectID()
+		targetID := primitive.NewObjectID().Hex()
+
+		// 10 children under the root and 5 grandchildren under each: 60 descendants
+		var level1, level2 []bson.D
+		for i := 0; i < 10; i++ {
+			child := primitive.NewObjectID()
+			level1 = append(level1, bson.D{{Key: "_id", Value: child}})
+			for j := 0; j < 5; j++ {
+				level2 = append(level2, bson.D{{Key: "_id", Value: primitive.NewObjectID()}})
+			}
+		}
+		// Two of them are already shared with the target
+		existing := []bson.D{
+			{{Key: "resource_id", Value: level1[0][0].Value.(primitive.ObjectID).Hex()}},
+			{{Key: "resource_id", Value: level2[7][0].Value.(primitive.ObjectID).Hex()}},
+		}
+
+		mt.AddMockResponses(
+			cursor("test.folders", level1...),
+			cursor("test.folders", level2...),
+			cursor("test.folders"),
+			cursor("test.shares", existing...),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 58}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 58}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		affected, err := service.shareDescendantFolders(context.Background(), root.Hex(), targetID, "viewer", primitive.NewObjectID().Hex(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if affected != 58 {
+			t.Fatalf("affected = %d, want 58", affected)
+		}
+
+		// One find per level, one for existing shares, then a single batch each for shares and grants
+		if n := len(mt.GetAllStartedEvents()); n != 6 {
+			t.Fatalf("%d commands, want 6", n)
+		}
+		inserts, updates := commands(mt, "insert"), commands(mt, "update")
+		if len(inserts) != 1 || len(updates) != 1 {
+			t.Fatalf("inserts = %d updates = %d, want one batch each", len(inserts), len(updates))
+		}
+		shares, _ := inserts[0].Command.Lookup("documents").Array().Values()
+		grants, _ := updates[0].Command.Lookup("updates").Array().Values()
+		if len(shares) != 58 || len(grants) != 58 {
+			t.Fatalf("batched %d shares and %d grants, want 58 each", len(shares), len(grants))
+		}
+	})
+}
+
+func TestDeclineShareRemovesResourceFromRecipient(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("decline", func(mt *mtest.T) {
+		service := NewShareService(mt.DB, NewPermissionService(mt.DB), nil)
+		shareID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+		recipientID := primitive.NewObjectID().Hex()
+
+		mt.AddMockResponses(
+			cursor("test.shares", bson.D{
+				{Key: "_id", Value: shareID},
+				{Key: "resource_id", Value: fileID.Hex()},
+				{Key: "resource_type", Value: "file"},
+				{Key: "shared_with", Value: recipientID},
+				{Key: "role", Value: "viewer"},
+				{Key: "is_active", Value: true},
+			}),
+			writeResult(1),
+			writeResult(1),
+		)
+
+		if err := service.DeclineShare(context.Background(), shareID.Hex(), recipientID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the recipient's own share can be declined
+		find := commands(mt, "find")[0].Command
+		if find.Lookup("filter", "shared_with").StringValue() != recipientID {
+			t.Fatal("share lookup is not scoped to the recipient")
+		}
+		updates := commands(mt, "update")
+		if len(updates) != 2 {
+			t.Fatalf("updates = %d, want the grant and the share", len(updates))
+		}
+		grant, record := updates[0].Command, updates[1].Command
+		if grant.Lookup("update").StringValue() != "permissions" ||
+			grant.Lookup("updates", "0", "q", "user_id").StringValue() != recipientID ||
+			grant.Lookup("updates", "0", "u", "$set", "is_active").Boolean() {
+			t.Fatalf("grant update = %v", grant)
+		}
+		if record.Lookup("update").StringValue() != "shares" ||
+			record.Lookup("updates", "0", "u", "$set", "is_active").Boolean() {
+			t.Fatalf("share update = %v", record)
+		}
+
+		// "Shared with me" only lists active shares, so the declined one is gone
+		mt.ClearEvents()
+		mt.AddMockResponses(cursor("test.shares"))
+		resources, err := service.GetSharedWithMe(context.Background(), recipientID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resources) != 0 {
+			t.Fatalf("resources = %+v, want none", resources)
+		}
+		if !commands(mt, "find")[0].Command.Lookup("filter", "is_active").Boolean() {
+			t.Fatal("shared with me must only list active shares")
+		}
+
+		// Declining again finds nothing
+		mt.AddMockResponses(cursor("test.shares"))
+		if err := service.DeclineShare(context.Background(), shareID.Hex(), recipientID); err == nil || err.Error() != "share not found" {
+			t.Fatalf("second decline: err = %v, want share not found", err)
+		}
+	})
+}
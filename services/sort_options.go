@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"phynixdrive/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// sortableFields maps the public sort names to their stored field names.
+var sortableFields = map[string]string{
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"size":       "size",
+}
+
+// SortOption is a listing order. The zero value means "not specified".
+type SortOption struct {
+	Field     string `json:"sort_field"`
+	Direction string `json:"sort_direction"`
+}
+
+var defaultSortOption = SortOption{Field: "name", Direction: SortAscending}
+
+// ParseSortOption validates a sort field and direction from a request.
+// An empty field yields the zero SortOption so the user's preference applies.
+func ParseSortOption(field, direction string) (SortOption, error) {
+	field = strings.ToLower(strings.TrimSpace(field))
+	direction = strings.ToLower(strings.TrimSpace(direction))
+
+	if field == "" {
+		if direction != "" {
+			return SortOption{}, fmt.Errorf("sort direction requires a sort field")
+		}
+		return SortOption{}, nil
+	}
+	if _, ok := sortableFields[field]; !ok {
+		return SortOption{}, fmt.Errorf("invalid sort field: %s", field)
+	}
+	if direction == "" {
+		direction = SortAscending
+	}
+	if direction != SortAscending && direction != SortDescending {
+		return SortOption{}, fmt.Errorf("invalid sort direction: %s", direction)
+	}
+
+	return SortOption{Field: field, Direction: direction}, nil
+}
+
+func (o SortOption) IsZero() bool {
+	return o.Field == ""
+}
+
+// sortDocument returns the sort document with an _id tie-breaker so paging stays stable.
+func (o SortOption) sortDocument() bson.D {
+	dir := 1
+	if o.Direction == SortDescending {
+		dir = -1
+	}
+	return bson.D{{Key: sortableFields[o.Field], Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// resolveSortOption returns the requested sort, falling back to the user's
+// stored preference and then to name ascending.
+func resolveSortOption(ctx context.Context, userCollection *mongo.Collection, userID string, requested SortOption) SortOption {
+	if !requested.IsZero() {
+		return requested
+	}
+	if userCollection == nil {
+		return defaultSortOption
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return defaultSortOption
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.M{"_id": userObjID},
+		options.FindOne().SetProjection(bson.M{"preferences": 1})).Decode(&user)
+	if err != nil || user.Preferences == nil {
+		return defaultSortOption
+	}
+
+	stored, err := ParseSortOption(user.Preferences.SortField, user.Preferences.SortDirection)
+	if err != nil || stored.IsZero() {
+		return defaultSortOption
+	}
+	return stored
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSortDocumentBreaksTiesByID(t *testing.T) {
+	for field := range sortableFields {
+		for _, direction := range []string{SortAscending, SortDescending} {
+			doc := SortOption{Field: field, Direction: direction}.sortDocument()
+			if len(doc) != 2 || doc[1].Key != "_id" || doc[1].Value != doc[0].Value {
+				t.Errorf("%s %s: sort = %v, want an _id tie-breaker in the same direction", field, direction, doc)
+			}
+		}
+	}
+}
+
+func TestListingWithEqualNamesPagesInIDOrder(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("ties", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		mt.AddMockResponses(cursor("test.folders"))
+
+		if _, err := service.ListRootFoldersWithCounts(primitive.NewObjectID().Hex(), SortOption{Field: "name", Direction: SortAscending}); err != nil {
+			t.Fatalf("ListRootFoldersWithCounts: %v", err)
+		}
+
+		// Two folders both called "Reports" always come back in _id order, so a page
+		// boundary between them can't repeat or skip one
+		elems, err := commands(mt, "find")[0].Command.Lookup("sort").Document().Elements()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(elems) != 2 || elems[0].Key() != "name" || elems[1].Key() != "_id" || elems[1].Value().Int32() != 1 {
+			t.Fatalf("sort = %v, want name then _id ascending", elems)
+		}
+	})
+}
+
+func TestStoredPreferenceSetsDefaultListingOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested SortOption
+		stored    bson.D // nil when the user has no preference
+		wantKey   string
+		wantDir   int32
+	}{
+		{"no preference", SortOption{}, nil, "name", 1},
+		{"stored preference", SortOption{}, bson.D{{Key: "sort_field", Value: "size"}, {Key: "sort_direction", Value: "desc"}}, "size", -1},
+		{"request wins", SortOption{Field: "updated_at", Direction: SortAscending}, bson.D{{Key: "sort_field", Value: "size"}, {Key: "sort_direction", Value: "desc"}}, "updated_at", 1},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewFolderService(mt.DB, nil, nil)
+			userID := primitive.NewObjectID()
+
+			user := bson.D{{Key: "_id", Value: userID}}
+			if tt.stored != nil {
+				user = append(user, bson.E{Key: "preferences", Value: tt.stored})
+			}
+			if tt.requested.IsZero() {
+				mt.AddMockResponses(cursor("test.users", user))
+			}
+			mt.AddMockResponses(cursor("test.folders"))
+
+			if _, err := service.ListRootFoldersWithCounts(userID.Hex(), tt.requested); err != nil {
+				t.Fatalf("ListRootFoldersWithCounts: %v", err)
+			}
+
+			var sort bson.Raw
+			for _, find := range commands(mt, "find") {
+				if find.Command.Lookup("find").StringValue() == "folders" {
+					sort = find.Command.Lookup("sort").Document()
+				}
+			}
+			elems, err := sort.Elements()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elems[0].Key() != tt.wantKey || elems[0].Value().Int32() != tt.wantDir {
+				t.Fatalf("sort = %v, want %s %d", elems, tt.wantKey, tt.wantDir)
+			}
+		})
+	}
+}
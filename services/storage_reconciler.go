@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"phynixdrive/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StorageReconciler rewrites users' used_storage from the files they actually own.
+// Unlike StorageService.RecalculateUsage it is not rate limited and is meant for operators.
+type StorageReconciler struct {
+	fileCollection *mongo.Collection
+	userCollection *mongo.Collection
+}
+
+// StorageCorrection records one user whose stored usage had drifted
+type StorageCorrection struct {
+	UserID string `json:"user_id"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+	Delta  int64  `json:"delta"`
+}
+
+// StorageReconcileReport summarizes a ReconcileAll run
+type StorageReconcileReport struct {
+	UsersChecked   int                 `json:"users_checked"`
+	UsersCorrected int                 `json:"users_corrected"`
+	UsersFailed    int                 `json:"users_failed"`
+	TotalDelta     int64               `json:"total_delta"`
+	Corrections    []StorageCorrection `json:"corrections"`
+}
+
+func NewStorageReconciler(db *mongo.Database) *StorageReconciler {
+	return &StorageReconciler{
+		fileCollection: db.Collection("files"),
+		userCollection: db.Collection("users"),
+	}
+}
+
+// ReconcileUser recomputes the user's usage from their non-deleted files and stores it
+func (r *StorageReconciler) ReconcileUser(userID string) (before, after int64, err error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	ctx := context.Background()
+
+	var user models.User
+	err = r.userCollection.FindOne(ctx, bson.M{"_id": userObjID},
+		options.FindOne().SetProjection(bson.M{"used_storage": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return 0, 0, fmt.Errorf("user not found")
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("database error: %w", err)
+	}
+
+	return r.reconcile(ctx, userObjID, user.UsedStorage)
+}
+
+// reconcileAttempts bounds how often reconcile retries when uploads keep moving the counter
+const reconcileAttempts = 3
+
+// reconcile stores the aggregated usage only if used_storage still holds the value it started
+// from. An upload or delete that lands in between moves the counter, so the sum is taken again
+// rather than overwriting its increment.
+func (r *StorageReconciler) reconcile(ctx context.Context, userObjID primitive.ObjectID, before int64) (int64, int64, error) {
+	current := before
+	for attempt := 0; attempt < reconcileAttempts; attempt++ {
+		after, err := sumStoredBytes(ctx, r.fileCollection, bson.M{"owner_id": userObjID, "deleted_at": nil})
+		if err != nil {
+			return 0, 0, err
+		}
+		if after == current {
+			return before, after, nil
+		}
+
+		result, err := r.userCollection.UpdateOne(ctx, bson.M{"_id": userObjID, "used_storage": current}, bson.M{
+			"$set": bson.M{"used_storage": after, "updated_at": time.Now()},
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to update storage usage: %w", err)
+		}
+		if result.MatchedCount > 0 {
+			return before, after, nil
+		}
+
+		var user models.User
+		err = r.userCollection.FindOne(ctx, bson.M{"_id": userObjID},
+			options.FindOne().SetProjection(bson.M{"used_storage": 1})).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			return 0, 0, fmt.Errorf("user not found")
+		} else if err != nil {
+			return 0, 0, fmt.Errorf("database error: %w", err)
+		}
+		current = user.UsedStorage
+	}
+	return 0, 0, fmt.Errorf("storage usage kept changing during reconciliation")
+}
+
+// ReconcileAll reconciles every user and reports those whose usage was corrected
+func (r *StorageReconciler) ReconcileAll() (*StorageReconcileReport, error) {
+	ctx := context.Background()
+
+	cursor, err := r.userCollection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"used_storage": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	report := &StorageReconcileReport{Corrections: []StorageCorrection{}}
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, fmt.Errorf("failed to decode user: %w", err)
+		}
+
+		report.UsersChecked++
+		before, after, err := r.reconcile(ctx, user.ID, user.UsedStorage)
+		if err != nil {
+			// One user's failure shouldn't leave everyone after them unreconciled
+			log.Printf("Failed to reconcile storage for user %s: %v", user.ID.Hex(), err)
+			report.UsersFailed++
+			continue
+		}
+		if before == after {
+			continue
+		}
+
+		report.UsersCorrected++
+		report.TotalDelta += after - before
+		report.Corrections = append(report.Corrections, StorageCorrection{
+			UserID: user.ID.Hex(),
+			Before: before,
+			After:  after,
+			Delta:  after - before,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return report, nil
+}
+
+// StartStorageReconcileJob periodically reconciles every user's stored usage
+func StartStorageReconcileJob(reconciler *StorageReconciler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			report, err := reconciler.ReconcileAll()
+			if err != nil {
+				log.Printf("Storage reconcile job failed: %v", err)
+				continue
+			}
+			if report.UsersCorrected > 0 || report.UsersFailed > 0 {
+				log.Printf("Storage reconcile job corrected %d and failed %d of %d users (total delta %d bytes)",
+					report.UsersCorrected, report.UsersFailed, report.UsersChecked, report.TotalDelta)
+			}
+		}
+	}()
+}
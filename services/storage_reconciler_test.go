@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func usageDoc(id primitive.ObjectID, used int64) bson.D {
+	return bson.D{{Key: "_id", Value: id}, {Key: "used_storage", Value: used}}
+}
+
+func totalDoc(total int64) bson.D {
+	return bson.D{{Key: "total", Value: total}}
+}
+
+func TestReconcileUserRetriesWhenUsageMovesConcurrently(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("concurrent", func(mt *mtest.T) {
+		reconciler := NewStorageReconciler(mt.DB)
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.users", usageDoc(userID, 100)),
+			cursor("test.files", totalDoc(110)),
+			writeResult(0), // an upload bumped used_storage in between
+			cursor("test.users", usageDoc(userID, 105)),
+			cursor("test.files", totalDoc(115)),
+			writeResult(1),
+		)
+
+		before, after, err := reconciler.ReconcileUser(userID.Hex())
+		if err != nil {
+			t.Fatalf("ReconcileUser: %v", err)
+		}
+		if before != 100 || after != 115 {
+			t.Fatalf("before=%d after=%d, want 100 and 115", before, after)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 2 {
+			t.Fatalf("got %d updates, want 2", len(updates))
+		}
+		for i, want := range []int64{100, 105} {
+			guard := updates[i].Command.Lookup("updates", "0", "q", "used_storage").AsInt64()
+			if guard != want {
+				t.Fatalf("update %d guarded on used_storage=%d, want %d", i, guard, want)
+			}
+		}
+	})
+}
+
+func TestReconcileAllContinuesPastFailingUser(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("continue", func(mt *mtest.T) {
+		reconciler := NewStorageReconciler(mt.DB)
+		failing, healthy := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.users", usageDoc(failing, 100), usageDoc(healthy, 50)),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}),
+			cursor("test.files", totalDoc(60)),
+			writeResult(1),
+		)
+
+		report, err := reconciler.ReconcileAll()
+		if err != nil {
+			t.Fatalf("ReconcileAll: %v", err)
+		}
+		if report.UsersChecked != 2 || report.UsersFailed != 1 || report.UsersCorrected != 1 {
+			t.Fatalf("report = %+v", report)
+		}
+		if report.Corrections[0].UserID != healthy.Hex() || report.Corrections[0].Delta != 10 {
+			t.Fatalf("corrections = %+v", report.Corrections)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"phynixdrive/config"
+	"phynixdrive/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StorageService reconciles the used_storage counter on users with the files they own
+type StorageService struct {
+	fileCollection *mongo.Collection
+	userCollection *mongo.Collection
+	reconciler     *StorageReconciler
+
+	recalcMu       sync.Mutex
+	lastRecalc     map[string]time.Time // last successful recalculation per user
+	recalcInFlight map[string]bool
+}
+
+// UsageRecalculation reports the counter before and after a reconciliation
+type UsageRecalculation struct {
+	PreviousUsage  int64     `json:"previous_usage"`
+	UsedStorage    int64     `json:"used_storage"`
+	Corrected      bool      `json:"corrected"`
+	RecalculatedAt time.Time `json:"recalculated_at"`
+}
+
+func NewStorageService(db *mongo.Database) *StorageService {
+	return &StorageService{
+		fileCollection: db.Collection("files"),
+		userCollection: db.Collection("users"),
+		reconciler:     NewStorageReconciler(db),
+		lastRecalc:     make(map[string]time.Time),
+		recalcInFlight: make(map[string]bool),
+	}
+}
+
+func usageRecalcInterval() time.Duration {
+	if config.AppConfig != nil && config.AppConfig.UsageRecalcInterval > 0 {
+		return config.AppConfig.UsageRecalcInterval
+	}
+	return 10 * time.Minute
+}
+
+// NextRecalculationIn returns how long the user must wait before recalculating again
+func (s *StorageService) NextRecalculationIn(userID string) time.Duration {
+	s.recalcMu.Lock()
+	defer s.recalcMu.Unlock()
+
+	last, ok := s.lastRecalc[userID]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(last.Add(usageRecalcInterval()))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// CalculateUsage sums the size of the user's live files plus their retained versions,
+// matching what uploads and content replacement add to used_storage
+func (s *StorageService) CalculateUsage(ctx context.Context, userObjID primitive.ObjectID) (int64, error) {
+	return sumStoredBytes(ctx, s.fileCollection, bson.M{"owner_id": userObjID, "deleted_at": nil})
+}
+
+// sumStoredBytes totals storedBytes over the files matching filter
+func sumStoredBytes(ctx context.Context, fileCollection *mongo.Collection, filter bson.M) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$project", Value: bson.M{
+			"bytes": bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$size", 0}},
+				bson.M{"$sum": bson.M{"$ifNull": bson.A{"$versions.size", bson.A{}}}},
+			}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$bytes"}}}},
+	}
+
+	cursor, err := fileCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total int64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, fmt.Errorf("failed to decode usage: %w", err)
+		}
+	}
+	return result.Total, nil
+}
+
+// RecalculateUsage recomputes the user's storage usage and stores it if it drifted.
+// Each user may only do this once per USAGE_RECALC_INTERVAL; a failed attempt doesn't count,
+// but only one may run at a time.
+func (s *StorageService) RecalculateUsage(userID string) (*UsageRecalculation, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	s.recalcMu.Lock()
+	if last, ok := s.lastRecalc[userID]; (ok && time.Since(last) < usageRecalcInterval()) || s.recalcInFlight[userID] {
+		s.recalcMu.Unlock()
+		return nil, fmt.Errorf("usage recalculation rate limited")
+	}
+	s.recalcInFlight[userID] = true
+	s.recalcMu.Unlock()
+
+	result, err := s.recalculate(userObjID)
+
+	s.recalcMu.Lock()
+	delete(s.recalcInFlight, userID)
+	if err == nil {
+		s.lastRecalc[userID] = time.Now()
+	}
+	s.recalcMu.Unlock()
+
+	return result, err
+}
+
+// recalculate corrects the counter through the reconciler, whose compare-and-set keeps an
+// upload or delete landing mid-recalculation from being overwritten
+func (s *StorageService) recalculate(userObjID primitive.ObjectID) (*UsageRecalculation, error) {
+	ctx := context.Background()
+
+	var user models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"_id": userObjID},
+		options.FindOne().SetProjection(bson.M{"used_storage": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	before, after, err := s.reconciler.reconcile(ctx, userObjID, user.UsedStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UsageRecalculation{
+		PreviousUsage:  before,
+		UsedStorage:    after,
+		Corrected:      before != after,
+		RecalculatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRecalculateUsageOnlyRateLimitsAfterSuccess(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("rate limit", func(mt *mtest.T) {
+		service := NewStorageService(mt.DB)
+		userID := primitive.NewObjectID()
+
+		// The first attempt fails on the database and must not use up the interval
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		if _, err := service.RecalculateUsage(userID.Hex()); err == nil {
+			t.Fatal("expected the database error")
+		}
+		if wait := service.NextRecalculationIn(userID.Hex()); wait != 0 {
+			t.Fatalf("a failed recalculation started a %v wait", wait)
+		}
+
+		mt.AddMockResponses(
+			cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "used_storage", Value: int64(10)}}),
+			cursor("test.files", bson.D{{Key: "total", Value: int64(10)}}),
+		)
+		result, err := service.RecalculateUsage(userID.Hex())
+		if err != nil {
+			t.Fatalf("retry: %v", err)
+		}
+		if result.Corrected {
+			t.Fatal("usage was already right")
+		}
+
+		if _, err := service.RecalculateUsage(userID.Hex()); err == nil || err.Error() != "usage recalculation rate limited" {
+			t.Fatalf("err = %v, want rate limited", err)
+		}
+	})
+}
+
+func TestRecalculateUsageFixesWrongCounter(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("drifted", func(mt *mtest.T) {
+		service := NewStorageService(mt.DB)
+		mt.ClearEvents()
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "used_storage", Value: int64(40)}}),
+			cursor("test.files", bson.D{{Key: "total", Value: int64(25)}}),
+			writeResult(1),
+		)
+
+		result, err := service.RecalculateUsage(userID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Corrected || result.PreviousUsage != 40 || result.UsedStorage != 25 {
+			t.Fatalf("result = %+v, want 40 corrected to 25", result)
+		}
+
+		updates := commands(mt, "update")
+		if len(updates) != 1 {
+			t.Fatalf("got %d updates, want 1", len(updates))
+		}
+		update := updates[0].Command.Lookup("updates", "0").Document()
+		if guard := update.Lookup("q", "used_storage").AsInt64(); guard != 40 {
+			t.Fatalf("update guarded by used_storage %d, want the 40 that was read", guard)
+		}
+		if set := update.Lookup("u", "$set", "used_storage").AsInt64(); set != 25 {
+			t.Fatalf("used_storage set to %d, want 25", set)
+		}
+	})
+
+	mt.Run("upload lands mid-recalculation", func(mt *mtest.T) {
+		service := NewStorageService(mt.DB)
+		mt.ClearEvents()
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "used_storage", Value: int64(40)}}),
+			cursor("test.files", bson.D{{Key: "total", Value: int64(25)}}),
+			writeResult(0), // a 10 byte upload moved the counter to 50
+			cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "used_storage", Value: int64(50)}}),
+			cursor("test.files", bson.D{{Key: "total", Value: int64(35)}}),
+			writeResult(1),
+		)
+
+		result, err := service.RecalculateUsage(userID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Corrected || result.UsedStorage != 35 {
+			t.Fatalf("result = %+v, want the upload kept in the corrected usage", result)
+		}
+		updates := commands(mt, "update")
+		if len(updates) != 2 || updates[1].Command.Lookup("updates", "0", "q", "used_storage").AsInt64() != 50 {
+			t.Fatal("the retry was not guarded by the counter after the upload")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TokenRevocationService invalidates JWTs before they expire. A single token is revoked by
+// its jti; every token of a user is revoked by bumping the user's token version.
+type TokenRevocationService struct {
+	userCollection    *mongo.Collection
+	revokedCollection *mongo.Collection
+}
+
+// RevokedToken is a denylisted jti, kept only until the token would have expired anyway
+type RevokedToken struct {
+	JTI       string    `bson:"jti"`
+	UserID    string    `bson:"user_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	RevokedAt time.Time `bson:"revoked_at"`
+}
+
+func NewTokenRevocationService(db *mongo.Database) *TokenRevocationService {
+	service := &TokenRevocationService{
+		userCollection:    db.Collection("users"),
+		revokedCollection: db.Collection("revoked_tokens"),
+	}
+	service.createIndexes()
+	return service
+}
+
+func (s *TokenRevocationService) createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.revokedCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Entries are useless once the token has expired
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create revoked token indexes: %v", err)
+	}
+}
+
+// RevokeToken denylists one token until its expiry
+func (s *TokenRevocationService) RevokeToken(ctx context.Context, claims *utils.Claims) error {
+	if claims.ID == "" {
+		return fmt.Errorf("token has no jti")
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	_, err := s.revokedCollection.InsertOne(ctx, RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: expiresAt,
+		RevokedAt: time.Now(),
+	})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllTokens invalidates every token issued to the user so far
+func (s *TokenRevocationService) RevokeAllTokens(ctx context.Context, userID string) error {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	_, err = s.userCollection.UpdateOne(ctx, bson.M{"_id": userObjID}, bson.M{
+		"$inc": bson.M{"token_version": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether the token was revoked individually or by a token version bump
+func (s *TokenRevocationService) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	if claims.ID != "" {
+		err := s.revokedCollection.FindOne(ctx, bson.M{"jti": claims.ID}).Err()
+		if err == nil {
+			return true, nil
+		} else if err != mongo.ErrNoDocuments {
+			return false, err
+		}
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return true, nil
+	}
+
+	var user models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": userObjID},
+		options.FindOne().SetProjection(bson.M{"token_version": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return claims.TokenVersion < user.TokenVersion, nil
+}
@@ -2,9 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"phynixdrive/config"
 	"phynixdrive/models"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,13 +22,41 @@ type TrashService struct {
 	fileCollection   *mongo.Collection
 	folderCollection *mongo.Collection
 	userCollection   *mongo.Collection
+	orphanCollection *mongo.Collection
+	purgeCollection  *mongo.Collection
 	b2Service        *B2Service
+
+	permissionService *PermissionService
+	retentionDays     int
+}
+
+// purgeConfirmation is a single-use token that must be presented to purge all trash. It is
+// stored rather than held in memory so any instance can redeem it and restarts don't drop it.
+type purgeConfirmation struct {
+	Token     string    `bson:"_id"`
+	UserID    string    `bson:"user_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	CreatedAt time.Time `bson:"created_at"`
 }
 
-// RestoreItem represents an item to be restored
+const defaultPurgeConfirmationTTL = 2 * time.Minute
+
+const defaultTrashRetentionDays = 30
+
+// TrashRetentionDays is how long items stay in trash before they are purged automatically
+func TrashRetentionDays() int {
+	if config.AppConfig != nil && config.AppConfig.TrashRetentionDays > 0 {
+		return config.AppConfig.TrashRetentionDays
+	}
+	return defaultTrashRetentionDays
+}
+
+// RestoreItem represents an item to be restored. DestinationFolderID optionally restores the
+// item into another folder ("root" for the top level) instead of its original location.
 type RestoreItem struct {
-	ID   string `json:"id"`
-	Type string `json:"type"`
+	ID                  string `json:"id"`
+	Type                string `json:"type"`
+	DestinationFolderID string `json:"destination_folder_id,omitempty"`
 }
 
 type RestoreResult struct {
@@ -33,13 +66,134 @@ type RestoreResult struct {
 	Error   string `json:"error,omitempty"`
 }
 
+const rootDestination = "root"
+
+// Soft-delete convention: deleting a file or folder sets is_deleted: true and deleted_at
+// together, and restoring clears both. Folder queries have always keyed off is_deleted and
+// file queries off deleted_at, so trash queries use the same field for each collection.
+// deleted_at also dates the item for the auto-purge after the retention period.
+
+// trashedFiles adds the file trash condition to filter
+func trashedFiles(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$ne": nil}
+	return filter
+}
+
+// trashedFolders adds the folder trash condition to filter
+func trashedFolders(filter bson.M) bson.M {
+	filter["is_deleted"] = true
+	return filter
+}
+
+const maxDeleteReasonLength = 500
+
+// NormalizeDeleteReason trims an optional reason given when moving an item to trash
+func NormalizeDeleteReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxDeleteReasonLength {
+		return "", fmt.Errorf("invalid reason: must be at most %d characters", maxDeleteReasonLength)
+	}
+	return reason, nil
+}
+
+// trashFields is the $set that moves a file or folder to trash, recording who did it and why
+func trashFields(now time.Time, userID, reason string) bson.M {
+	set := bson.M{
+		"is_deleted": true,
+		"deleted_at": now,
+		"updated_at": now,
+	}
+	if deletedBy, err := primitive.ObjectIDFromHex(userID); err == nil {
+		set["deleted_by"] = deletedBy
+	}
+	if reason != "" {
+		set["delete_reason"] = reason
+	}
+	return set
+}
+
+// untrashFields is the $unset that clears trash state on restore
+func untrashFields() bson.M {
+	return bson.M{"deleted_at": "", "deleted_by": "", "delete_reason": ""}
+}
+
 func NewTrashService(db *mongo.Database, b2Service *B2Service) *TrashService {
-	return &TrashService{
+	service := &TrashService{
 		fileCollection:   db.Collection("files"),
 		folderCollection: db.Collection("folders"),
 		userCollection:   db.Collection("users"),
+		orphanCollection: db.Collection("orphaned_objects"),
+		purgeCollection:  db.Collection("purge_confirmations"),
 		b2Service:        b2Service,
+
+		permissionService: NewPermissionService(db),
+		retentionDays:     TrashRetentionDays(),
+	}
+	service.createIndexes()
+	return service
+}
+
+func (s *TrashService) createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Unused confirmations are dropped once they expire
+	_, err := s.purgeCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create purge confirmation indexes: %v", err)
+	}
+}
+
+// RequestPurgeConfirmation issues a short-lived token the user must send back to purge all trash
+func (s *TrashService) RequestPurgeConfirmation(userID string) (string, time.Time, error) {
+	ttl := defaultPurgeConfirmationTTL
+	if config.AppConfig != nil && config.AppConfig.PurgeConfirmationTTL > 0 {
+		ttl = config.AppConfig.PurgeConfirmationTTL
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate confirmation token: %w", err)
 	}
+	token := hex.EncodeToString(buf)
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	_, err := s.purgeCollection.InsertOne(context.Background(), purgeConfirmation{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store confirmation token: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// ConsumePurgeConfirmation checks and invalidates a purge token issued to userID. Deleting it
+// is what redeems it, so two concurrent purges cannot both use the same token.
+func (s *TrashService) ConsumePurgeConfirmation(userID, token string) error {
+	var pc purgeConfirmation
+	err := s.purgeCollection.FindOneAndDelete(context.Background(), bson.M{
+		"_id":     token,
+		"user_id": userID,
+	}).Decode(&pc)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("invalid confirmation token")
+	} else if err != nil {
+		return fmt.Errorf("failed to check confirmation token: %w", err)
+	}
+
+	// The TTL monitor only sweeps periodically, so an expired token may still be stored
+	if time.Now().After(pc.ExpiresAt) {
+		return fmt.Errorf("confirmation token expired")
+	}
+	return nil
 }
 
 func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int) ([]models.TrashItem, error) {
@@ -52,21 +206,15 @@ func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int)
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	// Build filters
-	baseFilter := bson.M{
-		"owner_id":   userObjID,
-		"deleted_at": bson.M{"$ne": nil},
-	}
-
 	// Set up find options with limit and offset
 	findOptions := options.Find().
-		SetSort(bson.M{"deleted_at": -1}).
+		SetSort(bson.D{{Key: "deleted_at", Value: -1}, {Key: "_id", Value: -1}}).
 		SetLimit(int64(limit)).
 		SetSkip(int64(offset))
 
 	// Get deleted files if itemType is empty or "file"
 	if itemType == "" || itemType == "file" {
-		fileCursor, err := s.fileCollection.Find(ctx, baseFilter, findOptions)
+		fileCursor, err := s.fileCollection.Find(ctx, trashedFiles(bson.M{"owner_id": userObjID}), findOptions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch deleted files: %w", err)
 		}
@@ -81,7 +229,7 @@ func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int)
 			var deletedAt, autoPurgeAt time.Time
 			if file.DeletedAt != nil {
 				deletedAt = *file.DeletedAt
-				autoPurgeAt = deletedAt.AddDate(0, 0, 30)
+				autoPurgeAt = deletedAt.AddDate(0, 0, s.retentionDays)
 			}
 
 			trashItems = append(trashItems, models.TrashItem{
@@ -93,13 +241,15 @@ func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int)
 				Size:         file.Size,
 				DeletedAt:    deletedAt,
 				AutoPurgeAt:  autoPurgeAt,
+				DeletedBy:    file.DeletedBy,
+				DeleteReason: file.DeleteReason,
 			})
 		}
 	}
 
 	// Get deleted folders if itemType is empty or "folder"
 	if itemType == "" || itemType == "folder" {
-		folderCursor, err := s.folderCollection.Find(ctx, baseFilter, findOptions)
+		folderCursor, err := s.folderCollection.Find(ctx, trashedFolders(bson.M{"owner_id": userObjID}), findOptions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch deleted folders: %w", err)
 		}
@@ -114,7 +264,7 @@ func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int)
 			var deletedAt, autoPurgeAt time.Time
 			if folder.DeletedAt != nil {
 				deletedAt = *folder.DeletedAt
-				autoPurgeAt = deletedAt.AddDate(0, 0, 30)
+				autoPurgeAt = deletedAt.AddDate(0, 0, s.retentionDays)
 			}
 
 			trashItems = append(trashItems, models.TrashItem{
@@ -126,13 +276,92 @@ func (s *TrashService) GetTrashItems(userID, itemType string, limit, offset int)
 				Size:         0,
 				DeletedAt:    deletedAt,
 				AutoPurgeAt:  autoPurgeAt,
+				DeletedBy:    folder.DeletedBy,
+				DeleteReason: folder.DeleteReason,
 			})
 		}
 	}
 
+	s.resolveDeleterNames(ctx, trashItems)
+
 	return trashItems, nil
 }
 
+// resolveDeleterNames fills in who deleted each item, which matters in shared folders where
+// several editors can move things to the owner's trash. Unknown users are left blank.
+func (s *TrashService) resolveDeleterNames(ctx context.Context, items []models.TrashItem) {
+	for i := range items {
+		if items[i].DeletedBy == nil {
+			continue
+		}
+		if user, err := lookupUser(ctx, s.userCollection, *items[i].DeletedBy); err == nil {
+			items[i].DeletedByName = user.Name
+		}
+	}
+}
+
+// TrashSummary tells a user what emptying their trash would remove
+type TrashSummary struct {
+	FileCount        int64      `json:"file_count"`
+	FolderCount      int64      `json:"folder_count"`
+	ReclaimableBytes int64      `json:"reclaimable_bytes"`
+	OldestDeletedAt  *time.Time `json:"oldest_deleted_at,omitempty"`
+	NextExpiresAt    *time.Time `json:"next_expires_at,omitempty"`
+}
+
+// GetTrashSummary counts the user's trashed items and the bytes a purge would reclaim.
+// Folders have no size of their own; deleting a folder trashes every file beneath it,
+// so summing the trashed files already accounts for the folders' contents.
+func (s *TrashService) GetTrashSummary(userID string) (*TrashSummary, error) {
+	ctx := context.Background()
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	fileFilter := trashedFiles(bson.M{"owner_id": userObjID})
+	folderFilter := trashedFolders(bson.M{"owner_id": userObjID})
+
+	summary := &TrashSummary{}
+	if summary.FileCount, err = s.fileCollection.CountDocuments(ctx, fileFilter); err != nil {
+		return nil, fmt.Errorf("failed to count trashed files: %w", err)
+	}
+	if summary.FolderCount, err = s.folderCollection.CountDocuments(ctx, folderFilter); err != nil {
+		return nil, fmt.Errorf("failed to count trashed folders: %w", err)
+	}
+	if summary.ReclaimableBytes, err = sumStoredBytes(ctx, s.fileCollection, fileFilter); err != nil {
+		return nil, err
+	}
+
+	oldest := options.FindOne().
+		SetSort(bson.D{{Key: "deleted_at", Value: 1}}).
+		SetProjection(bson.M{"deleted_at": 1})
+	for _, source := range []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{{s.fileCollection, fileFilter}, {s.folderCollection, folderFilter}} {
+		var item struct {
+			DeletedAt *time.Time `bson:"deleted_at"`
+		}
+		err := source.collection.FindOne(ctx, source.filter, oldest).Decode(&item)
+		if err == mongo.ErrNoDocuments {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to find oldest trash item: %w", err)
+		}
+		if item.DeletedAt != nil && (summary.OldestDeletedAt == nil || item.DeletedAt.Before(*summary.OldestDeletedAt)) {
+			summary.OldestDeletedAt = item.DeletedAt
+		}
+	}
+	if summary.OldestDeletedAt != nil {
+		expiresAt := summary.OldestDeletedAt.AddDate(0, 0, s.retentionDays)
+		summary.NextExpiresAt = &expiresAt
+	}
+
+	return summary, nil
+}
+
 func (s *TrashService) RestoreFile(fileID, userID string) error {
 	ctx := context.Background()
 
@@ -167,7 +396,7 @@ func (s *TrashService) RestoreFile(fileID, userID string) error {
 		err = s.folderCollection.FindOne(ctx, bson.M{
 			"_id":        file.ParentID,
 			"owner_id":   userObjID,
-			"deleted_at": nil,
+			"is_deleted": false,
 		}).Decode(&parentFolder)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
@@ -178,23 +407,40 @@ func (s *TrashService) RestoreFile(fileID, userID string) error {
 	}
 
 	// Restore the file
-	update := bson.M{
-		"$unset": bson.M{"deleted_at": ""},
-	}
+	return s.restoreFileDocument(ctx, &file, userObjID, bson.M{
+		"$set":   bson.M{"is_deleted": false},
+		"$unset": untrashFields(),
+	})
+}
 
-	result, err := s.fileCollection.UpdateOne(ctx, bson.M{
-		"_id":      fileObjID,
-		"owner_id": userObjID,
-	}, update)
+// restoreFileDocument applies update to a trashed file, charges its storage back and resumes
+// its shares. Like DeleteFile, the three commit together, so a failure never leaves a live file
+// uncounted or still unshared.
+func (s *TrashService) restoreFileDocument(ctx context.Context, file *models.File, userObjID primitive.ObjectID, update bson.M) error {
+	session, err := s.fileCollection.Database().Client().StartSession()
 	if err != nil {
-		return fmt.Errorf("failed to restore file: %w", err)
+		return fmt.Errorf("failed to start session: %w", err)
 	}
+	defer session.EndSession(ctx)
 
-	if result.ModifiedCount == 0 {
-		return fmt.Errorf("file not found or already restored")
-	}
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := s.fileCollection.UpdateOne(sc, trashedFiles(bson.M{
+			"_id":      file.ID,
+			"owner_id": userObjID,
+		}), update)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore file: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			return nil, fmt.Errorf("file not found or already restored")
+		}
 
-	return nil
+		if err := s.chargeStorage(sc, userObjID, storedBytes(file)); err != nil {
+			return nil, err
+		}
+		return nil, s.permissionService.ResumeResourcePermissions(sc, []string{file.ID.Hex()})
+	})
+	return err
 }
 
 func (s *TrashService) RestoreFolder(folderID, userID string) error {
@@ -216,7 +462,7 @@ func (s *TrashService) RestoreFolder(folderID, userID string) error {
 	err = s.folderCollection.FindOne(ctx, bson.M{
 		"_id":        folderObjID,
 		"owner_id":   userObjID,
-		"deleted_at": bson.M{"$ne": nil},
+		"is_deleted": true,
 	}).Decode(&folder)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -231,7 +477,7 @@ func (s *TrashService) RestoreFolder(folderID, userID string) error {
 		err = s.folderCollection.FindOne(ctx, bson.M{
 			"_id":        folder.ParentID,
 			"owner_id":   userObjID,
-			"deleted_at": nil,
+			"is_deleted": false,
 		}).Decode(&parentFolder)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
@@ -241,6 +487,11 @@ func (s *TrashService) RestoreFolder(folderID, userID string) error {
 		}
 	}
 
+	subtreeIDs, err := subtreeResourceIDs(ctx, s.folderCollection, s.fileCollection, &folder, bson.M{"deleted_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return fmt.Errorf("failed to collect folder contents: %w", err)
+	}
+
 	// Start a session for transaction
 	session, err := s.folderCollection.Database().Client().StartSession()
 	if err != nil {
@@ -252,7 +503,8 @@ func (s *TrashService) RestoreFolder(folderID, userID string) error {
 	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
 		// Restore the folder
 		update := bson.M{
-			"$unset": bson.M{"deleted_at": ""},
+			"$set":   bson.M{"is_deleted": false},
+			"$unset": untrashFields(),
 		}
 
 		result, err := s.folderCollection.UpdateOne(sc, bson.M{
@@ -268,26 +520,36 @@ func (s *TrashService) RestoreFolder(folderID, userID string) error {
 		}
 
 		// Restore all child folders recursively
-		_, err = s.folderCollection.UpdateMany(sc, bson.M{
-			"path":     bson.M{"$regex": "^" + folder.Path + "/"},
+		_, err = s.folderCollection.UpdateMany(sc, trashedFolders(bson.M{
+			"path":     underPath(folder.Path),
 			"owner_id": userObjID,
-		}, update)
+		}), update)
 		if err != nil {
 			return nil, fmt.Errorf("failed to restore child folders: %w", err)
 		}
 
 		// Restore all files in this folder and subfolders
-		_, err = s.fileCollection.UpdateMany(sc, bson.M{
-			"relative_path": bson.M{"$regex": "^" + folder.Path + "/"},
+		underFolder := underPath(folder.Path)
+		restored, err := sumStoredBytes(sc, s.fileCollection, trashedFiles(bson.M{
+			"relative_path": underFolder,
 			"owner_id":      userObjID,
-		}, update)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		_, err = s.fileCollection.UpdateMany(sc, trashedFiles(bson.M{
+			"relative_path": underFolder,
+			"owner_id":      userObjID,
+		}), update)
 		if err != nil {
 			return nil, fmt.Errorf("failed to restore files in folder: %w", err)
 		}
 
-		return nil, nil
+		if err := s.chargeStorage(sc, userObjID, restored); err != nil {
+			return nil, err
+		}
+		return nil, s.permissionService.ResumeResourcePermissions(sc, subtreeIDs)
 	})
-
 	return err
 }
 
@@ -300,26 +562,29 @@ func (s *TrashService) RestoreMultipleItems(userID string, items []RestoreItem)
 			Type: item.Type,
 		}
 
+		var err error
 		switch item.Type {
 		case "file":
-			err := s.RestoreFile(item.ID, userID)
-			if err != nil {
-				result.Success = false
-				result.Error = err.Error()
+			if item.DestinationFolderID != "" {
+				err = s.RestoreFileTo(item.ID, userID, item.DestinationFolderID)
 			} else {
-				result.Success = true
+				err = s.RestoreFile(item.ID, userID)
 			}
 		case "folder":
-			err := s.RestoreFolder(item.ID, userID)
-			if err != nil {
-				result.Success = false
-				result.Error = err.Error()
+			if item.DestinationFolderID != "" {
+				err = s.RestoreFolderTo(item.ID, userID, item.DestinationFolderID)
 			} else {
-				result.Success = true
+				err = s.RestoreFolder(item.ID, userID)
 			}
 		default:
+			err = fmt.Errorf("Invalid item type")
+		}
+
+		if err != nil {
 			result.Success = false
-			result.Error = "Invalid item type"
+			result.Error = err.Error()
+		} else {
+			result.Success = true
 		}
 
 		results = append(results, result)
@@ -328,6 +593,276 @@ func (s *TrashService) RestoreMultipleItems(userID string, items []RestoreItem)
 	return results, nil
 }
 
+// RestoreFileTo restores a trashed file into destinationID instead of its original folder
+func (s *TrashService) RestoreFileTo(fileID, userID, destinationID string) error {
+	ctx := context.Background()
+
+	fileObjID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var file models.File
+	err = s.fileCollection.FindOne(ctx, bson.M{
+		"_id":        fileObjID,
+		"owner_id":   userObjID,
+		"deleted_at": bson.M{"$ne": nil},
+	}).Decode(&file)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("file not found in trash")
+		}
+		return fmt.Errorf("failed to find file: %w", err)
+	}
+
+	destination, err := s.findRestoreDestination(ctx, userObjID, destinationID)
+	if err != nil {
+		return err
+	}
+
+	// Same name collision rule as MoveFile
+	var folderObjID *primitive.ObjectID
+	if destination != nil {
+		folderObjID = &destination.ID
+	}
+	count, err := s.fileCollection.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$ne": file.ID},
+		"name":       file.Name,
+		"owner_id":   userObjID,
+		"folder_id":  folderObjID,
+		"deleted_at": nil,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check destination: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("file with name '%s' already exists in destination", file.Name)
+	}
+
+	set := bson.M{
+		"relative_path": file.Name,
+		"updated_at":    time.Now(),
+		"is_deleted":    false,
+	}
+	update := bson.M{"$set": set, "$unset": untrashFields()}
+	if destination != nil {
+		set["folder_id"] = destination.ID
+		set["relative_path"] = destination.Path + "/" + file.Name
+	} else {
+		unset := untrashFields()
+		unset["folder_id"] = ""
+		update["$unset"] = unset
+	}
+
+	return s.restoreFileDocument(ctx, &file, userObjID, update)
+}
+
+// RestoreFolderTo restores a trashed folder and its contents under destinationID,
+// rewriting the paths of everything beneath it
+func (s *TrashService) RestoreFolderTo(folderID, userID, destinationID string) error {
+	ctx := context.Background()
+
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var folder models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{
+		"_id":        folderObjID,
+		"owner_id":   userObjID,
+		"is_deleted": true,
+	}).Decode(&folder)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("folder not found in trash")
+		}
+		return fmt.Errorf("failed to find folder: %w", err)
+	}
+
+	destination, err := s.findRestoreDestination(ctx, userObjID, destinationID)
+	if err != nil {
+		return err
+	}
+
+	var parentID *primitive.ObjectID
+	newPath := folder.Name
+	if destination != nil {
+		if destination.ID == folder.ID || strings.HasPrefix(destination.Path+"/", folder.Path+"/") {
+			return fmt.Errorf("cannot restore a folder into itself")
+		}
+		// Same rule as MoveFolder: descendants must stay owned by the owner of their tree
+		if destination.OwnerID != userObjID {
+			return fmt.Errorf("cannot restore folder into another user's folder")
+		}
+		parentID = &destination.ID
+		newPath = destination.Path + "/" + folder.Name
+	}
+
+	// Same name collision rule as CreateFolder
+	collision := bson.M{
+		"name":       folder.Name,
+		"owner_id":   userObjID,
+		"parent_id":  parentID,
+		"is_deleted": false,
+		"_id":        bson.M{"$ne": folderObjID},
+	}
+	if count, err := s.folderCollection.CountDocuments(ctx, collision); err != nil {
+		return fmt.Errorf("failed to check destination: %w", err)
+	} else if count > 0 {
+		return fmt.Errorf("folder with name '%s' already exists in destination", folder.Name)
+	}
+
+	subtreeIDs, err := subtreeResourceIDs(ctx, s.folderCollection, s.fileCollection, &folder, bson.M{"deleted_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return fmt.Errorf("failed to collect folder contents: %w", err)
+	}
+
+	session, err := s.folderCollection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := s.folderCollection.UpdateOne(sc, bson.M{
+			"_id":      folderObjID,
+			"owner_id": userObjID,
+		}, bson.M{
+			"$set": bson.M{
+				"parent_id":  parentID,
+				"path":       newPath,
+				"updated_at": time.Now(),
+				"is_deleted": false,
+			},
+			"$unset": untrashFields(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore folder: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			return nil, fmt.Errorf("folder not found or already restored")
+		}
+
+		if err := s.restoreUnderNewPath(sc, s.folderCollection, "path", trashedFolders, userObjID, folder.Path, newPath); err != nil {
+			return nil, fmt.Errorf("failed to restore child folders: %w", err)
+		}
+		restored, err := sumStoredBytes(sc, s.fileCollection, trashedFiles(bson.M{
+			"relative_path": underPath(folder.Path),
+			"owner_id":      userObjID,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if err := s.restoreUnderNewPath(sc, s.fileCollection, "relative_path", trashedFiles, userObjID, folder.Path, newPath); err != nil {
+			return nil, fmt.Errorf("failed to restore files in folder: %w", err)
+		}
+
+		if err := s.chargeStorage(sc, userObjID, restored); err != nil {
+			return nil, err
+		}
+		return nil, s.permissionService.ResumeResourcePermissions(sc, subtreeIDs)
+	})
+	return err
+}
+
+// chargeStorage adds restored files back to the owner's used_storage, undoing the decrement made when they were trashed
+func (s *TrashService) chargeStorage(ctx context.Context, userObjID primitive.ObjectID, bytes int64) error {
+	if bytes == 0 {
+		return nil
+	}
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": userObjID},
+		bson.M{"$inc": bson.M{"used_storage": bytes}}); err != nil {
+		return fmt.Errorf("failed to update storage usage: %w", err)
+	}
+	return nil
+}
+
+// underPath matches paths strictly below prefix. The prefix is escaped so folder names
+// containing regex metacharacters, like "a.b", cannot match sibling trees such as "axb".
+func underPath(prefix string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(prefix+"/")}
+}
+
+// findRestoreDestination resolves a destination folder ID; "root" yields nil
+func (s *TrashService) findRestoreDestination(ctx context.Context, userObjID primitive.ObjectID, destinationID string) (*models.Folder, error) {
+	if destinationID == rootDestination {
+		return nil, nil
+	}
+
+	destObjID, err := primitive.ObjectIDFromHex(destinationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination folder ID: %w", err)
+	}
+
+	// Not scoped to the owner: restoring into a folder shared with the user is allowed when
+	// they can edit it, which the permission check below decides
+	var destination models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{
+		"_id":        destObjID,
+		"is_deleted": false,
+	}).Decode(&destination)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("destination folder not found")
+		}
+		return nil, fmt.Errorf("failed to check destination folder: %w", err)
+	}
+
+	// Restoring adds to the destination's contents, same as an upload or move would
+	hasPermission, err := s.permissionService.HasFolderPermission(ctx, userObjID.Hex(), destinationID, "editor")
+	if err != nil {
+		return nil, fmt.Errorf("permission check failed: %w", err)
+	}
+	if !hasPermission {
+		return nil, fmt.Errorf("insufficient permissions")
+	}
+
+	return &destination, nil
+}
+
+// restoreUnderNewPath restores every trashed document whose pathField sits under oldPrefix and
+// rewrites that prefix to newPrefix. trashed is the collection's trash condition: a live folder
+// created at the old path since the delete has children there too, and they must be left alone.
+func (s *TrashService) restoreUnderNewPath(ctx mongo.SessionContext, collection *mongo.Collection, pathField string, trashed func(bson.M) bson.M, userObjID primitive.ObjectID, oldPrefix, newPrefix string) error {
+	cursor, err := collection.Find(ctx, trashed(bson.M{
+		pathField:  underPath(oldPrefix),
+		"owner_id": userObjID,
+	}), options.Find().SetProjection(bson.M{pathField: 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		oldPath, _ := doc[pathField].(string)
+
+		_, err := collection.UpdateOne(ctx, trashed(bson.M{"_id": doc["_id"]}), bson.M{
+			"$set":   bson.M{pathField: newPrefix + strings.TrimPrefix(oldPath, oldPrefix), "is_deleted": false},
+			"$unset": untrashFields(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
 func (s *TrashService) PurgeFile(fileID, userID string) error {
 	ctx := context.Background()
 
@@ -363,6 +898,11 @@ func (s *TrashService) PurgeFile(fileID, userID string) error {
 			// Log the error but don't fail the operation
 			fmt.Printf("Warning: failed to delete file from B2 storage: %v\n", err)
 		}
+		for _, v := range file.Versions {
+			if err := s.b2Service.DeleteFile(v.B2FileID); err != nil {
+				fmt.Printf("Warning: failed to delete version %s from B2 storage: %v\n", v.VersionID.Hex(), err)
+			}
+		}
 	}
 
 	// Delete from database
@@ -378,7 +918,7 @@ func (s *TrashService) PurgeFile(fileID, userID string) error {
 		return fmt.Errorf("file not found")
 	}
 
-	return nil
+	return s.permissionService.DeleteResourcePermissions(ctx, []string{fileID})
 }
 
 func (s *TrashService) PurgeFolder(folderID, userID string) error {
@@ -400,7 +940,7 @@ func (s *TrashService) PurgeFolder(folderID, userID string) error {
 	err = s.folderCollection.FindOne(ctx, bson.M{
 		"_id":        folderObjID,
 		"owner_id":   userObjID,
-		"deleted_at": bson.M{"$ne": nil},
+		"is_deleted": true,
 	}).Decode(&folder)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -409,6 +949,11 @@ func (s *TrashService) PurgeFolder(folderID, userID string) error {
 		return fmt.Errorf("failed to find folder: %w", err)
 	}
 
+	subtreeIDs, err := subtreeResourceIDs(ctx, s.folderCollection, s.fileCollection, &folder, nil)
+	if err != nil {
+		return fmt.Errorf("failed to collect folder contents: %w", err)
+	}
+
 	// Start a session for transaction
 	session, err := s.folderCollection.Database().Client().StartSession()
 	if err != nil {
@@ -416,34 +961,23 @@ func (s *TrashService) PurgeFolder(folderID, userID string) error {
 	}
 	defer session.EndSession(ctx)
 
+	// As in PurgeAllTrash, B2 objects (heads and retained versions) are deleted only after commit
+	var objects []orphanCandidate
+
 	// Use transaction to delete folder and its contents
 	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		// Get all files in this folder and subfolders for B2 deletion
-		if s.b2Service != nil {
-			fileCursor, err := s.fileCollection.Find(sc, bson.M{
-				"relative_path": bson.M{"$regex": "^" + folder.Path + "/"},
-				"owner_id":      userObjID,
-			})
-			if err == nil {
-				defer fileCursor.Close(sc)
-
-				var files []models.File
-				if err = fileCursor.All(sc, &files); err == nil {
-					for _, file := range files {
-						if file.B2FileID != "" {
-							err = s.b2Service.DeleteFile(file.B2FileID)
-							if err != nil {
-								fmt.Printf("Warning: failed to delete file %s from B2 storage: %v\n", file.Name, err)
-							}
-						}
-					}
-				}
-			}
+		var err error
+		objects, err = s.trashedObjects(sc, bson.M{
+			"relative_path": underPath(folder.Path),
+			"owner_id":      userObjID,
+		})
+		if err != nil {
+			return nil, err
 		}
 
 		// Delete all files in this folder and subfolders
 		_, err = s.fileCollection.DeleteMany(sc, bson.M{
-			"relative_path": bson.M{"$regex": "^" + folder.Path + "/"},
+			"relative_path": underPath(folder.Path),
 			"owner_id":      userObjID,
 		})
 		if err != nil {
@@ -452,7 +986,7 @@ func (s *TrashService) PurgeFolder(folderID, userID string) error {
 
 		// Delete all child folders
 		_, err = s.folderCollection.DeleteMany(sc, bson.M{
-			"path":     bson.M{"$regex": "^" + folder.Path + "/"},
+			"path":     underPath(folder.Path),
 			"owner_id": userObjID,
 		})
 		if err != nil {
@@ -474,8 +1008,13 @@ func (s *TrashService) PurgeFolder(folderID, userID string) error {
 
 		return nil, nil
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.deleteObjects(ctx, objects)
+
+	return s.permissionService.DeleteResourcePermissions(ctx, subtreeIDs)
 }
 
 func (s *TrashService) PurgeAllTrash(userID string) (int64, error) {
@@ -489,6 +1028,13 @@ func (s *TrashService) PurgeAllTrash(userID string) (int64, error) {
 
 	var totalDeleted int64
 
+	trashedIDs, err := s.trashedResourceIDs(ctx,
+		trashedFiles(bson.M{"owner_id": userObjID}),
+		trashedFolders(bson.M{"owner_id": userObjID}))
+	if err != nil {
+		return 0, err
+	}
+
 	// Start a session for transaction
 	session, err := s.fileCollection.Database().Client().StartSession()
 	if err != nil {
@@ -496,29 +1042,16 @@ func (s *TrashService) PurgeAllTrash(userID string) (int64, error) {
 	}
 	defer session.EndSession(ctx)
 
+	// B2 objects are only deleted once the transaction has committed, so an aborted
+	// purge never leaves rows pointing at deleted objects
+	var objects []orphanCandidate
+
 	// Use transaction to delete all trash items
 	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		// Get all deleted files for B2 cleanup
-		if s.b2Service != nil {
-			fileCursor, err := s.fileCollection.Find(sc, bson.M{
-				"owner_id":   userObjID,
-				"deleted_at": bson.M{"$ne": nil},
-			})
-			if err == nil {
-				defer fileCursor.Close(sc)
-
-				var files []models.File
-				if err = fileCursor.All(sc, &files); err == nil {
-					for _, file := range files {
-						if file.B2FileID != "" {
-							err = s.b2Service.DeleteFile(file.B2FileID)
-							if err != nil {
-								fmt.Printf("Warning: failed to delete file %s from B2 storage: %v\n", file.Name, err)
-							}
-						}
-					}
-				}
-			}
+		var err error
+		objects, err = s.trashedObjects(sc, trashedFiles(bson.M{"owner_id": userObjID}))
+		if err != nil {
+			return nil, err
 		}
 
 		// Delete all deleted files
@@ -531,10 +1064,7 @@ func (s *TrashService) PurgeAllTrash(userID string) (int64, error) {
 		}
 
 		// Delete all deleted folders
-		folderResult, err := s.folderCollection.DeleteMany(sc, bson.M{
-			"owner_id":   userObjID,
-			"deleted_at": bson.M{"$ne": nil},
-		})
+		folderResult, err := s.folderCollection.DeleteMany(sc, trashedFolders(bson.M{"owner_id": userObjID}))
 		if err != nil {
 			return nil, fmt.Errorf("failed to delete folders from trash: %w", err)
 		}
@@ -542,8 +1072,127 @@ func (s *TrashService) PurgeAllTrash(userID string) (int64, error) {
 		totalDeleted = fileResult.DeletedCount + folderResult.DeletedCount
 		return nil, nil
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.deleteObjects(ctx, objects)
+
+	return totalDeleted, s.permissionService.DeleteResourcePermissions(ctx, trashedIDs)
+}
 
-	return totalDeleted, err
+// orphanCandidate is a B2 object that must be deleted after its file row is purged
+type orphanCandidate struct {
+	b2FileID string
+	ownerID  primitive.ObjectID
+}
+
+// trashedObjects lists the B2 objects, including retained versions, of the files matching filter
+func (s *TrashService) trashedObjects(ctx context.Context, filter bson.M) ([]orphanCandidate, error) {
+	if s.b2Service == nil {
+		return nil, nil
+	}
+
+	cursor, err := s.fileCollection.Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"owner_id": 1, "b2_file_id": 1, "versions.b2_file_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find trashed files: %w", err)
+	}
+
+	var files []models.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode trashed files: %w", err)
+	}
+
+	var objects []orphanCandidate
+	for _, file := range files {
+		if file.B2FileID != "" {
+			objects = append(objects, orphanCandidate{b2FileID: file.B2FileID, ownerID: file.OwnerID})
+		}
+		for _, v := range file.Versions {
+			if v.B2FileID != "" {
+				objects = append(objects, orphanCandidate{b2FileID: v.B2FileID, ownerID: file.OwnerID})
+			}
+		}
+	}
+	return objects, nil
+}
+
+// deleteObjects deletes purged files' B2 objects. Failures are recorded as orphans for
+// RetryOrphanedObjects instead of being lost, since the rows pointing at them are gone.
+func (s *TrashService) deleteObjects(ctx context.Context, objects []orphanCandidate) {
+	for _, object := range objects {
+		err := s.b2Service.DeleteFile(object.b2FileID)
+		if err == nil {
+			continue
+		}
+
+		now := time.Now()
+		_, recordErr := s.orphanCollection.InsertOne(ctx, models.OrphanedObject{
+			ID:            primitive.NewObjectID(),
+			B2FileID:      object.b2FileID,
+			OwnerID:       object.ownerID,
+			LastError:     err.Error(),
+			Attempts:      1,
+			CreatedAt:     now,
+			LastAttemptAt: now,
+		})
+		if recordErr != nil {
+			log.Printf("Failed to record orphaned B2 object %s (delete failed: %v): %v", object.b2FileID, err, recordErr)
+		}
+	}
+}
+
+// RetryOrphanedObjects retries deleting B2 objects whose earlier delete failed and
+// returns how many were deleted and how many remain
+func (s *TrashService) RetryOrphanedObjects() (deleted, remaining int, err error) {
+	if s.b2Service == nil {
+		return 0, 0, nil
+	}
+
+	ctx := context.Background()
+	cursor, err := s.orphanCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find orphaned objects: %w", err)
+	}
+
+	var orphans []models.OrphanedObject
+	if err := cursor.All(ctx, &orphans); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode orphaned objects: %w", err)
+	}
+
+	for _, orphan := range orphans {
+		if deleteErr := s.b2Service.DeleteFile(orphan.B2FileID); deleteErr != nil {
+			remaining++
+			if _, err := s.orphanCollection.UpdateOne(ctx, bson.M{"_id": orphan.ID}, bson.M{
+				"$set": bson.M{"last_error": deleteErr.Error(), "last_attempt_at": time.Now()},
+				"$inc": bson.M{"attempts": 1},
+			}); err != nil {
+				return deleted, remaining, fmt.Errorf("failed to update orphaned object: %w", err)
+			}
+			continue
+		}
+
+		deleted++
+		if _, err := s.orphanCollection.DeleteOne(ctx, bson.M{"_id": orphan.ID}); err != nil {
+			return deleted, remaining, fmt.Errorf("failed to remove orphaned object: %w", err)
+		}
+	}
+
+	return deleted, remaining, nil
+}
+
+// trashedResourceIDs returns the IDs of the files and folders matching their filters
+func (s *TrashService) trashedResourceIDs(ctx context.Context, fileFilter, folderFilter bson.M) ([]string, error) {
+	fileIDs, err := resourceIDs(ctx, s.fileCollection, fileFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find trashed files: %w", err)
+	}
+	folderIDs, err := resourceIDs(ctx, s.folderCollection, folderFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find trashed folders: %w", err)
+	}
+	return append(fileIDs, folderIDs...), nil
 }
 
 func (s *TrashService) EmptyTrash(userID string) (int64, error) {
@@ -551,93 +1200,144 @@ func (s *TrashService) EmptyTrash(userID string) (int64, error) {
 	return s.PurgeAllTrash(userID)
 }
 
-// AutoPurgeExpiredItems removes items that have been in trash for more than 30 days
+// AutoPurgeExpiredItems removes items that have been in trash longer than the retention period
 func (s *TrashService) AutoPurgeExpiredItems() error {
-	ctx := context.Background()
-	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
+	_, err := s.purgeExpired(context.Background(), bson.M{})
+	return err
+}
+
+// PurgeExpiredForUser permanently deletes the user's trash items that are past the retention
+// period and returns how many were removed. Unlike PurgeAllTrash, recent deletions are kept.
+func (s *TrashService) PurgeExpiredForUser(userID string) (int64, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return s.purgeExpired(context.Background(), bson.M{"owner_id": userObjID})
+}
+
+// purgeExpired permanently deletes expired trash items matching scope, including the B2
+// objects of expired files and their versions
+func (s *TrashService) purgeExpired(ctx context.Context, scope bson.M) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -s.retentionDays)
+
+	// Both collections set deleted_at on delete, and it carries the date
+	expired := bson.M{
+		"deleted_at": bson.M{
+			"$ne":  nil,
+			"$lte": cutoff,
+		},
+	}
+	for key, value := range scope {
+		expired[key] = value
+	}
+
+	expiredIDs, err := s.trashedResourceIDs(ctx, expired, expired)
+	if err != nil {
+		return 0, err
+	}
 
 	// Start a session for transaction
 	session, err := s.fileCollection.Database().Client().StartSession()
 	if err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
+		return 0, fmt.Errorf("failed to start session: %w", err)
 	}
 	defer session.EndSession(ctx)
 
+	var totalDeleted int64
+	var objects []orphanCandidate
 	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		// Get expired files for B2 cleanup
-		if s.b2Service != nil {
-			fileCursor, err := s.fileCollection.Find(sc, bson.M{
-				"deleted_at": bson.M{
-					"$ne":  nil,
-					"$lte": thirtyDaysAgo,
-				},
-			})
-			if err == nil {
-				defer fileCursor.Close(sc)
-
-				var files []models.File
-				if err = fileCursor.All(sc, &files); err == nil {
-					for _, file := range files {
-						if file.B2FileID != "" {
-							err = s.b2Service.DeleteFile(file.B2FileID)
-							if err != nil {
-								fmt.Printf("Warning: failed to delete expired file %s from B2 storage: %v\n", file.Name, err)
-							}
-						}
-					}
-				}
-			}
+		// Collected here, deleted from B2 after commit
+		var err error
+		objects, err = s.trashedObjects(sc, expired)
+		if err != nil {
+			return nil, err
 		}
 
 		// Delete expired files
-		_, err = s.fileCollection.DeleteMany(sc, bson.M{
-			"deleted_at": bson.M{
-				"$ne":  nil,
-				"$lte": thirtyDaysAgo,
-			},
-		})
+		fileResult, err := s.fileCollection.DeleteMany(sc, expired)
 		if err != nil {
 			return nil, fmt.Errorf("failed to auto-purge expired files: %w", err)
 		}
 
 		// Delete expired folders
-		_, err = s.folderCollection.DeleteMany(sc, bson.M{
-			"deleted_at": bson.M{
-				"$ne":  nil,
-				"$lte": thirtyDaysAgo,
-			},
-		})
+		folderResult, err := s.folderCollection.DeleteMany(sc, expired)
 		if err != nil {
 			return nil, fmt.Errorf("failed to auto-purge expired folders: %w", err)
 		}
 
+		totalDeleted = fileResult.DeletedCount + folderResult.DeletedCount
 		return nil, nil
 	})
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	s.deleteObjects(ctx, objects)
+
+	return totalDeleted, s.permissionService.DeleteResourcePermissions(ctx, expiredIDs)
 }
 
 // StartTrashCleanupJob initializes a background job that periodically purges expired trash items
 func StartTrashCleanupJob(trashService *TrashService, interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	quit := make(chan struct{})
+
+	go func() {
+		for range ticker.C {
+			runTrashCleanup(trashService)
+		}
+	}()
+}
+
+// StartDailyTrashCleanupJob purges expired trash items once a day at the given UTC time
+// ("HH:MM"), so the schedule does not drift with restarts
+func StartDailyTrashCleanupJob(trashService *TrashService, at string) error {
+	hour, minute, err := ParseDailyTime(at)
+	if err != nil {
+		return err
+	}
 
 	go func() {
 		for {
-			select {
-			case <-ticker.C:
-				log.Println("Running trash cleanup job...")
-				err := trashService.AutoPurgeExpiredItems()
-				if err != nil {
-					log.Printf("Trash cleanup job failed: %v", err)
-				} else {
-					log.Println("Trash cleanup job completed successfully")
-				}
-			case <-quit:
-				ticker.Stop()
-				return
-			}
+			timer := time.NewTimer(time.Until(NextDailyRun(time.Now(), hour, minute)))
+			<-timer.C
+			runTrashCleanup(trashService)
 		}
 	}()
+	return nil
+}
+
+// ParseDailyTime parses a 24-hour "HH:MM" time of day
+func ParseDailyTime(at string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(at))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid daily time %q: expected HH:MM", at)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// NextDailyRun returns the first hour:minute UTC strictly after now
+func NextDailyRun(now time.Time, hour, minute int) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func runTrashCleanup(trashService *TrashService) {
+	log.Println("Running trash cleanup job...")
+	if err := trashService.AutoPurgeExpiredItems(); err != nil {
+		log.Printf("Trash cleanup job failed: %v", err)
+	} else {
+		log.Println("Trash cleanup job completed successfully")
+	}
 
+	deleted, remaining, err := trashService.RetryOrphanedObjects()
+	if err != nil {
+		log.Printf("Orphaned object cleanup failed: %v", err)
+	} else if deleted > 0 || remaining > 0 {
+		log.Printf("Orphaned object cleanup deleted %d objects, %d still pending", deleted, remaining)
+	}
 }
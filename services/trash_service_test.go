@@ -0,0 +1,775 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"phynixdrive/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestConsumePurgeConfirmation(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  bson.D // nil when no token matches
+		wantErr string
+	}{
+		{"valid", bson.D{{Key: "_id", Value: "tok"}, {Key: "user_id", Value: "u1"}, {Key: "expires_at", Value: time.Now().Add(time.Minute)}}, ""},
+		{"expired", bson.D{{Key: "_id", Value: "tok"}, {Key: "user_id", Value: "u1"}, {Key: "expires_at", Value: time.Now().Add(-time.Second)}}, "confirmation token expired"},
+		{"unknown", nil, "invalid confirmation token"},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			service := NewTrashService(mt.DB, nil)
+			mt.ClearEvents()
+
+			var value interface{}
+			if tt.stored != nil {
+				value = tt.stored
+			}
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: value}))
+
+			err := service.ConsumePurgeConfirmation("u1", "tok")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("err = %v, want %s", err, tt.wantErr)
+			}
+
+			// The token is redeemed by deleting it, scoped to the user it was issued to
+			deletes := commands(mt, "findAndModify")
+			if len(deletes) != 1 || !deletes[0].Command.Lookup("remove").Boolean() {
+				t.Fatal("token was not consumed with a single find-and-delete")
+			}
+			if user := deletes[0].Command.Lookup("query", "user_id").StringValue(); user != "u1" {
+				t.Fatalf("token lookup scoped to %q, want u1", user)
+			}
+		})
+	}
+}
+
+func TestRestoreMultipleItemsIntoDifferentDestinations(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("destinations", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+
+		userID := primitive.NewObjectID()
+		fileA, fileB := primitive.NewObjectID(), primitive.NewObjectID()
+		destinations := map[primitive.ObjectID]primitive.ObjectID{
+			fileA: primitive.NewObjectID(),
+			fileB: primitive.NewObjectID(),
+		}
+
+		var items []RestoreItem
+		for _, fileID := range []primitive.ObjectID{fileA, fileB} {
+			destID := destinations[fileID]
+			destination := append(folderDoc(destID, "Dest", "/Dest-"+destID.Hex(), nil, time.Now()),
+				bson.E{Key: "owner_id", Value: userID})
+			trashed := append(fileDoc(fileID, userID, "a.txt"), bson.E{Key: "deleted_at", Value: time.Now()})
+
+			mt.AddMockResponses(
+				cursor("test.files", trashed),
+				cursor("test.folders", destination),
+				cursor("test.folders", destination), // editor check: the user owns it
+				cursor("test.files", bson.D{{Key: "n", Value: int32(0)}}),
+				writeResult(1),
+				writeResult(1),                // storage charged back
+				writeResult(0),                // permissions resumed
+				writeResult(0),                // shares resumed
+				mtest.CreateSuccessResponse(), // commitTransaction
+			)
+			items = append(items, RestoreItem{ID: fileID.Hex(), Type: "file", DestinationFolderID: destID.Hex()})
+		}
+
+		results, err := service.RestoreMultipleItems(userID.Hex(), items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if !result.Success {
+				t.Fatalf("result = %+v", result)
+			}
+		}
+
+		restored := map[primitive.ObjectID]primitive.ObjectID{}
+		for _, update := range commands(mt, "update") {
+			if update.Command.Lookup("update").StringValue() != "files" {
+				continue
+			}
+			fileID := update.Command.Lookup("updates", "0", "q", "_id").ObjectID()
+			restored[fileID] = update.Command.Lookup("updates", "0", "u", "$set", "folder_id").ObjectID()
+		}
+		for fileID, destID := range destinations {
+			if restored[fileID] != destID {
+				t.Fatalf("file %s restored into %s, want %s", fileID.Hex(), restored[fileID].Hex(), destID.Hex())
+			}
+		}
+	})
+}
+
+func TestTrashLifecycleKeepsSharesUntilPurge(t *testing.T) {
+	// updated returns the set or unset clause each update sent to collection
+	updated := func(mt *mtest.T, collection, op string) []bson.Raw {
+		var docs []bson.Raw
+		for _, evt := range commands(mt, "update") {
+			if evt.Command.Lookup("update").StringValue() == collection {
+				docs = append(docs, evt.Command.Lookup("updates", "0", "u", op).Document())
+			}
+		}
+		return docs
+	}
+
+	mt := newMockDB(t)
+	mt.Run("delete suspends", func(mt *mtest.T) {
+		service := NewFileService(mt.DB, nil, nil, NewPermissionService(mt.DB))
+		mt.ClearEvents()
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(id, ownerID, "a.txt")), // access check
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(id, ownerID, "a.txt")}),
+			writeResult(1),                // permissions
+			writeResult(1),                // shares
+			writeResult(1),                // used_storage
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.DeleteFile(id.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+		for _, collection := range []string{"permissions", "shares"} {
+			set := updated(mt, collection, "$set")
+			if len(set) != 1 || set[0].Lookup("is_active").Boolean() {
+				t.Fatalf("%s were not suspended: %v", collection, set)
+			}
+			if _, err := set[0].LookupErr("suspended_at"); err != nil {
+				t.Fatalf("%s suspension was not timestamped", collection)
+			}
+		}
+	})
+
+	mt.Run("restore resumes", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(id, ownerID, "a.txt")),
+			writeResult(1),                // file
+			writeResult(1),                // used_storage
+			writeResult(1),                // permissions
+			writeResult(1),                // shares
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.RestoreFile(id.Hex(), ownerID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+		for _, collection := range []string{"permissions", "shares"} {
+			set, unset := updated(mt, collection, "$set"), updated(mt, collection, "$unset")
+			if len(set) != 1 || !set[0].Lookup("is_active").Boolean() {
+				t.Fatalf("%s were not reactivated: %v", collection, set)
+			}
+			if _, err := unset[0].LookupErr("suspended_at"); err != nil {
+				t.Fatalf("%s kept their suspension marker", collection)
+			}
+		}
+	})
+
+	mt.Run("purge removes", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", fileDoc(id, ownerID, "a.txt")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // file
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // permissions
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // shares
+		)
+
+		if err := service.PurgeFile(id.Hex(), ownerID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+		deleted := map[string]bool{}
+		for _, evt := range commands(mt, "delete") {
+			collection := evt.Command.Lookup("delete").StringValue()
+			ids, ok := evt.Command.Lookup("deletes", "0", "q", "resource_id", "$in").ArrayOK()
+			if ok && ids.Index(0).Value().StringValue() == id.Hex() {
+				deleted[collection] = true
+			}
+		}
+		if !deleted["permissions"] || !deleted["shares"] {
+			t.Fatalf("grants deleted from %v, want permissions and shares", deleted)
+		}
+	})
+}
+
+func TestTrashListsFoldersAndFilesDeletedThroughTheirServices(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("trash", func(mt *mtest.T) {
+		folders := NewFolderService(mt.DB, nil, nil)
+		files := NewFileService(mt.DB, nil, nil, nil)
+		trash := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+
+		ownerID, folderID, fileID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		folder := append(folderDoc(folderID, "docs", "/docs", nil, time.Now()), bson.E{Key: "owner_id", Value: ownerID})
+
+		mt.AddMockResponses(
+			cursor("test.folders", folder),
+			cursor("test.folders"),        // subtree folders
+			cursor("test.files"),          // subtree files
+			writeResult(1),                // folder
+			cursor("test.folders"),        // subfolders
+			cursor("test.files"),          // stored bytes
+			writeResult(0),                // files
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+		if err := folders.DeleteFolder(context.Background(), folderID.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(fileID, ownerID, "a.txt")}),
+			writeResult(1),                // used_storage
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+		if err := files.DeleteFile(fileID.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// Each delete must set the field the trash listing keys that collection on
+		var folderSet, fileSet bson.Raw
+		for _, evt := range commands(mt, "update") {
+			if evt.Command.Lookup("update").StringValue() == "folders" {
+				folderSet = evt.Command.Lookup("updates", "0", "u", "$set").Document()
+			}
+		}
+		if modify := commands(mt, "findAndModify"); len(modify) == 1 {
+			fileSet = modify[0].Command.Lookup("update", "$set").Document()
+		}
+		if folderSet == nil || !folderSet.Lookup("is_deleted").Boolean() {
+			t.Fatal("DeleteFolder did not set is_deleted")
+		}
+		if fileSet == nil || fileSet.Lookup("deleted_at").Type != bson.TypeDateTime {
+			t.Fatal("DeleteFile did not set deleted_at")
+		}
+
+		mt.ClearEvents()
+		deletedAt := time.Now()
+		mt.AddMockResponses(
+			cursor("test.files", append(fileDoc(fileID, ownerID, "a.txt"),
+				bson.E{Key: "is_deleted", Value: true}, bson.E{Key: "deleted_at", Value: deletedAt})),
+			cursor("test.folders", append(folder,
+				bson.E{Key: "is_deleted", Value: true}, bson.E{Key: "deleted_at", Value: deletedAt})),
+		)
+		items, err := trash.GetTrashItems(ownerID.Hex(), "", 20, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		finds := commands(mt, "find")
+		if len(finds) != 2 {
+			t.Fatalf("finds = %d, want 2", len(finds))
+		}
+		if finds[0].Command.Lookup("filter", "deleted_at", "$ne").Type != bson.TypeNull {
+			t.Fatal("files are not listed by deleted_at")
+		}
+		if !finds[1].Command.Lookup("filter", "is_deleted").Boolean() {
+			t.Fatal("folders are not listed by is_deleted")
+		}
+
+		listed := map[string]bool{}
+		for _, item := range items {
+			listed[item.ItemType+":"+item.ItemID.Hex()] = true
+		}
+		if !listed["file:"+fileID.Hex()] || !listed["folder:"+folderID.Hex()] {
+			t.Fatalf("trash = %v, want both the file and the folder", listed)
+		}
+	})
+}
+
+func TestConfiguredRetentionPurgesOlderItems(t *testing.T) {
+	withConfig(t, &config.Config{TrashRetentionDays: 10})
+
+	mt := newMockDB(t)
+	mt.Run("ten days", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		ownerID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", bson.D{{Key: "_id", Value: fileID}}),
+			cursor("test.folders"),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // files
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // folders
+			mtest.CreateSuccessResponse(),                           // commitTransaction
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // permissions
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // shares
+		)
+
+		purged, err := service.PurgeExpiredForUser(ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 1 {
+			t.Fatalf("purged %d, want 1", purged)
+		}
+
+		deletes := commands(mt, "delete")
+		if len(deletes) == 0 || deletes[0].Command.Lookup("delete").StringValue() != "files" {
+			t.Fatal("expired files were not deleted")
+		}
+		// An item deleted 11 days ago is past the cutoff; one deleted 9 days ago is not
+		cutoff := deletes[0].Command.Lookup("deletes", "0", "q", "deleted_at", "$lte").Time()
+		if elevenDays := time.Now().AddDate(0, 0, -11); cutoff.Before(elevenDays) {
+			t.Fatalf("cutoff %v keeps an item deleted 11 days ago", cutoff)
+		}
+		if nineDays := time.Now().AddDate(0, 0, -9); !cutoff.Before(nineDays) {
+			t.Fatalf("cutoff %v purges an item deleted 9 days ago", cutoff)
+		}
+	})
+
+	mt.Run("listing", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		ownerID := primitive.NewObjectID()
+		deletedAt := time.Now().AddDate(0, 0, -11).Truncate(time.Millisecond)
+
+		mt.AddMockResponses(cursor("test.files", append(fileDoc(primitive.NewObjectID(), ownerID, "old.txt"),
+			bson.E{Key: "deleted_at", Value: deletedAt})))
+
+		items, err := service.GetTrashItems(ownerID.Hex(), "file", 20, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || !items[0].AutoPurgeAt.Equal(deletedAt.AddDate(0, 0, 10)) {
+			t.Fatalf("items = %+v, want auto-purge 10 days after deletion", items)
+		}
+	})
+}
+
+func TestNextDailyRunLandsAtConfiguredTime(t *testing.T) {
+	hour, minute, err := ParseDailyTime("03:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"before today's run", time.Date(2024, 5, 1, 1, 30, 0, 0, time.UTC), time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+		{"exactly at the run", time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)},
+		{"after today's run", time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)},
+		{"month boundary", time.Date(2024, 5, 31, 4, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)},
+		// 02:00 in UTC+2 is midnight UTC, so 03:00 UTC is still ahead the same day
+		{"other time zone", time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("UTC+2", 2*3600)), time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := NextDailyRun(tt.now, hour, minute); !got.Equal(tt.want) {
+			t.Errorf("%s: next run = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "3am", "25:00", "03:60"} {
+		if _, _, err := ParseDailyTime(bad); err == nil {
+			t.Errorf("ParseDailyTime(%q) accepted an invalid time", bad)
+		}
+	}
+}
+
+func TestFolderDeleteReleasesStorageAndRestoreChargesIt(t *testing.T) {
+	// storageChange returns the used_storage increments sent to the users collection
+	storageChange := func(mt *mtest.T) []int64 {
+		var changes []int64
+		for _, evt := range commands(mt, "update") {
+			if evt.Command.Lookup("update").StringValue() == "users" {
+				if _, err := evt.Command.LookupErr("txnNumber"); err != nil {
+					t.Fatal("storage must change in the same transaction as the folder")
+				}
+				changes = append(changes, evt.Command.Lookup("updates", "0", "u", "$inc", "used_storage").AsInt64())
+			}
+		}
+		return changes
+	}
+
+	mt := newMockDB(t)
+	ownerID, folderID := primitive.NewObjectID(), primitive.NewObjectID()
+	folder := append(folderDoc(folderID, "docs", "/docs", nil, time.Now()), bson.E{Key: "owner_id", Value: ownerID})
+	files := []bson.D{
+		{{Key: "_id", Value: primitive.NewObjectID()}},
+		{{Key: "_id", Value: primitive.NewObjectID()}},
+	}
+
+	mt.Run("delete", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, nil, nil)
+		mt.AddMockResponses(
+			cursor("test.folders", folder),
+			cursor("test.folders"),
+			cursor("test.files", files...),
+			writeResult(1),         // folder
+			cursor("test.folders"), // subfolders
+			cursor("test.files", bson.D{{Key: "total", Value: int64(25)}}), // stored bytes
+			writeResult(2),                // files
+			writeResult(1),                // used_storage
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.DeleteFolder(context.Background(), folderID.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := storageChange(mt); len(got) != 1 || got[0] != -25 {
+			t.Fatalf("storage changes = %v, want -25", got)
+		}
+	})
+
+	mt.Run("restore", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		trashed := bson.D{
+			{Key: "_id", Value: folderID},
+			{Key: "name", Value: "docs"},
+			{Key: "path", Value: "/docs"},
+			{Key: "owner_id", Value: ownerID},
+			{Key: "is_deleted", Value: true},
+			{Key: "deleted_at", Value: time.Now()},
+		}
+
+		mt.AddMockResponses(
+			cursor("test.folders", trashed),
+			cursor("test.folders"),
+			cursor("test.files", files...),
+			writeResult(1), // folder
+			writeResult(0), // subfolders
+			cursor("test.files", bson.D{{Key: "total", Value: int64(25)}}), // stored bytes
+			writeResult(2),                // files
+			writeResult(1),                // used_storage
+			writeResult(0),                // permissions
+			writeResult(0),                // shares
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.RestoreFolder(folderID.Hex(), ownerID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+		if got := storageChange(mt); len(got) != 1 || got[0] != 25 {
+			t.Fatalf("storage changes = %v, want +25", got)
+		}
+	})
+}
+
+func TestTrashShowsDeleteReasonAndActor(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("reason", func(mt *mtest.T) {
+		files := NewFileService(mt.DB, nil, nil, nil)
+		trash := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		ownerID, editorID, fileID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+		// An editor of a shared folder moves the owner's file to trash
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: fileDoc(fileID, ownerID, "draft.txt")}),
+			writeResult(1),                // used_storage
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+		if err := files.DeleteFile(fileID.Hex(), editorID.Hex(), "outdated draft"); err != nil {
+			t.Fatal(err)
+		}
+		set := commands(mt, "findAndModify")[0].Command.Lookup("update", "$set").Document()
+		if set.Lookup("deleted_by").ObjectID() != editorID || set.Lookup("delete_reason").StringValue() != "outdated draft" {
+			t.Fatalf("trash update = %v, want the editor and the reason", set)
+		}
+
+		mt.AddMockResponses(
+			cursor("test.files", append(fileDoc(fileID, ownerID, "draft.txt"),
+				bson.E{Key: "deleted_at", Value: time.Now()},
+				bson.E{Key: "deleted_by", Value: editorID},
+				bson.E{Key: "delete_reason", Value: "outdated draft"})),
+			cursor("test.users", bson.D{{Key: "_id", Value: editorID}, {Key: "name", Value: "Eve"}}),
+		)
+		items, err := trash.GetTrashItems(ownerID.Hex(), "file", 20, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 {
+			t.Fatalf("items = %d, want 1", len(items))
+		}
+		item := items[0]
+		if item.DeletedBy == nil || *item.DeletedBy != editorID || item.DeletedByName != "Eve" || item.DeleteReason != "outdated draft" {
+			t.Fatalf("item = %+v, want deleted by Eve for \"outdated draft\"", item)
+		}
+	})
+}
+
+func TestPurgeAllTrashRecordsFailedB2Deletes(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("orphan", func(mt *mtest.T) {
+		// The stub B2 has no delete endpoint, so every object delete fails
+		b2Service, _ := newStubB2Service(t)
+		service := NewTrashService(mt.DB, b2Service)
+		mt.ClearEvents()
+		ownerID, fileID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", bson.D{{Key: "_id", Value: fileID}}),
+			cursor("test.folders"),
+			cursor("test.files", bson.D{
+				{Key: "_id", Value: fileID},
+				{Key: "owner_id", Value: ownerID},
+				{Key: "b2_file_id", Value: "users/live"},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // files
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // folders
+			mtest.CreateSuccessResponse(),                           // commitTransaction
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // orphan record
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // permissions
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // shares
+		)
+
+		purged, err := service.PurgeAllTrash(ownerID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 1 {
+			t.Fatalf("purged %d, want 1", purged)
+		}
+
+		// The rows are gone for good before B2 is touched, and the object that could not be
+		// deleted is queued for the orphan cleanup instead of being forgotten
+		var committed bool
+		var orphans []bson.Raw
+		for _, evt := range mt.GetAllStartedEvents() {
+			switch evt.CommandName {
+			case "commitTransaction":
+				committed = true
+			case "insert":
+				if evt.Command.Lookup("insert").StringValue() != "orphaned_objects" {
+					continue
+				}
+				if !committed {
+					t.Fatal("orphan recorded before the purge committed")
+				}
+				orphans = append(orphans, evt.Command.Lookup("documents", "0").Document())
+			}
+		}
+		if len(orphans) != 1 {
+			t.Fatalf("orphans recorded = %d, want 1", len(orphans))
+		}
+		if orphans[0].Lookup("b2_file_id").StringValue() != "users/live" || orphans[0].Lookup("owner_id").ObjectID() != ownerID {
+			t.Fatalf("orphan = %v, want the live object of the purged file", orphans[0])
+		}
+	})
+}
+
+func TestPurgeFolderOnlyMatchesItsOwnSubtree(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("a.b", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		ownerID, folderID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.folders", bson.D{
+				{Key: "_id", Value: folderID},
+				{Key: "name", Value: "a.b"},
+				{Key: "path", Value: "a.b"},
+				{Key: "owner_id", Value: ownerID},
+				{Key: "is_deleted", Value: true},
+			}),
+			cursor("test.folders"),
+			cursor("test.files"),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // files
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // child folders
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), // folder
+			mtest.CreateSuccessResponse(),                           // commitTransaction
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // permissions
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}), // shares
+		)
+
+		if err := service.PurgeFolder(folderID.Hex(), ownerID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+
+		finds, deletes := commands(mt, "find"), commands(mt, "delete")
+		if len(finds) < 2 || len(deletes) < 2 {
+			t.Fatalf("finds = %d, deletes = %d", len(finds), len(deletes))
+		}
+		patterns := map[string]string{
+			"subtree lookup":      finds[1].Command.Lookup("filter", "path", "$regex").StringValue(),
+			"file purge":          deletes[0].Command.Lookup("deletes", "0", "q", "relative_path", "$regex").StringValue(),
+			"child folders purge": deletes[1].Command.Lookup("deletes", "0", "q", "path", "$regex").StringValue(),
+		}
+		for name, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !re.MatchString("a.b/report.txt") || !re.MatchString("a.b/sub/deep") {
+				t.Errorf("%s: %q misses the folder's own contents", name, pattern)
+			}
+			if re.MatchString("axb/report.txt") || re.MatchString("a.bc/report.txt") {
+				t.Errorf("%s: %q matches a sibling tree", name, pattern)
+			}
+		}
+	})
+}
+
+func TestRestoreFolderToLeavesLiveFolderAtOldPathAlone(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("recreated", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		ownerID, folderID, destID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		trashedChild := primitive.NewObjectID()
+		destination := append(folderDoc(destID, "dest", "dest", nil, time.Now()), bson.E{Key: "owner_id", Value: ownerID})
+
+		// A new live "a" with its own children was created after the old "a" went to trash;
+		// a correct server only hands back the trashed child
+		mt.AddMockResponses(
+			cursor("test.folders", bson.D{
+				{Key: "_id", Value: folderID},
+				{Key: "name", Value: "a"},
+				{Key: "path", Value: "a"},
+				{Key: "owner_id", Value: ownerID},
+				{Key: "is_deleted", Value: true},
+				{Key: "deleted_at", Value: time.Now()},
+			}),
+			cursor("test.folders", destination),
+			cursor("test.folders", destination), // editor check: the user owns it
+			cursor("test.folders"),              // no name collision in dest
+			cursor("test.folders"),              // subtree folders
+			cursor("test.files"),                // subtree files
+			writeResult(1),                      // folder
+			cursor("test.folders", bson.D{{Key: "_id", Value: trashedChild}, {Key: "path", Value: "a/old"}}),
+			writeResult(1),                // the trashed child
+			cursor("test.files"),          // stored bytes
+			cursor("test.files"),          // files
+			writeResult(0),                // permissions
+			writeResult(0),                // shares
+			mtest.CreateSuccessResponse(), // commitTransaction
+		)
+
+		if err := service.RestoreFolderTo(folderID.Hex(), ownerID.Hex(), destID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+
+		// The restore's own lookups run in the transaction, and each must be limited to trash
+		var lookups int
+		for _, evt := range commands(mt, "find") {
+			if _, err := evt.Command.LookupErr("txnNumber"); err != nil {
+				continue
+			}
+			lookups++
+			filter := evt.Command.Lookup("filter").Document()
+			switch evt.Command.Lookup("find").StringValue() {
+			case "folders":
+				if deleted, ok := filter.Lookup("is_deleted").BooleanOK(); !ok || !deleted {
+					t.Fatalf("restore selected folders by path alone: %v", filter)
+				}
+			case "files":
+				if _, err := filter.LookupErr("deleted_at", "$ne"); err != nil {
+					t.Fatalf("restore selected files by path alone: %v", filter)
+				}
+			}
+		}
+		if lookups != 2 {
+			t.Fatalf("got %d lookups in the transaction, want folders and files", lookups)
+		}
+
+		for _, evt := range commands(mt, "update") {
+			if evt.Command.Lookup("update").StringValue() != "folders" {
+				continue
+			}
+			q := evt.Command.Lookup("updates", "0", "q").Document()
+			if q.Lookup("_id").ObjectID() != trashedChild {
+				continue
+			}
+			if deleted, ok := q.Lookup("is_deleted").BooleanOK(); !ok || !deleted {
+				t.Fatalf("child update not limited to trashed folders: %v", q)
+			}
+			if path := evt.Command.Lookup("updates", "0", "u", "$set", "path").StringValue(); path != "dest/a/old" {
+				t.Fatalf("child path = %q, want dest/a/old", path)
+			}
+		}
+	})
+}
+
+func TestShareStateChangesCommitWithTrashState(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("folder delete", func(mt *mtest.T) {
+		service := NewFolderService(mt.DB, NewPermissionService(mt.DB), nil)
+		mt.ClearEvents()
+		ownerID, folderID := primitive.NewObjectID(), primitive.NewObjectID()
+		folder := append(folderDoc(folderID, "docs", "/docs", nil, time.Now()), bson.E{Key: "owner_id", Value: ownerID})
+
+		mt.AddMockResponses(
+			cursor("test.folders", folder), // access check: the user owns it
+			cursor("test.folders", folder),
+			cursor("test.folders"),
+			cursor("test.files"),
+			writeResult(1),         // folder
+			cursor("test.folders"), // subfolders
+			cursor("test.files"),   // stored bytes
+			writeResult(0),         // files
+			writeResult(1),         // permissions
+			writeResult(1),         // shares
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := service.DeleteFolder(context.Background(), folderID.Hex(), ownerID.Hex(), ""); err != nil {
+			t.Fatal(err)
+		}
+		suspended := 0
+		for _, evt := range commands(mt, "update") {
+			collection := evt.Command.Lookup("update").StringValue()
+			if collection != "permissions" && collection != "shares" {
+				continue
+			}
+			suspended++
+			if _, err := evt.Command.LookupErr("txnNumber"); err != nil {
+				t.Fatalf("%s were suspended outside the delete's transaction", collection)
+			}
+		}
+		if suspended != 2 {
+			t.Fatalf("got %d suspensions, want permissions and shares", suspended)
+		}
+	})
+
+	mt.Run("file restore", func(mt *mtest.T) {
+		service := NewTrashService(mt.DB, nil)
+		mt.ClearEvents()
+		id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			cursor("test.files", append(fileDoc(id, ownerID, "a.txt"), bson.E{Key: "deleted_at", Value: time.Now()})),
+			writeResult(1), // file
+			writeResult(1), // used_storage
+			writeResult(1), // permissions
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}), // shares
+			mtest.CreateSuccessResponse(), // abortTransaction
+		)
+
+		if err := service.RestoreFile(id.Hex(), ownerID.Hex()); err == nil {
+			t.Fatal("expected the share resume to fail the restore")
+		}
+		if len(commands(mt, "abortTransaction")) != 1 || len(commands(mt, "commitTransaction")) != 0 {
+			t.Fatal("a restore whose shares could not resume must roll back the file and its storage")
+		}
+		for _, evt := range commands(mt, "update") {
+			if _, err := evt.Command.LookupErr("txnNumber"); err != nil {
+				t.Fatalf("%s was written outside the restore's transaction", evt.Command.Lookup("update").StringValue())
+			}
+		}
+	})
+}
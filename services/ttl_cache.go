@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache is a small in-process cache whose entries expire after ttl(). It never holds more
+// than maxEntries: expired entries are swept first, then the entry closest to expiry goes.
+// Each process keeps its own copy, so other instances only see a change once it expires.
+type ttlCache[K comparable, V any] struct {
+	mu         sync.Mutex
+	entries    map[K]ttlEntry[V]
+	maxEntries int
+	ttl        func() time.Duration // read on every call so config changes apply; <= 0 disables
+}
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func newTTLCache[K comparable, V any](maxEntries int, ttl func() time.Duration) *ttlCache[K, V] {
+	return &ttlCache[K, V]{entries: make(map[K]ttlEntry[V]), maxEntries: maxEntries, ttl: ttl}
+}
+
+func (c *ttlCache[K, V]) get(key K) (V, bool) {
+	var zero V
+	if c.ttl() <= 0 {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[K, V]) set(key K, value V) {
+	ttl := c.ttl()
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: now.Add(ttl)}
+}
+
+func (c *ttlCache[K, V]) delete(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// evict makes room for one entry; callers hold mu
+func (c *ttlCache[K, V]) evict(now time.Time) {
+	var oldest K
+	var oldestExpiry time.Time
+	first := true
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if first || entry.expiresAt.Before(oldestExpiry) {
+			oldest, oldestExpiry, first = key, entry.expiresAt, false
+		}
+	}
+	if len(c.entries) >= c.maxEntries && !first {
+		delete(c.entries, oldest)
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCacheStaysBounded(t *testing.T) {
+	cache := newTTLCache[int, string](3, func() time.Duration { return time.Hour })
+	for i := 0; i < 10; i++ {
+		cache.set(i, "v")
+	}
+
+	if len(cache.entries) != 3 {
+		t.Fatalf("cache holds %d entries, want at most 3", len(cache.entries))
+	}
+	// The newest entries survive
+	if _, ok := cache.get(9); !ok {
+		t.Fatal("latest entry was evicted")
+	}
+}
+
+func TestTTLCacheExpiresEntries(t *testing.T) {
+	cache := newTTLCache[string, int](10, func() time.Duration { return time.Hour })
+	cache.set("a", 1)
+	cache.entries["a"] = ttlEntry[int]{value: 1, expiresAt: time.Now().Add(-time.Second)}
+
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if _, ok := cache.entries["a"]; ok {
+		t.Fatal("expired entry kept")
+	}
+}
+
+func TestTTLCacheDisabledByNonPositiveTTL(t *testing.T) {
+	cache := newTTLCache[string, int](10, func() time.Duration { return 0 })
+	cache.set("a", 1)
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("a disabled cache must not return entries")
+	}
+}
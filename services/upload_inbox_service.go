@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"path/filepath"
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"phynixdrive/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UploadInboxService manages folders that accept anonymous uploads through a token
+type UploadInboxService struct {
+	inboxCollection   *mongo.Collection
+	folderCollection  *mongo.Collection
+	fileCollection    *mongo.Collection
+	userCollection    *mongo.Collection
+	fileService       *FileService
+	b2Service         *B2Service
+	permissionService *PermissionService
+}
+
+// UploadInboxRequest configures an inbox. Zero limits fall back to the configured maximums.
+type UploadInboxRequest struct {
+	MaxFileSize  int64      `json:"max_file_size"`
+	MaxFiles     int        `json:"max_files"`
+	AllowedTypes []string   `json:"allowed_types"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+// InboxUploadResult is all an anonymous uploader learns about the stored file
+type InboxUploadResult struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+func NewUploadInboxService(db *mongo.Database, fileService *FileService, b2Service *B2Service, permissionService *PermissionService) *UploadInboxService {
+	return &UploadInboxService{
+		inboxCollection:   db.Collection("upload_inboxes"),
+		folderCollection:  db.Collection("folders"),
+		fileCollection:    db.Collection("files"),
+		userCollection:    db.Collection("users"),
+		fileService:       fileService,
+		b2Service:         b2Service,
+		permissionService: permissionService,
+	}
+}
+
+func inboxLimits() (maxFileSize int64, maxFiles int) {
+	maxFileSize, maxFiles = 25*1024*1024, 100
+	if config.AppConfig != nil {
+		if config.AppConfig.InboxMaxFileSize > 0 {
+			maxFileSize = config.AppConfig.InboxMaxFileSize
+		}
+		if config.AppConfig.InboxMaxFiles > 0 {
+			maxFiles = int(config.AppConfig.InboxMaxFiles)
+		}
+	}
+	return maxFileSize, maxFiles
+}
+
+// CreateInbox turns a folder into an upload inbox, replacing any inbox it already has.
+// Only folder admins may do this since uploads count against the folder owner's storage.
+func (s *UploadInboxService) CreateInbox(ctx context.Context, folderID, userID string, request UploadInboxRequest) (*models.UploadInbox, error) {
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "admin"); err != nil {
+			return nil, err
+		}
+	}
+
+	var folder models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{"_id": folderObjID, "is_deleted": false}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("folder not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	maxFileSize, maxFiles := inboxLimits()
+	if request.MaxFileSize > 0 && request.MaxFileSize < maxFileSize {
+		maxFileSize = request.MaxFileSize
+	}
+	if request.MaxFiles > 0 && request.MaxFiles < maxFiles {
+		maxFiles = request.MaxFiles
+	}
+
+	var allowedTypes []string
+	for _, ext := range request.AllowedTypes {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		allowedTypes = append(allowedTypes, ext)
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate inbox token: %w", err)
+	}
+
+	if err := s.deactivate(ctx, folderObjID); err != nil {
+		return nil, err
+	}
+
+	inbox := models.UploadInbox{
+		ID:           primitive.NewObjectID(),
+		Token:        base64.RawURLEncoding.EncodeToString(tokenBytes),
+		FolderID:     folder.ID,
+		OwnerID:      folder.OwnerID,
+		CreatedBy:    userID,
+		MaxFileSize:  maxFileSize,
+		MaxFiles:     maxFiles,
+		AllowedTypes: allowedTypes,
+		ExpiresAt:    request.ExpiresAt,
+		CreatedAt:    time.Now(),
+		IsActive:     true,
+	}
+	if _, err := s.inboxCollection.InsertOne(ctx, inbox); err != nil {
+		return nil, fmt.Errorf("failed to create upload inbox: %w", err)
+	}
+
+	return &inbox, nil
+}
+
+// DisableInbox stops a folder from accepting anonymous uploads
+func (s *UploadInboxService) DisableInbox(ctx context.Context, folderID, userID string) error {
+	folderObjID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	if s.permissionService != nil {
+		if err := s.permissionService.CheckAccess(ctx, userID, "folder", folderID, "admin"); err != nil {
+			return err
+		}
+	}
+
+	return s.deactivate(ctx, folderObjID)
+}
+
+func (s *UploadInboxService) deactivate(ctx context.Context, folderObjID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := s.inboxCollection.UpdateMany(ctx, bson.M{
+		"folder_id": folderObjID,
+		"is_active": true,
+	}, bson.M{"$set": bson.M{"is_active": false, "revoked_at": now}})
+	if err != nil {
+		return fmt.Errorf("failed to disable upload inbox: %w", err)
+	}
+	return nil
+}
+
+// activeInbox loads the inbox behind a token if it still accepts uploads
+func (s *UploadInboxService) activeInbox(ctx context.Context, token string) (*models.UploadInbox, error) {
+	var inbox models.UploadInbox
+	err := s.inboxCollection.FindOne(ctx, bson.M{"token": token, "is_active": true}).Decode(&inbox)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("upload inbox not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if inbox.ExpiresAt != nil && time.Now().After(*inbox.ExpiresAt) {
+		return nil, fmt.Errorf("upload inbox expired")
+	}
+	return &inbox, nil
+}
+
+// MaxUploadSize is the largest file the inbox behind token accepts, so the request body can
+// be capped before it is parsed
+func (s *UploadInboxService) MaxUploadSize(ctx context.Context, token string) (int64, error) {
+	inbox, err := s.activeInbox(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	return inbox.MaxFileSize, nil
+}
+
+// Upload stores one anonymously uploaded file in the inbox folder. The upload slot is
+// reserved before any bytes are stored, so concurrent uploads cannot exceed MaxFiles.
+func (s *UploadInboxService) Upload(ctx context.Context, token string, fileHeader *multipart.FileHeader) (*InboxUploadResult, error) {
+	inbox, err := s.activeInbox(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/"))
+	if err := utils.ValidateFileName(name); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateFileType(name); err != nil {
+		return nil, err
+	}
+	if _, err := utils.SniffFileHeader(fileHeader); err != nil {
+		return nil, err
+	}
+	if fileHeader.Size > inbox.MaxFileSize {
+		return nil, fmt.Errorf("file too large: limit is %d bytes", inbox.MaxFileSize)
+	}
+	extension := strings.ToLower(filepath.Ext(name))
+	if len(inbox.AllowedTypes) > 0 && !slices.Contains(inbox.AllowedTypes, extension) {
+		return nil, fmt.Errorf("file type not allowed")
+	}
+
+	var folder models.Folder
+	err = s.folderCollection.FindOne(ctx, bson.M{"_id": inbox.FolderID, "is_deleted": false}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("upload inbox not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	result, err := s.inboxCollection.UpdateOne(ctx, bson.M{
+		"_id":          inbox.ID,
+		"is_active":    true,
+		"upload_count": bson.M{"$lt": inbox.MaxFiles},
+	}, bson.M{"$inc": bson.M{"upload_count": 1}})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("upload inbox file limit reached")
+	}
+
+	stored, err := s.store(ctx, inbox, &folder, fileHeader, name, extension)
+	if err != nil {
+		s.inboxCollection.UpdateOne(ctx, bson.M{"_id": inbox.ID}, bson.M{"$inc": bson.M{"upload_count": -1}})
+		return nil, err
+	}
+	return stored, nil
+}
+
+// store writes the file into the folder as its owner, enforcing the owner's limits
+func (s *UploadInboxService) store(ctx context.Context, inbox *models.UploadInbox, folder *models.Folder, fileHeader *multipart.FileHeader, name, extension string) (*InboxUploadResult, error) {
+	if s.b2Service == nil {
+		return nil, fmt.Errorf("storage service not available")
+	}
+
+	ownerID := inbox.OwnerID.Hex()
+	if err := s.fileService.CheckQuota(ownerID, fileHeader.Size); err != nil {
+		return nil, err
+	}
+	if err := s.fileService.CheckFileCountLimit(ctx, inbox.OwnerID, 1); err != nil {
+		return nil, err
+	}
+
+	// Never replace or version an existing file from an anonymous upload
+	name, err := s.fileService.availableCopyName(ctx, inbox.OwnerID, &folder.ID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	mimeType := s.fileService.getMimeType(name)
+	relativePath := folder.Path + "/" + name
+	fileID := primitive.NewObjectID()
+	objectName := s.b2Service.BuildObjectName(ownerID, fileID.Hex(), relativePath, name)
+
+	uploadResult, err := s.b2Service.UploadFile(file, objectName, name, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s to B2: %w", name, err)
+	}
+
+	now := time.Now()
+	fileDoc := models.File{
+		ID:           fileID,
+		Name:         name,
+		OriginalName: fileHeader.Filename,
+		Size:         uploadResult.Size,
+		MimeType:     mimeType,
+		ContentType:  mimeType,
+		Extension:    extension,
+		OwnerID:      inbox.OwnerID,
+		B2FileID:     uploadResult.FileID,
+		B2FileName:   uploadResult.FileName,
+		SHA1Hash:     uploadResult.SHA1,
+		FolderID:     &folder.ID,
+		RelativePath: relativePath,
+		Versions:     []models.FileVersion{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := s.fileCollection.InsertOne(ctx, fileDoc); err != nil {
+		s.b2Service.DeleteFile(uploadResult.FileID)
+		return nil, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": inbox.OwnerID},
+		bson.M{"$inc": bson.M{"used_storage": uploadResult.Size}}); err != nil {
+		return nil, fmt.Errorf("file uploaded but failed to update storage usage: %w", err)
+	}
+
+	return &InboxUploadResult{Name: name, Size: uploadResult.Size}, nil
+}
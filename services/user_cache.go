@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"phynixdrive/config"
+	"phynixdrive/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxCachedUsers bounds the user cache
+const maxCachedUsers = 1000
+
+// users holds recently looked-up users so building share lists and notifications does not
+// fetch the same sharer and recipient over and over. Entries live for USER_CACHE_TTL and are
+// dropped as soon as the profile changes, but only in the process that made the change:
+// other instances keep serving the old profile until their entry expires, so the TTL is the
+// staleness window and is kept short.
+var users = newTTLCache[primitive.ObjectID, models.User](maxCachedUsers, userCacheTTL)
+
+func userCacheTTL() time.Duration {
+	if config.AppConfig != nil {
+		return config.AppConfig.UserCacheTTL
+	}
+	return 15 * time.Second
+}
+
+// lookupUser returns the user with the given ID, reading through the cache.
+// Missing users yield mongo.ErrNoDocuments and are not cached.
+func lookupUser(ctx context.Context, userCollection *mongo.Collection, userID primitive.ObjectID) (models.User, error) {
+	if user, ok := users.get(userID); ok {
+		return user, nil
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return models.User{}, err
+	}
+	users.set(userID, user)
+	return user, nil
+}
+
+// invalidateUser drops a cached user after their profile changes
+func invalidateUser(userID primitive.ObjectID) {
+	users.delete(userID)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestLookupUserCachesUntilInvalidated(t *testing.T) {
+	mt := newMockDB(t)
+	mt.Run("cache", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		collection := mt.DB.Collection("users")
+		defer invalidateUser(userID)
+
+		mt.AddMockResponses(cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "name", Value: "Ada"}}))
+		for i := 0; i < 2; i++ {
+			user, err := lookupUser(context.Background(), collection, userID)
+			if err != nil || user.Name != "Ada" {
+				t.Fatalf("lookup %d: %+v, %v", i, user, err)
+			}
+		}
+		if finds := commands(mt, "find"); len(finds) != 1 {
+			t.Fatalf("got %d finds, want the second lookup served from cache", len(finds))
+		}
+
+		invalidateUser(userID)
+		mt.AddMockResponses(cursor("test.users", bson.D{{Key: "_id", Value: userID}, {Key: "name", Value: "Grace"}}))
+		user, err := lookupUser(context.Background(), collection, userID)
+		if err != nil || user.Name != "Grace" {
+			t.Fatalf("after invalidation: %+v, %v", user, err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeNotSatisfiable is returned for a Range header that lies outside the content
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ParseByteRange interprets a Range header against content of the given size. Only a
+// single "bytes=" range is honoured; an empty, malformed or multi-range header yields
+// ok=false so the caller serves the whole content.
+func ParseByteRange(header string, size int64) (start, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// Suffix range: the final N bytes
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, ErrRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, ErrRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, nil
+}
@@ -0,0 +1,10 @@
+package utils
+
+import "github.com/gin-gonic/gin"
+
+// CurrentUserID returns the authenticated user's hex ID set by AuthMiddleware, or "" when
+// the request is not authenticated. Note that the "userId" key holds a primitive.ObjectID,
+// so reading it with GetString always yields "".
+func CurrentUserID(c *gin.Context) string {
+	return c.GetString("userIdStr")
+}
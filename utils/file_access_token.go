@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// File access token actions. A token is only good for the action it was issued for.
+const (
+	FileActionRead  = "read"
+	FileActionWrite = "write"
+)
+
+const fileAccessAudience = "file-access"
+
+// FileAccessTokenHeader carries a file access token. It is never read from the query string,
+// where it would end up in access logs and proxy logs.
+const FileAccessTokenHeader = "X-File-Access-Token"
+
+// FileAccessClaims scope a token to one user, one file and one action
+type FileAccessClaims struct {
+	UserID string `json:"user_id"`
+	FileID string `json:"file_id"`
+	Action string `json:"action"`
+	jwt.RegisteredClaims
+}
+
+// fileAccessKey derives a separate signing key so file access tokens can never be
+// accepted as session tokens by AuthMiddleware, or the other way round
+func fileAccessKey(jwtSecret string) []byte {
+	return []byte(jwtSecret + "|" + fileAccessAudience)
+}
+
+// GenerateFileAccessToken issues a short-lived token for an external app to read or write one file
+func GenerateFileAccessToken(userID, fileID, action, jwtSecret string, ttl time.Duration) (string, time.Time, error) {
+	if action != FileActionRead && action != FileActionWrite {
+		return "", time.Time{}, errors.New("invalid action")
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	claims := &FileAccessClaims{
+		UserID: userID,
+		FileID: fileID,
+		Action: action,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{fileAccessAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(fileAccessKey(jwtSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// VerifyFileAccessToken checks the token and that it was issued for fileID and action
+func VerifyFileAccessToken(tokenString, jwtSecret, fileID, action string) (*FileAccessClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &FileAccessClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return fileAccessKey(jwtSecret), nil
+	}, jwt.WithAudience(fileAccessAudience))
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(*FileAccessClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if claims.FileID != fileID {
+		return nil, errors.New("token not valid for this file")
+	}
+	if claims.Action != action {
+		return nil, errors.New("token not valid for this action")
+	}
+
+	return claims, nil
+}
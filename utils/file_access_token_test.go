@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"phynixdrive/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFileAccessTokenIsScopedToFileAndAction(t *testing.T) {
+	const secret = "test-secret"
+	issue := func(fileID, action string, ttl time.Duration) string {
+		t.Helper()
+		token, _, err := GenerateFileAccessToken("u1", fileID, action, secret, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		fileID, action string
+		wantErr        string
+	}{
+		{"read with read token", issue("f1", FileActionRead, time.Minute), "f1", FileActionRead, ""},
+		{"write with write token", issue("f1", FileActionWrite, time.Minute), "f1", FileActionWrite, ""},
+		{"write with read token", issue("f1", FileActionRead, time.Minute), "f1", FileActionWrite, "token not valid for this action"},
+		{"read with write token", issue("f1", FileActionWrite, time.Minute), "f1", FileActionRead, "token not valid for this action"},
+		{"other file", issue("f2", FileActionRead, time.Minute), "f1", FileActionRead, "token not valid for this file"},
+		{"expired", issue("f1", FileActionRead, -time.Minute), "f1", FileActionRead, "invalid token"},
+	}
+	for _, tt := range tests {
+		claims, err := VerifyFileAccessToken(tt.token, secret, tt.fileID, tt.action)
+		if tt.wantErr == "" {
+			if err != nil || claims.UserID != "u1" {
+				t.Errorf("%s: claims = %+v, err = %v", tt.name, claims, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A session token signed with the plain secret is not a file access token
+	session, err := GenerateJWTTokenWithSecret(&models.User{ID: primitive.NewObjectID(), Email: "u1@example.com"}, secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFileAccessToken(session, secret, "f1", FileActionRead); err == nil {
+		t.Fatal("session token accepted as a file access token")
+	}
+}
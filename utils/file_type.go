@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"phynixdrive/config"
+)
+
+// SniffLength is how many leading bytes http.DetectContentType looks at
+const SniffLength = 512
+
+// sniffedTypes lists, for extensions whose files always start with a signature that
+// http.DetectContentType recognises, the detected types that count as a match. Formats
+// without a reliable signature (plain text, MP3 without ID3) are not content-checked.
+var sniffedTypes = map[string][]string{
+	".png":  {"image/png"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".pdf":  {"application/pdf"},
+	".zip":  {"application/zip"},
+	".docx": {"application/zip"},
+	".xlsx": {"application/zip"},
+	".pptx": {"application/zip"},
+	".wav":  {"audio/wave"},
+}
+
+// normalizeExtension lowercases an extension and adds the leading dot if missing
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// ValidateFileType applies the ALLOWED_EXTENSIONS / BLOCKED_EXTENSIONS policy to a filename.
+// When an allow list is set, only those extensions are accepted; the block list always wins.
+func ValidateFileType(filename string) error {
+	if config.AppConfig == nil {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, blocked := range config.AppConfig.BlockedExtensions {
+		if ext == normalizeExtension(blocked) {
+			return fmt.Errorf("file type not allowed: %s", ext)
+		}
+	}
+
+	if len(config.AppConfig.AllowedExtensions) == 0 {
+		return nil
+	}
+	for _, allowed := range config.AppConfig.AllowedExtensions {
+		if ext == normalizeExtension(allowed) {
+			return nil
+		}
+	}
+	if ext == "" {
+		return fmt.Errorf("file type not allowed: files need an extension")
+	}
+	return fmt.Errorf("file type not allowed: %s", ext)
+}
+
+// DetectFileType sniffs the MIME type from the first bytes of a file and rejects content that
+// contradicts a recognised extension, such as an executable renamed to .png. Empty files and
+// extensions without a known signature are accepted as-is.
+func DetectFileType(filename string, head []byte) (string, error) {
+	if len(head) == 0 {
+		return "", nil
+	}
+
+	detected := http.DetectContentType(head)
+	if config.AppConfig != nil && !config.AppConfig.VerifyFileContent {
+		return detected, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	expected, ok := sniffedTypes[ext]
+	if !ok {
+		return detected, nil
+	}
+	for _, mimeType := range expected {
+		if strings.HasPrefix(detected, mimeType) {
+			return detected, nil
+		}
+	}
+	return "", fmt.Errorf("file content does not match its extension: %s looks like %s", ext, detected)
+}
+
+// SniffFileHeader reads the start of an uploaded file and runs DetectFileType on it
+func SniffFileHeader(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", header.Filename, err)
+	}
+	defer file.Close()
+
+	head, err := readHead(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", header.Filename, err)
+	}
+	return DetectFileType(header.Filename, head)
+}
+
+// SniffReader runs DetectFileType on the start of a stream. The returned reader still yields
+// the whole stream, the sniffed bytes included.
+func SniffReader(filename string, r io.Reader) (string, io.Reader, error) {
+	head, err := readHead(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+	detected, err := DetectFileType(filename, head)
+	if err != nil {
+		return "", nil, err
+	}
+	return detected, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// readHead reads up to SniffLength bytes; shorter content is not an error
+func readHead(r io.Reader) ([]byte, error) {
+	head := make([]byte, SniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"phynixdrive/config"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func withFileTypeConfig(t *testing.T, allowed, blocked []string) {
+	t.Helper()
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{AllowedExtensions: allowed, BlockedExtensions: blocked, VerifyFileContent: true}
+	t.Cleanup(func() { config.AppConfig = previous })
+}
+
+func TestValidateFileTypeAllowsPNGAndBlocksEXE(t *testing.T) {
+	withFileTypeConfig(t, []string{"png", ".exe"}, []string{".exe"})
+
+	if err := ValidateFileType("photo.PNG"); err != nil {
+		t.Fatalf("png rejected: %v", err)
+	}
+	// The block list wins even over an allow list entry
+	if err := ValidateFileType("setup.exe"); err == nil || !strings.HasPrefix(err.Error(), "file type not allowed") {
+		t.Fatalf("exe err = %v, want file type not allowed", err)
+	}
+	if err := ValidateFileType("notes.txt"); err == nil {
+		t.Fatal("txt is not on the allow list")
+	}
+}
+
+func TestSniffReaderKeepsSniffedBytes(t *testing.T) {
+	withFileTypeConfig(t, nil, nil)
+
+	content := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 2*SniffLength)...)
+	detected, r, err := SniffReader("photo.png", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("SniffReader: %v", err)
+	}
+	if detected != "image/png" {
+		t.Fatalf("detected %q", detected)
+	}
+	replayed, _ := io.ReadAll(r)
+	if !bytes.Equal(replayed, content) {
+		t.Fatalf("reader returned %d bytes, want %d", len(replayed), len(content))
+	}
+}
+
+func TestSniffReaderRejectsRenamedExecutable(t *testing.T) {
+	withFileTypeConfig(t, nil, nil)
+
+	exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00"), bytes.Repeat([]byte{0}, 64)...)
+	if _, _, err := SniffReader("photo.png", bytes.NewReader(exe)); err == nil || !strings.HasPrefix(err.Error(), "file content does not match") {
+		t.Fatalf("err = %v, want a content mismatch", err)
+	}
+}
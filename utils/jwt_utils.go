@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"phynixdrive/config"
 	"phynixdrive/models"
 	"time"
 
@@ -15,64 +16,77 @@ type Claims struct {
 	Name     string `json:"name"`
 	GoogleID string `json:"google_id"`
 	Role     string `json:"role"`
+	// ImpersonatedBy is the admin acting as this user; empty on normal tokens
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	// TokenVersion must match the user's current version; logging out everywhere bumps it
+	TokenVersion int64 `json:"token_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// GenerateJWTToken issues a 24 hour session token signed with the configured secret
 func GenerateJWTToken(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	secret, err := getJWTSecret()
+	if err != nil {
+		return "", err
+	}
+	return GenerateJWTTokenWithSecret(user, secret, 24)
+}
+
+func GenerateJWTTokenWithSecret(user *models.User, jwtSecret string, expirationHours int) (string, error) {
+	expirationTime := time.Now().Add(time.Duration(expirationHours) * time.Hour)
 
 	claims := &Claims{
-		UserID:   user.ID.Hex(),
-		Email:    user.Email,
-		Name:     user.Name,
-		GoogleID: user.GoogleID,
-		Role:     user.Role,
+		UserID:       user.ID.Hex(),
+		Email:        user.Email,
+		Name:         user.Name,
+		GoogleID:     user.GoogleID,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(getJWTSecret()))
+	return token.SignedString([]byte(jwtSecret))
 }
 
-func GenerateJWTTokenWithSecret(user *models.User, jwtSecret string, expirationHours int) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(expirationHours) * time.Hour)
+// GenerateImpersonationToken issues a short-lived token acting as user, flagged with the admin's ID
+func GenerateImpersonationToken(user *models.User, adminID, jwtSecret string, ttl time.Duration) (string, time.Time, error) {
+	expirationTime := time.Now().Add(ttl)
 
 	claims := &Claims{
-		UserID:   user.ID.Hex(),
-		Email:    user.Email,
-		Name:     user.Name,
-		GoogleID: user.GoogleID,
-		Role:     user.Role,
+		UserID:         user.ID.Hex(),
+		Email:          user.Email,
+		Name:           user.Name,
+		GoogleID:       user.GoogleID,
+		Role:           user.Role,
+		ImpersonatedBy: adminID,
+		TokenVersion:   user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	signed, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expirationTime, nil
 }
 
+// VerifyJWTToken checks a token against the configured secret
 func VerifyJWTToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(getJWTSecret()), nil
-	})
-
+	secret, err := getJWTSecret()
 	if err != nil {
 		return nil, err
 	}
-
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, errors.New("invalid token")
+	return VerifyJWTTokenWithSecret(tokenString, secret)
 }
 
 func VerifyJWTTokenWithSecret(tokenString string, jwtSecret string) (*Claims, error) {
@@ -94,22 +108,21 @@ func VerifyJWTTokenWithSecret(tokenString string, jwtSecret string) (*Claims, er
 	return nil, errors.New("invalid token")
 }
 
-func getJWTSecret() string {
-	panic("getJWTSecret not implemented - please implement based on your config system")
+// getJWTSecret returns the secret the server signs sessions with, the same one handed to
+// AuthMiddleware and the services, so tokens from either set of helpers are interchangeable
+func getJWTSecret() (string, error) {
+	if config.AppConfig == nil || config.AppConfig.JWTSecret == "" {
+		return "", errors.New("JWT secret not configured")
+	}
+	return config.AppConfig.JWTSecret, nil
 }
 
 func GetUserIDFromToken(tokenString string) (primitive.ObjectID, error) {
-	claims, err := VerifyJWTToken(tokenString)
+	secret, err := getJWTSecret()
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
-
-	userID, err := primitive.ObjectIDFromHex(claims.UserID)
-	if err != nil {
-		return primitive.NilObjectID, errors.New("invalid user ID in token")
-	}
-
-	return userID, nil
+	return GetUserIDFromTokenWithSecret(tokenString, secret)
 }
 
 func GetUserIDFromTokenWithSecret(tokenString string, jwtSecret string) (primitive.ObjectID, error) {
@@ -127,27 +140,11 @@ func GetUserIDFromTokenWithSecret(tokenString string, jwtSecret string) (primiti
 }
 
 func RefreshJWTToken(tokenString string) (string, error) {
-	claims, err := VerifyJWTToken(tokenString)
+	secret, err := getJWTSecret()
 	if err != nil {
 		return "", err
 	}
-
-	if time.Until(claims.ExpiresAt.Time) > 30*time.Minute {
-		return "", errors.New("token is not expired yet")
-	}
-
-	userID, err := primitive.ObjectIDFromHex(claims.UserID)
-	if err != nil {
-		return "", errors.New("invalid user ID in token")
-	}
-
-	return GenerateJWTTokenWithSecret(&models.User{
-		ID:       userID,
-		Email:    claims.Email,
-		Name:     claims.Name,
-		GoogleID: claims.GoogleID,
-		Role:     claims.Role,
-	}, getJWTSecret(), 24)
+	return RefreshJWTTokenWithSecret(tokenString, secret, 24)
 }
 
 func RefreshJWTTokenWithSecret(tokenString string, jwtSecret string, expirationHours int) (string, error) {
@@ -156,6 +153,10 @@ func RefreshJWTTokenWithSecret(tokenString string, jwtSecret string, expirationH
 		return "", err
 	}
 
+	if claims.ImpersonatedBy != "" {
+		return "", errors.New("impersonation tokens cannot be refreshed")
+	}
+
 	if time.Until(claims.ExpiresAt.Time) > 30*time.Minute {
 		return "", errors.New("token is not expired yet")
 	}
@@ -166,10 +167,11 @@ func RefreshJWTTokenWithSecret(tokenString string, jwtSecret string, expirationH
 	}
 
 	return GenerateJWTTokenWithSecret(&models.User{
-		ID:       userID,
-		Email:    claims.Email,
-		Name:     claims.Name,
-		GoogleID: claims.GoogleID,
-		Role:     claims.Role,
+		ID:           userID,
+		Email:        claims.Email,
+		Name:         claims.Name,
+		GoogleID:     claims.GoogleID,
+		Role:         claims.Role,
+		TokenVersion: claims.TokenVersion,
 	}, jwtSecret, expirationHours)
 }
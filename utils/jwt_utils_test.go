@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"phynixdrive/config"
+	"phynixdrive/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConfiguredSecretHelpersDoNotPanic(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	user := &models.User{ID: primitive.NewObjectID(), Email: "u@example.com"}
+
+	// Without a configured secret every helper reports an error instead of panicking
+	config.AppConfig = nil
+	if _, err := GenerateJWTToken(user); err == nil {
+		t.Fatal("GenerateJWTToken succeeded without a secret")
+	}
+	if _, err := VerifyJWTToken("token"); err == nil {
+		t.Fatal("VerifyJWTToken succeeded without a secret")
+	}
+	if _, err := RefreshJWTToken("token"); err == nil {
+		t.Fatal("RefreshJWTToken succeeded without a secret")
+	}
+	if _, err := GetUserIDFromToken("token"); err == nil {
+		t.Fatal("GetUserIDFromToken succeeded without a secret")
+	}
+
+	config.AppConfig = &config.Config{JWTSecret: "configured-secret"}
+	token, err := GenerateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := VerifyJWTToken(token)
+	if err != nil || claims.UserID != user.ID.Hex() {
+		t.Fatalf("verify: claims = %+v, err = %v", claims, err)
+	}
+	if id, err := GetUserIDFromToken(token); err != nil || id != user.ID {
+		t.Fatalf("user ID = %s, err = %v, want %s", id.Hex(), err, user.ID.Hex())
+	}
+	// The configured helpers and the WithSecret ones agree on the secret
+	if _, err := VerifyJWTTokenWithSecret(token, "configured-secret"); err != nil {
+		t.Fatalf("token not accepted with the configured secret: %v", err)
+	}
+	if _, err := RefreshJWTToken(token); err == nil || err.Error() != "token is not expired yet" {
+		t.Fatalf("refresh of a fresh token: err = %v", err)
+	}
+
+	expiring, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: user.ID.Hex(),
+		Email:  user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+		},
+	}).SignedString([]byte("configured-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := RefreshJWTToken(expiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := GetUserIDFromToken(refreshed); err != nil || id != user.ID {
+		t.Fatalf("refreshed token: user ID = %s, err = %v", id.Hex(), err)
+	}
+}
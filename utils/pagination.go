@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// ParsePagination reads ?limit= and ?offset= with shared rules: a missing or invalid limit
+// falls back to defaultLimit, limits above MaxPageLimit are clamped, and offset is never negative.
+func ParsePagination(c *gin.Context, defaultLimit int) (limit, offset int) {
+	if defaultLimit <= 0 || defaultLimit > MaxPageLimit {
+		defaultLimit = DefaultPageLimit
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	offset, err = strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
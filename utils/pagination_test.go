@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePaginationClampsAndDefaults(t *testing.T) {
+	tests := []struct {
+		query                 string
+		defaultLimit          int
+		wantLimit, wantOffset int
+	}{
+		{"?limit=100000&offset=40", 20, MaxPageLimit, 40},
+		{"", 20, 20, 0},
+		{"?limit=abc&offset=-5", 20, 20, 0},
+		{"?limit=0", 0, DefaultPageLimit, 0},
+		{"?limit=75", 20, 75, 0},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/items"+tt.query, nil)
+
+		limit, offset := ParsePagination(c, tt.defaultLimit)
+		if limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("%q: limit, offset = %d, %d, want %d, %d", tt.query, limit, offset, tt.wantLimit, tt.wantOffset)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const refreshAudience = "refresh"
+
+// RefreshClaims identify the user a long-lived refresh token was issued to. TokenVersion ties
+// it to the user's sessions, so logging out everywhere also retires it. The jti names the
+// server-side record that makes the token single-use.
+type RefreshClaims struct {
+	UserID       string `json:"user_id"`
+	TokenVersion int64  `json:"token_version,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// refreshKey derives a separate signing key so refresh tokens and session tokens
+// can never be used in place of each other
+func refreshKey(jwtSecret string) []byte {
+	return []byte(jwtSecret + "|" + refreshAudience)
+}
+
+// GenerateRefreshToken issues a long-lived token that can only be exchanged for a new session.
+// tokenID becomes the jti.
+func GenerateRefreshToken(userID, tokenID string, tokenVersion int64, jwtSecret string, ttl time.Duration) (string, error) {
+	claims := &RefreshClaims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Audience:  jwt.ClaimStrings{refreshAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(refreshKey(jwtSecret))
+}
+
+// VerifyRefreshToken checks the signature and expiry of a token from GenerateRefreshToken
+func VerifyRefreshToken(tokenString, jwtSecret string) (*RefreshClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &RefreshClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return refreshKey(jwtSecret), nil
+	}, jwt.WithAudience(refreshAudience))
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(*RefreshClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
@@ -89,6 +89,6 @@ func PayloadTooLargeResponse(c *gin.Context, message string) {
 	ErrorResponse(c, http.StatusRequestEntityTooLarge, message, nil)
 }
 
-func InsufficientStorageResponse(c *gin.Context, message string) {
-	ErrorResponse(c, http.StatusInsufficientStorage, message, nil)
+func InsufficientStorageResponse(c *gin.Context, message string, err interface{}) {
+	ErrorResponse(c, http.StatusInsufficientStorage, message, err)
 }
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"phynixdrive/config"
+	"strings"
+)
+
+// encryptedTokenPrefix marks values sealed by EncryptToken and the scheme that sealed them
+const encryptedTokenPrefix = "enc:v1:"
+
+// tokenEncryptionKey derives the AES-256 key for secrets kept in the database. Without a
+// TOKEN_ENCRYPTION_KEY it falls back to the JWT secret, so rotating that makes stored tokens unreadable.
+func tokenEncryptionKey() ([]byte, error) {
+	if config.AppConfig == nil {
+		return nil, errors.New("token encryption key not configured")
+	}
+	secret := config.AppConfig.TokenEncryptionKey
+	if secret == "" {
+		secret = config.AppConfig.JWTSecret
+	}
+	if secret == "" {
+		return nil, errors.New("token encryption key not configured")
+	}
+	key := sha256.Sum256([]byte("token-encryption|" + secret))
+	return key[:], nil
+}
+
+func tokenCipher() (cipher.AEAD, error) {
+	key, err := tokenEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptToken seals a secret such as an OAuth refresh token with AES-GCM for storage
+func EncryptToken(plaintext string) (string, error) {
+	gcm, err := tokenCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedTokenPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptToken opens a value from EncryptToken. Values stored before encryption was
+// added carry no prefix and are returned unchanged.
+func DecryptToken(stored string) (string, error) {
+	if !IsEncryptedToken(stored) {
+		return stored, nil
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedTokenPrefix))
+	if err != nil {
+		return "", errors.New("malformed encrypted token")
+	}
+	gcm, err := tokenCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted token")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt token")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncryptedToken reports whether a stored value was sealed by EncryptToken
+func IsEncryptedToken(stored string) bool {
+	return strings.HasPrefix(stored, encryptedTokenPrefix)
+}
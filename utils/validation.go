@@ -2,7 +2,7 @@ package utils
 
 import (
 	"fmt"
-	"mime/multipart"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -11,6 +11,8 @@ import (
 	"phynixdrive/config"
 )
 
+var reservedNames = []string{"CON", "PRN", "AUX", "NUL", "COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
+
 func ValidateFileSize(size int64) error {
 	if size > config.AppConfig.MaxFileSize {
 		return fmt.Errorf("file size %d bytes exceeds maximum allowed size of %d bytes", size, config.AppConfig.MaxFileSize)
@@ -38,7 +40,6 @@ func ValidateFileName(filename string) error {
 		}
 	}
 
-	reservedNames := []string{"CON", "PRN", "AUX", "NUL", "COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
 	nameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
 	for _, reserved := range reservedNames {
 		if strings.EqualFold(nameWithoutExt, reserved) {
@@ -48,18 +49,6 @@ func ValidateFileName(filename string) error {
 	return nil
 }
 
-func ValidateFileHeader(header *multipart.FileHeader) error {
-	if err := ValidateFileName(header.Filename); err != nil {
-		return err
-	}
-
-	if err := ValidateFileSize(header.Size); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func ValidateFolderName(name string) error {
 	if name == "" {
 		return fmt.Errorf("folder name cannot be empty")
@@ -80,10 +69,32 @@ func ValidateFolderName(name string) error {
 		}
 	}
 
+	if strings.Trim(name, ". ") == "" {
+		return fmt.Errorf("folder name cannot consist only of dots or spaces")
+	}
+
 	if strings.HasSuffix(name, ".") {
 		return fmt.Errorf("folder name cannot end with a dot")
 	}
 
+	baseName := strings.TrimSpace(name)
+	if idx := strings.Index(baseName, "."); idx > 0 {
+		baseName = baseName[:idx]
+	}
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(baseName, reserved) {
+			return fmt.Errorf("folder name uses reserved name: %s", reserved)
+		}
+	}
+
+	if config.AppConfig != nil {
+		for _, blocked := range config.AppConfig.FolderNameBlacklist {
+			if strings.EqualFold(strings.TrimSpace(name), blocked) {
+				return fmt.Errorf("folder name is not allowed: %s", name)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -115,6 +126,47 @@ func ValidateRelativePath(path string) error {
 	return nil
 }
 
+// ValidateUploadPairing checks that a relative path ends in the filename it was sent with,
+// catching files[] and relativePath[] entries that arrived out of order. Empty paths are allowed.
+func ValidateUploadPairing(filename, relativePath string) error {
+	if relativePath == "" {
+		return nil
+	}
+
+	relativePath = strings.ReplaceAll(relativePath, "\\", "/")
+	base := relativePath[strings.LastIndex(relativePath, "/")+1:]
+	if base != filename {
+		return fmt.Errorf("relative path '%s' does not match file '%s'", relativePath, filename)
+	}
+
+	return nil
+}
+
+// ValidateRedirectURL accepts absolute http(s) URLs whose host is in allowedHosts.
+// Entries may include a port ("app.example.com:8443") or match on hostname alone.
+func ValidateRedirectURL(target string, allowedHosts []string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid redirect URL")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("redirect URL must use http or https")
+	}
+
+	if u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid redirect URL")
+	}
+
+	for _, allowed := range allowedHosts {
+		if strings.EqualFold(u.Host, allowed) || strings.EqualFold(u.Hostname(), allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("redirect host not allowed: %s", u.Hostname())
+}
+
 func ValidateEmail(email string) error {
 	if email == "" {
 		return fmt.Errorf("email cannot be empty")
@@ -138,6 +190,27 @@ func ValidatePermissionRole(role string) error {
 	return fmt.Errorf("invalid role: %s. Allowed roles: %s", role, strings.Join(allowedRoles, ", "))
 }
 
+// roleSynonyms maps the read/write vocabulary some clients send onto share roles
+var roleSynonyms = map[string]string{
+	"read":  "viewer",
+	"write": "editor",
+}
+
+// NormalizeRole lowercases a share role and maps synonyms onto viewer, editor or admin
+func NormalizeRole(role string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(role))
+	if normalized == "" {
+		return "", fmt.Errorf("role is required")
+	}
+	if mapped, ok := roleSynonyms[normalized]; ok {
+		normalized = mapped
+	}
+	if err := ValidatePermissionRole(normalized); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
 func ValidateStorageQuota(currentUsage, additionalSize, maxStorage int64) error {
 	if currentUsage+additionalSize > maxStorage {
 		return fmt.Errorf("storage quota exceeded. Current: %d bytes, Additional: %d bytes, Max: %d bytes",
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"phynixdrive/config"
+)
+
+func TestValidateFolderNameRejectsReservedAndBlankNames(t *testing.T) {
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{FolderNameBlacklist: []string{"tmp"}}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"CON", "folder name uses reserved name"},
+		{"con.backup", "folder name uses reserved name"},
+		{"  ", "folder name cannot consist only of dots or spaces"},
+		{"...", "folder name cannot consist only of dots or spaces"},
+		{"TMP", "folder name is not allowed"},
+		{"Console", ""},
+		{"Projects", ""},
+	}
+	for _, tt := range tests {
+		err := ValidateFolderName(tt.name)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateUploadPairing(t *testing.T) {
+	tests := []struct {
+		filename, relativePath string
+		wantErr                bool
+	}{
+		{"a.txt", "docs/a.txt", false},
+		{"a.txt", `docs\a.txt`, false},
+		{"a.txt", "", false},
+		{"a.txt", "docs/b.txt", true},
+		{"a.txt", "docs/xa.txt", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateUploadPairing(tt.filename, tt.relativePath); (err != nil) != tt.wantErr {
+			t.Errorf("%q with %q: err = %v, wantErr %t", tt.filename, tt.relativePath, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeRoleMapsSynonymsAndRejectsGarbage(t *testing.T) {
+	tests := []struct {
+		role    string
+		want    string
+		wantErr string
+	}{
+		{"read", "viewer", ""},
+		{"WRITE", "editor", ""},
+		{" Viewer ", "viewer", ""},
+		{"Admin", "admin", ""},
+		{"", "", "role is required"},
+		{"owner", "", "invalid role: owner"},
+		{"superuser", "", "invalid role: superuser"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeRole(tt.role)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.role, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.role, got, err, tt.want)
+		}
+	}
+}